@@ -1,18 +1,25 @@
 package app
 
 import (
+	"context"
+	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/getsentry/sentry-go"
 	sentrygin "github.com/getsentry/sentry-go/gin"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/grpcapi"
 	"github.com/zaharinea/go-example/pkg/handler"
+	"github.com/zaharinea/go-example/pkg/idgen"
 	"github.com/zaharinea/go-example/pkg/repository"
 	"github.com/zaharinea/go-example/pkg/rmq"
 	"github.com/zaharinea/go-example/pkg/service"
-	rmqclient "github.com/zaharinea/go-rmq-client"
+	"github.com/zaharinea/go-example/pkg/webhook"
 	ginprometheus "github.com/zsais/go-gin-prometheus"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -20,7 +27,12 @@ import (
 // InitLogger initialize logger
 func InitLogger(config *config.Config) *logrus.Logger {
 	logger := logrus.New()
+	ApplyLogConfig(logger, config)
+	return logger
+}
 
+// ApplyLogConfig sets the format and the level of the logger and the standard logger
+func ApplyLogConfig(logger *logrus.Logger, config *config.Config) {
 	if strings.ToUpper(config.LogFormat) == "JSON" {
 		logger.SetFormatter(&logrus.JSONFormatter{})
 		logrus.SetFormatter(&logrus.JSONFormatter{})
@@ -35,31 +47,96 @@ func InitLogger(config *config.Config) *logrus.Logger {
 	}
 	logrus.SetLevel(level)
 	logger.SetLevel(level)
-
-	return logger
 }
 
-// InitPrometheus initialize prometheus
-func InitPrometheus(engine *gin.Engine) {
-	p := ginprometheus.NewPrometheus("gin")
-	p.ReqCntURLLabelMappingFn = func(c *gin.Context) string {
-		url := c.Request.URL.Path
-		for _, p := range c.Params {
-			if p.Key == "id" {
-				url = strings.Replace(url, p.Value, ":id", 1)
-				break
+var (
+	ginPrometheus     *ginprometheus.Prometheus
+	ginPrometheusOnce sync.Once
+)
+
+// InitPrometheus initialize prometheus, metrics of the engine are served on metricsEngine.
+// Collectors are registered once, engines of all Apps created by the process share them
+func InitPrometheus(engine *gin.Engine, metricsEngine *gin.Engine) {
+	ginPrometheusOnce.Do(func() {
+		ginPrometheus = ginprometheus.NewPrometheus("gin")
+		ginPrometheus.ReqCntURLLabelMappingFn = func(c *gin.Context) string {
+			url := c.Request.URL.Path
+			for _, p := range c.Params {
+				if p.Key == "id" {
+					url = strings.Replace(url, p.Value, ":id", 1)
+					break
+				}
 			}
+			return url
 		}
-		return url
+	})
+	engine.Use(ginPrometheus.HandlerFunc())
+	metricsEngine.GET(ginPrometheus.MetricsPath, gin.WrapH(promhttp.Handler()))
+}
+
+// NewAdminEngine returns gin engine of the admin listener serving metrics, pprof, swagger, migration status and health
+func NewAdminEngine(handlers *handler.Handler) *gin.Engine {
+	engine := gin.New()
+	engine.Use(handler.ErrorMiddleware())
+	engine.Use(handler.Recovery(handler.RecoveryHandler))
+	engine.NoRoute(handler.NoRouteHandler)
+	engine.NoMethod(handler.NoMethodHandler)
+
+	engine.GET("/api/healthcheck", handlers.Healthcheck)
+	engine.GET("/api/readycheck", handlers.Readycheck)
+	handlers.InitAdminRoutes(engine)
+	handler.InitPprofRoutes(engine)
+	return engine
+}
+
+// InitDbMigrations apply or verify migrations according to the config
+func InitDbMigrations(c *config.Config, dbClient *mongo.Client, migrations repository.IMigrationRepository) {
+	switch c.MongoAutoMigrate {
+	case config.AutoMigrateUp:
+		repository.ApplyDbMigrations(context.Background(), c, dbClient)
+	case config.AutoMigrateVerify:
+		if err := migrations.Verify(context.Background()); err != nil {
+			logrus.Fatalf("Database migrations verification failed: %s", err)
+		}
+	default:
+		logrus.Info("Automatic database migrations are disabled")
 	}
-	p.Use(engine)
+}
+
+// InitConfigWatcher returns a config watcher applying reloaded fields to the logger, the handlers and the rate limiter
+func InitConfigWatcher(c *config.Config, logger *logrus.Logger, handlers *handler.Handler, rateLimiter *handler.RateLimiter) *config.Watcher {
+	watcher := config.NewWatcher(c)
+	watcher.Subscribe(func(c *config.Config) { ApplyLogConfig(logger, c) })
+	watcher.Subscribe(handlers.SetConfig)
+	watcher.Subscribe(rateLimiter.SetConfig)
+	return watcher
 }
 
 // App struct
 type App struct {
-	Engine      *gin.Engine
-	RmqConsumer *rmqclient.Consumer
-	DbClient    *mongo.Client
+	Engine        *gin.Engine
+	AdminEngine   *gin.Engine
+	GRPCServer    *grpcapi.Server
+	Handlers      *handler.Handler
+	RmqHandlers   *rmq.Handler
+	RmqConsumer   rmq.Consumer
+	WebhookWorker *webhook.Worker
+	DbClient      *mongo.Client
+	ConfigWatcher *config.Watcher
+}
+
+// Dependencies of the App on external services, time and randomness
+type Dependencies struct {
+	Logger      *logrus.Logger
+	Repos       *repository.Repository
+	RmqConsumer rmq.Consumer
+	// DbClient is nil if Repos do not use MongoDB
+	DbClient *mongo.Client
+	// Clock is used by middlewares, Repos are created with their own
+	Clock      clock.Clock
+	RequestIDs idgen.IDGenerator
+	// HTTPClient posts webhook deliveries
+	HTTPClient *http.Client
 }
 
 // NewApp return new gin engine
@@ -71,24 +148,76 @@ func NewApp(config *config.Config) *App {
 		logrus.Errorf("Sentry initialization failed: %v\n", err)
 	}
 
+	systemClock := clock.System{}
 	dbClient := repository.InitDbClient(config)
-	repository.ApplyDbMigrations(config, dbClient)
-	repos := repository.NewRepository(dbClient.Database(config.MongoDbName))
-	services := service.NewService(repos)
+	repos := repository.NewRepository(dbClient.Database(config.MongoDbName), systemClock, idgen.ObjectID{})
+	repos.Migration = repository.NewMigrationRepository(config, dbClient)
+	InitDbMigrations(config, dbClient, repos.Migration)
+
+	return NewAppWithDependencies(config, Dependencies{
+		Logger:      logger,
+		Repos:       repos,
+		RmqConsumer: rmq.NewClientConsumer(config.RmqURI, logger),
+		DbClient:    dbClient,
+		Clock:       systemClock,
+		RequestIDs:  idgen.UUID{},
+		HTTPClient:  webhook.NewHTTPClient(config.WebhookTimeout),
+	})
+}
+
+// NewAppWithDependencies returns the App using deps instead of connecting to external services
+func NewAppWithDependencies(config *config.Config, deps Dependencies) *App {
+	services := service.NewService(deps.Repos)
 	handlers := handler.NewHandler(config, services)
 
-	rmqConsumer := rmqclient.NewConsumer(config.RmqURI, logger)
-	rmqHandlers := rmq.NewHandler(config, repos)
-	rmq.SetupExchangesAndQueues(rmqConsumer, rmqHandlers)
+	rmqHandlers := rmq.NewHandler(config, deps.Repos)
+	rmq.SetupExchangesAndQueues(deps.RmqConsumer, rmqHandlers)
+
+	rateLimiter := handler.NewRateLimiter(config.RateLimit, deps.Clock)
 
+	configWatcher := InitConfigWatcher(config, deps.Logger, handlers, rateLimiter)
+
+	var adminEngine *gin.Engine
 	engine := gin.New()
-	engine.Use(handler.SetRequestIDMiddleware())
+	metricsEngine := engine
+	if config.AdminAddr != "" {
+		adminEngine = NewAdminEngine(handlers)
+		metricsEngine = adminEngine
+	}
+
+	// logging and metrics wrap ErrorMiddleware to see the status of rendered errors
+	engine.Use(handler.SetRequestIDMiddleware(deps.RequestIDs))
+	InitPrometheus(engine, metricsEngine)
 	engine.Use(handler.Logging())
+	engine.Use(handler.ErrorMiddleware())
+	engine.Use(handler.ClientIdentityMiddleware())
+	engine.Use(handler.MaxBodyMiddleware(config.HTTPMaxBodyBytes))
 	engine.Use(handler.Recovery(handler.RecoveryHandler))
 	engine.Use(sentrygin.New(sentrygin.Options{Repanic: true}))
+	engine.Use(handler.TenantMiddleware(config, deps.Clock))
+	engine.Use(handler.RateLimitMiddleware(rateLimiter))
+	if config.OpenAPIValidationEnabled() {
+		doc := handler.NewOpenAPI(config.AppVersion)
+		engine.Use(handler.OpenAPIValidationMiddleware(doc, config.OpenAPIResponseValidationEnabled()))
+	}
 
-	InitPrometheus(engine)
 	handlers.InitRoutes(engine)
+	if adminEngine == nil {
+		handlers.InitAdminRoutes(engine)
+	}
+
+	grpcServer := grpcapi.NewServer(config, services, deps.Clock, deps.RequestIDs)
+	webhookWorker := webhook.NewWorker(config, deps.Repos, deps.Clock, deps.HTTPClient)
 
-	return &App{DbClient: dbClient, Engine: engine, RmqConsumer: rmqConsumer}
+	return &App{
+		Engine:        engine,
+		AdminEngine:   adminEngine,
+		GRPCServer:    grpcServer,
+		Handlers:      handlers,
+		RmqHandlers:   rmqHandlers,
+		RmqConsumer:   deps.RmqConsumer,
+		WebhookWorker: webhookWorker,
+		DbClient:      deps.DbClient,
+		ConfigWatcher: configWatcher,
+	}
 }
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+func runAccounts(ctx context.Context, env *environment, args []string) error {
+	if len(args) < 1 || args[0] != "import" {
+		return fmt.Errorf("%w: accounts subcommand required", errUsage)
+	}
+
+	flags := flag.NewFlagSet("accounts import", flag.ContinueOnError)
+	file := flags.String("file", "", "JSON or YAML file with a list of accounts")
+	force := flags.Bool("force", false, "overwrite accounts updated later than the imported ones")
+	if err := flags.Parse(args[1:]); err != nil || *file == "" {
+		return fmt.Errorf("%w: accounts import requires -file", errUsage)
+	}
+
+	var accounts []accountFixture
+	if err := loadFile(*file, &accounts); err != nil {
+		return err
+	}
+
+	imported, err := importAccounts(ctx, env, accounts, *force)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("imported accounts: %d, skipped: %d\n", imported, len(accounts)-imported)
+	return nil
+}
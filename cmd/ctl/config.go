@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/zaharinea/go-example/config"
+)
+
+func runConfig(c *config.Config, args []string) error {
+	if len(args) < 1 || args[0] != "print" {
+		return fmt.Errorf("%w: config subcommand required", errUsage)
+	}
+	return c.Print(os.Stdout)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/apperror"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/service"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const usage = `Usage: ctl [config flags] <command> [arguments]
+
+Commands:
+  config print            print the effective configuration with secrets redacted
+  migrate up [N]          apply all or N up migrations
+  migrate down N|-all     revert N or all migrations
+  migrate status          show current migration version
+  migrate force V         set version V without running migrations
+  migrate goto V          migrate up or down to version V
+  seed -file F            load accounts and users from a JSON or YAML fixtures file
+  users list              list users
+  users get ID            get user by ID
+  users create -name N    create user
+  users delete ID         delete user by ID
+  accounts import -file F import accounts from a JSON or YAML file
+`
+
+// errUsage returned on invalid command line arguments
+var errUsage = errors.New("invalid arguments")
+
+// environment holds dependencies shared by commands
+type environment struct {
+	config   *config.Config
+	dbClient *mongo.Client
+	repos    *repository.Repository
+	services *service.Service
+}
+
+func newEnvironment(c *config.Config) *environment {
+	dbClient := repository.InitDbClient(c)
+	repos := repository.NewRepository(dbClient.Database(c.MongoDbName), clock.System{}, idgen.ObjectID{})
+	return &environment{
+		config:   c,
+		dbClient: dbClient,
+		repos:    repos,
+		services: service.NewService(repos),
+	}
+}
+
+func (e *environment) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := e.dbClient.Disconnect(ctx); err != nil {
+		logrus.Errorf("MongoDB client disconnect: %s", err)
+	}
+}
+
+type commandFunc func(ctx context.Context, env *environment, args []string) error
+
+var commands = map[string]commandFunc{
+	"migrate":  runMigrate,
+	"seed":     runSeed,
+	"users":    runUsers,
+	"accounts": runAccounts,
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fmt.Fprint(os.Stderr, "\nConfig flags:\n")
+		flag.PrintDefaults()
+	}
+	c := config.NewConfigWithFlags(flag.CommandLine, os.Args[1:])
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	if flag.Arg(0) == "config" {
+		err = runConfig(c, flag.Args()[1:])
+	} else {
+		cmd, ok := commands[flag.Arg(0)]
+		if !ok {
+			flag.Usage()
+			os.Exit(2)
+		}
+
+		env := newEnvironment(c)
+		err = cmd(context.Background(), env, flag.Args()[1:])
+		env.close()
+	}
+
+	if err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "%s\n\n%s", err, usage)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// notFoundErr replaces the not found error with a readable one
+func notFoundErr(err error, what string, id string) error {
+	if apperror.KindOf(err) == apperror.KindNotFound {
+		return fmt.Errorf("%s not found: %s", what, id)
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/zaharinea/go-example/pkg/repository"
+)
+
+func runMigrate(ctx context.Context, env *environment, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("%w: migrate subcommand required", errUsage)
+	}
+
+	m, err := repository.NewMigrate(ctx, env.config, env.dbClient)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		err = migrateUp(m, args[1:])
+	case "down":
+		err = migrateDown(m, args[1:])
+	case "force":
+		err = migrateForce(m, args[1:])
+	case "goto":
+		err = migrateGoto(m, args[1:])
+	case "status":
+	default:
+		return fmt.Errorf("%w: unknown migrate subcommand %s", errUsage, args[0])
+	}
+
+	if err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return printMigrationStatus(ctx, env)
+}
+
+func migrateUp(m *migrate.Migrate, args []string) error {
+	if len(args) == 0 {
+		return m.Up()
+	}
+
+	n, err := parseNumber(args[0])
+	if err != nil {
+		return err
+	}
+	return m.Steps(n)
+}
+
+func migrateDown(m *migrate.Migrate, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: migrate down requires N or -all", errUsage)
+	}
+	if args[0] == "-all" {
+		return m.Down()
+	}
+
+	n, err := parseNumber(args[0])
+	if err != nil {
+		return err
+	}
+	return m.Steps(-n)
+}
+
+func migrateForce(m *migrate.Migrate, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: migrate force requires version", errUsage)
+	}
+
+	v, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("%w: invalid version %s", errUsage, args[0])
+	}
+	return m.Force(v)
+}
+
+func migrateGoto(m *migrate.Migrate, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: migrate goto requires version", errUsage)
+	}
+
+	v, err := parseNumber(args[0])
+	if err != nil {
+		return err
+	}
+	return m.Migrate(uint(v))
+}
+
+func printMigrationStatus(ctx context.Context, env *environment) error {
+	status, err := repository.NewMigrationRepository(env.config, env.dbClient).Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version: %d, target_version: %d, dirty: %v\n", status.Version, status.TargetVersion, status.Dirty)
+	return nil
+}
+
+func parseNumber(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%w: invalid number %s", errUsage, value)
+	}
+	return n, nil
+}
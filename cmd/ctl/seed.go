@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zaharinea/go-example/pkg/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// accountFixture struct
+type accountFixture struct {
+	ExternalID string     `json:"external_id" yaml:"external_id"`
+	Name       string     `json:"name" yaml:"name"`
+	CreatedAt  *time.Time `json:"created_at" yaml:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at" yaml:"updated_at"`
+}
+
+// userFixture struct
+type userFixture struct {
+	Name              string `json:"name" yaml:"name"`
+	AccountExternalID string `json:"account_external_id" yaml:"account_external_id"`
+}
+
+// fixtures struct
+type fixtures struct {
+	Accounts []accountFixture `json:"accounts" yaml:"accounts"`
+	Users    []userFixture    `json:"users" yaml:"users"`
+}
+
+func (f accountFixture) toAccount() domain.Account {
+	now := time.Now().UTC()
+	account := domain.Account{
+		ExternalID: f.ExternalID,
+		Name:       f.Name,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if f.CreatedAt != nil {
+		account.CreatedAt = *f.CreatedAt
+	}
+	if f.UpdatedAt != nil {
+		account.UpdatedAt = *f.UpdatedAt
+	}
+	return account
+}
+
+// loadFile decodes a YAML file (by extension) or a JSON file into v
+func loadFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, v)
+	default:
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("failed decode %s: %w", path, err)
+	}
+	return nil
+}
+
+func importAccounts(ctx context.Context, env *environment, accounts []accountFixture, forceUpdate bool) (int, error) {
+	imported := 0
+	for _, f := range accounts {
+		if f.ExternalID == "" {
+			return imported, fmt.Errorf("account without external_id: %s", f.Name)
+		}
+
+		_, err := env.repos.Account.CreateOrUpdate(ctx, f.toAccount(), forceUpdate)
+		if err != nil {
+			if errors.Is(err, domain.ErrStale) || errors.Is(err, domain.ErrDuplicate) {
+				continue
+			}
+			return imported, fmt.Errorf("failed import account %s: %w", f.ExternalID, err)
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+func runSeed(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := flags.String("file", "", "JSON or YAML fixtures file")
+	if err := flags.Parse(args); err != nil || *file == "" {
+		return fmt.Errorf("%w: seed requires -file", errUsage)
+	}
+
+	var f fixtures
+	if err := loadFile(*file, &f); err != nil {
+		return err
+	}
+
+	accounts, err := importAccounts(ctx, env, f.Accounts, true)
+	if err != nil {
+		return err
+	}
+
+	for _, userFixture := range f.Users {
+		user := domain.User{Name: userFixture.Name, AccountExternalID: userFixture.AccountExternalID}
+		if err := env.services.User.Create(ctx, &user); err != nil {
+			return fmt.Errorf("failed create user %s: %w", userFixture.Name, err)
+		}
+	}
+
+	fmt.Printf("seeded accounts: %d, users: %d\n", accounts, len(f.Users))
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTempFile(t *testing.T, name string, data string) string {
+	dir, err := ioutil.TempDir("", "ctl")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+	return path
+}
+
+func TestLoadFileYAML(t *testing.T) {
+	path := writeTempFile(t, "fixtures.yaml", `
+accounts:
+  - external_id: "1"
+    name: account1
+    updated_at: 2020-11-21T00:00:00Z
+users:
+  - name: user1
+    account_external_id: "1"
+`)
+
+	var f fixtures
+	require.NoError(t, loadFile(path, &f))
+	require.Equal(t, 1, len(f.Accounts))
+	assert.Equal(t, "1", f.Accounts[0].ExternalID)
+	assert.Equal(t, time.Date(2020, 11, 21, 0, 0, 0, 0, time.UTC), f.Accounts[0].toAccount().UpdatedAt)
+	require.Equal(t, 1, len(f.Users))
+	assert.Equal(t, "user1", f.Users[0].Name)
+	assert.Equal(t, "1", f.Users[0].AccountExternalID)
+}
+
+func TestLoadFileJSON(t *testing.T) {
+	path := writeTempFile(t, "accounts.json", `[{"external_id": "1", "name": "account1"}]`)
+
+	var accounts []accountFixture
+	require.NoError(t, loadFile(path, &accounts))
+	require.Equal(t, 1, len(accounts))
+	assert.Equal(t, "account1", accounts[0].Name)
+	assert.False(t, accounts[0].toAccount().CreatedAt.IsZero())
+}
+
+func TestLoadFileErrorInvalid(t *testing.T) {
+	path := writeTempFile(t, "accounts.json", `{`)
+
+	var accounts []accountFixture
+	assert.Error(t, loadFile(path, &accounts))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/zaharinea/go-example/pkg/domain"
+)
+
+func runUsers(ctx context.Context, env *environment, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("%w: users subcommand required", errUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		return usersList(ctx, env, args[1:])
+	case "get":
+		return usersGet(ctx, env, args[1:])
+	case "create":
+		return usersCreate(ctx, env, args[1:])
+	case "delete":
+		return usersDelete(ctx, env, args[1:])
+	default:
+		return fmt.Errorf("%w: unknown users subcommand %s", errUsage, args[0])
+	}
+}
+
+func usersList(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("users list", flag.ContinueOnError)
+	limit := flags.Int64("limit", env.config.PageSize, "limit")
+	offset := flags.Int64("offset", 0, "offset")
+	account := flags.String("account", "", "account external ID")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", errUsage, err)
+	}
+
+	var users []*domain.User
+	var err error
+	if *account != "" {
+		users, err = env.services.User.ListByAccount(ctx, *account, *limit, *offset)
+	} else {
+		users, err = env.services.User.List(ctx, *limit, *offset)
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(users)
+}
+
+func usersGet(ctx context.Context, env *environment, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("%w: users get requires ID", errUsage)
+	}
+
+	user, err := env.services.User.GetByID(ctx, args[0])
+	if err != nil {
+		return notFoundErr(err, "user", args[0])
+	}
+	return printJSON(user)
+}
+
+func usersCreate(ctx context.Context, env *environment, args []string) error {
+	flags := flag.NewFlagSet("users create", flag.ContinueOnError)
+	name := flags.String("name", "", "user name")
+	account := flags.String("account", "", "account external ID")
+	if err := flags.Parse(args); err != nil || *name == "" {
+		return fmt.Errorf("%w: users create requires -name", errUsage)
+	}
+
+	user := domain.User{Name: *name, AccountExternalID: *account}
+	if err := env.services.User.Create(ctx, &user); err != nil {
+		return err
+	}
+	return printJSON(user)
+}
+
+func usersDelete(ctx context.Context, env *environment, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("%w: users delete requires ID", errUsage)
+	}
+
+	if err := env.services.User.DeleteByID(ctx, args[0]); err != nil {
+		return notFoundErr(err, "user", args[0])
+	}
+	fmt.Printf("deleted user: %s\n", args[0])
+	return nil
+}
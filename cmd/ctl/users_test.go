@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository/memory"
+	"github.com/zaharinea/go-example/pkg/service"
+)
+
+func newTestEnvironment() *environment {
+	repos := memory.NewRepository(clock.NewFake(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)), idgen.NewSequence())
+	return &environment{config: config.NewDefaultConfig(), repos: repos, services: service.NewService(repos)}
+}
+
+func TestUsersDelete(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnvironment()
+	user := domain.User{Name: "user1"}
+	require.NoError(t, env.services.User.Create(ctx, &user))
+
+	require.NoError(t, usersDelete(ctx, env, []string{user.ID}))
+
+	err := usersDelete(ctx, env, []string{user.ID})
+	require.Error(t, err)
+	assert.Equal(t, "user not found: "+user.ID, err.Error())
+}
+
+func TestUsersDeleteNotFound(t *testing.T) {
+	err := usersDelete(context.Background(), newTestEnvironment(), []string{"5fbaeab741e97bef8525d6ab"})
+	require.Error(t, err)
+	assert.Equal(t, "user not found: 5fbaeab741e97bef8525d6ab", err.Error())
+}
@@ -2,29 +2,30 @@ package main
 
 import (
 	"context"
-	"net/http"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/zaharinea/go-example/app"
 	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/rmq"
+	"github.com/zaharinea/go-example/pkg/server"
 )
 
 func main() {
-	c := config.NewConfig()
+	c := config.NewConfigWithFlags(flag.CommandLine, os.Args[1:])
 	a := app.NewApp(c)
 
 	a.RmqConsumer.Start()
+	a.WebhookWorker.Start()
+	a.ConfigWatcher.Start()
 
-	httpSrv := &http.Server{
-		Addr:           c.AppAddr,
-		Handler:        a.Engine,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		MaxHeaderBytes: 1 << 20, // 1 MB
+	httpSrv, err := server.NewServer(c, a.Engine)
+	if err != nil {
+		logrus.Fatal(err)
 	}
 	go func() {
 		if err := httpSrv.ListenAndServe(); err != nil {
@@ -32,27 +33,74 @@ func main() {
 		}
 	}()
 
-	// Wait for interrupt signal to gracefully shutdown the server with a timeout of 5 seconds.
-	quit := make(chan os.Signal)
-	signal.Notify(quit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	logrus.Info("Shutdown Server ...")
-
-	if err := a.RmqConsumer.Stop(); err != nil {
-		logrus.Infof("Stop rabbitmq consumer: %s\n", err)
+	var adminSrv *server.Server
+	if a.AdminEngine != nil {
+		adminSrv = server.NewAdminServer(c, a.AdminEngine)
+		go func() {
+			if err := adminSrv.ListenAndServe(); err != nil {
+				logrus.Infof("admin listen: %s\n", err)
+			}
+		}()
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := httpSrv.Shutdown(ctx); err != nil {
-		logrus.Fatal("Http server shutdown:", err)
+	var grpcSrv *server.GRPCServer
+	if c.GRPCAddr != "" {
+		grpcSrv, err = server.NewGRPCServer(c, a.GRPCServer.Server)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		go func() {
+			if err := grpcSrv.ListenAndServe(); err != nil {
+				logrus.Infof("grpc listen: %s\n", err)
+			}
+		}()
 	}
 
-	if err := a.DbClient.Disconnect(ctx); err != nil {
-		logrus.Fatal("MongoDB client disconnect:", err)
-	}
-	logrus.Info("Connection to MongoDB closed")
+	// Wait for interrupt signal to gracefully shutdown the server
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	logrus.Info("Shutdown Server ...")
+	a.ConfigWatcher.Stop()
 
+	results := server.Shutdown(
+		server.Phase{Name: "readiness", Timeout: c.ShutdownReadinessDelay, Run: func(ctx context.Context) error {
+			// give load balancers time to notice the failed readiness before connections are refused
+			a.Handlers.SetReady(false)
+			a.GRPCServer.SetReady(false)
+			<-ctx.Done()
+			return nil
+		}},
+		server.Phase{Name: "rabbitmq", Timeout: c.ShutdownRmqTimeout, Run: func(ctx context.Context) error {
+			return rmq.StopConsumer(ctx, a.RmqConsumer, a.RmqHandlers)
+		}},
+		server.Phase{Name: "http", Timeout: c.ShutdownHTTPTimeout, Run: func(ctx context.Context) error {
+			// event streams never end on their own, Shutdown would wait for them until the timeout
+			a.Handlers.StopStreams()
+			if grpcSrv == nil {
+				return httpSrv.Shutdown(ctx)
+			}
+			// the HTTP and gRPC servers stop together, calls of both get the same timeout
+			errs := make(chan error, 1)
+			go func() { errs <- grpcSrv.Shutdown(ctx) }()
+			httpErr := httpSrv.Shutdown(ctx)
+			if grpcErr := <-errs; grpcErr != nil {
+				return fmt.Errorf("grpc: %w", grpcErr)
+			}
+			return httpErr
+		}},
+		server.Phase{Name: "webhooks", Timeout: c.ShutdownWebhookTimeout, Run: a.WebhookWorker.Stop},
+		server.Phase{Name: "mongodb", Timeout: c.ShutdownMongoTimeout, Run: a.DbClient.Disconnect},
+		server.Phase{Name: "admin http", Timeout: c.ShutdownHTTPTimeout, Run: func(ctx context.Context) error {
+			if adminSrv == nil {
+				return nil
+			}
+			return adminSrv.Shutdown(ctx)
+		}},
+	)
+	if server.Failed(results) {
+		logrus.Error("Server exiting after failed shutdown")
+		os.Exit(1)
+	}
 	logrus.Info("Server exiting")
 }
@@ -1,106 +1,224 @@
 package config
 
 import (
+	"flag"
 	"fmt"
 	"net"
 	"os"
-	"strconv"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 )
 
+// Policies applied to the users of an account deleted via RMQ
+const (
+	AccountDeletePolicyBlock   = "block"
+	AccountDeletePolicyCascade = "cascade"
+	AccountDeletePolicyOrphan  = "orphan"
+)
+
+// Modes of applying migrations at startup
+const (
+	AutoMigrateOff    = "off"
+	AutoMigrateUp     = "up"
+	AutoMigrateVerify = "verify"
+)
+
+// Modes of validating requests and responses against the OpenAPI document
+const (
+	OpenAPIValidationOff      = "off"
+	OpenAPIValidationRequest  = "request"
+	OpenAPIValidationResponse = "response"
+)
+
+// Modes of verifying client certificates
+const (
+	TLSClientAuthNone     = "none"
+	TLSClientAuthOptional = "optional"
+	TLSClientAuthRequire  = "require"
+)
+
 // Config struct
+//
+// Fields are loaded by Loader, the tags describe each field:
+// config - key in the config file and name of the flag (with dashes), env - environment variable,
+// default - default value, validate - comma separated rules, secret - redacted when printed,
+// reload - applied by Watcher without a restart.
 type Config struct {
-	AppVersion         string
-	AppHost            string
-	AppPort            string
-	AppAddr            string
-	RmqURI             string
-	MongoURI           string
-	MongoDbName        string
-	MongoMigrationsDir string
-	PageSize           int64
-	LogLevel           string
-	LogFormat          string
-	SentryDSN          string
+	AppVersion string `config:"app_version" env:"APP_VERSION" default:"0.0.0"`
+	AppHost    string `config:"app_host" env:"APP_HOST" default:"0.0.0.0"`
+	AppPort    string `config:"app_port" env:"APP_PORT" default:"8000" validate:"required"`
+	AppAddr    string
+	AdminAddr  string `config:"admin_addr" env:"ADMIN_ADDR"`
+	GRPCAddr   string `config:"grpc_addr" env:"GRPC_ADDR"`
+
+	HTTPReadTimeout    time.Duration `config:"http_read_timeout" env:"HTTP_READ_TIMEOUT" default:"10s" validate:"min=0"`
+	HTTPWriteTimeout   time.Duration `config:"http_write_timeout" env:"HTTP_WRITE_TIMEOUT" default:"10s" validate:"min=0"`
+	HTTPIdleTimeout    time.Duration `config:"http_idle_timeout" env:"HTTP_IDLE_TIMEOUT" default:"60s" validate:"min=0"`
+	HTTPMaxHeaderBytes int64         `config:"http_max_header_bytes" env:"HTTP_MAX_HEADER_BYTES" default:"1048576" validate:"min=1"`
+	HTTPMaxBodyBytes   int64         `config:"http_max_body_bytes" env:"HTTP_MAX_BODY_BYTES" default:"1048576" validate:"min=1"`
+
+	ShutdownReadinessDelay time.Duration `config:"shutdown_readiness_delay" env:"SHUTDOWN_READINESS_DELAY" default:"5s" validate:"min=0"`
+	ShutdownRmqTimeout     time.Duration `config:"shutdown_rmq_timeout" env:"SHUTDOWN_RMQ_TIMEOUT" default:"15s" validate:"min=0"`
+	ShutdownHTTPTimeout    time.Duration `config:"shutdown_http_timeout" env:"SHUTDOWN_HTTP_TIMEOUT" default:"10s" validate:"min=0"`
+	ShutdownWebhookTimeout time.Duration `config:"shutdown_webhook_timeout" env:"SHUTDOWN_WEBHOOK_TIMEOUT" default:"10s" validate:"min=0"`
+	ShutdownMongoTimeout   time.Duration `config:"shutdown_mongo_timeout" env:"SHUTDOWN_MONGO_TIMEOUT" default:"5s" validate:"min=0"`
+
+	TLSCertFile     string `config:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile      string `config:"tls_key_file" env:"TLS_KEY_FILE"`
+	TLSClientCAFile string `config:"tls_client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	TLSClientAuth   string `config:"tls_client_auth" env:"TLS_CLIENT_AUTH" default:"none" validate:"oneof=none optional require"`
+
+	RmqURI             string `config:"rmq_uri" env:"RMQ_URI" validate:"required" secret:"true"`
+	MongoURI           string `config:"mongo_uri" env:"MONGODB_CONNECTION_STRING" validate:"required" secret:"true"`
+	MongoDbName        string `config:"mongo_dbname" env:"MONGO_DBNAME" validate:"required"`
+	MongoMigrationsDir string `config:"mongo_migrations_dir" env:"MONGO_MIGRATIONS_DIR"`
+	MongoAutoMigrate   string `config:"mongo_auto_migrate" env:"MONGO_AUTO_MIGRATE" default:"up" validate:"oneof=off up verify"`
+	PageSize           int64  `config:"page_size" env:"PAGE_SIZE" default:"25" validate:"min=1,max=100" reload:"true"`
+	LogLevel           string `config:"logs_level" env:"LOGS_LEVEL" default:"INFO" validate:"oneof=trace debug info warning warn error fatal panic" reload:"true"`
+	LogFormat          string `config:"logs_format" env:"LOGS_FORMAT" default:"TEXT" validate:"oneof=text json" reload:"true"`
+	SentryDSN          string `config:"sentry_dsn" env:"SENTRY_DSN" secret:"true"`
+
+	MongoMigrationTimeout time.Duration `config:"mongo_migration_timeout" env:"MONGO_MIGRATION_TIMEOUT" default:"30m" validate:"min=1s"`
+
+	OpenAPIValidation string `config:"openapi_validation" env:"OPENAPI_VALIDATION" default:"off" validate:"oneof=off request response"`
+
+	GraphQLMaxDepth      int64 `config:"graphql_max_depth" env:"GRAPHQL_MAX_DEPTH" default:"6" validate:"min=1" reload:"true"`
+	GraphQLMaxComplexity int64 `config:"graphql_max_complexity" env:"GRAPHQL_MAX_COMPLEXITY" default:"1000" validate:"min=1" reload:"true"`
+
+	StreamHeartbeatInterval time.Duration `config:"stream_heartbeat_interval" env:"STREAM_HEARTBEAT_INTERVAL" default:"5s" validate:"min=1s" reload:"true"`
+
+	WebhookWorkers      int64         `config:"webhook_workers" env:"WEBHOOK_WORKERS" default:"4" validate:"min=0"`
+	WebhookPollInterval time.Duration `config:"webhook_poll_interval" env:"WEBHOOK_POLL_INTERVAL" default:"1s" validate:"min=100ms"`
+	WebhookTimeout      time.Duration `config:"webhook_timeout" env:"WEBHOOK_TIMEOUT" default:"10s" validate:"min=1s"`
+	WebhookMaxAttempts  int64         `config:"webhook_max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" default:"8" validate:"min=1"`
+	WebhookRetryBase    time.Duration `config:"webhook_retry_base" env:"WEBHOOK_RETRY_BASE" default:"10s" validate:"min=1s"`
+	WebhookRetryMax     time.Duration `config:"webhook_retry_max" env:"WEBHOOK_RETRY_MAX" default:"1h" validate:"min=1s"`
+	WebhookDisableAfter int64         `config:"webhook_disable_after" env:"WEBHOOK_DISABLE_AFTER" default:"20" validate:"min=1"`
+
+	RateLimit           int64         `config:"rate_limit" env:"RATE_LIMIT" default:"0" validate:"min=0" reload:"true"`
+	Features            string        `config:"features" env:"FEATURES" reload:"true"`
+	ConfigWatchInterval time.Duration `config:"config_watch_interval" env:"CONFIG_WATCH_INTERVAL" default:"5s" validate:"min=0"`
+
+	AccountDeletePolicy string `config:"account_delete_policy" env:"ACCOUNT_DELETE_POLICY" default:"orphan" validate:"oneof=block cascade orphan"`
+
+	JWTSecret      string `config:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	TenantJWTClaim string `config:"tenant_jwt_claim" env:"TENANT_JWT_CLAIM" default:"tenant_id" validate:"required"`
+	TenantRequired bool   `config:"tenant_required" env:"TENANT_REQUIRED" default:"true"`
+
+	loader *Loader
 }
 
-// Simple helper function to read an environment or return error
-func getRequiredEnv(key string) string {
-	value, exists := os.LookupEnv(key)
-	if !exists {
-		logrus.Fatalf("Environment variable not set: %s", key)
-	}
-	return value
+// normalize fills derived fields and lowercases enum values
+func (c *Config) normalize() {
+	c.AppAddr = net.JoinHostPort(c.AppHost, c.AppPort)
+	c.MongoAutoMigrate = strings.ToLower(c.MongoAutoMigrate)
+	c.AccountDeletePolicy = strings.ToLower(c.AccountDeletePolicy)
+	c.TLSClientAuth = strings.ToLower(c.TLSClientAuth)
+	c.OpenAPIValidation = strings.ToLower(c.OpenAPIValidation)
 }
 
-// Simple helper function to read an environment or return a default value
-func getEnv(key string, defaultVal string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+// validate checks rules involving several fields
+func (c *Config) validate() []error {
+	var errs []error
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, fmt.Errorf("tls_cert_file and tls_key_file must be set together"))
 	}
-
-	return defaultVal
-}
-
-// Simple helper function to read an environment variable into integer or return a default value
-func getEnvAsInt(name string, defaultVal int) int {
-	valueStr := getEnv(name, "")
-	if value, err := strconv.Atoi(valueStr); err == nil {
-		return value
+	if c.TLSClientAuth != TLSClientAuthNone && (c.TLSCertFile == "" || c.TLSClientCAFile == "") {
+		errs = append(errs, fmt.Errorf("tls_client_auth: requires tls_cert_file, tls_key_file and tls_client_ca_file"))
+	}
+	if c.ConfigWatchInterval > 0 && c.ConfigWatchInterval < time.Second {
+		errs = append(errs, fmt.Errorf("config_watch_interval: must be 0 or >= 1s, got %s", c.ConfigWatchInterval))
 	}
+	if c.HTTPWriteTimeout > 0 && c.StreamHeartbeatInterval >= c.StreamTimeout() {
+		errs = append(errs, fmt.Errorf("stream_heartbeat_interval: must be shorter than %s, 9/10 of http_write_timeout", c.StreamTimeout()))
+	}
+	return errs
+}
 
-	return defaultVal
+// StreamTimeout returns how long an event stream lasts, 0 if it is unlimited.
+// Streams end before the server write timeout closes the connection, clients resume them with Last-Event-ID
+func (c *Config) StreamTimeout() time.Duration {
+	return c.HTTPWriteTimeout * 9 / 10
 }
 
-// Helper to read an environment variable into a bool or return default value
-func getEnvAsBool(name string, defaultVal bool) bool {
-	valStr := getEnv(name, "")
-	if val, err := strconv.ParseBool(valStr); err == nil {
-		return val
-	}
+// TLSEnabled returns true if the server certificate is configured
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != ""
+}
 
-	return defaultVal
+// OpenAPIValidationEnabled returns true if requests are validated against the OpenAPI document
+func (c *Config) OpenAPIValidationEnabled() bool {
+	return c.OpenAPIValidation != OpenAPIValidationOff
 }
 
-// Helper to read an environment variable into a string slice or return default value
-func getEnvAsSlice(name string, defaultVal []string, sep string) []string {
-	valStr := getEnv(name, "")
+// OpenAPIResponseValidationEnabled returns true if responses are validated against the OpenAPI document
+func (c *Config) OpenAPIResponseValidationEnabled() bool {
+	return c.OpenAPIValidation == OpenAPIValidationResponse
+}
 
-	if valStr == "" {
-		return defaultVal
+// FeatureEnabled returns true if the feature is listed in Features
+func (c *Config) FeatureEnabled(name string) bool {
+	for _, feature := range strings.Split(c.Features, ",") {
+		if strings.EqualFold(strings.TrimSpace(feature), name) {
+			return true
+		}
 	}
+	return false
+}
 
-	val := strings.Split(valStr, sep)
+// Simple helper function to read an environment or return a default value
+func getEnv(key string, defaultVal string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
 
-	return val
+	return defaultVal
 }
 
-// NewConfig returns a new Config struct
+// NewConfig returns a new Config struct loaded from the config file and environment
 func NewConfig() *Config {
+	return NewConfigWithFlags(nil, nil)
+}
+
+// NewConfigWithFlags returns a new Config struct loaded from the config file, environment and command line flags,
+// flags for the config fields are registered in flags which is then parsed with args
+func NewConfigWithFlags(flags *flag.FlagSet, args []string) *Config {
 	err := godotenv.Load()
 	if err != nil {
 		logrus.Info("Error loading .env file")
 	}
 
-	appHost := getEnv("APP_HOST", "0.0.0.0")
-	appPort := getEnv("APP_PORT", "8000")
-	return &Config{
-		AppVersion:         getEnv("APP_VERSION", "0.0.0"),
-		AppHost:            appHost,
-		AppPort:            appPort,
-		AppAddr:            net.JoinHostPort(appHost, appPort),
-		RmqURI:             getRequiredEnv("RMQ_URI"),
-		MongoURI:           getRequiredEnv("MONGODB_CONNECTION_STRING"),
-		MongoDbName:        getRequiredEnv("MONGO_DBNAME"),
-		MongoMigrationsDir: "file://migrations",
-		PageSize:           25,
-		LogLevel:           getEnv("LOGS_LEVEL", "INFO"),
-		LogFormat:          getEnv("LOGS_FORMAT", "TEXT"),
-		SentryDSN:          getEnv("SENTRY_DSN", ""),
+	loader := NewLoader(flags)
+	if flags != nil {
+		if err := flags.Parse(args); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	config, err := loader.Load()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return config
+}
+
+// NewDefaultConfig returns a new Config struct with default values only, the config file and environment are ignored.
+// It is meant for tests which do not connect to MongoDB and RabbitMQ, required fields are left empty
+func NewDefaultConfig() *Config {
+	var config Config
+	v := reflect.ValueOf(&config).Elem()
+	for _, f := range configFields() {
+		if f.def != "" {
+			// defaults are checked by tests of Loader
+			_ = setValue(v.Field(f.index), f.def)
+		}
 	}
+	config.normalize()
+	return &config
 }
 
 // NewTestingConfig returns a new Config struct for tests
@@ -0,0 +1,385 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFileEnv  = "CONFIG_FILE"
+	configFileFlag = "config"
+	redactedValue  = "******"
+)
+
+// Errors contains all problems found while loading the config
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = "  - " + err.Error()
+	}
+	return "invalid config:\n" + strings.Join(messages, "\n")
+}
+
+// field describes a Config field from its tags
+type field struct {
+	index    int
+	key      string
+	env      string
+	def      string
+	validate string
+	secret   bool
+	reload   bool
+}
+
+func (f field) flagName() string {
+	return strings.ReplaceAll(f.key, "_", "-")
+}
+
+func configFields() []field {
+	t := reflect.TypeOf(Config{})
+	fields := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag
+		key := tag.Get("config")
+		if key == "" {
+			continue
+		}
+		fields = append(fields, field{
+			index:    i,
+			key:      key,
+			env:      tag.Get("env"),
+			def:      tag.Get("default"),
+			validate: tag.Get("validate"),
+			secret:   tag.Get("secret") == "true",
+			reload:   tag.Get("reload") == "true",
+		})
+	}
+	return fields
+}
+
+// flagValue is a flag.Value remembering whether the flag was set
+type flagValue struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (v *flagValue) String() string { return v.value }
+
+func (v *flagValue) Set(value string) error {
+	v.value = value
+	v.set = true
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool { return v.isBool }
+
+// Loader loads Config from layered sources, each one overrides the previous:
+// defaults from struct tags, the config file (YAML or TOML), environment variables and flags
+type Loader struct {
+	fields     []field
+	configFile *flagValue
+	flagValues map[string]*flagValue
+	lookupEnv  func(key string) (string, bool)
+}
+
+// NewLoader returns a new Loader, if flags is not nil a flag for every field and -config are registered in it
+// and Load must be called after flags are parsed
+func NewLoader(flags *flag.FlagSet) *Loader {
+	l := &Loader{
+		fields:     configFields(),
+		configFile: &flagValue{},
+		flagValues: make(map[string]*flagValue),
+		lookupEnv:  os.LookupEnv,
+	}
+	if flags == nil {
+		return l
+	}
+
+	flags.Var(l.configFile, configFileFlag, "path to YAML or TOML config file (env "+configFileEnv+")")
+	t := reflect.TypeOf(Config{})
+	for _, f := range l.fields {
+		value := &flagValue{isBool: t.Field(f.index).Type.Kind() == reflect.Bool}
+		l.flagValues[f.key] = value
+		usage := fmt.Sprintf("%s (env %s)", f.key, f.env)
+		if f.def != "" {
+			usage += fmt.Sprintf(" (default %q)", f.def)
+		}
+		flags.Var(value, f.flagName(), usage)
+	}
+	return l
+}
+
+// Load returns the effective Config, the returned error lists all problems found
+func (l *Loader) Load() (*Config, error) {
+	var config Config
+	var errs Errors
+	v := reflect.ValueOf(&config).Elem()
+
+	apply := func(f field, value string, source string) {
+		if err := setValue(v.Field(f.index), value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value %q from %s: %w", f.key, value, source, err))
+		}
+	}
+
+	for _, f := range l.fields {
+		if f.def != "" {
+			apply(f, f.def, "default")
+		}
+	}
+
+	path := l.configPath()
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		known := make(map[string]bool, len(l.fields))
+		for _, f := range l.fields {
+			known[f.key] = true
+			if value, ok := values[f.key]; ok {
+				apply(f, value, path)
+			}
+		}
+		for key := range values {
+			if !known[key] {
+				errs = append(errs, fmt.Errorf("%s: unknown key in %s", key, path))
+			}
+		}
+	}
+
+	for _, f := range l.fields {
+		if value, ok := l.lookupEnv(f.env); ok && f.env != "" {
+			apply(f, value, "env "+f.env)
+		}
+	}
+
+	for _, f := range l.fields {
+		if value, ok := l.flagValues[f.key]; ok && value.set {
+			apply(f, value.value, "flag -"+f.flagName())
+		}
+	}
+
+	errs = append(errs, config.check()...)
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	config.loader = l
+	return &config, nil
+}
+
+// check normalizes the config and returns problems found by the field rules and the rules involving several fields
+func (c *Config) check() Errors {
+	var errs Errors
+	c.normalize()
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range configFields() {
+		for _, err := range validateValue(v.Field(f.index), f.validate) {
+			errs = append(errs, fmt.Errorf("%s: %w", f.key, err))
+		}
+	}
+	return append(errs, c.validate()...)
+}
+
+// configPath returns path of the config file set by the flag or the environment
+func (l *Loader) configPath() string {
+	if l.configFile.set {
+		return l.configFile.value
+	}
+	path, _ := l.lookupEnv(configFileEnv)
+	return path
+}
+
+// readConfigFile returns values of the flat YAML (by default) or TOML (by extension) config file
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed read config file: %w", err)
+	}
+
+	raw := make(map[string]interface{})
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		err = toml.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed decode config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("failed decode config file %s: %s must be a scalar", path, key)
+		}
+		values[key] = fmt.Sprint(value)
+	}
+	return values, nil
+}
+
+func setValue(v reflect.Value, value string) error {
+	switch v.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// validateValue checks rules: required, oneof=a b (case insensitive), min=N, max=N,
+// bounds of durations are durations as well, e.g. min=1s
+func validateValue(v reflect.Value, rules string) []error {
+	var errs []error
+	if rules == "" {
+		return errs
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg := rule, ""
+		if idx := strings.Index(rule, "="); idx >= 0 {
+			name, arg = rule[:idx], rule[idx+1:]
+		}
+
+		switch name {
+		case "required":
+			if v.IsZero() {
+				errs = append(errs, fmt.Errorf("is required"))
+			}
+		case "oneof":
+			value := fmt.Sprint(v.Interface())
+			valid := false
+			for _, option := range strings.Fields(arg) {
+				if strings.EqualFold(option, value) {
+					valid = true
+				}
+			}
+			if !valid {
+				errs = append(errs, fmt.Errorf("must be one of [%s], got %q", arg, value))
+			}
+		case "min", "max":
+			if d, ok := v.Interface().(time.Duration); ok {
+				limit, err := time.ParseDuration(arg)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("invalid rule %s", rule))
+					continue
+				}
+				if name == "min" && d < limit {
+					errs = append(errs, fmt.Errorf("must be >= %s, got %s", limit, d))
+				}
+				if name == "max" && d > limit {
+					errs = append(errs, fmt.Errorf("must be <= %s, got %s", limit, d))
+				}
+				continue
+			}
+
+			limit, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid rule %s", rule))
+				continue
+			}
+			if name == "min" && v.Int() < limit {
+				errs = append(errs, fmt.Errorf("must be >= %d, got %d", limit, v.Int()))
+			}
+			if name == "max" && v.Int() > limit {
+				errs = append(errs, fmt.Errorf("must be <= %d, got %d", limit, v.Int()))
+			}
+		}
+	}
+	return errs
+}
+
+// redact hides the secret value, of a URL only the password or the user and the query values are hidden
+// so that the host and the option names stay visible
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return redactedValue
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redactedValue)
+		} else {
+			u.User = url.User(redactedValue)
+		}
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			query[key] = []string{redactedValue}
+		}
+		u.RawQuery = query.Encode()
+	}
+	u.Fragment, u.RawFragment = "", ""
+	return u.String()
+}
+
+// Print writes the config as YAML with secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	v := reflect.ValueOf(c).Elem()
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, f := range configFields() {
+		valueNode := &yaml.Node{Kind: yaml.ScalarNode}
+		switch value := v.Field(f.index).Interface().(type) {
+		case string:
+			if f.secret {
+				value = redact(value)
+			}
+			valueNode.SetString(value)
+		case time.Duration:
+			valueNode.SetString(value.String())
+		default:
+			valueNode.Value = fmt.Sprint(value)
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.key}, valueNode)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
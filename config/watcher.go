@@ -0,0 +1,215 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Results of the config reload
+const (
+	ReloadResultSuccess = "success"
+	ReloadResultFailure = "failure"
+)
+
+var reloadCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "config_reloads_total",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(reloadCounter)
+}
+
+// ErrNotReloadable returned when the config was not created by Loader
+var ErrNotReloadable = errors.New("config is not reloadable")
+
+// SubscriberFunc is called with the new config after each successful reload
+type SubscriberFunc func(c *Config)
+
+// Watcher reloads the config on SIGHUP or when the config file changes.
+// Only fields tagged with reload are applied, changes of other fields are ignored until restart.
+// A reload never mutates a Config passed to subscribers, every reload creates a new one.
+type Watcher struct {
+	mu          sync.RWMutex
+	current     *Config
+	subscribers []SubscriberFunc
+
+	reloadMu sync.Mutex
+	modTime  time.Time
+	size     int64
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewWatcher returns a new Watcher struct for the config returned by Loader
+func NewWatcher(c *Config) *Watcher {
+	w := &Watcher{current: c}
+	w.modTime, w.size = w.stat()
+	return w
+}
+
+// Current returns the config with the last applied changes
+func (w *Watcher) Current() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current
+}
+
+// Subscribe registers fn to be called after each successful reload
+func (w *Watcher) Subscribe(fn SubscriberFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Reload loads the config and applies changed reloadable fields,
+// an invalid config is rejected and the running config stays unchanged
+func (w *Watcher) Reload() error {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	current := w.Current()
+	if current.loader == nil {
+		reloadCounter.WithLabelValues(ReloadResultFailure).Inc()
+		return ErrNotReloadable
+	}
+
+	loaded, err := current.loader.Load()
+	if err != nil {
+		reloadCounter.WithLabelValues(ReloadResultFailure).Inc()
+		logrus.Errorf("Config reload rejected: %s", err)
+		return err
+	}
+
+	next := *current
+	currentValue := reflect.ValueOf(current).Elem()
+	loadedValue := reflect.ValueOf(loaded).Elem()
+	nextValue := reflect.ValueOf(&next).Elem()
+	var applied, ignored []string
+	for _, f := range configFields() {
+		if reflect.DeepEqual(currentValue.Field(f.index).Interface(), loadedValue.Field(f.index).Interface()) {
+			continue
+		}
+		if !f.reload {
+			ignored = append(ignored, f.key)
+			continue
+		}
+		nextValue.Field(f.index).Set(loadedValue.Field(f.index))
+		applied = append(applied, f.key)
+	}
+
+	if len(ignored) > 0 {
+		logrus.Warnf("Config reload ignored fields requiring restart: %s", strings.Join(ignored, ", "))
+	}
+	// applied fields are checked against the running values of the fields requiring restart
+	if errs := next.check(); len(errs) > 0 {
+		reloadCounter.WithLabelValues(ReloadResultFailure).Inc()
+		logrus.Errorf("Config reload rejected: %s", errs)
+		return errs
+	}
+	reloadCounter.WithLabelValues(ReloadResultSuccess).Inc()
+	if len(applied) == 0 {
+		logrus.Info("Config reloaded without changes")
+		return nil
+	}
+	logrus.Infof("Config reloaded: %s", strings.Join(applied, ", "))
+
+	w.mu.Lock()
+	w.current = &next
+	subscribers := append([]SubscriberFunc(nil), w.subscribers...)
+	w.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(&next)
+	}
+	return nil
+}
+
+// Start reloads the config on SIGHUP and polls the config file for changes every ConfigWatchInterval
+func (w *Watcher) Start() {
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	var ticker *time.Ticker
+	if interval := w.Current().ConfigWatchInterval; interval > 0 && w.path() != "" {
+		ticker = time.NewTicker(interval)
+		tick = ticker.C
+	}
+
+	go func() {
+		defer close(w.done)
+		defer signal.Stop(hup)
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-hup:
+				logrus.Info("Config reload requested by SIGHUP")
+				_ = w.Reload()
+			case <-tick:
+				if w.changed() {
+					logrus.Info("Config file changed")
+					_ = w.Reload()
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops watching for changes
+func (w *Watcher) Stop() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+}
+
+func (w *Watcher) path() string {
+	loader := w.Current().loader
+	if loader == nil {
+		return ""
+	}
+	return loader.configPath()
+}
+
+func (w *Watcher) stat() (time.Time, int64) {
+	path := w.path()
+	if path == "" {
+		return time.Time{}, 0
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
+
+// changed returns true if the config file was modified since the last check
+func (w *Watcher) changed() bool {
+	modTime, size := w.stat()
+	if modTime.Equal(w.modTime) && size == w.size {
+		return false
+	}
+	w.modTime, w.size = modTime, size
+	return true
+}
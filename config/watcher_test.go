@@ -0,0 +1,72 @@
+package config
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherReload(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "page_size: 10\n")
+	config, err := newTestLoader(nil, withEnv(map[string]string{"CONFIG_FILE": path})).Load()
+	require.NoError(t, err)
+
+	w := NewWatcher(config)
+	var applied []*Config
+	w.Subscribe(func(c *Config) { applied = append(applied, c) })
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("page_size: 50\nlogs_level: debug\nfeatures: graphql, sse\nmongo_dbname: other\n"), 0600))
+	assert.True(t, w.changed())
+	require.NoError(t, w.Reload())
+
+	require.Equal(t, 1, len(applied))
+	current := w.Current()
+	assert.Equal(t, applied[0], current)
+	assert.Equal(t, int64(50), current.PageSize)
+	assert.Equal(t, "debug", current.LogLevel)
+	assert.True(t, current.FeatureEnabled("sse"))
+	assert.False(t, current.FeatureEnabled("webhooks"))
+	assert.Equal(t, "go-example", current.MongoDbName, "fields requiring restart are not applied")
+	assert.Equal(t, int64(10), config.PageSize, "the previous config is not mutated")
+	assert.False(t, w.changed())
+}
+
+func TestWatcherRejectsInvalidReload(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "page_size: 10\n")
+	config, err := newTestLoader(nil, withEnv(map[string]string{"CONFIG_FILE": path})).Load()
+	require.NoError(t, err)
+
+	w := NewWatcher(config)
+	called := false
+	w.Subscribe(func(c *Config) { called = true })
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("page_size: 500\nlogs_level: debug\n"), 0600))
+	require.Error(t, w.Reload())
+	assert.False(t, called)
+	assert.Equal(t, config, w.Current())
+}
+
+func TestWatcherNotReloadable(t *testing.T) {
+	w := NewWatcher(&Config{})
+	assert.Equal(t, ErrNotReloadable, w.Reload())
+}
+
+func TestWatcherRejectsReloadBreakingRunningConfig(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "http_write_timeout: 10s\nstream_heartbeat_interval: 5s\n")
+	config, err := newTestLoader(nil, withEnv(map[string]string{"CONFIG_FILE": path})).Load()
+	require.NoError(t, err)
+
+	w := NewWatcher(config)
+	called := false
+	w.Subscribe(func(c *Config) { called = true })
+
+	// valid by itself, but http_write_timeout requires restart and stays 10s
+	require.NoError(t, ioutil.WriteFile(path, []byte("http_write_timeout: 0\nstream_heartbeat_interval: 1m\n"), 0600))
+	err = w.Reload()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stream_heartbeat_interval: must be shorter than 9s")
+	assert.False(t, called)
+	assert.Equal(t, config, w.Current())
+}
@@ -0,0 +1,8 @@
+package docs
+
+import "embed"
+
+// Files contains the generated swagger specs embedded into the binary
+//
+//go:embed swagger.json swagger.yaml
+var Files embed.FS
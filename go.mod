@@ -1,14 +1,18 @@
 module github.com/zaharinea/go-example
 
-go 1.15
+go 1.16
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751
 	github.com/getsentry/sentry-go v0.8.0
-	github.com/gin-gonic/gin v1.6.3
+	github.com/gin-gonic/gin v1.7.0
 	github.com/go-errors/errors v1.1.1
+	github.com/go-playground/validator/v10 v10.4.1
 	github.com/golang-migrate/migrate/v4 v4.14.0
+	github.com/golang/protobuf v1.4.3
 	github.com/google/uuid v1.1.2
+	github.com/graphql-go/graphql v0.8.1
 	github.com/joho/godotenv v1.3.0
 	github.com/kisielk/errcheck v1.4.0 // indirect
 	github.com/prometheus/client_golang v1.8.0
@@ -23,4 +27,8 @@ require (
 	go.mongodb.org/mongo-driver v1.4.3
 	golang.org/x/lint v0.0.0-20200302205851-738671d3881b // indirect
 	golang.org/x/net v0.0.0-20201029221708-28c70e62bb1d
+	google.golang.org/genproto v0.0.0-20201030142918-24207fddd1c3
+	google.golang.org/grpc v1.34.0
+	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -20,7 +21,7 @@ func TestMain(m *testing.M) {
 func setup() {
 	c := config.NewTestingConfig()
 	dbClient := repository.InitDbClient(c)
-	repository.ApplyDbMigrations(c, dbClient)
+	repository.ApplyDbMigrations(context.Background(), c, dbClient)
 
 	fmt.Printf("\033[1;36m%s\033[0m", "> Setup completed\n")
 }
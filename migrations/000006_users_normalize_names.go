@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func init() {
+	Register(&GoMigration{
+		Version: 6,
+		Name:    "users_normalize_names",
+		Up:      usersNormalizeNamesUp,
+		// the original names are not kept, reverting must not pretend the data is restored
+		Down: func(ctx context.Context, db *mongo.Database) error { return ErrIrreversible },
+	})
+}
+
+// normalizeName trims the name and collapses inner whitespace
+func normalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+func usersNormalizeNamesUp(ctx context.Context, db *mongo.Database) error {
+	return Batch(ctx, db, "000006_users_normalize_names", "users", bson.M{}, DefaultBatchSize, func(doc bson.Raw) (interface{}, error) {
+		name, ok := doc.Lookup("name").StringValueOK()
+		if !ok || name == normalizeName(name) {
+			return nil, nil
+		}
+		return bson.M{"$set": bson.M{"name": normalizeName(name)}}, nil
+	})
+}
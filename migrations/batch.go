@@ -0,0 +1,85 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const checkpointsCollection = "migrations_checkpoints"
+
+// DefaultBatchSize of Batch
+const DefaultBatchSize = 500
+
+// BatchFunc returns the update for a document or nil to leave it unchanged
+type BatchFunc func(doc bson.Raw) (update interface{}, err error)
+
+// checkpoint stores the last processed document of a batched migration
+type checkpoint struct {
+	Name   string      `bson:"_id"`
+	LastID interface{} `bson:"last_id"`
+}
+
+// Batch applies fn to documents of the collection matching filter in _id order by batches of batchSize,
+// after each batch the last processed _id is saved so that an interrupted migration resumes where it stopped
+func Batch(ctx context.Context, db *mongo.Database, name string, collection string, filter bson.M, batchSize int64, fn BatchFunc) error {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	checkpoints := db.Collection(checkpointsCollection)
+	coll := db.Collection(collection)
+
+	var cp checkpoint
+	err := checkpoints.FindOne(ctx, bson.M{"_id": name}).Decode(&cp)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	for {
+		batchFilter := filter
+		if cp.LastID != nil {
+			batchFilter = bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$gt": cp.LastID}}}}
+		}
+
+		opts := options.Find().SetSort(bson.D{bson.E{Key: "_id", Value: 1}}).SetLimit(batchSize)
+		cur, err := coll.Find(ctx, batchFilter, opts)
+		if err != nil {
+			return err
+		}
+
+		var docs []bson.Raw
+		if err := cur.All(ctx, &docs); err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			break
+		}
+
+		var models []mongo.WriteModel
+		for _, doc := range docs {
+			update, err := fn(doc)
+			if err != nil {
+				return err
+			}
+			if update != nil {
+				models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": doc.Lookup("_id")}).SetUpdate(update))
+			}
+		}
+		if len(models) > 0 {
+			if _, err := coll.BulkWrite(ctx, models); err != nil {
+				return err
+			}
+		}
+
+		cp.LastID = docs[len(docs)-1].Lookup("_id")
+		upsertOpts := options.Update().SetUpsert(true)
+		if _, err := checkpoints.UpdateOne(ctx, bson.M{"_id": name}, bson.M{"$set": bson.M{"last_id": cp.LastID}}, upsertOpts); err != nil {
+			return err
+		}
+	}
+
+	_, err = checkpoints.DeleteOne(ctx, bson.M{"_id": name})
+	return err
+}
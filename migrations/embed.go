@@ -0,0 +1,8 @@
+package migrations
+
+import "embed"
+
+// FS contains the command migrations embedded into the binary
+//
+//go:embed *.mongodb
+var FS embed.FS
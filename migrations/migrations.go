@@ -0,0 +1,55 @@
+// Package migrations contains the MongoDB migrations: command files (*.mongodb) and Go migrations
+// registered with Register, both are applied in the order of their versions
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrIrreversible returned by Down of a migration which can not be undone, e.g. a lossy data backfill
+var ErrIrreversible = errors.New("migration can not be reverted")
+
+// MigrateFunc is a step of a Go migration
+type MigrateFunc func(ctx context.Context, db *mongo.Database) error
+
+// GoMigration struct
+type GoMigration struct {
+	Version uint
+	Name    string
+	Up      MigrateFunc
+	Down    MigrateFunc
+}
+
+var registry = make(map[uint]*GoMigration)
+
+// Register registers a Go migration, it is called from init of the migration file
+func Register(migration *GoMigration) {
+	if _, exist := registry[migration.Version]; exist {
+		panic(fmt.Sprintf("go migration already registered: %d", migration.Version))
+	}
+	if migration.Up == nil {
+		panic(fmt.Sprintf("go migration without up step: %d", migration.Version))
+	}
+	registry[migration.Version] = migration
+}
+
+// Registered returns registered Go migrations ordered by version
+func Registered() []*GoMigration {
+	result := make([]*GoMigration, 0, len(registry))
+	for _, migration := range registry {
+		result = append(result, migration)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result
+}
+
+// Get returns the registered Go migration by version
+func Get(version uint) (*GoMigration, bool) {
+	migration, ok := registry[version]
+	return migration, ok
+}
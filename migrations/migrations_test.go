@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisteredOrdered(t *testing.T) {
+	registered := Registered()
+	for i := 1; i < len(registered); i++ {
+		assert.Less(t, registered[i-1].Version, registered[i].Version)
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	assert.Equal(t, "user name", normalizeName("  user \t name "))
+	assert.Equal(t, "user", normalizeName("user"))
+}
+
+func TestNormalizeNamesIrreversible(t *testing.T) {
+	migration, ok := Get(6)
+	assert.True(t, ok)
+	assert.True(t, errors.Is(migration.Down(context.Background(), nil), ErrIrreversible))
+}
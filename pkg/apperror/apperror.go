@@ -0,0 +1,121 @@
+// Package apperror contains typed errors returned by services, they are mapped to transport responses by handlers
+package apperror
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind is a category of errors
+type Kind string
+
+// Kinds of errors
+const (
+	KindValidation       Kind = "validation"
+	KindUnauthorized     Kind = "unauthorized"
+	KindForbidden        Kind = "forbidden"
+	KindNotFound         Kind = "not_found"
+	KindMethodNotAllowed Kind = "method_not_allowed"
+	KindConflict         Kind = "conflict"
+	KindPayloadTooLarge  Kind = "payload_too_large"
+	KindTooManyRequests  Kind = "too_many_requests"
+	KindUnavailable      Kind = "unavailable"
+	KindInternal         Kind = "internal"
+)
+
+// FieldError describes an invalid field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error safe to show to clients, Err is the internal cause which is never shown
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+// New returns a new Error
+func New(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %s", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Unwrap returns the cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports errors with the same code as equal, so that sentinel errors match their wrapped copies
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of the error with the cause
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+// WithFields returns a copy of the error with invalid fields
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	wrapped := *e
+	wrapped.Fields = append(append([]FieldError(nil), e.Fields...), fields...)
+	return &wrapped
+}
+
+// Validation returns a new validation Error
+func Validation(code string, message string, fields ...FieldError) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message, Fields: fields}
+}
+
+// NotFound returns a new not found Error
+func NotFound(code string, message string) *Error {
+	return New(KindNotFound, code, message)
+}
+
+// Conflict returns a new conflict Error
+func Conflict(code string, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+// Unauthorized returns a new unauthorized Error
+func Unauthorized(code string, message string) *Error {
+	return New(KindUnauthorized, code, message)
+}
+
+// Forbidden returns a new forbidden Error
+func Forbidden(code string, message string) *Error {
+	return New(KindForbidden, code, message)
+}
+
+// Internal returns a new internal Error hiding err
+func Internal(err error) *Error {
+	return &Error{Kind: KindInternal, Code: "internal_error", Message: "Server error", Err: err}
+}
+
+// From returns err as Error, errors of other types are internal
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return Internal(err)
+}
+
+// KindOf returns the kind of err, KindInternal for errors of other types
+func KindOf(err error) Kind {
+	return From(err).Kind
+}
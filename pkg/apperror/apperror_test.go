@@ -0,0 +1,40 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTestNotFound = NotFound("test_not_found", "Not found test")
+
+func TestIs(t *testing.T) {
+	cause := errors.New("no documents")
+	err := fmt.Errorf("get: %w", errTestNotFound.Wrap(cause))
+
+	assert.True(t, errors.Is(err, errTestNotFound))
+	assert.True(t, errors.Is(err, cause))
+	assert.False(t, errors.Is(err, NotFound("other_not_found", "Not found other")))
+	assert.Equal(t, KindNotFound, KindOf(err))
+	assert.Equal(t, "test_not_found: Not found test: no documents", From(err).Error())
+}
+
+func TestFrom(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := From(cause)
+
+	assert.Equal(t, KindInternal, err.Kind)
+	assert.Equal(t, "Server error", err.Message)
+	assert.Equal(t, cause, errors.Unwrap(err))
+}
+
+func TestWithFields(t *testing.T) {
+	base := Validation("invalid_request", "Request is invalid")
+	err := base.WithFields(FieldError{Field: "name", Code: "required", Message: "name is required"})
+
+	assert.Empty(t, base.Fields)
+	assert.Equal(t, 1, len(err.Fields))
+	assert.True(t, errors.Is(err, base))
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken returned when the token is malformed, has a bad signature or is expired
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims of JWT
+type Claims map[string]interface{}
+
+// String returns a string claim
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+// ParseToken verifies a HS256 signed JWT and returns its claims, the token is expired if its exp is not after now
+func ParseToken(token string, secret string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || secret == "" {
+		return nil, ErrInvalidToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(signature, sign(parts[0]+"."+parts[1], secret)) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.Unix() >= int64(exp) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// NewToken returns a HS256 signed JWT with the claims
+func NewToken(claims Claims, secret string) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: "HS256"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sign(unsigned, secret)), nil
+}
+
+func sign(data string, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
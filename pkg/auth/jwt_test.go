@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTokenOk(t *testing.T) {
+	token, err := NewToken(Claims{"tenant_id": "1"}, "secret")
+	require.NoError(t, err)
+
+	claims, err := ParseToken(token, "secret", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "1", claims.String("tenant_id"))
+}
+
+func TestParseTokenErrorInvalidSignature(t *testing.T) {
+	token, err := NewToken(Claims{"tenant_id": "1"}, "secret")
+	require.NoError(t, err)
+
+	_, err = ParseToken(token, "other", time.Now())
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestParseTokenErrorExpired(t *testing.T) {
+	exp := time.Date(2020, 11, 20, 0, 0, 0, 0, time.UTC)
+	token, err := NewToken(Claims{"tenant_id": "1", "exp": exp.Unix()}, "secret")
+	require.NoError(t, err)
+
+	_, err = ParseToken(token, "secret", exp.Add(-time.Second))
+	require.NoError(t, err)
+	_, err = ParseToken(token, "secret", exp)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestParseTokenErrorMalformed(t *testing.T) {
+	_, err := ParseToken("token", "secret", time.Now())
+	assert.Equal(t, ErrInvalidToken, err)
+}
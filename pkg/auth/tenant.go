@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/apperror"
+)
+
+const bearerPrefix = "Bearer "
+
+// Errors of resolving the tenant
+var (
+	ErrUnauthorized   = apperror.Unauthorized("unauthorized", "Unauthorized")
+	ErrTenantMismatch = apperror.Forbidden("tenant_mismatch", "Tenant mismatch")
+)
+
+// ErrMissingTenantClaim returned when the token has no tenant claim, such a token would give access to all tenants
+var ErrMissingTenantClaim = errors.New("missing tenant claim")
+
+// ResolveTenant returns the tenant of a request from the TenantJWTClaim claim of the bearer token in authorization
+// or from tenantID sent in X-Tenant-ID, both must match if both are set. A token without the claim is rejected,
+// the tenant is empty if neither is set and TenantRequired is false, now is used to check expiration of the token
+func ResolveTenant(c *config.Config, authorization string, tenantID string, now time.Time) (string, error) {
+	if strings.HasPrefix(authorization, bearerPrefix) {
+		claims, err := ParseToken(strings.TrimPrefix(authorization, bearerPrefix), c.JWTSecret, now)
+		if err != nil {
+			return "", ErrUnauthorized.Wrap(err)
+		}
+
+		claimTenantID := claims.String(c.TenantJWTClaim)
+		if claimTenantID == "" {
+			return "", ErrUnauthorized.Wrap(ErrMissingTenantClaim)
+		}
+		if tenantID != "" && tenantID != claimTenantID {
+			return "", ErrTenantMismatch
+		}
+		tenantID = claimTenantID
+	}
+
+	if tenantID == "" && c.TenantRequired {
+		return "", ErrUnauthorized
+	}
+	return tenantID, nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaharinea/go-example/config"
+)
+
+func TestResolveTenant(t *testing.T) {
+	c := &config.Config{JWTSecret: "secret", TenantJWTClaim: "tenant_id"}
+	now := time.Now()
+	token, err := NewToken(Claims{"tenant_id": "1"}, "secret")
+	require.NoError(t, err)
+
+	tenantID, err := ResolveTenant(c, "", "", now)
+	require.NoError(t, err)
+	assert.Equal(t, "", tenantID)
+
+	tenantID, err = ResolveTenant(c, "", "2", now)
+	require.NoError(t, err)
+	assert.Equal(t, "2", tenantID)
+
+	tenantID, err = ResolveTenant(c, "Bearer "+token, "1", now)
+	require.NoError(t, err)
+	assert.Equal(t, "1", tenantID)
+
+	_, err = ResolveTenant(c, "Bearer "+token, "2", now)
+	assert.True(t, errors.Is(err, ErrTenantMismatch))
+
+	_, err = ResolveTenant(c, "Bearer invalid", "", now)
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+
+	token, err = NewToken(Claims{"tenant_id": ""}, "secret")
+	require.NoError(t, err)
+	_, err = ResolveTenant(c, "Bearer "+token, "", now)
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	assert.True(t, errors.Is(err, ErrMissingTenantClaim))
+
+	token, err = NewToken(Claims{"sub": "1"}, "secret")
+	require.NoError(t, err)
+	_, err = ResolveTenant(c, "Bearer "+token, "1", now)
+	assert.True(t, errors.Is(err, ErrMissingTenantClaim), "the header does not replace a missing claim")
+
+	c.TenantRequired = true
+	_, err = ResolveTenant(c, "", "", now)
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+}
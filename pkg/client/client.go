@@ -0,0 +1,225 @@
+// Package client is a typed client of the go-example HTTP API for other Go services.
+// Idempotent calls are retried with backoff, the request ID of the context is sent as X-Request-ID
+// and error responses are returned as *Error.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeaderName     = "X-Request-ID"
+	tenantIDHeaderName      = "X-Tenant-ID"
+	authorizationHeaderName = "Authorization"
+	defaultTimeout          = 10 * time.Second
+	// maxErrorBodyBytes limits the body of error responses read into Error
+	maxErrorBodyBytes = 1 << 20
+)
+
+// Retry is the policy of retrying idempotent calls failed by network errors or 429, 502, 503 and 504 responses,
+// the backoff doubles after each attempt starting from MinBackoff up to MaxBackoff
+type Retry struct {
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+// DefaultRetry is the Retry used by NewClient
+var DefaultRetry = Retry{MaxAttempts: 3, MinBackoff: 100 * time.Millisecond, MaxBackoff: 2 * time.Second}
+
+func (r Retry) backoff(attempt int) time.Duration {
+	backoff := r.MinBackoff
+	for i := 1; i < attempt && backoff < r.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.MaxBackoff {
+		backoff = r.MaxBackoff
+	}
+	return backoff
+}
+
+// Option configures the Client
+type Option func(c *Client)
+
+// WithHTTPClient sets the HTTP client, by default a client with a 10 seconds timeout is used
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithRetry sets the retry policy of idempotent calls, MaxAttempts 1 disables retries
+func WithRetry(retry Retry) Option {
+	return func(c *Client) { c.retry = retry }
+}
+
+// WithTenantID sends the tenant ID in X-Tenant-ID with every request
+func WithTenantID(tenantID string) Option {
+	return func(c *Client) { c.header.Set(tenantIDHeaderName, tenantID) }
+}
+
+// WithToken sends the JWT as a bearer token with every request
+func WithToken(token string) Option {
+	return func(c *Client) { c.header.Set(authorizationHeaderName, "Bearer "+token) }
+}
+
+// Client of the go-example HTTP API, it is safe for concurrent use
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retry      Retry
+	header     http.Header
+}
+
+// NewClient returns a new Client struct for the API served at baseURL
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		retry:      DefaultRetry,
+		header:     http.Header{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context sending requestID as X-Request-ID, services pass the ID of their own request
+// so that calls are traced through both services. Without it every call gets a new ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	if requestID, ok := ctx.Value(requestIDKey{}).(string); ok && requestID != "" {
+		return requestID
+	}
+	return uuid.New().String()
+}
+
+// do sends the request and decodes the response body into out, out may be nil.
+// Idempotent requests are retried, all attempts have the same request ID.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}, out interface{}) error {
+	attempts := 1
+	if idempotent(method) && c.retry.MaxAttempts > 1 {
+		attempts = c.retry.MaxAttempts
+	}
+	return c.doAttempts(ctx, attempts, method, path, query, body, out)
+}
+
+func (c *Client) doAttempts(ctx context.Context, attempts int, method string, path string, query url.Values, body interface{}, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	requestID := requestIDFromContext(ctx)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retryable bool
+		retryable, err = c.send(ctx, method, endpoint, requestID, payload, out)
+		if err == nil || !retryable || attempt >= attempts {
+			return err
+		}
+
+		timer := time.NewTimer(c.retry.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// send performs one attempt, returns true if the attempt may be retried
+func (c *Client) send(ctx context.Context, method string, endpoint string, requestID string, payload []byte, out interface{}) (bool, error) {
+	var bodyReader io.Reader
+	if payload != nil {
+		bodyReader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bodyReader)
+	if err != nil {
+		return false, err
+	}
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	req.Header.Set(requestIDHeaderName, requestID)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return retryableStatus(resp.StatusCode), newError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("decode response of %s %s: %w", method, endpoint, err)
+	}
+	return false, nil
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// HealthStatus is the response of the health and readiness checks
+type HealthStatus struct {
+	Status string `json:"status"`
+}
+
+// Healthcheck returns nil if the service is alive
+func (c *Client) Healthcheck(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/api/healthcheck", nil, nil, &HealthStatus{})
+}
+
+// Readycheck returns nil if the service is ready to serve requests, a shutting down service returns
+// an *Error of the apperror.KindUnavailable kind. The call is not retried to report the current state.
+func (c *Client) Readycheck(ctx context.Context) error {
+	return c.doAttempts(ctx, 1, http.MethodGet, "/api/readycheck", nil, nil, &HealthStatus{})
+}
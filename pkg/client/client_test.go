@@ -0,0 +1,275 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/apperror"
+	"github.com/zaharinea/go-example/pkg/client"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/handler"
+	"github.com/zaharinea/go-example/pkg/service"
+	"github.com/zaharinea/go-example/pkg/testkit"
+)
+
+var noRetry = client.WithRetry(client.Retry{MaxAttempts: 1})
+
+type ClientSuite struct {
+	testkit.Suite
+	ctx    context.Context
+	server *httptest.Server
+	client *client.Client
+}
+
+func (s *ClientSuite) SetupSuite() {
+	s.Suite.SetupSuite()
+	s.ctx = context.Background()
+	s.server = httptest.NewServer(s.Kit.App.Engine)
+	s.client = client.NewClient(s.server.URL, noRetry)
+}
+
+func (s *ClientSuite) TearDownSuite() {
+	s.server.Close()
+}
+
+func (s *ClientSuite) createUser(name string, accountExternalID string) *client.User {
+	user, err := s.client.CreateUser(s.ctx, client.CreateUserRequest{Name: name, AccountExternalID: accountExternalID})
+	s.Require().NoError(err)
+	return user
+}
+
+func (s *ClientSuite) TestUserLifecycle() {
+	created := s.createUser("user1", "")
+	s.Require().Equal(&client.User{
+		ID:        "000000000000000000000001",
+		Name:      "user1",
+		CreatedAt: testkit.StartTime,
+		UpdatedAt: testkit.StartTime,
+	}, created)
+
+	user, err := s.client.GetUser(s.ctx, created.ID)
+	s.Require().NoError(err)
+	s.Require().Equal(created, user)
+
+	s.Kit.Clock.Advance(time.Hour)
+	updated, err := s.client.UpdateUser(s.ctx, created.ID, client.UpdateUserRequest{Name: "user2"})
+	s.Require().NoError(err)
+	s.Require().Equal("user2", updated.Name)
+	s.Require().Equal(testkit.StartTime.Add(time.Hour), updated.UpdatedAt)
+
+	users, err := s.client.ListUsers(s.ctx, client.Page{})
+	s.Require().NoError(err)
+	s.Require().Equal([]*client.User{updated}, users)
+
+	s.Require().NoError(s.client.DeleteUser(s.ctx, created.ID))
+	_, err = s.client.GetUser(s.ctx, created.ID)
+	s.Require().True(errors.Is(err, service.ErrUserNotFound))
+}
+
+func (s *ClientSuite) TestNotFoundError() {
+	_, err := s.client.GetUser(client.WithRequestID(s.ctx, "request-1"), "5fbaeab741e97bef8525d6ab")
+
+	var clientErr *client.Error
+	s.Require().True(errors.As(err, &clientErr))
+	s.Require().Equal(http.StatusNotFound, clientErr.Status)
+	s.Require().Equal("user_not_found", clientErr.Code)
+	s.Require().Equal("request-1", clientErr.RequestID)
+	s.Require().Equal(apperror.KindNotFound, apperror.KindOf(err))
+	s.Require().Equal("go-example: 404 user_not_found: Not found user (request_id=request-1)", err.Error())
+}
+
+func (s *ClientSuite) TestValidationError() {
+	_, err := s.client.CreateUser(s.ctx, client.CreateUserRequest{})
+
+	s.Require().Equal(apperror.KindValidation, apperror.KindOf(err))
+	s.Require().Equal([]apperror.FieldError{{Field: "name", Code: "required", Message: "name is required"}}, apperror.From(err).Fields)
+}
+
+func (s *ClientSuite) TestUnknownAccountError() {
+	_, err := s.client.CreateUser(s.ctx, client.CreateUserRequest{Name: "user1", AccountExternalID: "1"})
+	s.Require().True(errors.Is(err, service.ErrUnknownAccount))
+}
+
+func (s *ClientSuite) TestUsersIterator() {
+	var ids []string
+	for _, name := range []string{"user1", "user2", "user3", "user4"} {
+		ids = append(ids, s.createUser(name, "").ID)
+	}
+
+	for _, pageSize := range []int64{0, 1, 2, 3, 4} {
+		var iterated []string
+		it := s.client.Users(pageSize)
+		for it.Next(s.ctx) {
+			iterated = append(iterated, it.User().ID)
+		}
+		s.Require().NoError(it.Err())
+		s.Require().Equal(ids, iterated, "page size %d", pageSize)
+		s.Require().False(it.Next(s.ctx))
+	}
+}
+
+func (s *ClientSuite) TestAccountUsersIterator() {
+	s.Require().True(s.Kit.Deliver("go-example-accounts", `{"external_id":"1","name":"account1","updated_at":"2020-11-21T00:00:00.000Z"}`))
+	user := s.createUser("user1", "1")
+	s.createUser("user2", "")
+
+	it := s.client.AccountUsers("1", 0)
+	s.Require().True(it.Next(s.ctx))
+	s.Require().Equal(user, it.User())
+	s.Require().False(it.Next(s.ctx))
+	s.Require().NoError(it.Err())
+}
+
+func (s *ClientSuite) TestIteratorError() {
+	it := client.NewClient(s.server.URL+"/unknown", noRetry).Users(0)
+	s.Require().False(it.Next(s.ctx))
+	s.Require().Equal(apperror.KindNotFound, apperror.KindOf(it.Err()))
+}
+
+func (s *ClientSuite) TestHealthChecks() {
+	s.Require().NoError(s.client.Healthcheck(s.ctx))
+	s.Require().NoError(s.client.Readycheck(s.ctx))
+
+	s.Kit.App.Handlers.SetReady(false)
+	err := s.client.Readycheck(s.ctx)
+	s.Require().Equal(apperror.KindUnavailable, apperror.KindOf(err))
+}
+
+func TestClientSuite(t *testing.T) {
+	suite.Run(t, new(ClientSuite))
+}
+
+func TestTenant(t *testing.T) {
+	kit := testkit.New(func(c *config.Config) { c.TenantRequired = true })
+	server := httptest.NewServer(kit.App.Engine)
+	defer server.Close()
+	ctx := context.Background()
+
+	_, err := client.NewClient(server.URL, noRetry).ListUsers(ctx, client.Page{})
+	require.Equal(t, apperror.KindUnauthorized, apperror.KindOf(err))
+
+	_, err = kit.Repos.Account.CreateOrUpdate(ctx, domain.Account{ExternalID: "1", Name: "account1"}, true)
+	require.NoError(t, err)
+	user, err := client.NewClient(server.URL, noRetry, client.WithTenantID("1")).CreateUser(ctx, client.CreateUserRequest{Name: "user1"})
+	require.NoError(t, err)
+	require.Equal(t, "1", user.AccountExternalID)
+}
+
+// flakyServer fails the first failures requests with status and records request IDs
+type flakyServer struct {
+	mu         sync.Mutex
+	failures   int
+	status     int
+	requestIDs []string
+	handler    http.Handler
+}
+
+func (f *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requestIDs = append(f.requestIDs, r.Header.Get("X-Request-ID"))
+	fail := len(f.requestIDs) <= f.failures
+	f.mu.Unlock()
+
+	if fail {
+		w.WriteHeader(f.status)
+		return
+	}
+	f.handler.ServeHTTP(w, r)
+}
+
+func newFlakyServer(failures int, status int) (*flakyServer, *httptest.Server) {
+	flaky := &flakyServer{failures: failures, status: status, handler: testkit.New().App.Engine}
+	return flaky, httptest.NewServer(flaky)
+}
+
+var fastRetry = client.WithRetry(client.Retry{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+func TestRetryIdempotentCall(t *testing.T) {
+	flaky, server := newFlakyServer(2, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	_, err := client.NewClient(server.URL, fastRetry).ListUsers(context.Background(), client.Page{})
+	require.NoError(t, err)
+	require.Len(t, flaky.requestIDs, 3)
+	require.NotEmpty(t, flaky.requestIDs[0])
+	require.Equal(t, flaky.requestIDs[0], flaky.requestIDs[1])
+	require.Equal(t, flaky.requestIDs[0], flaky.requestIDs[2])
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	flaky, server := newFlakyServer(3, http.StatusBadGateway)
+	defer server.Close()
+
+	_, err := client.NewClient(server.URL, fastRetry).GetUser(context.Background(), "5fbaeab741e97bef8525d6ab")
+	var clientErr *client.Error
+	require.True(t, errors.As(err, &clientErr))
+	require.Equal(t, http.StatusBadGateway, clientErr.Status)
+	require.Equal(t, apperror.KindInternal, apperror.KindOf(err))
+	require.Len(t, flaky.requestIDs, 3)
+}
+
+func TestNoRetryOfCreate(t *testing.T) {
+	flaky, server := newFlakyServer(1, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	_, err := client.NewClient(server.URL, fastRetry).CreateUser(context.Background(), client.CreateUserRequest{Name: "user1"})
+	require.Equal(t, apperror.KindUnavailable, apperror.KindOf(err))
+	require.Len(t, flaky.requestIDs, 1)
+}
+
+func TestNoRetryOfClientError(t *testing.T) {
+	flaky, server := newFlakyServer(0, 0)
+	defer server.Close()
+
+	_, err := client.NewClient(server.URL, fastRetry).GetUser(context.Background(), "5fbaeab741e97bef8525d6ab")
+	require.Equal(t, apperror.KindNotFound, apperror.KindOf(err))
+	require.Len(t, flaky.requestIDs, 1)
+}
+
+func TestRetryStopsOnCanceledContext(t *testing.T) {
+	flaky, server := newFlakyServer(3, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c := client.NewClient(server.URL, client.WithRetry(client.Retry{MaxAttempts: 3, MinBackoff: time.Minute, MaxBackoff: time.Minute}))
+
+	start := time.Now()
+	_, err := c.ListUsers(ctx, client.Page{})
+	require.Equal(t, apperror.KindUnavailable, apperror.KindOf(err))
+	require.Less(t, int64(time.Since(start)), int64(time.Minute))
+	require.Len(t, flaky.requestIDs, 1)
+}
+
+// TestTypesMatchHandlers keeps JSON fields of the client types in sync with the handler types
+func TestTypesMatchHandlers(t *testing.T) {
+	for _, types := range [][2]interface{}{
+		{client.User{}, handler.ResponseUser{}},
+		{client.CreateUserRequest{}, handler.RequestCreateUser{}},
+		{client.UpdateUserRequest{}, handler.RequestUpdateUser{}},
+		{client.Problem{}, handler.ResponseProblem{}},
+		{client.HealthStatus{}, handler.ResponseHealthcheck{}},
+	} {
+		require.Equal(t, jsonFields(types[1]), jsonFields(types[0]), "%T", types[0])
+	}
+}
+
+func jsonFields(v interface{}) map[string]string {
+	fields := map[string]string{}
+	typ := reflect.TypeOf(v)
+	for i := 0; i < typ.NumField(); i++ {
+		name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		fields[name] = typ.Field(i).Type.String()
+	}
+	return fields
+}
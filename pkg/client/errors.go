@@ -0,0 +1,90 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/zaharinea/go-example/pkg/apperror"
+)
+
+const problemTypePrefix = "urn:go-example:problem:"
+
+// Problem is the RFC 7807 problem details object returned by the API for errors
+type Problem struct {
+	Type      string                `json:"type"`
+	Title     string                `json:"title"`
+	Status    int                   `json:"status"`
+	Detail    string                `json:"detail"`
+	Code      string                `json:"code"`
+	RequestID string                `json:"request_id,omitempty"`
+	Errors    []apperror.FieldError `json:"errors,omitempty"`
+}
+
+// Error is returned for responses with an error status. It unwraps to an *apperror.Error with the code of
+// the problem, so errors.Is(err, service.ErrUserNotFound) and apperror.KindOf(err) work as on the server.
+type Error struct {
+	Problem
+}
+
+// Error returns a message with the status, the code and the detail of the problem
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("go-example: %d %s", e.Status, e.Code)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.RequestID != "" {
+		msg += " (request_id=" + e.RequestID + ")"
+	}
+	return msg
+}
+
+// Unwrap returns the problem as an *apperror.Error
+func (e *Error) Unwrap() error {
+	return apperror.New(e.Kind(), e.Code, e.Detail).WithFields(e.Errors...)
+}
+
+// Kind returns the kind of the problem, responses without a problem are classified by the status
+func (e *Error) Kind() apperror.Kind {
+	if strings.HasPrefix(e.Type, problemTypePrefix) {
+		return apperror.Kind(strings.TrimPrefix(e.Type, problemTypePrefix))
+	}
+	if kind, ok := kindByStatus[e.Status]; ok {
+		return kind
+	}
+	if e.Status >= http.StatusInternalServerError {
+		return apperror.KindInternal
+	}
+	return apperror.KindValidation
+}
+
+var kindByStatus = map[int]apperror.Kind{
+	http.StatusBadRequest:            apperror.KindValidation,
+	http.StatusUnauthorized:          apperror.KindUnauthorized,
+	http.StatusForbidden:             apperror.KindForbidden,
+	http.StatusNotFound:              apperror.KindNotFound,
+	http.StatusMethodNotAllowed:      apperror.KindMethodNotAllowed,
+	http.StatusConflict:              apperror.KindConflict,
+	http.StatusRequestEntityTooLarge: apperror.KindPayloadTooLarge,
+	http.StatusTooManyRequests:       apperror.KindTooManyRequests,
+	http.StatusServiceUnavailable:    apperror.KindUnavailable,
+}
+
+// newError decodes the problem of the response, responses of proxies and health checks
+// which are not problems get the title of the status
+func newError(resp *http.Response) *Error {
+	var problem Problem
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxErrorBodyBytes)).Decode(&problem); err != nil || problem.Status == 0 {
+		problem = Problem{}
+	}
+	problem.Status = resp.StatusCode
+	if problem.Title == "" {
+		problem.Title = http.StatusText(resp.StatusCode)
+	}
+	if problem.RequestID == "" {
+		problem.RequestID = resp.Header.Get(requestIDHeaderName)
+	}
+	return &Error{Problem: problem}
+}
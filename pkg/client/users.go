@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// maxPageSize is the largest page served by the API
+const maxPageSize = 100
+
+// User of the API
+type User struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	AccountExternalID string    `json:"account_external_id,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// CreateUserRequest is the body of CreateUser
+type CreateUserRequest struct {
+	Name              string `json:"name"`
+	AccountExternalID string `json:"account_external_id,omitempty"`
+}
+
+// UpdateUserRequest is the body of UpdateUser
+type UpdateUserRequest struct {
+	Name              string `json:"name"`
+	AccountExternalID string `json:"account_external_id,omitempty"`
+}
+
+// Page selects a page of a list, zero Limit selects the default page size of the service
+type Page struct {
+	Limit  int64
+	Offset int64
+}
+
+func (p Page) query() url.Values {
+	query := url.Values{}
+	if p.Limit > 0 {
+		query.Set("limit", strconv.FormatInt(p.Limit, 10))
+	}
+	if p.Offset > 0 {
+		query.Set("offset", strconv.FormatInt(p.Offset, 10))
+	}
+	return query
+}
+
+type usersResponse struct {
+	Items []*User `json:"items"`
+}
+
+// CreateUser creates the user, the call is not retried
+func (c *Client) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	var user User
+	if err := c.do(ctx, http.MethodPost, "/api/users", nil, req, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListUsers returns the page of users
+func (c *Client) ListUsers(ctx context.Context, page Page) ([]*User, error) {
+	var resp usersResponse
+	if err := c.do(ctx, http.MethodGet, "/api/users", page.query(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// ListAccountUsers returns the page of users of the account
+func (c *Client) ListAccountUsers(ctx context.Context, accountExternalID string, page Page) ([]*User, error) {
+	var resp usersResponse
+	path := "/api/accounts/" + url.PathEscape(accountExternalID) + "/users"
+	if err := c.do(ctx, http.MethodGet, path, page.query(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// GetUser returns the user by ID
+func (c *Client) GetUser(ctx context.Context, userID string) (*User, error) {
+	var user User
+	if err := c.do(ctx, http.MethodGet, userPath(userID), nil, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateUser updates the user and returns it
+func (c *Client) UpdateUser(ctx context.Context, userID string, req UpdateUserRequest) (*User, error) {
+	var user User
+	if err := c.do(ctx, http.MethodPut, userPath(userID), nil, req, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteUser deletes the user by ID
+func (c *Client) DeleteUser(ctx context.Context, userID string) error {
+	return c.do(ctx, http.MethodDelete, userPath(userID), nil, nil, nil)
+}
+
+func userPath(userID string) string {
+	return "/api/users/" + url.PathEscape(userID)
+}
+
+// Users returns an iterator over all users, pageSize <= 0 or above 100 requests pages of 100 users
+func (c *Client) Users(pageSize int64) *UserIterator {
+	return newUserIterator(pageSize, c.ListUsers)
+}
+
+// AccountUsers returns an iterator over all users of the account, pageSize is as in Users
+func (c *Client) AccountUsers(accountExternalID string, pageSize int64) *UserIterator {
+	return newUserIterator(pageSize, func(ctx context.Context, page Page) ([]*User, error) {
+		return c.ListAccountUsers(ctx, accountExternalID, page)
+	})
+}
+
+// UserIterator iterates over users page by page, pages are requested by Next:
+//
+//	it := c.Users(0)
+//	for it.Next(ctx) {
+//		user := it.User()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+//
+// Users created or deleted during the iteration may be skipped or returned twice as pages are selected by offset.
+type UserIterator struct {
+	list     func(ctx context.Context, page Page) ([]*User, error)
+	pageSize int64
+	offset   int64
+	users    []*User
+	user     *User
+	last     bool
+	err      error
+}
+
+func newUserIterator(pageSize int64, list func(ctx context.Context, page Page) ([]*User, error)) *UserIterator {
+	if pageSize <= 0 || pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	return &UserIterator{list: list, pageSize: pageSize}
+}
+
+// Next advances to the next user, returns false when there are no more users or a request failed
+func (it *UserIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.users) == 0 {
+		if it.last {
+			it.user = nil
+			return false
+		}
+		users, err := it.list(ctx, Page{Limit: it.pageSize, Offset: it.offset})
+		if err != nil {
+			it.err, it.user = err, nil
+			return false
+		}
+		it.offset += int64(len(users))
+		it.last = int64(len(users)) < it.pageSize
+		it.users = users
+		if len(users) == 0 {
+			it.user = nil
+			return false
+		}
+	}
+	it.user, it.users = it.users[0], it.users[1:]
+	return true
+}
+
+// User returns the current user
+func (it *UserIterator) User() *User {
+	return it.user
+}
+
+// Err returns the error of the failed request
+func (it *UserIterator) Err() error {
+	return it.err
+}
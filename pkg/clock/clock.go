@@ -0,0 +1,52 @@
+// Package clock abstracts the current time, so timestamps set by the application can be asserted in tests
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock returns the current time
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the Clock of the operating system
+type System struct{}
+
+// Now returns the current time
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// Fake is a Clock for tests, its time only moves by Advance and Set
+type Fake struct {
+	mu  sync.RWMutex
+	now time.Time
+}
+
+// NewFake returns a new Fake struct set to now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the time of the clock
+func (c *Fake) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.now
+}
+
+// Advance moves the clock by d
+func (c *Fake) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set sets the time of the clock
+func (c *Fake) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
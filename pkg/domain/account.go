@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// Account struct
+type Account struct {
+	ID         string     `json:"id"`
+	ExternalID string     `json:"external_id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+}
@@ -0,0 +1,19 @@
+// Package domain holds models and errors shared by services, handlers and repositories.
+// It does not depend on a storage driver, repositories translate driver types and errors at the boundary.
+package domain
+
+import "errors"
+
+// Errors returned by repositories
+var (
+	// ErrNotFound returned when the requested entity does not exist or is not visible to the tenant
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate returned when an entity with the same unique key already exists
+	ErrDuplicate = errors.New("duplicate")
+	// ErrStale returned when the stored entity is newer than or as new as the update
+	ErrStale = errors.New("stale update")
+	// ErrTenantMismatch returned on writes of another tenant's entities
+	ErrTenantMismatch = errors.New("tenant mismatch")
+	// ErrInvalidResumeToken returned when a stream of changes can not be resumed from the token
+	ErrInvalidResumeToken = errors.New("invalid resume token")
+)
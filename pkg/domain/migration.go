@@ -0,0 +1,13 @@
+package domain
+
+// MigrationStatus struct
+type MigrationStatus struct {
+	Version       uint `json:"version"`
+	TargetVersion uint `json:"target_version"`
+	Dirty         bool `json:"dirty"`
+}
+
+// Pending returns true if there are not applied migrations
+func (s *MigrationStatus) Pending() bool {
+	return s.Version < s.TargetVersion
+}
@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+// User struct
+type User struct {
+	ID                string     `json:"id"`
+	Name              string     `json:"name"`
+	AccountExternalID string     `json:"account_external_id,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	DeletedAt         *time.Time `json:"deleted_at,omitempty"`
+}
+
+// UpdateUser struct
+type UpdateUser struct {
+	Name              string    `json:"name"`
+	AccountExternalID string    `json:"account_external_id,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Types of UserChange
+const (
+	UserCreated = "created"
+	UserUpdated = "updated"
+	UserDeleted = "deleted"
+)
+
+// UserChange struct, User of a deleted user carries only its ID if the user was removed from storage
+type UserChange struct {
+	Type string
+	User *User
+	// Token resumes the stream of changes after this change
+	Token string
+}
@@ -0,0 +1,63 @@
+package domain
+
+import "time"
+
+// Types of events delivered to webhooks
+const (
+	EventUserCreated    = "user.created"
+	EventUserUpdated    = "user.updated"
+	EventUserDeleted    = "user.deleted"
+	EventAccountUpdated = "account.updated"
+	EventAccountDeleted = "account.deleted"
+)
+
+// Statuses of WebhookDelivery
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook struct, a subscription of URL to events
+type Webhook struct {
+	ID         string
+	URL        string
+	EventTypes []string
+	// Secret signs payloads, it is never returned by the API
+	Secret string
+	// AccountExternalID is the tenant of the webhook, webhooks of a tenant get events of its account and users only,
+	// webhooks of no tenant get events of users without an account only
+	AccountExternalID string
+	Enabled           bool
+	// Failures is the number of failed delivery attempts in a row
+	Failures   int64
+	DisabledAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// UpdateWebhook struct, an empty Secret keeps the current one, Enabled nil keeps the current state
+type UpdateWebhook struct {
+	URL        string
+	EventTypes []string
+	Secret     string
+	// Enabled set to true resets failures of the webhook
+	Enabled *bool
+}
+
+// WebhookDelivery struct, the delivery of an event to a webhook and the result of its last attempt
+type WebhookDelivery struct {
+	ID        string
+	WebhookID string
+	EventType string
+	// Payload is the JSON body sent to the webhook
+	Payload        string
+	Status         string
+	Attempts       int64
+	NextAttemptAt  time.Time
+	LastAttemptAt  *time.Time
+	ResponseStatus int
+	Error          string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
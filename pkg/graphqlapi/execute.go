@@ -0,0 +1,152 @@
+package graphqlapi
+
+import (
+	"context"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/sirupsen/logrus"
+	"github.com/zaharinea/go-example/pkg/apperror"
+)
+
+// Codes of errors rejecting the query, errors of resolvers carry the code of the apperror as the HTTP API
+const (
+	CodeInvalidQuery    = "invalid_query"
+	CodeQueryTooDeep    = "query_too_deep"
+	CodeQueryTooComplex = "query_too_complex"
+)
+
+// Request struct
+type Request struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Response struct, Data is omitted when the query is rejected before execution
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Error struct
+type Error struct {
+	Message    string          `json:"message"`
+	Locations  []Location      `json:"locations,omitempty"`
+	Path       []interface{}   `json:"path,omitempty"`
+	Extensions ErrorExtensions `json:"extensions"`
+}
+
+// Location struct
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// ErrorExtensions struct, the fields match the problem details of the HTTP API
+type ErrorExtensions struct {
+	Code      string                `json:"code"`
+	RequestID string                `json:"request_id,omitempty"`
+	Errors    []apperror.FieldError `json:"errors,omitempty"`
+}
+
+// Options struct
+type Options struct {
+	// MaxDepth is the deepest allowed nesting of fields
+	MaxDepth int
+	// MaxComplexity is the largest allowed number of fields, fields inside a list count once per item of a page
+	MaxComplexity int
+	// DefaultPageSize is the size of pages of list fields without a valid limit
+	DefaultPageSize int64
+	RequestID       string
+}
+
+type optionsKey struct{}
+
+func optionsFromContext(ctx context.Context) Options {
+	opts, _ := ctx.Value(optionsKey{}).(Options)
+	return opts
+}
+
+// Execute validates and executes the request, errors of the query and of resolvers are returned in the Response.
+// Internal errors are logged and sent to Sentry but their details are hidden as by ErrorMiddleware of the HTTP API
+func (s *Schema) Execute(ctx context.Context, req Request, opts Options) *Response {
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		return &Response{Errors: s.errors(req, opts, gqlerrors.FormatErrors(err))}
+	}
+	if validation := graphql.ValidateDocument(&s.schema, doc, nil); !validation.IsValid {
+		return &Response{Errors: s.errors(req, opts, validation.Errors)}
+	}
+	if limitErr := checkLimits(doc, req, opts); limitErr != nil {
+		limitErr.Extensions.RequestID = opts.RequestID
+		return &Response{Errors: []*Error{limitErr}}
+	}
+
+	ctx = context.WithValue(ctx, optionsKey{}, opts)
+	ctx = withAccountLoader(ctx, newAccountLoader(s.services.Account))
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+	return &Response{Data: result.Data, Errors: s.errors(req, opts, result.Errors)}
+}
+
+func (s *Schema) errors(req Request, opts Options, formatted []gqlerrors.FormattedError) []*Error {
+	if len(formatted) == 0 {
+		return nil
+	}
+
+	errs := make([]*Error, len(formatted))
+	for i, formattedErr := range formatted {
+		err := &Error{
+			Message:    formattedErr.Message,
+			Path:       formattedErr.Path,
+			Extensions: ErrorExtensions{Code: CodeInvalidQuery, RequestID: opts.RequestID},
+		}
+		for _, location := range formattedErr.Locations {
+			err.Locations = append(err.Locations, Location{Line: location.Line, Column: location.Column})
+		}
+
+		if len(formattedErr.Path) > 0 {
+			// errors of fields are returned by resolvers or are results violating the schema
+			original := originalError(formattedErr)
+			if original == nil {
+				original = formattedErr
+			}
+			appErr := apperror.From(original)
+			if appErr.Kind == apperror.KindInternal {
+				logrus.Errorf("GraphQL request failed: operation=%s, path=%v, request_id=%s, error=%s",
+					req.OperationName, formattedErr.Path, opts.RequestID, original)
+				sentry.CurrentHub().CaptureException(original)
+			}
+			err.Message = appErr.Message
+			err.Extensions.Code = appErr.Code
+			err.Extensions.Errors = appErr.Fields
+		}
+		errs[i] = err
+	}
+	return errs
+}
+
+// originalError returns the error returned by a resolver, nil for errors of graphql-go itself
+func originalError(err error) error {
+	for {
+		switch e := err.(type) {
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			return err
+		}
+		if err == nil {
+			return nil
+		}
+	}
+}
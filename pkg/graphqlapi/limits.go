@@ -0,0 +1,113 @@
+package graphqlapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// listFields are fields returning pages, fields selected inside them count once per item of a page
+var listFields = map[string]bool{"users": true, "accounts": true}
+
+// checkLimits returns an error if the operation is deeper or more complex than opts allow.
+// Introspection fields are not counted, the schema is static and small.
+func checkLimits(doc *ast.Document, req Request, opts Options) *Error {
+	m := &measurer{fragments: map[string]*ast.FragmentDefinition{}, req: req, opts: opts}
+	var operations []*ast.OperationDefinition
+	for _, definition := range doc.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			m.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if req.OperationName == "" || (definition.Name != nil && definition.Name.Value == req.OperationName) {
+				operations = append(operations, definition)
+			}
+		}
+	}
+
+	for _, operation := range operations {
+		depth, complexity := m.selectionSet(operation.SelectionSet)
+		if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+			return &Error{
+				Message:    fmt.Sprintf("Query depth %d exceeds the limit of %d", depth, opts.MaxDepth),
+				Extensions: ErrorExtensions{Code: CodeQueryTooDeep},
+			}
+		}
+		if opts.MaxComplexity > 0 && complexity > opts.MaxComplexity {
+			return &Error{
+				Message:    fmt.Sprintf("Query complexity %d exceeds the limit of %d", complexity, opts.MaxComplexity),
+				Extensions: ErrorExtensions{Code: CodeQueryTooComplex},
+			}
+		}
+	}
+	return nil
+}
+
+type measurer struct {
+	fragments map[string]*ast.FragmentDefinition
+	req       Request
+	opts      Options
+}
+
+// selectionSet returns the depth and the complexity of the selection set, fragments are expanded.
+// Validation rejects cycles of fragments before the limits are checked.
+func (m *measurer) selectionSet(set *ast.SelectionSet) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	depth, complexity := 0, 0
+	for _, selection := range set.Selections {
+		var d, c int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name.Value, "__") {
+				continue
+			}
+			d, c = m.selectionSet(selection.SelectionSet)
+			d++
+			if listFields[selection.Name.Value] {
+				c *= m.pageSize(selection)
+			}
+			c++
+		case *ast.InlineFragment:
+			d, c = m.selectionSet(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			if fragment, ok := m.fragments[selection.Name.Value]; ok {
+				d, c = m.selectionSet(fragment.SelectionSet)
+			}
+		}
+		if d > depth {
+			depth = d
+		}
+		complexity += c
+	}
+	return depth, complexity
+}
+
+// pageSize returns the page size of a list field as pageArgs does
+func (m *measurer) pageSize(field *ast.Field) int {
+	limit := 0
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			limit, _ = strconv.Atoi(value.Value)
+		case *ast.Variable:
+			switch variable := m.req.Variables[value.Name.Value].(type) {
+			case float64:
+				limit = int(variable)
+			case int:
+				limit = variable
+			}
+		}
+	}
+	if limit <= 0 || limit > maxPageSize {
+		return int(m.opts.DefaultPageSize)
+	}
+	return limit
+}
@@ -0,0 +1,52 @@
+package graphqlapi
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLimits(t *testing.T) {
+	opts := Options{MaxDepth: 3, MaxComplexity: 50, DefaultPageSize: 10}
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		code      string
+	}{
+		{"fields", `{ user(id: "1") { id name account { name } } }`, nil, ""},
+		{"too deep", `{ user(id: "1") { account { users { id } } } }`, nil, CodeQueryTooDeep},
+		{"list of default page size", `{ users { id name account { name } } }`, nil, ""},
+		{"list of limit", `{ users(limit: 20) { id name account { name } } }`, nil, CodeQueryTooComplex},
+		{"limit from variable", `query($limit: Int) { users(limit: $limit) { id name } }`, map[string]interface{}{"limit": float64(30)}, CodeQueryTooComplex},
+		{"invalid limit", `{ users(limit: 1000) { id name } }`, nil, ""},
+		{"fragments", `{ users { ...user } } fragment user on User { id ... on User { name account { name } } }`, nil, ""},
+		{"nested fragments", `{ user(id: "1") { ...user } } fragment user on User { account { ...account } } fragment account on Account { users { id } }`, nil, CodeQueryTooDeep},
+		{"introspection", `{ __schema { types { fields { type { ofType { name } } } } } }`, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: tt.query})
+			require.NoError(t, err)
+
+			limitErr := checkLimits(doc, Request{Query: tt.query, Variables: tt.variables}, opts)
+			if tt.code == "" {
+				require.Nil(t, limitErr)
+			} else {
+				require.NotNil(t, limitErr)
+				require.Equal(t, tt.code, limitErr.Extensions.Code)
+			}
+		})
+	}
+}
+
+func TestCheckLimitsOfNamedOperation(t *testing.T) {
+	query := `query small { user(id: "1") { id } } query deep { user(id: "1") { account { users { account { name } } } } }`
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	require.NoError(t, err)
+
+	opts := Options{MaxDepth: 3, MaxComplexity: 100, DefaultPageSize: 10}
+	require.Nil(t, checkLimits(doc, Request{Query: query, OperationName: "small"}, opts))
+	require.Equal(t, "Query depth 5 exceeds the limit of 3", checkLimits(doc, Request{Query: query, OperationName: "deep"}, opts).Message)
+}
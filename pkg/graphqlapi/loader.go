@@ -0,0 +1,86 @@
+package graphqlapi
+
+import (
+	"context"
+	"sync"
+
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/service"
+)
+
+// accountLoader batches lookups of accounts by external ID within a request.
+// load only queues the external ID and returns a thunk, graphql-go calls the thunks of a level of the response
+// after all its fields are resolved, so the first called thunk loads the accounts of all queued IDs at once.
+type accountLoader struct {
+	mu       sync.Mutex
+	accounts service.IAccountService
+	queued   []string
+	// loaded accounts by external ID, nil for missing accounts
+	loaded map[string]*domain.Account
+	errs   map[string]error
+}
+
+func newAccountLoader(accounts service.IAccountService) *accountLoader {
+	return &accountLoader{accounts: accounts, loaded: map[string]*domain.Account{}, errs: map[string]error{}}
+}
+
+type accountLoaderKey struct{}
+
+func withAccountLoader(ctx context.Context, loader *accountLoader) context.Context {
+	return context.WithValue(ctx, accountLoaderKey{}, loader)
+}
+
+func accountLoaderFromContext(ctx context.Context) *accountLoader {
+	return ctx.Value(accountLoaderKey{}).(*accountLoader)
+}
+
+// load queues the external ID, the returned thunk returns the account or nil if it does not exist
+func (l *accountLoader) load(ctx context.Context, externalID string) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, ok := l.loaded[externalID]; !ok && !l.isQueued(externalID) {
+		l.queued = append(l.queued, externalID)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if _, ok := l.loaded[externalID]; !ok {
+			l.dispatch(ctx)
+		}
+		if err := l.errs[externalID]; err != nil {
+			return nil, err
+		}
+		if account := l.loaded[externalID]; account != nil {
+			return account, nil
+		}
+		return nil, nil
+	}
+}
+
+func (l *accountLoader) isQueued(externalID string) bool {
+	for _, queued := range l.queued {
+		if queued == externalID {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch loads the queued accounts, it is called with mu held
+func (l *accountLoader) dispatch(ctx context.Context) {
+	externalIDs := l.queued
+	l.queued = nil
+
+	accounts, err := l.accounts.ListByExternalIDs(ctx, externalIDs)
+	for _, externalID := range externalIDs {
+		l.loaded[externalID] = nil
+		if err != nil {
+			l.errs[externalID] = err
+		}
+	}
+	for _, account := range accounts {
+		l.loaded[account.ExternalID] = account
+	}
+}
@@ -0,0 +1,51 @@
+package graphqlapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository/memory"
+	"github.com/zaharinea/go-example/pkg/service"
+)
+
+// countingAccounts counts batches of account lookups
+type countingAccounts struct {
+	service.IAccountService
+	batches [][]string
+}
+
+func (a *countingAccounts) ListByExternalIDs(ctx context.Context, accountExternalIDs []string) ([]*domain.Account, error) {
+	a.batches = append(a.batches, accountExternalIDs)
+	return a.IAccountService.ListByExternalIDs(ctx, accountExternalIDs)
+}
+
+func TestAccountsAreLoadedInBatches(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.NewRepository(clock.NewFake(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)), idgen.NewSequence())
+	services := service.NewService(repos)
+	accounts := &countingAccounts{IAccountService: services.Account}
+	services.Account = accounts
+
+	for _, externalID := range []string{"1", "2"} {
+		_, err := repos.Account.CreateOrUpdate(ctx, domain.Account{ExternalID: externalID, Name: "account" + externalID}, true)
+		require.NoError(t, err)
+	}
+	for _, accountExternalID := range []string{"1", "2", "", "1", "3"} {
+		require.NoError(t, repos.User.Create(ctx, &domain.User{Name: "user", AccountExternalID: accountExternalID}))
+	}
+
+	schema := NewSchema(services)
+	resp := schema.Execute(ctx, Request{Query: `{ users { account { externalId } } accounts { users { account { name } } } }`}, Options{DefaultPageSize: 25})
+	require.Empty(t, resp.Errors)
+	require.Equal(t, [][]string{{"1", "2", "3"}}, accounts.batches)
+
+	accounts.batches = nil
+	resp = schema.Execute(ctx, Request{Query: `{ accounts { users { account { name } } } }`}, Options{DefaultPageSize: 25})
+	require.Empty(t, resp.Errors)
+	require.Equal(t, [][]string{{"1", "2"}}, accounts.batches)
+}
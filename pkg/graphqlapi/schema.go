@@ -0,0 +1,249 @@
+// Package graphqlapi serves the GraphQL API over users and accounts, it is the GraphQL counterpart of the HTTP handlers
+// in pkg/handler. Queries and mutations are resolved by the services shared with the other APIs.
+package graphqlapi
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/zaharinea/go-example/pkg/apperror"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/service"
+)
+
+// maxPageSize is the largest page of a list field, other values of limit select the default page size
+const maxPageSize = 100
+
+var errInvalidRequest = apperror.Validation("invalid_request", "Request is invalid")
+
+// Schema struct
+type Schema struct {
+	schema   graphql.Schema
+	services *service.Service
+}
+
+// NewSchema returns a new Schema struct resolving fields with services.
+// It panics if the schema is invalid as the definition does not depend on input.
+func NewSchema(services *service.Service) *Schema {
+	s := &Schema{services: services}
+
+	var userType, accountType *graphql.Object
+	pageArgs := graphql.FieldConfigArgument{
+		"limit":  &graphql.ArgumentConfig{Type: graphql.Int, Description: "page size from 1 to 100, other values select the default page size"},
+		"offset": &graphql.ArgumentConfig{Type: graphql.Int, Description: "number of skipped items, negative values are ignored"},
+	}
+
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":   &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: userField(func(u *domain.User) interface{} { return u.ID })},
+				"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: userField(func(u *domain.User) interface{} { return u.Name })},
+				"accountExternalId": &graphql.Field{Type: graphql.String, Resolve: userField(func(u *domain.User) interface{} {
+					return optional(u.AccountExternalID)
+				})},
+				"account": &graphql.Field{
+					Type:        accountType,
+					Description: "null if the user has no account, accounts of the users of a response are loaded at once",
+					Resolve:     s.resolveUserAccount,
+				},
+				"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: userField(func(u *domain.User) interface{} { return u.CreatedAt })},
+				"updatedAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: userField(func(u *domain.User) interface{} { return u.UpdatedAt })},
+			}
+		}),
+	})
+
+	accountType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Account",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"externalId": &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: accountField(func(a *domain.Account) interface{} { return a.ExternalID })},
+				"name":       &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: accountField(func(a *domain.Account) interface{} { return a.Name })},
+				"createdAt":  &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: accountField(func(a *domain.Account) interface{} { return a.CreatedAt })},
+				"updatedAt":  &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: accountField(func(a *domain.Account) interface{} { return a.UpdatedAt })},
+				"users": &graphql.Field{
+					Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType))),
+					Args:    pageArgs,
+					Resolve: s.resolveAccountUsers,
+				},
+			}
+		}),
+	})
+
+	userInputFields := graphql.InputObjectConfigFieldMap{
+		"name":              &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"accountExternalId": &graphql.InputObjectFieldConfig{Type: graphql.String},
+	}
+	createUserInput := graphql.NewInputObject(graphql.InputObjectConfig{Name: "CreateUserInput", Fields: userInputFields})
+	updateUserInput := graphql.NewInputObject(graphql.InputObjectConfig{Name: "UpdateUserInput", Fields: userInputFields})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type:    userType,
+				Args:    graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: s.resolveUser,
+			},
+			"users": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType))),
+				Args: graphql.FieldConfigArgument{
+					"limit":             pageArgs["limit"],
+					"offset":            pageArgs["offset"],
+					"accountExternalId": &graphql.ArgumentConfig{Type: graphql.String, Description: "only users of the account"},
+				},
+				Resolve: s.resolveUsers,
+			},
+			"account": &graphql.Field{
+				Type:    accountType,
+				Args:    graphql.FieldConfigArgument{"externalId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: s.resolveAccount,
+			},
+			"accounts": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(accountType))),
+				Args:    pageArgs,
+				Resolve: s.resolveAccounts,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser": &graphql.Field{
+				Type:    graphql.NewNonNull(userType),
+				Args:    graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createUserInput)}},
+				Resolve: s.resolveCreateUser,
+			},
+			"updateUser": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateUserInput)},
+				},
+				Resolve: s.resolveUpdateUser,
+			},
+			"deleteUser": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.ID),
+				Description: "returns the ID of the deleted user",
+				Args:        graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve:     s.resolveDeleteUser,
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+	if err != nil {
+		panic(err)
+	}
+	s.schema = schema
+	return s
+}
+
+func (s *Schema) resolveUser(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	return s.services.User.GetByID(p.Context, id)
+}
+
+func (s *Schema) resolveUsers(p graphql.ResolveParams) (interface{}, error) {
+	limit, offset := pageArgs(p)
+	if accountExternalID, ok := p.Args["accountExternalId"].(string); ok && accountExternalID != "" {
+		return s.services.User.ListByAccount(p.Context, accountExternalID, limit, offset)
+	}
+	return s.services.User.List(p.Context, limit, offset)
+}
+
+func (s *Schema) resolveUserAccount(p graphql.ResolveParams) (interface{}, error) {
+	user := p.Source.(*domain.User)
+	if user.AccountExternalID == "" {
+		return nil, nil
+	}
+	return accountLoaderFromContext(p.Context).load(p.Context, user.AccountExternalID), nil
+}
+
+func (s *Schema) resolveAccount(p graphql.ResolveParams) (interface{}, error) {
+	externalID, _ := p.Args["externalId"].(string)
+	return s.services.Account.GetByExternalID(p.Context, externalID)
+}
+
+func (s *Schema) resolveAccounts(p graphql.ResolveParams) (interface{}, error) {
+	limit, offset := pageArgs(p)
+	return s.services.Account.List(p.Context, limit, offset)
+}
+
+func (s *Schema) resolveAccountUsers(p graphql.ResolveParams) (interface{}, error) {
+	account := p.Source.(*domain.Account)
+	limit, offset := pageArgs(p)
+	return s.services.User.ListByAccount(p.Context, account.ExternalID, limit, offset)
+}
+
+func (s *Schema) resolveCreateUser(p graphql.ResolveParams) (interface{}, error) {
+	input, _ := p.Args["input"].(map[string]interface{})
+	user := domain.User{}
+	user.Name, _ = input["name"].(string)
+	user.AccountExternalID, _ = input["accountExternalId"].(string)
+	if user.Name == "" {
+		return nil, requiredError("input.name")
+	}
+
+	if err := s.services.User.Create(p.Context, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *Schema) resolveUpdateUser(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	input, _ := p.Args["input"].(map[string]interface{})
+	update := domain.UpdateUser{}
+	update.Name, _ = input["name"].(string)
+	update.AccountExternalID, _ = input["accountExternalId"].(string)
+	if update.Name == "" {
+		return nil, requiredError("input.name")
+	}
+
+	return s.services.User.UpdateAndReturn(p.Context, id, update)
+}
+
+func (s *Schema) resolveDeleteUser(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	if err := s.services.User.DeleteByID(p.Context, id); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// pageArgs returns limit and offset of a list field as the HTTP API reads them from the query string
+func pageArgs(p graphql.ResolveParams) (int64, int64) {
+	limit, _ := p.Args["limit"].(int)
+	offset, _ := p.Args["offset"].(int)
+	if limit <= 0 || limit > maxPageSize {
+		limit = int(optionsFromContext(p.Context).DefaultPageSize)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return int64(limit), int64(offset)
+}
+
+func userField(get func(user *domain.User) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(*domain.User)), nil
+	}
+}
+
+func accountField(get func(account *domain.Account) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(*domain.Account)), nil
+	}
+}
+
+// optional returns nil for an empty string so that it is rendered as null
+func optional(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func requiredError(field string) error {
+	return errInvalidRequest.WithFields(apperror.FieldError{Field: field, Code: "required", Message: field + " is required"})
+}
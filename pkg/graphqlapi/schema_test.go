@@ -0,0 +1,163 @@
+package graphqlapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/graphqlapi"
+	"github.com/zaharinea/go-example/pkg/testkit"
+)
+
+type SchemaSuite struct {
+	testkit.Suite
+}
+
+func (s *SchemaSuite) SetupSuite() {
+	s.Configure = []func(c *config.Config){func(c *config.Config) {
+		c.GraphQLMaxDepth = 4
+		c.GraphQLMaxComplexity = 100
+	}}
+	s.Suite.SetupSuite()
+}
+
+func (s *SchemaSuite) do(query string, variables map[string]interface{}) *graphqlapi.Response {
+	body, err := json.Marshal(graphqlapi.Request{Query: query, Variables: variables})
+	s.Require().NoError(err)
+	w := s.Kit.Do("POST", "/api/graphql", string(body), nil)
+	s.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+	var resp graphqlapi.Response
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &resp))
+	return &resp
+}
+
+// data returns the data of a response without errors as JSON
+func (s *SchemaSuite) data(query string, variables map[string]interface{}) string {
+	resp := s.do(query, variables)
+	s.Require().Empty(resp.Errors)
+	data, err := json.Marshal(resp.Data)
+	s.Require().NoError(err)
+	return string(data)
+}
+
+func (s *SchemaSuite) deliverAccount(externalID string) {
+	s.Require().True(s.Kit.Deliver("go-example-accounts",
+		`{"external_id":"`+externalID+`","name":"account`+externalID+`","updated_at":"2020-11-21T00:00:00.000Z"}`))
+}
+
+func (s *SchemaSuite) createUser(name string, accountExternalID string) string {
+	input := map[string]interface{}{"name": name}
+	if accountExternalID != "" {
+		input["accountExternalId"] = accountExternalID
+	}
+	resp := s.do(`mutation($input: CreateUserInput!) { createUser(input: $input) { id } }`, map[string]interface{}{"input": input})
+	s.Require().Empty(resp.Errors)
+	return resp.Data.(map[string]interface{})["createUser"].(map[string]interface{})["id"].(string)
+}
+
+func (s *SchemaSuite) TestUserLifecycle() {
+	s.deliverAccount("1")
+
+	data := s.data(`mutation { createUser(input: {name: "user1", accountExternalId: "1"}) { id name accountExternalId createdAt } }`, nil)
+	s.Require().JSONEq(`{"createUser":{"id":"000000000000000000000002","name":"user1","accountExternalId":"1","createdAt":"2020-12-01T00:00:00Z"}}`, data)
+
+	data = s.data(`query($id: ID!) { user(id: $id) { name account { externalId name } } }`, map[string]interface{}{"id": "000000000000000000000002"})
+	s.Require().JSONEq(`{"user":{"name":"user1","account":{"externalId":"1","name":"account1"}}}`, data)
+
+	data = s.data(`mutation { updateUser(id: "000000000000000000000002", input: {name: "user2"}) { name accountExternalId } }`, nil)
+	s.Require().JSONEq(`{"updateUser":{"name":"user2","accountExternalId":"1"}}`, data)
+
+	data = s.data(`mutation { deleteUser(id: "000000000000000000000002") }`, nil)
+	s.Require().JSONEq(`{"deleteUser":"000000000000000000000002"}`, data)
+
+	resp := s.do(`{ user(id: "000000000000000000000002") { name } }`, nil)
+	s.Require().Equal(map[string]interface{}{"user": nil}, resp.Data)
+	s.Require().Len(resp.Errors, 1)
+	s.Require().Equal("Not found user", resp.Errors[0].Message)
+	s.Require().Equal([]interface{}{"user"}, resp.Errors[0].Path)
+	s.Require().Equal(graphqlapi.ErrorExtensions{Code: "user_not_found", RequestID: "000000000000000000000005"}, resp.Errors[0].Extensions)
+}
+
+func (s *SchemaSuite) TestUsersWithAccounts() {
+	s.deliverAccount("1")
+	s.deliverAccount("2")
+	s.createUser("user1", "1")
+	s.createUser("user2", "2")
+	s.createUser("user3", "")
+	s.createUser("user4", "1")
+
+	data := s.data(`{ users { name account { externalId } } }`, nil)
+	s.Require().JSONEq(`{"users":[
+		{"name":"user1","account":{"externalId":"1"}},
+		{"name":"user2","account":{"externalId":"2"}},
+		{"name":"user3","account":null},
+		{"name":"user4","account":{"externalId":"1"}}
+	]}`, data)
+}
+
+func (s *SchemaSuite) TestPaginationAndFilters() {
+	s.deliverAccount("1")
+	s.createUser("user1", "1")
+	s.createUser("user2", "")
+	s.createUser("user3", "1")
+
+	s.Require().JSONEq(`{"users":[{"name":"user2"}]}`, s.data(`{ users(limit: 1, offset: 1) { name } }`, nil))
+	s.Require().JSONEq(`{"users":[{"name":"user1"},{"name":"user2"},{"name":"user3"}]}`, s.data(`{ users(limit: 0, offset: -1) { name } }`, nil))
+	s.Require().JSONEq(`{"users":[{"name":"user1"},{"name":"user3"}]}`, s.data(`{ users(accountExternalId: "1") { name } }`, nil))
+	s.Require().JSONEq(
+		`{"accounts":[{"externalId":"1","users":[{"name":"user3"}]}]}`,
+		s.data(`query($limit: Int) { accounts { externalId users(limit: $limit, offset: 1) { name } } }`, map[string]interface{}{"limit": 1}),
+	)
+
+	resp := s.do(`{ account(externalId: "2") { name } }`, nil)
+	s.Require().Equal("account_not_found", resp.Errors[0].Extensions.Code)
+	resp = s.do(`{ users(accountExternalId: "2") { name } }`, nil)
+	s.Require().Nil(resp.Data)
+	s.Require().Equal("account_not_found", resp.Errors[0].Extensions.Code)
+}
+
+func (s *SchemaSuite) TestValidationErrors() {
+	resp := s.do(`mutation { createUser(input: {name: ""}) { id } }`, nil)
+	s.Require().Nil(resp.Data)
+	s.Require().Len(resp.Errors, 1)
+	s.Require().Equal("invalid_request", resp.Errors[0].Extensions.Code)
+	s.Require().Equal("input.name is required", resp.Errors[0].Extensions.Errors[0].Message)
+
+	resp = s.do(`mutation { createUser(input: {name: "user1", accountExternalId: "1"}) { id } }`, nil)
+	s.Require().Equal("unknown_account", resp.Errors[0].Extensions.Code)
+	s.Require().Equal("account_external_id", resp.Errors[0].Extensions.Errors[0].Field)
+
+	resp = s.do(`{ users { password } }`, nil)
+	s.Require().Nil(resp.Data)
+	s.Require().Equal(`Cannot query field "password" on type "User".`, resp.Errors[0].Message)
+	s.Require().Equal([]graphqlapi.Location{{Line: 1, Column: 11}}, resp.Errors[0].Locations)
+	s.Require().Equal(graphqlapi.CodeInvalidQuery, resp.Errors[0].Extensions.Code)
+
+	resp = s.do(`{ users {`, nil)
+	s.Require().Equal(graphqlapi.CodeInvalidQuery, resp.Errors[0].Extensions.Code)
+
+	w := s.Kit.Do("POST", "/api/graphql", `{"variables":{}}`, nil)
+	s.Require().Equal(http.StatusBadRequest, w.Code)
+}
+
+func (s *SchemaSuite) TestLimits() {
+	resp := s.do(`{ users { account { users { account { name } } } } }`, nil)
+	s.Require().Nil(resp.Data)
+	s.Require().Equal("Query depth 5 exceeds the limit of 4", resp.Errors[0].Message)
+	s.Require().Equal(graphqlapi.CodeQueryTooDeep, resp.Errors[0].Extensions.Code)
+
+	// 1 + 25 * (1 + 1 + 1 + 1)
+	resp = s.do(`{ users { id name createdAt updatedAt } }`, nil)
+	s.Require().Equal("Query complexity 101 exceeds the limit of 100", resp.Errors[0].Message)
+	s.Require().Equal(graphqlapi.CodeQueryTooComplex, resp.Errors[0].Extensions.Code)
+
+	s.Require().JSONEq(`{"users":[]}`, s.data(`query($limit: Int) { users(limit: $limit) { id name createdAt updatedAt } }`, map[string]interface{}{"limit": 10}))
+	s.Require().Empty(s.do(`{ __schema { types { name fields { name type { name ofType { name ofType { name } } } } } } }`, nil).Errors)
+}
+
+func TestSchemaSuite(t *testing.T) {
+	suite.Run(t, new(SchemaSuite))
+}
@@ -0,0 +1,55 @@
+package grpcapi
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/zaharinea/go-example/pkg/apperror"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain of the google.rpc.ErrorInfo detail of errors, its reason is the apperror code
+const ErrorDomain = "go-example"
+
+var codeByKind = map[apperror.Kind]codes.Code{
+	apperror.KindValidation:       codes.InvalidArgument,
+	apperror.KindUnauthorized:     codes.Unauthenticated,
+	apperror.KindForbidden:        codes.PermissionDenied,
+	apperror.KindNotFound:         codes.NotFound,
+	apperror.KindMethodNotAllowed: codes.Unimplemented,
+	apperror.KindConflict:         codes.AlreadyExists,
+	apperror.KindPayloadTooLarge:  codes.ResourceExhausted,
+	apperror.KindTooManyRequests:  codes.ResourceExhausted,
+	apperror.KindUnavailable:      codes.Unavailable,
+	apperror.KindInternal:         codes.Internal,
+}
+
+// newStatus returns the status for err as the problem details of the HTTP API: the code is chosen by the kind,
+// the apperror code is sent in google.rpc.ErrorInfo and invalid fields in google.rpc.BadRequest
+func newStatus(err *apperror.Error, requestID string) *status.Status {
+	code, ok := codeByKind[err.Kind]
+	if !ok {
+		code = codes.Internal
+	}
+
+	st := status.New(code, err.Message)
+	info := &errdetails.ErrorInfo{Reason: err.Code, Domain: ErrorDomain}
+	if requestID != "" {
+		info.Metadata = map[string]string{"request_id": requestID}
+	}
+	details := []proto.Message{info}
+	if len(err.Fields) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, field := range err.Fields {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field: field.Field, Description: field.Message,
+			})
+		}
+		details = append(details, badRequest)
+	}
+
+	if withDetails, detailsErr := st.WithDetails(details...); detailsErr == nil {
+		return withDetails
+	}
+	return st
+}
@@ -0,0 +1,195 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/apperror"
+	"github.com/zaharinea/go-example/pkg/auth"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys, gRPC metadata keys are lowercase HTTP headers
+const (
+	requestIDMetadataKey     = "x-request-id"
+	tenantIDMetadataKey      = "x-tenant-id"
+	authorizationMetadataKey = "authorization"
+)
+
+// interceptor wraps a unary or a streaming call, next calls the method with ctx
+type interceptor func(ctx context.Context, method string, next func(ctx context.Context) error) error
+
+func (i interceptor) unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var resp interface{}
+		err := i(ctx, info.FullMethod, func(ctx context.Context) error {
+			var err error
+			resp, err = handler(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+}
+
+func (i interceptor) stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return i(ss.Context(), info.FullMethod, func(ctx context.Context) error {
+			return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		})
+	}
+}
+
+// serverStream replaces the context of the stream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID of the call
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// requestIDInterceptor takes the request ID from x-request-id or generates one and sends it back in the header
+func requestIDInterceptor(ids idgen.IDGenerator) interceptor {
+	return func(ctx context.Context, method string, next func(ctx context.Context) error) error {
+		requestID := metadataValue(ctx, requestIDMetadataKey)
+		if requestID == "" {
+			requestID = ids.NewID()
+		}
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadataKey, requestID))
+		return next(context.WithValue(ctx, requestIDKey{}, requestID))
+	}
+}
+
+// tenantInterceptor resolves the tenant from the JWT claim or x-tenant-id as TenantMiddleware of the HTTP API
+func tenantInterceptor(config *config.Config, clock clock.Clock) interceptor {
+	return func(ctx context.Context, method string, next func(ctx context.Context) error) error {
+		if method == healthCheckMethod || method == healthWatchMethod {
+			return next(ctx)
+		}
+
+		tenantID, err := auth.ResolveTenant(config, metadataValue(ctx, authorizationMetadataKey), metadataValue(ctx, tenantIDMetadataKey), clock.Now())
+		if err != nil {
+			return err
+		}
+		if tenantID != "" {
+			ctx = tenant.WithTenant(ctx, tenantID)
+		}
+		return next(ctx)
+	}
+}
+
+const (
+	healthCheckMethod = "/grpc.health.v1.Health/Check"
+	healthWatchMethod = "/grpc.health.v1.Health/Watch"
+)
+
+// errorInterceptor converts errors and panics to statuses, internal errors are logged and sent to Sentry
+// but their details are hidden from clients as by ErrorMiddleware of the HTTP API.
+// Errors of a cancelled or expired context become Canceled and DeadlineExceeded and are not reported
+func errorInterceptor() interceptor {
+	return func(ctx context.Context, method string, next func(ctx context.Context) error) (err error) {
+		requestID := RequestIDFromContext(ctx)
+		defer func() {
+			if value := recover(); value != nil {
+				err = fmt.Errorf("panic: %v", value)
+			}
+			if err == nil {
+				return
+			}
+			if _, ok := status.FromError(err); ok {
+				// statuses of gRPC itself, e.g. a cancelled stream
+				return
+			}
+			// the client went away or ran out of time, it is not a failure of the server
+			if errors.Is(err, context.Canceled) {
+				err = status.Error(codes.Canceled, err.Error())
+				return
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = status.Error(codes.DeadlineExceeded, err.Error())
+				return
+			}
+
+			appErr := apperror.From(err)
+			if appErr.Kind == apperror.KindInternal {
+				logrus.Errorf("Call failed: method=%s, request_id=%s, error=%s", method, requestID, err)
+				sentry.CurrentHub().CaptureException(err)
+			}
+			err = newStatus(appErr, requestID).Err()
+		}()
+		return next(ctx)
+	}
+}
+
+// loggingInterceptor logs calls in the format of the Logging middleware of the HTTP API
+func loggingInterceptor() interceptor {
+	return func(ctx context.Context, method string, next func(ctx context.Context) error) error {
+		start := time.Now()
+		err := next(ctx)
+		if method != healthCheckMethod && method != healthWatchMethod {
+			logrus.Infof("method: %s response_time: %.8f status: %s request_id: %s",
+				method, time.Since(start).Seconds(), status.Code(err), RequestIDFromContext(ctx))
+		}
+		return err
+	}
+}
+
+var (
+	grpcRequests        *prometheus.CounterVec
+	grpcRequestDuration *prometheus.HistogramVec
+	grpcMetricsOnce     sync.Once
+)
+
+// metricsInterceptor counts calls by method and status code, the collectors are registered once
+// in the default registry and served on /metrics with the metrics of the HTTP API
+func metricsInterceptor() interceptor {
+	grpcMetricsOnce.Do(func() {
+		grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_requests_total",
+			Help: "How many gRPC calls processed, partitioned by status code and method.",
+		}, []string{"code", "method"})
+		grpcRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "grpc_request_duration_seconds",
+			Help: "The gRPC call latencies in seconds.",
+		}, []string{"method"})
+		prometheus.MustRegister(grpcRequests, grpcRequestDuration)
+	})
+
+	return func(ctx context.Context, method string, next func(ctx context.Context) error) error {
+		start := time.Now()
+		err := next(ctx)
+		grpcRequests.WithLabelValues(status.Code(err).String(), method).Inc()
+		grpcRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
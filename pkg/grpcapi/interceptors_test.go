@@ -0,0 +1,61 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/stretchr/testify/require"
+	"github.com/zaharinea/go-example/pkg/apperror"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorInterceptor(t *testing.T) {
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "request-1")
+	call := func(next func(ctx context.Context) error) error {
+		return errorInterceptor()(ctx, "/test", next)
+	}
+
+	require.NoError(t, call(func(ctx context.Context) error { return nil }))
+
+	err := call(func(ctx context.Context) error { panic("boom") })
+	require.Equal(t, codes.Internal, status.Code(err))
+	require.Equal(t, "Server error", status.Convert(err).Message())
+
+	err = call(func(ctx context.Context) error { return errors.New("connection refused") })
+	require.Equal(t, codes.Internal, status.Code(err))
+	require.Equal(t, "Server error", status.Convert(err).Message())
+
+	err = call(func(ctx context.Context) error { return apperror.Conflict("duplicate", "Duplicate") })
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	canceled := status.Error(codes.Canceled, "context canceled")
+	require.Equal(t, canceled, call(func(ctx context.Context) error { return canceled }))
+}
+
+func TestErrorInterceptorContextErrors(t *testing.T) {
+	var reported []*sentry.Event
+	client, err := sentry.NewClient(sentry.ClientOptions{BeforeSend: func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		reported = append(reported, event)
+		return nil
+	}})
+	require.NoError(t, err)
+	hub := sentry.CurrentHub()
+	previous := hub.Client()
+	hub.BindClient(client)
+	t.Cleanup(func() { hub.BindClient(previous) })
+
+	call := func(err error) error {
+		return errorInterceptor()(context.Background(), "/test", func(ctx context.Context) error { return err })
+	}
+
+	require.Equal(t, codes.Canceled, status.Code(call(context.Canceled)))
+	require.Equal(t, codes.DeadlineExceeded, status.Code(call(fmt.Errorf("list users: %w", context.DeadlineExceeded))))
+	require.Empty(t, reported)
+
+	require.Equal(t, codes.Internal, status.Code(call(errors.New("connection refused"))))
+	require.Len(t, reported, 1)
+}
@@ -0,0 +1,168 @@
+// Package grpcapi serves the gRPC API, it is the gRPC counterpart of the HTTP handlers in pkg/handler.
+// The code in userspb is generated from proto/users/v1/users.proto.
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/apperror"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/grpcapi/userspb"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxPageSize is the largest number of users read from the database at once by ListUsers
+const maxPageSize = 100
+
+var errInvalidRequest = apperror.Validation("invalid_request", "Request is invalid")
+
+// Server is the gRPC server of the App, it serves UserService and the standard health service
+type Server struct {
+	*grpc.Server
+	health *health.Server
+}
+
+// NewServer returns a new Server struct, calls pass the request ID, metrics, logging, error and tenant interceptors
+// which behave as the middlewares of the HTTP API. ids generates IDs of calls without x-request-id.
+func NewServer(config *config.Config, services *service.Service, clock clock.Clock, ids idgen.IDGenerator, opts ...grpc.ServerOption) *Server {
+	interceptors := []interceptor{requestIDInterceptor(ids), metricsInterceptor(), loggingInterceptor(), errorInterceptor(), tenantInterceptor(config, clock)}
+	unary := make([]grpc.UnaryServerInterceptor, len(interceptors))
+	stream := make([]grpc.StreamServerInterceptor, len(interceptors))
+	for i, interceptor := range interceptors {
+		unary[i], stream[i] = interceptor.unary(), interceptor.stream()
+	}
+	opts = append(opts, grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
+
+	s := &Server{Server: grpc.NewServer(opts...), health: health.NewServer()}
+	userspb.RegisterUserServiceServer(s.Server, NewUserServer(services))
+	healthpb.RegisterHealthServer(s.Server, s.health)
+	return s
+}
+
+// SetReady changes the status reported by the health service, the server is ready by default
+func (s *Server) SetReady(ready bool) {
+	status := healthpb.HealthCheckResponse_SERVING
+	if !ready {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	s.health.SetServingStatus("", status)
+}
+
+// UserServer struct
+type UserServer struct {
+	userspb.UnimplementedUserServiceServer
+	services *service.Service
+}
+
+// NewUserServer returns a new UserServer struct
+func NewUserServer(services *service.Service) *UserServer {
+	return &UserServer{services: services}
+}
+
+// CreateUser method
+func (s *UserServer) CreateUser(ctx context.Context, req *userspb.CreateUserRequest) (*userspb.User, error) {
+	if req.Name == "" {
+		return nil, requiredError("name")
+	}
+
+	user := domain.User{Name: req.Name, AccountExternalID: req.AccountExternalId}
+	if err := s.services.User.Create(ctx, &user); err != nil {
+		return nil, err
+	}
+	return newUser(&user), nil
+}
+
+// GetUser method
+func (s *UserServer) GetUser(ctx context.Context, req *userspb.GetUserRequest) (*userspb.User, error) {
+	if req.Id == "" {
+		return nil, requiredError("id")
+	}
+
+	user, err := s.services.User.GetByID(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return newUser(user), nil
+}
+
+// ListUsers method, users are read page by page while they are sent
+func (s *UserServer) ListUsers(req *userspb.ListUsersRequest, stream userspb.UserService_ListUsersServer) error {
+	pageSize := req.PageSize
+	if pageSize <= 0 || pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	ctx := stream.Context()
+	for offset := int64(0); ; offset += pageSize {
+		var users []*domain.User
+		var err error
+		if req.AccountExternalId != "" {
+			users, err = s.services.User.ListByAccount(ctx, req.AccountExternalId, pageSize, offset)
+		} else {
+			users, err = s.services.User.List(ctx, pageSize, offset)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			if err := stream.Send(newUser(user)); err != nil {
+				return err
+			}
+		}
+		if int64(len(users)) < pageSize {
+			return nil
+		}
+	}
+}
+
+// UpdateUser method
+func (s *UserServer) UpdateUser(ctx context.Context, req *userspb.UpdateUserRequest) (*userspb.User, error) {
+	if req.Id == "" {
+		return nil, requiredError("id")
+	}
+	if req.Name == "" {
+		return nil, requiredError("name")
+	}
+
+	update := domain.UpdateUser{Name: req.Name, AccountExternalID: req.AccountExternalId}
+	user, err := s.services.User.UpdateAndReturn(ctx, req.Id, update)
+	if err != nil {
+		return nil, err
+	}
+	return newUser(user), nil
+}
+
+// DeleteUser method
+func (s *UserServer) DeleteUser(ctx context.Context, req *userspb.DeleteUserRequest) (*empty.Empty, error) {
+	if req.Id == "" {
+		return nil, requiredError("id")
+	}
+
+	if err := s.services.User.DeleteByID(ctx, req.Id); err != nil {
+		return nil, err
+	}
+	return &empty.Empty{}, nil
+}
+
+func newUser(user *domain.User) *userspb.User {
+	return &userspb.User{
+		Id:                user.ID,
+		Name:              user.Name,
+		AccountExternalId: user.AccountExternalID,
+		CreatedAt:         timestamppb.New(user.CreatedAt),
+		UpdatedAt:         timestamppb.New(user.UpdatedAt),
+	}
+}
+
+func requiredError(field string) error {
+	return errInvalidRequest.WithFields(apperror.FieldError{Field: field, Code: "required", Message: field + " is required"})
+}
@@ -0,0 +1,212 @@
+package grpcapi_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/auth"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/grpcapi"
+	"github.com/zaharinea/go-example/pkg/grpcapi/userspb"
+	"github.com/zaharinea/go-example/pkg/testkit"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type UserServerSuite struct {
+	testkit.Suite
+	ctx    context.Context
+	conn   *grpc.ClientConn
+	client userspb.UserServiceClient
+}
+
+func (s *UserServerSuite) SetupSuite() {
+	s.Suite.SetupSuite()
+	s.ctx = context.Background()
+	conn, err := s.Kit.GRPCConn()
+	s.Require().NoError(err)
+	s.conn = conn
+	s.client = userspb.NewUserServiceClient(conn)
+}
+
+func (s *UserServerSuite) TearDownSuite() {
+	s.Require().NoError(s.conn.Close())
+}
+
+func (s *UserServerSuite) createUser(name string, accountExternalID string) *userspb.User {
+	user, err := s.client.CreateUser(s.ctx, &userspb.CreateUserRequest{Name: name, AccountExternalId: accountExternalID})
+	s.Require().NoError(err)
+	return user
+}
+
+func (s *UserServerSuite) listUsers(req *userspb.ListUsersRequest) []string {
+	stream, err := s.client.ListUsers(s.ctx, req)
+	s.Require().NoError(err)
+
+	var ids []string
+	for {
+		user, err := stream.Recv()
+		if err == io.EOF {
+			return ids
+		}
+		s.Require().NoError(err)
+		ids = append(ids, user.Id)
+	}
+}
+
+func (s *UserServerSuite) TestUserLifecycle() {
+	created := s.createUser("user1", "")
+	s.Require().Equal("000000000000000000000001", created.Id)
+	s.Require().Equal("user1", created.Name)
+	s.Require().Equal(testkit.StartTime, created.CreatedAt.AsTime())
+
+	user, err := s.client.GetUser(s.ctx, &userspb.GetUserRequest{Id: created.Id})
+	s.Require().NoError(err)
+	s.Require().Equal(created.Name, user.Name)
+
+	s.Kit.Clock.Advance(time.Hour)
+	updated, err := s.client.UpdateUser(s.ctx, &userspb.UpdateUserRequest{Id: created.Id, Name: "user2"})
+	s.Require().NoError(err)
+	s.Require().Equal("user2", updated.Name)
+	s.Require().Equal(testkit.StartTime.Add(time.Hour), updated.UpdatedAt.AsTime())
+
+	s.Require().Equal([]string{created.Id}, s.listUsers(&userspb.ListUsersRequest{}))
+
+	_, err = s.client.DeleteUser(s.ctx, &userspb.DeleteUserRequest{Id: created.Id})
+	s.Require().NoError(err)
+	_, err = s.client.GetUser(s.ctx, &userspb.GetUserRequest{Id: created.Id})
+	s.Require().Equal(codes.NotFound, status.Code(err))
+}
+
+func (s *UserServerSuite) TestNotFoundError() {
+	ctx := metadata.AppendToOutgoingContext(s.ctx, "x-request-id", "request-1")
+	_, err := s.client.GetUser(ctx, &userspb.GetUserRequest{Id: "5fbaeab741e97bef8525d6ab"})
+
+	st := status.Convert(err)
+	s.Require().Equal(codes.NotFound, st.Code())
+	s.Require().Equal("Not found user", st.Message())
+	s.Require().Len(st.Details(), 1)
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	s.Require().Equal("user_not_found", info.Reason)
+	s.Require().Equal(grpcapi.ErrorDomain, info.Domain)
+	s.Require().Equal(map[string]string{"request_id": "request-1"}, info.Metadata)
+}
+
+func (s *UserServerSuite) TestValidationError() {
+	_, err := s.client.CreateUser(s.ctx, &userspb.CreateUserRequest{})
+
+	st := status.Convert(err)
+	s.Require().Equal(codes.InvalidArgument, st.Code())
+	s.Require().Len(st.Details(), 2)
+	s.Require().Equal("invalid_request", st.Details()[0].(*errdetails.ErrorInfo).Reason)
+	violations := st.Details()[1].(*errdetails.BadRequest).FieldViolations
+	s.Require().Len(violations, 1)
+	s.Require().Equal("name", violations[0].Field)
+	s.Require().Equal("name is required", violations[0].Description)
+
+	_, err = s.client.CreateUser(s.ctx, &userspb.CreateUserRequest{Name: "user1", AccountExternalId: "1"})
+	s.Require().Equal(codes.InvalidArgument, status.Code(err))
+	s.Require().Equal("unknown_account", status.Convert(err).Details()[0].(*errdetails.ErrorInfo).Reason)
+}
+
+func (s *UserServerSuite) TestListUsersStreamsAllPages() {
+	s.Require().True(s.Kit.Deliver("go-example-accounts", `{"external_id":"1","name":"account1","updated_at":"2020-11-21T00:00:00.000Z"}`))
+	var ids, accountIDs []string
+	for i, name := range []string{"user1", "user2", "user3", "user4", "user5"} {
+		accountExternalID := ""
+		if i%2 == 0 {
+			accountExternalID = "1"
+		}
+		user := s.createUser(name, accountExternalID)
+		ids = append(ids, user.Id)
+		if accountExternalID != "" {
+			accountIDs = append(accountIDs, user.Id)
+		}
+	}
+
+	for _, pageSize := range []int64{0, 1, 2, 5, 1000} {
+		s.Require().Equal(ids, s.listUsers(&userspb.ListUsersRequest{PageSize: pageSize}), "page size %d", pageSize)
+	}
+	s.Require().Equal(accountIDs, s.listUsers(&userspb.ListUsersRequest{AccountExternalId: "1", PageSize: 2}))
+}
+
+func (s *UserServerSuite) TestRequestID() {
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(s.ctx, "x-request-id", "request-1")
+	_, err := s.client.CreateUser(ctx, &userspb.CreateUserRequest{Name: "user1"}, grpc.Header(&header))
+	s.Require().NoError(err)
+	s.Require().Equal([]string{"request-1"}, header.Get("x-request-id"))
+
+	_, err = s.client.CreateUser(s.ctx, &userspb.CreateUserRequest{Name: "user2"}, grpc.Header(&header))
+	s.Require().NoError(err)
+	s.Require().Equal([]string{"000000000000000000000001"}, header.Get("x-request-id"))
+}
+
+func (s *UserServerSuite) TestHealth() {
+	health := healthpb.NewHealthClient(s.conn)
+	resp, err := health.Check(s.ctx, &healthpb.HealthCheckRequest{})
+	s.Require().NoError(err)
+	s.Require().Equal(healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	s.Kit.App.GRPCServer.SetReady(false)
+	resp, err = health.Check(s.ctx, &healthpb.HealthCheckRequest{})
+	s.Require().NoError(err)
+	s.Require().Equal(healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+}
+
+func (s *UserServerSuite) TestMetrics() {
+	_, err := s.client.GetUser(s.ctx, &userspb.GetUserRequest{Id: "5fbaeab741e97bef8525d6ab"})
+	s.Require().Error(err)
+
+	w := s.Kit.DoAdmin("GET", "/metrics", "", nil)
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Contains(w.Body.String(), `grpc_requests_total{code="NotFound",method="/goexample.users.v1.UserService/GetUser"}`)
+}
+
+func TestUserServerSuite(t *testing.T) {
+	suite.Run(t, new(UserServerSuite))
+}
+
+func TestTenant(t *testing.T) {
+	kit := testkit.New(func(c *config.Config) {
+		c.TenantRequired = true
+		c.JWTSecret = "secret"
+	})
+	conn, err := kit.GRPCConn()
+	require.NoError(t, err)
+	defer conn.Close()
+	client := userspb.NewUserServiceClient(conn)
+	ctx := context.Background()
+
+	_, err = client.CreateUser(ctx, &userspb.CreateUserRequest{Name: "user1"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = kit.Repos.Account.CreateOrUpdate(ctx, domain.Account{ExternalID: "1", Name: "account1"}, true)
+	require.NoError(t, err)
+	user, err := client.CreateUser(metadata.AppendToOutgoingContext(ctx, "x-tenant-id", "1"), &userspb.CreateUserRequest{Name: "user1"})
+	require.NoError(t, err)
+	require.Equal(t, "1", user.AccountExternalId)
+
+	token, err := auth.NewToken(auth.Claims{"tenant_id": "2"}, "secret")
+	require.NoError(t, err)
+	_, err = client.GetUser(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token), &userspb.GetUserRequest{Id: user.Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.GetUser(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token, "x-tenant-id", "1"), &userspb.GetUserRequest{Id: user.Id})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.Equal(t, "tenant_mismatch", status.Convert(err).Details()[0].(*errdetails.ErrorInfo).Reason)
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestGetAccount struct
+type RequestGetAccount struct {
+	ExternalID string `uri:"external_id" binding:"required"`
+}
+
+// ListAccountUsers handler
+// @Summary List account users
+// @Description get users of the account
+// @Tags accounts
+// @Accept  json
+// @Produce  json
+// @Param  external_id path string true "Account external ID"
+// @Param limit query int false "limit" mininum(1) maxinum(100) default(25)
+// @Param offset query int false "offset" mininum(0) default(0)
+// @Success 200 {object} ResponseUsers
+// @Failure 400 {object} ResponseProblem
+// @Failure 404 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
+// @Router /api/accounts/{external_id}/users [get]
+func (h *Handler) ListAccountUsers(c *gin.Context) {
+	var reqURI RequestGetAccount
+	if err := c.ShouldBindUri(&reqURI); err != nil {
+		abortWithError(c, bindingError(err))
+		return
+	}
+
+	var req RequestListUsers
+	if err := c.ShouldBindQuery(&req); err != nil {
+		abortWithError(c, bindingError(err))
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = h.Config().PageSize
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	users, err := h.services.User.ListByAccount(c, reqURI.ExternalID, req.Limit, req.Offset)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newResponseUsers(users))
+}
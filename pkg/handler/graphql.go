@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zaharinea/go-example/pkg/graphqlapi"
+)
+
+// GraphQL handler
+// @Summary GraphQL
+// @Description execute a GraphQL query or mutation over users and accounts, errors of the query are returned with status 200
+// @Tags graphql
+// @Accept  json
+// @Produce  json
+// @Param request body graphqlapi.Request true "GraphQL request"
+// @Success 200 {object} graphqlapi.Response
+// @Failure 400 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
+// @Router /api/graphql [post]
+func (h *Handler) GraphQL(c *gin.Context) {
+	var req graphqlapi.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, bindingError(err))
+		return
+	}
+
+	config := h.Config()
+	resp := h.graphql.Execute(c, req, graphqlapi.Options{
+		MaxDepth:        int(config.GraphQLMaxDepth),
+		MaxComplexity:   int(config.GraphQLMaxComplexity),
+		DefaultPageSize: config.PageSize,
+		RequestID:       c.GetString(contextRequestIDKey),
+	})
+	c.JSON(http.StatusOK, resp)
+}
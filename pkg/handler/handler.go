@@ -1,29 +1,47 @@
 package handler
 
 import (
+	"net/http"
+	"sync"
+
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/zaharinea/go-example/config"
-	_ "github.com/zaharinea/go-example/docs"
+	"github.com/zaharinea/go-example/docs"
+	"github.com/zaharinea/go-example/pkg/graphqlapi"
 	"github.com/zaharinea/go-example/pkg/service"
 )
 
-const (
-	errorMessageNotFound         = "Not found"
-	errorMessageMethodNotAllowed = "Method not allowed"
-	errorMessageServerError      = "Server error"
-)
-
 // Handler struct
 type Handler struct {
+	mu       sync.RWMutex
 	config   *config.Config
 	services *service.Service
+	graphql  *graphqlapi.Schema
+	notReady int32
+	// stop is closed by StopStreams
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 // NewHandler returns a new Handler struct
 func NewHandler(config *config.Config, services *service.Service) *Handler {
-	return &Handler{config: config, services: services}
+	return &Handler{config: config, services: services, graphql: graphqlapi.NewSchema(services), stop: make(chan struct{})}
+}
+
+// Config returns the current config
+func (h *Handler) Config() *config.Config {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.config
+}
+
+// SetConfig replaces the config, it is subscribed to config reloads
+func (h *Handler) SetConfig(c *config.Config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.config = c
 }
 
 // InitRoutes initialize endpoint
@@ -34,13 +52,31 @@ func (h *Handler) InitRoutes(engine *gin.Engine) {
 	engine.NoRoute(NoRouteHandler)
 	engine.NoMethod(NoMethodHandler)
 
-	url := ginSwagger.URL("/swagger/doc.json")
-	engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, url))
-
 	engine.GET("/api/healthcheck", h.Healthcheck)
+	engine.GET("/api/readycheck", h.Readycheck)
 	engine.POST("/api/users", h.CreateUser)
 	engine.GET("/api/users", h.ListUsers)
+	engine.GET("/api/users/stream", h.StreamUsers)
 	engine.GET("/api/users/:id", h.GetUserByID)
 	engine.PUT("/api/users/:id", h.UpdateUser)
 	engine.DELETE("/api/users/:id", h.DeleteUserByID)
+	engine.GET("/api/accounts/:external_id/users", h.ListAccountUsers)
+	engine.POST("/api/webhooks", h.CreateWebhook)
+	engine.GET("/api/webhooks", h.ListWebhooks)
+	engine.GET("/api/webhooks/:id", h.GetWebhookByID)
+	engine.PUT("/api/webhooks/:id", h.UpdateWebhook)
+	engine.DELETE("/api/webhooks/:id", h.DeleteWebhookByID)
+	engine.GET("/api/webhooks/:id/deliveries", h.ListWebhookDeliveries)
+	engine.POST("/api/graphql", h.GraphQL)
+}
+
+// InitAdminRoutes initialize swagger, OpenAPI, docs and migration status endpoints,
+// they are served by the admin listener if it is enabled, otherwise by the public one
+func (h *Handler) InitAdminRoutes(engine *gin.Engine) {
+	url := ginSwagger.URL("/swagger/doc.json")
+	engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, url))
+	engine.StaticFS("/docs", http.FS(docs.Files))
+	engine.GET("/openapi.json", h.OpenAPIDocument)
+
+	engine.GET("/api/admin/migrations", h.MigrationStatus)
 }
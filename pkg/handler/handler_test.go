@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/suite"
+)
+
+type RoutesSuite struct {
+	suite.Suite
+	router *gin.Engine
+}
+
+func (s *RoutesSuite) SetupSuite() {
+	gin.SetMode(gin.ReleaseMode)
+	s.router = gin.New()
+	s.router.Use(ErrorMiddleware())
+	h := &Handler{}
+	h.InitRoutes(s.router)
+	h.InitAdminRoutes(s.router)
+}
+
+func (s *RoutesSuite) TestEmbeddedSwaggerSpec() {
+	w := performRequest(s.router, "GET", "/docs/swagger.json", "")
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Contains(w.Body.String(), `"swagger": "2.0"`)
+}
+
+func (s *RoutesSuite) TestNoRoute() {
+	w := performRequest(s.router, "GET", "/unknown", "")
+	s.Require().Equal(http.StatusNotFound, w.Code)
+	s.Require().Equal("application/problem+json", w.Header().Get("Content-Type"))
+	s.Require().Equal(`{"type":"urn:go-example:problem:not_found","title":"Not Found","status":404,"detail":"Not found","code":"not_found"}`, w.Body.String())
+}
+
+func (s *RoutesSuite) TestPprof() {
+	router := gin.New()
+	InitPprofRoutes(router)
+
+	w := performRequest(router, "GET", "/debug/pprof/", "")
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Contains(w.Body.String(), "goroutine")
+
+	w = performRequest(router, "GET", "/debug/pprof/goroutine?debug=1", "")
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Contains(w.Body.String(), "goroutine profile")
+
+	w = performRequest(router, "GET", "/debug/pprof/cmdline", "")
+	s.Require().Equal(http.StatusOK, w.Code)
+}
+
+func TestRoutesSuite(t *testing.T) {
+	suite.Run(t, new(RoutesSuite))
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,3 +21,28 @@ type ResponseHealthcheck struct {
 func (h *Handler) Healthcheck(c *gin.Context) {
 	c.JSON(http.StatusOK, ResponseHealthcheck{Status: "ok"})
 }
+
+// SetReady changes the readiness reported by Readycheck, the handler is ready by default
+func (h *Handler) SetReady(ready bool) {
+	var notReady int32
+	if !ready {
+		notReady = 1
+	}
+	atomic.StoreInt32(&h.notReady, notReady)
+}
+
+// Readycheck handler
+// @Summary Readycheck
+// @Description returns 503 when the service is shutting down
+// @Tags healthcheck
+// @Produce  json
+// @Success 200 {object} ResponseHealthcheck
+// @Failure 503 {object} ResponseHealthcheck
+// @Router /api/readycheck [get]
+func (h *Handler) Readycheck(c *gin.Context) {
+	if atomic.LoadInt32(&h.notReady) != 0 {
+		c.JSON(http.StatusServiceUnavailable, ResponseHealthcheck{Status: "shutting down"})
+		return
+	}
+	c.JSON(http.StatusOK, ResponseHealthcheck{Status: "ok"})
+}
@@ -27,6 +27,19 @@ func (s *HealthcheckSuite) TestHealthcheck() {
 	s.Require().Equal(`{"status":"ok"}`, w.Body.String())
 }
 
+func (s *HealthcheckSuite) TestReadycheck() {
+	s.router.GET("/ready", s.handlers.Readycheck)
+	w := performRequest(s.router, "GET", "/ready", "")
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Equal(`{"status":"ok"}`, w.Body.String())
+
+	s.handlers.SetReady(false)
+	defer s.handlers.SetReady(true)
+	w = performRequest(s.router, "GET", "/ready", "")
+	s.Require().Equal(http.StatusServiceUnavailable, w.Code)
+	s.Require().Equal(`{"status":"shutting down"}`, w.Body.String())
+}
+
 func TestHealthcheckSuite(t *testing.T) {
 	suite.Run(t, new(HealthcheckSuite))
 }
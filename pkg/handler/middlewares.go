@@ -1,29 +1,42 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
+	"strings"
 	"time"
 
+	"github.com/getsentry/sentry-go"
+	sentrygin "github.com/getsentry/sentry-go/gin"
 	"github.com/gin-gonic/gin"
-	"github.com/go-errors/errors"
-	"github.com/google/uuid"
+	goerrors "github.com/go-errors/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/apperror"
+	"github.com/zaharinea/go-example/pkg/auth"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/tenant"
 )
 
 const (
-	requestIDHeaderName = "X-Request-ID"
-	contextRequestIDKey = "request_id"
+	requestIDHeaderName     = "X-Request-ID"
+	contextRequestIDKey     = "request_id"
+	contextClientIDKey      = "client_identity"
+	tenantIDHeaderName      = "X-Tenant-ID"
+	authorizationHeaderName = "Authorization"
 )
 
-//SetRequestIDMiddleware middleware for storing RequestID in Context
-func SetRequestIDMiddleware() gin.HandlerFunc {
+//SetRequestIDMiddleware middleware for storing RequestID in Context, ids generates IDs of requests without X-Request-ID
+func SetRequestIDMiddleware(ids idgen.IDGenerator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		requestID := c.GetHeader(requestIDHeaderName)
 		if requestID == "" {
-			requestID = uuid.New().String()
+			requestID = ids.NewID()
 		}
 
 		c.Writer.Header().Set(requestIDHeaderName, requestID)
@@ -36,11 +49,77 @@ func SetRequestIDMiddleware() gin.HandlerFunc {
 	}
 }
 
+// TenantMiddleware middleware for resolving the tenant from the JWT claim or the X-Tenant-ID header,
+// clock is used to check expiration of the JWT
+func TenantMiddleware(config *config.Config, clock clock.Clock) gin.HandlerFunc {
+	skipPaths := map[string]bool{"/api/healthcheck": true, "/api/readycheck": true, "/api/admin/migrations": true, "/metrics": true, "/openapi.json": true}
+
+	return func(c *gin.Context) {
+		if skipPaths[c.Request.URL.Path] || strings.HasPrefix(c.Request.URL.Path, "/swagger/") || strings.HasPrefix(c.Request.URL.Path, "/docs/") {
+			c.Next()
+			return
+		}
+
+		tenantID, err := auth.ResolveTenant(config, c.GetHeader(authorizationHeaderName), c.GetHeader(tenantIDHeaderName), clock.Now())
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if tenantID == "" {
+			c.Next()
+			return
+		}
+
+		c.Set(tenant.ContextKey, tenantID)
+		c.Request = c.Request.WithContext(tenant.WithTenant(c.Request.Context(), tenantID))
+		c.Next()
+	}
+}
+
+// MaxBodyMiddleware middleware limiting the request body size, larger bodies are rejected with 413
+func MaxBodyMiddleware(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			abortWithError(c, errBodyTooLarge)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// ClientIdentity is the identity of a client authenticated by a verified TLS certificate
+type ClientIdentity struct {
+	Subject    string
+	CommonName string
+}
+
+// ClientIdentityMiddleware middleware storing the identity of the verified client certificate in Context
+func ClientIdentityMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 && len(c.Request.TLS.VerifiedChains[0]) > 0 {
+			cert := c.Request.TLS.VerifiedChains[0][0]
+			c.Set(contextClientIDKey, &ClientIdentity{Subject: cert.Subject.String(), CommonName: cert.Subject.CommonName})
+		}
+		c.Next()
+	}
+}
+
+// GetClientIdentity returns the identity stored by ClientIdentityMiddleware
+func GetClientIdentity(c *gin.Context) (*ClientIdentity, bool) {
+	value, ok := c.Get(contextClientIDKey)
+	if !ok {
+		return nil, false
+	}
+	identity, ok := value.(*ClientIdentity)
+	return identity, ok
+}
+
 // Logging middleware
 func Logging() gin.HandlerFunc {
 	return gin.LoggerWithConfig(
 		gin.LoggerConfig{
-			SkipPaths: []string{"/api/healthcheck", "/metrics"},
+			SkipPaths: []string{"/api/healthcheck", "/api/readycheck", "/metrics"},
 			Formatter: func(param gin.LogFormatterParams) string {
 				return fmt.Sprintf("%v method: %s path: %s response_time: %.8f status: %d request_id: %s\n",
 					param.TimeStamp.Format(time.RFC3339),
@@ -70,7 +149,7 @@ func RecoveryWithWriter(f func(c *gin.Context, err interface{}), out io.Writer)
 			if err := recover(); err != nil {
 				if logger != nil {
 					httprequest, _ := httputil.DumpRequest(c.Request, false)
-					goErr := errors.Wrap(err, 3)
+					goErr := goerrors.Wrap(err, 3)
 					reset := string([]byte{27, 91, 48, 109})
 					logger.Printf("[Recovery] panic recovered:\n\n%s%s\n\n%s%s", httprequest, goErr.Error(), goErr.Stack(), reset)
 				}
@@ -82,17 +161,53 @@ func RecoveryWithWriter(f func(c *gin.Context, err interface{}), out io.Writer)
 	}
 }
 
+// panicError is a recovered panic, it is already reported to Sentry by the sentry middleware
+type panicError struct {
+	value interface{}
+}
+
+func (e panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
 // RecoveryHandler handler
 func RecoveryHandler(c *gin.Context, err interface{}) {
-	c.JSON(http.StatusInternalServerError, errorResponse{errorMessageServerError})
+	abortWithError(c, apperror.Internal(panicError{err}))
 }
 
 // NoRouteHandler handler
 func NoRouteHandler(c *gin.Context) {
-	c.JSON(http.StatusNotFound, errorResponse{errorMessageNotFound})
+	abortWithError(c, errNotFound)
 }
 
 // NoMethodHandler handler
 func NoMethodHandler(c *gin.Context) {
-	c.JSON(http.StatusMethodNotAllowed, errorResponse{errorMessageMethodNotAllowed})
+	abortWithError(c, errMethodNotAllowed)
+}
+
+// ErrorMiddleware middleware rendering the last error of the request as application/problem+json,
+// internal errors are logged and sent to Sentry but their details are hidden from clients
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		appErr := apperror.From(err)
+		problem := newProblem(c, appErr)
+		if problem.Status >= http.StatusInternalServerError {
+			logrus.Errorf("Request failed: method=%s, path=%s, request_id=%s, error=%s", c.Request.Method, c.Request.URL.Path, problem.RequestID, err)
+			if !errors.As(err, &panicError{}) {
+				hub := sentrygin.GetHubFromContext(c)
+				if hub == nil {
+					hub = sentry.CurrentHub()
+				}
+				hub.CaptureException(err)
+			}
+		}
+		renderProblem(c, problem)
+	}
 }
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/pkg/idgen"
+)
+
+type MiddlewaresSuite struct {
+	suite.Suite
+	router *gin.Engine
+}
+
+func (s *MiddlewaresSuite) SetupTest() {
+	gin.SetMode(gin.ReleaseMode)
+	s.router = gin.New()
+	s.router.Use(ErrorMiddleware(), ClientIdentityMiddleware(), MaxBodyMiddleware(8))
+	s.router.POST("/body", func(c *gin.Context) {
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			c.String(http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		c.String(http.StatusOK, string(body))
+	})
+	s.router.GET("/identity", func(c *gin.Context) {
+		identity, ok := GetClientIdentity(c)
+		if !ok {
+			c.String(http.StatusUnauthorized, "")
+			return
+		}
+		c.String(http.StatusOK, identity.CommonName+"|"+identity.Subject)
+	})
+}
+
+func (s *MiddlewaresSuite) TestMaxBody() {
+	w := performRequest(s.router, "POST", "/body", "12345678")
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Equal("12345678", w.Body.String())
+
+	w = performRequest(s.router, "POST", "/body", "123456789")
+	s.Require().Equal(http.StatusRequestEntityTooLarge, w.Code)
+	s.Require().Contains(w.Body.String(), `"code":"payload_too_large"`)
+}
+
+func (s *MiddlewaresSuite) TestMaxBodyChunked() {
+	req, _ := http.NewRequest("POST", "/body", ioutil.NopCloser(strings.NewReader("123456789")))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func (s *MiddlewaresSuite) TestClientIdentity() {
+	req, _ := http.NewRequest("GET", "/identity", nil)
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "client1", Organization: []string{"go-example"}}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Equal("client1|CN=client1,O=go-example", w.Body.String())
+}
+
+func (s *MiddlewaresSuite) TestNoClientIdentity() {
+	w := performRequest(s.router, "GET", "/identity", "")
+	s.Require().Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (s *MiddlewaresSuite) TestSetRequestID() {
+	router := gin.New()
+	router.Use(SetRequestIDMiddleware(idgen.NewSequence()))
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(contextRequestIDKey))
+	})
+
+	w := performRequest(router, "GET", "/", "")
+	s.Require().Equal("000000000000000000000001", w.Body.String())
+	s.Require().Equal("000000000000000000000001", w.Header().Get(requestIDHeaderName))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(requestIDHeaderName, "request-1")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	s.Require().Equal("request-1", w.Body.String())
+}
+
+func (s *MiddlewaresSuite) TestErrorMiddlewarePanic() {
+	router := gin.New()
+	router.Use(SetRequestIDMiddleware(idgen.NewSequence()), ErrorMiddleware(), RecoveryWithWriter(RecoveryHandler, nil))
+	router.GET("/", func(c *gin.Context) {
+		panic("secret details")
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set(requestIDHeaderName, "request-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusInternalServerError, w.Code)
+	s.Require().Equal("application/problem+json", w.Header().Get("Content-Type"))
+	s.Require().Equal(`{"type":"urn:go-example:problem:internal","title":"Internal Server Error","status":500,"detail":"Server error","code":"internal_error","request_id":"request-1"}`, w.Body.String())
+}
+
+func (s *MiddlewaresSuite) TestBindingError() {
+	var req RequestCreateUser
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.POST("/", func(c *gin.Context) {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, bindingError(err))
+		}
+	})
+
+	w := performRequest(router, "POST", "/", `{"name": 1}`)
+	s.Require().Equal(http.StatusBadRequest, w.Code)
+	s.Require().Contains(w.Body.String(), `"errors":[{"field":"name","code":"type","message":"name must be string"}]`)
+
+	w = performRequest(router, "POST", "/", `{"name"`)
+	s.Require().Equal(http.StatusBadRequest, w.Code)
+	s.Require().Contains(w.Body.String(), `"code":"invalid_body"`)
+}
+
+func TestMiddlewaresSuite(t *testing.T) {
+	suite.Run(t, new(MiddlewaresSuite))
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zaharinea/go-example/pkg/domain"
+)
+
+// ResponseMigrationStatus struct
+type ResponseMigrationStatus struct {
+	Version       uint `json:"version"`
+	TargetVersion uint `json:"target_version"`
+	Dirty         bool `json:"dirty"`
+	Pending       bool `json:"pending"`
+}
+
+func newResponseMigrationStatus(status *domain.MigrationStatus) *ResponseMigrationStatus {
+	return &ResponseMigrationStatus{
+		Version:       status.Version,
+		TargetVersion: status.TargetVersion,
+		Dirty:         status.Dirty,
+		Pending:       status.Pending(),
+	}
+}
+
+// MigrationStatus handler
+// @Summary Migration status
+// @Description get current and target database migration versions
+// @Tags admin
+// @Produce  json
+// @Success 200 {object} ResponseMigrationStatus
+// @Failure 500 {object} ResponseProblem
+// @Router /api/admin/migrations [get]
+func (h *Handler) MigrationStatus(c *gin.Context) {
+	status, err := h.services.Migration.Status(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newResponseMigrationStatus(status))
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/service"
+)
+
+type fakeMigrationService struct {
+	status *domain.MigrationStatus
+	err    error
+}
+
+func (s *fakeMigrationService) Status(ctx context.Context) (*domain.MigrationStatus, error) {
+	return s.status, s.err
+}
+
+type MigrationSuite struct {
+	suite.Suite
+	router     *gin.Engine
+	migrations *fakeMigrationService
+}
+
+func (s *MigrationSuite) SetupTest() {
+	gin.SetMode(gin.ReleaseMode)
+	s.migrations = &fakeMigrationService{}
+	handlers := &Handler{services: &service.Service{Migration: s.migrations}}
+	s.router = gin.New()
+	s.router.Use(ErrorMiddleware())
+	s.router.GET("/", handlers.MigrationStatus)
+}
+
+func (s *MigrationSuite) TestMigrationStatusOk() {
+	s.migrations.status = &domain.MigrationStatus{Version: 4, TargetVersion: 5, Dirty: false}
+
+	w := performRequest(s.router, "GET", "/", "")
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Equal(`{"version":4,"target_version":5,"dirty":false,"pending":true}`, w.Body.String())
+}
+
+func (s *MigrationSuite) TestMigrationStatusError() {
+	s.migrations.err = errors.New("failed")
+
+	w := performRequest(s.router, "GET", "/", "")
+	s.Require().Equal(http.StatusInternalServerError, w.Code)
+	s.Require().Equal(`{"type":"urn:go-example:problem:internal","title":"Internal Server Error","status":500,"detail":"Server error","code":"internal_error"}`, w.Body.String())
+}
+
+func TestMigrationSuite(t *testing.T) {
+	suite.Run(t, new(MigrationSuite))
+}
@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zaharinea/go-example/pkg/apperror"
+	"github.com/zaharinea/go-example/pkg/graphqlapi"
+	"github.com/zaharinea/go-example/pkg/openapi"
+)
+
+// NewOpenAPI returns the OpenAPI 3 document of the routes registered by InitRoutes,
+// schemas are generated from the request and response types of the handlers
+func NewOpenAPI(version string) *openapi.Document {
+	doc := openapi.NewDocument("Example API", "This is an example http api server", version)
+
+	health := doc.ResponseSchema(ResponseHealthcheck{})
+	user := doc.ResponseSchema(ResponseUser{})
+	users := doc.ResponseSchema(ResponseUsers{})
+	problem := openapi.ProblemResponse("Problem details", doc.ResponseSchema(ResponseProblem{}))
+	pageParameters := []*openapi.Parameter{
+		openapi.QueryParameter("limit", "page size from 1 to 100, other values select the default page size",
+			&openapi.Schema{Type: openapi.TypeInteger, Format: "int64"}),
+		openapi.QueryParameter("offset", "number of skipped users, negative values are ignored",
+			&openapi.Schema{Type: openapi.TypeInteger, Format: "int64"}),
+	}
+	userID := openapi.PathParameter("id", "User ID")
+
+	doc.AddOperation(http.MethodGet, "/api/healthcheck", &openapi.Operation{
+		OperationID: "Healthcheck",
+		Summary:     "Healthcheck",
+		Tags:        []string{"healthcheck"},
+		Responses:   map[string]*openapi.Response{"200": openapi.JSONResponse("Service is alive", health)},
+	})
+	doc.AddOperation(http.MethodGet, "/api/readycheck", &openapi.Operation{
+		OperationID: "Readycheck",
+		Summary:     "Readycheck",
+		Description: "returns 503 when the service is shutting down",
+		Tags:        []string{"healthcheck"},
+		Responses: map[string]*openapi.Response{
+			"200": openapi.JSONResponse("Service is ready", health),
+			"503": openapi.JSONResponse("Service is shutting down", health),
+		},
+	})
+	doc.AddOperation(http.MethodPost, "/api/users", &openapi.Operation{
+		OperationID: "CreateUser",
+		Summary:     "Create user",
+		Tags:        []string{"users"},
+		RequestBody: openapi.JSONRequestBody("Add user", doc.RequestSchema(RequestCreateUser{})),
+		Responses:   map[string]*openapi.Response{"201": openapi.JSONResponse("Created user", user), "default": problem},
+	})
+	doc.AddOperation(http.MethodGet, "/api/users", &openapi.Operation{
+		OperationID: "ListUsers",
+		Summary:     "List users",
+		Description: "get users",
+		Tags:        []string{"users"},
+		Parameters:  pageParameters,
+		Responses:   map[string]*openapi.Response{"200": openapi.JSONResponse("Page of users", users), "default": problem},
+	})
+	doc.AddOperation(http.MethodGet, "/api/users/stream", &openapi.Operation{
+		OperationID: "StreamUsers",
+		Summary:     "Stream user changes",
+		Description: "stream created, updated and deleted users as Server-Sent Events, the data of deleted events holds only the user ID. " +
+			"Last-Event-ID resumes the stream after the event, idle streams send heartbeats.",
+		Tags: []string{"users"},
+		Parameters: []*openapi.Parameter{
+			openapi.HeaderParameter("Last-Event-ID", "ID of the last received event", &openapi.Schema{Type: openapi.TypeString}),
+		},
+		Responses: map[string]*openapi.Response{
+			"200":     openapi.EventStreamResponse("Stream of created, updated and deleted events"),
+			"default": problem,
+		},
+	})
+	doc.AddOperation(http.MethodGet, "/api/users/{id}", &openapi.Operation{
+		OperationID: "GetUserByID",
+		Summary:     "Get user by ID",
+		Description: "get user by ID",
+		Tags:        []string{"users"},
+		Parameters:  []*openapi.Parameter{userID},
+		Responses:   map[string]*openapi.Response{"200": openapi.JSONResponse("User", user), "default": problem},
+	})
+	doc.AddOperation(http.MethodPut, "/api/users/{id}", &openapi.Operation{
+		OperationID: "UpdateUser",
+		Summary:     "Update user",
+		Description: "Update by json user",
+		Tags:        []string{"users"},
+		Parameters:  []*openapi.Parameter{userID},
+		RequestBody: openapi.JSONRequestBody("Update user", doc.RequestSchema(RequestUpdateUser{})),
+		Responses:   map[string]*openapi.Response{"200": openapi.JSONResponse("Updated user", user), "default": problem},
+	})
+	doc.AddOperation(http.MethodDelete, "/api/users/{id}", &openapi.Operation{
+		OperationID: "DeleteUserByID",
+		Summary:     "Delete user",
+		Description: "Delete by user ID",
+		Tags:        []string{"users"},
+		Parameters:  []*openapi.Parameter{userID},
+		Responses:   map[string]*openapi.Response{"204": openapi.EmptyResponse(http.StatusNoContent), "default": problem},
+	})
+	doc.AddOperation(http.MethodGet, "/api/accounts/{external_id}/users", &openapi.Operation{
+		OperationID: "ListAccountUsers",
+		Summary:     "List account users",
+		Description: "get users of the account",
+		Tags:        []string{"accounts"},
+		Parameters:  append([]*openapi.Parameter{openapi.PathParameter("external_id", "Account external ID")}, pageParameters...),
+		Responses:   map[string]*openapi.Response{"200": openapi.JSONResponse("Page of users", users), "default": problem},
+	})
+
+	webhook := doc.ResponseSchema(ResponseWebhook{})
+	webhookID := openapi.PathParameter("id", "Webhook ID")
+	doc.AddOperation(http.MethodPost, "/api/webhooks", &openapi.Operation{
+		OperationID: "CreateWebhook",
+		Summary:     "Create webhook",
+		Description: "subscribe the URL to events, the payloads are signed with the secret",
+		Tags:        []string{"webhooks"},
+		RequestBody: openapi.JSONRequestBody("Add webhook", doc.RequestSchema(RequestCreateWebhook{})),
+		Responses:   map[string]*openapi.Response{"201": openapi.JSONResponse("Created webhook", webhook), "default": problem},
+	})
+	doc.AddOperation(http.MethodGet, "/api/webhooks", &openapi.Operation{
+		OperationID: "ListWebhooks",
+		Summary:     "List webhooks",
+		Description: "get webhooks",
+		Tags:        []string{"webhooks"},
+		Parameters:  pageParameters,
+		Responses: map[string]*openapi.Response{
+			"200":     openapi.JSONResponse("Page of webhooks", doc.ResponseSchema(ResponseWebhooks{})),
+			"default": problem,
+		},
+	})
+	doc.AddOperation(http.MethodGet, "/api/webhooks/{id}", &openapi.Operation{
+		OperationID: "GetWebhookByID",
+		Summary:     "Get webhook by ID",
+		Description: "get webhook by ID",
+		Tags:        []string{"webhooks"},
+		Parameters:  []*openapi.Parameter{webhookID},
+		Responses:   map[string]*openapi.Response{"200": openapi.JSONResponse("Webhook", webhook), "default": problem},
+	})
+	doc.AddOperation(http.MethodPut, "/api/webhooks/{id}", &openapi.Operation{
+		OperationID: "UpdateWebhook",
+		Summary:     "Update webhook",
+		Description: "Update by json webhook, an omitted secret keeps the current one, enabled true re-enables a disabled webhook",
+		Tags:        []string{"webhooks"},
+		Parameters:  []*openapi.Parameter{webhookID},
+		RequestBody: openapi.JSONRequestBody("Update webhook", doc.RequestSchema(RequestUpdateWebhook{})),
+		Responses:   map[string]*openapi.Response{"200": openapi.JSONResponse("Updated webhook", webhook), "default": problem},
+	})
+	doc.AddOperation(http.MethodDelete, "/api/webhooks/{id}", &openapi.Operation{
+		OperationID: "DeleteWebhookByID",
+		Summary:     "Delete webhook",
+		Description: "Delete by webhook ID with its deliveries",
+		Tags:        []string{"webhooks"},
+		Parameters:  []*openapi.Parameter{webhookID},
+		Responses:   map[string]*openapi.Response{"204": openapi.EmptyResponse(http.StatusNoContent), "default": problem},
+	})
+	doc.AddOperation(http.MethodGet, "/api/webhooks/{id}/deliveries", &openapi.Operation{
+		OperationID: "ListWebhookDeliveries",
+		Summary:     "List webhook deliveries",
+		Description: "get deliveries of the webhook newest first",
+		Tags:        []string{"webhooks"},
+		Parameters:  append([]*openapi.Parameter{webhookID}, pageParameters...),
+		Responses: map[string]*openapi.Response{
+			"200":     openapi.JSONResponse("Page of deliveries", doc.ResponseSchema(ResponseWebhookDeliveries{})),
+			"default": problem,
+		},
+	})
+
+	graphqlRequest := doc.RequestSchema(graphqlapi.Request{})
+	// GraphQL clients send null for missing variables and operation names
+	for _, name := range []string{"operationName", "variables"} {
+		doc.Resolve(graphqlRequest).Properties[name].Nullable = true
+	}
+	doc.AddOperation(http.MethodPost, "/api/graphql", &openapi.Operation{
+		OperationID: "GraphQL",
+		Summary:     "GraphQL",
+		Description: "execute a GraphQL query or mutation over users and accounts, errors of the query are returned with status 200",
+		Tags:        []string{"graphql"},
+		RequestBody: openapi.JSONRequestBody("GraphQL request", graphqlRequest),
+		Responses: map[string]*openapi.Response{
+			"200":     openapi.JSONResponse("GraphQL response", doc.ResponseSchema(graphqlapi.Response{})),
+			"default": problem,
+		},
+	})
+	return doc
+}
+
+// OpenAPIDocument handler
+func (h *Handler) OpenAPIDocument(c *gin.Context) {
+	c.JSON(http.StatusOK, NewOpenAPI(h.Config().AppVersion))
+}
+
+// OpenAPIValidationMiddleware rejects requests which do not match the operation in doc, routes missing in doc are not checked.
+// If validateResponses is set responses of the handlers are buffered and replaced by an internal error when they do not match,
+// it is meant for tests since mismatches are only logged. Responses of streaming operations are never buffered.
+func OpenAPIValidationMiddleware(doc *openapi.Document, validateResponses bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op := doc.Operation(c.Request.Method, openapi.PathTemplate(c.FullPath()))
+		if op == nil {
+			c.Next()
+			return
+		}
+
+		if err := validateRequest(c, doc, op); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if !validateResponses || op.Streams() {
+			c.Next()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer, status: c.Writer.Status()}
+		c.Writer = recorder
+		c.Next()
+		c.Writer = recorder.ResponseWriter
+
+		if !recorder.written {
+			return
+		}
+		if err := validateResponse(doc, op, recorder.status, recorder.body.Bytes()); err != nil {
+			abortWithError(c, apperror.Internal(fmt.Errorf("response does not match the OpenAPI document: %w", err)))
+			return
+		}
+		c.Writer.WriteHeader(recorder.status)
+		if recorder.body.Len() > 0 {
+			_, _ = c.Writer.Write(recorder.body.Bytes())
+		}
+	}
+}
+
+func validateRequest(c *gin.Context, doc *openapi.Document, op *openapi.Operation) error {
+	var fields []apperror.FieldError
+	for _, param := range op.Parameters {
+		var value string
+		var ok bool
+		switch param.In {
+		case "path":
+			value = c.Param(param.Name)
+			ok = value != ""
+		case "header":
+			value = c.GetHeader(param.Name)
+			ok = value != ""
+		default:
+			value, ok = c.GetQuery(param.Name)
+		}
+		if !ok {
+			if param.Required {
+				fields = append(fields, apperror.FieldError{Field: param.Name, Code: "required", Message: param.Name + " is required"})
+			}
+			continue
+		}
+		fields = append(fields, doc.ValidateParameter(param, value)...)
+	}
+
+	if op.RequestBody != nil {
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			return bindingError(err)
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		bodyFields, err := doc.ValidateJSON(op.RequestBody.Schema(), body)
+		if err != nil {
+			return errInvalidBody.Wrap(err)
+		}
+		fields = append(fields, bodyFields...)
+	}
+
+	if len(fields) > 0 {
+		return errInvalidRequest.WithFields(fields...)
+	}
+	return nil
+}
+
+func validateResponse(doc *openapi.Document, op *openapi.Operation, status int, body []byte) error {
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok && status >= http.StatusBadRequest {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("status %d is not documented", status)
+	}
+
+	schema := resp.Schema()
+	if schema == nil {
+		if len(body) > 0 {
+			return fmt.Errorf("status %d has no body but %d bytes were written", status, len(body))
+		}
+		return nil
+	}
+	fields, err := doc.ValidateJSON(schema, body)
+	if err != nil {
+		return err
+	}
+	if len(fields) > 0 {
+		return fmt.Errorf("status %d: %v", status, fields)
+	}
+	return nil
+}
+
+// responseRecorder buffers the response until it is validated
+type responseRecorder struct {
+	gin.ResponseWriter
+	status  int
+	body    bytes.Buffer
+	written bool
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if code > 0 {
+		r.status = code
+		r.written = true
+	}
+}
+
+func (r *responseRecorder) WriteHeaderNow() {}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.written = true
+	return r.body.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.written = true
+	return r.body.WriteString(s)
+}
+
+func (r *responseRecorder) Status() int {
+	return r.status
+}
+
+func (r *responseRecorder) Size() int {
+	if !r.written {
+		return -1
+	}
+	return r.body.Len()
+}
+
+func (r *responseRecorder) Written() bool {
+	return r.written
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/openapi"
+	"github.com/zaharinea/go-example/pkg/repository/memory"
+	"github.com/zaharinea/go-example/pkg/service"
+	"github.com/zaharinea/go-example/pkg/tenant"
+)
+
+// TestOpenAPIDocumentsRoutes fails when a route of InitRoutes is missing in NewOpenAPI or the other way round
+func TestOpenAPIDocumentsRoutes(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	(&Handler{}).InitRoutes(engine)
+	doc := NewOpenAPI("1.0.0")
+
+	routes := engine.Routes()
+	for _, route := range routes {
+		require.NotNil(t, doc.Operation(route.Method, openapi.PathTemplate(route.Path)), "%s %s is not documented", route.Method, route.Path)
+	}
+	require.Equal(t, len(routes), doc.Operations())
+}
+
+// TestOpenAPIDocumentsResponses serves every documented operation by its handler with response validation,
+// so schemas drifting from the request and response types of the handlers fail here rather than in production
+func TestOpenAPIDocumentsResponses(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	ctx := context.Background()
+	repos := memory.NewRepository(clock.NewFake(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)), idgen.NewSequence())
+	doc := NewOpenAPI("1.0.0")
+	router := gin.New()
+	router.Use(ErrorMiddleware(), OpenAPIValidationMiddleware(doc, true))
+	NewHandler(config.NewDefaultConfig(), service.NewService(repos)).InitRoutes(router)
+
+	// every optional field is set so that its schema is checked too
+	_, err := repos.Account.CreateOrUpdate(ctx, domain.Account{ExternalID: "1", Name: "account1"}, true)
+	require.NoError(t, err)
+	user := domain.User{Name: "user1", AccountExternalID: "1"}
+	require.NoError(t, repos.User.Create(ctx, &user))
+	webhook := domain.Webhook{URL: "https://example.com/hook", EventTypes: []string{domain.EventUserCreated}, Secret: "0123456789abcdef"}
+	require.NoError(t, repos.Webhook.Create(tenant.WithTenant(ctx, "1"), &webhook))
+	_, err = repos.Webhook.RecordFailure(ctx, webhook.ID, 1)
+	require.NoError(t, err)
+	delivery := domain.WebhookDelivery{WebhookID: webhook.ID, EventType: domain.EventUserCreated, Payload: "{}"}
+	require.NoError(t, repos.WebhookDelivery.Create(ctx, &delivery))
+	lastAttemptAt := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	delivery.Attempts, delivery.LastAttemptAt, delivery.ResponseStatus, delivery.Error = 1, &lastAttemptAt, 500, "unexpected status 500"
+	require.NoError(t, repos.WebhookDelivery.Update(ctx, &delivery))
+
+	webhookBody := `{"url": "https://example.com/hook", "event_types": ["user.created"], "secret": "0123456789abcdef"}`
+	requests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"GET", "/api/healthcheck", "", http.StatusOK},
+		{"GET", "/api/readycheck", "", http.StatusOK},
+		{"POST", "/api/users", `{"name": "user2", "account_external_id": "1"}`, http.StatusCreated},
+		{"POST", "/api/users", `{"name": "user2", "account_external_id": "2"}`, http.StatusBadRequest},
+		{"GET", "/api/users", "", http.StatusOK},
+		{"GET", "/api/users/" + user.ID, "", http.StatusOK},
+		{"GET", "/api/users/000000000000000000000000", "", http.StatusNotFound},
+		{"PUT", "/api/users/" + user.ID, `{"name": "user3"}`, http.StatusOK},
+		{"GET", "/api/accounts/1/users", "", http.StatusOK},
+		{"POST", "/api/webhooks", webhookBody, http.StatusCreated},
+		{"GET", "/api/webhooks", "", http.StatusOK},
+		{"GET", "/api/webhooks/" + webhook.ID, "", http.StatusOK},
+		{"PUT", "/api/webhooks/" + webhook.ID, webhookBody, http.StatusOK},
+		{"GET", "/api/webhooks/" + webhook.ID + "/deliveries", "", http.StatusOK},
+		{"POST", "/api/graphql", `{"query": "{ users(limit: 10) { id name account { externalId name } } }"}`, http.StatusOK},
+		{"DELETE", "/api/webhooks/" + webhook.ID, "", http.StatusNoContent},
+		{"DELETE", "/api/users/" + user.ID, "", http.StatusNoContent},
+	}
+	// the stream does not end by itself, its event stream response has no schema
+	served := map[string]bool{"GET /api/users/stream": true}
+	for _, r := range requests {
+		w := performRequest(router, r.method, r.path, r.body)
+		require.Equal(t, r.status, w.Code, "%s %s: %s", r.method, r.path, w.Body.String())
+		for _, route := range router.Routes() {
+			if route.Method == r.method && matchRoute(route.Path, r.path) {
+				served[route.Method+" "+route.Path] = true
+			}
+		}
+	}
+	require.Equal(t, doc.Operations(), len(served), "every operation is served")
+}
+
+// matchRoute returns true if the path matches the gin route with :name parameters
+func matchRoute(route string, path string) bool {
+	routeParts, pathParts := strings.Split(route, "/"), strings.Split(path, "/")
+	if len(routeParts) != len(pathParts) {
+		return false
+	}
+	for i := range routeParts {
+		if !strings.HasPrefix(routeParts[i], ":") && routeParts[i] != pathParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type OpenAPIValidationSuite struct {
+	suite.Suite
+	router *gin.Engine
+	body   interface{}
+	status int
+}
+
+func (s *OpenAPIValidationSuite) SetupTest() {
+	gin.SetMode(gin.ReleaseMode)
+	s.router = gin.New()
+	s.router.Use(ErrorMiddleware())
+	s.router.Use(OpenAPIValidationMiddleware(NewOpenAPI("1.0.0"), true))
+
+	respond := func(c *gin.Context) {
+		if s.body == nil {
+			c.Status(s.status)
+			return
+		}
+		c.JSON(s.status, s.body)
+	}
+	s.router.GET("/api/users", respond)
+	s.router.GET("/api/users/:id", respond)
+	s.router.POST("/api/users", respond)
+	s.router.DELETE("/api/users/:id", respond)
+	s.router.GET("/undocumented", respond)
+
+	s.status = http.StatusOK
+	s.body = gin.H{"items": []gin.H{}}
+}
+
+func (s *OpenAPIValidationSuite) TestValidRequest() {
+	w := performRequest(s.router, "GET", "/api/users?limit=10&offset=0", "")
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().JSONEq(`{"items":[]}`, w.Body.String())
+}
+
+func (s *OpenAPIValidationSuite) TestInvalidQuery() {
+	w := performRequest(s.router, "GET", "/api/users?limit=ten", "")
+	s.Require().Equal(http.StatusBadRequest, w.Code)
+	s.Require().Equal(
+		`[{"field":"limit","code":"type","message":"limit must be integer"}]`,
+		problemFields(s.T(), w.Body.Bytes()),
+	)
+}
+
+func (s *OpenAPIValidationSuite) TestInvalidBody() {
+	w := performRequest(s.router, "POST", "/api/users", `{"name":1,"account_external_id":null}`)
+	s.Require().Equal(http.StatusBadRequest, w.Code)
+	s.Require().Equal(
+		`[{"field":"account_external_id","code":"type","message":"account_external_id must be string"},`+
+			`{"field":"name","code":"type","message":"name must be string"}]`,
+		problemFields(s.T(), w.Body.Bytes()),
+	)
+
+	w = performRequest(s.router, "POST", "/api/users", `{}`)
+	s.Require().Equal(http.StatusBadRequest, w.Code)
+	s.Require().Equal(`[{"field":"name","code":"required","message":"name is required"}]`, problemFields(s.T(), w.Body.Bytes()))
+
+	w = performRequest(s.router, "POST", "/api/users", `{"name":`)
+	s.Require().Equal(http.StatusBadRequest, w.Code)
+	s.Require().Contains(w.Body.String(), `"code":"invalid_body"`)
+}
+
+func (s *OpenAPIValidationSuite) TestRequestBodyIsPassedToHandler() {
+	s.router.PUT("/api/users/:id", func(c *gin.Context) {
+		var req RequestUpdateUser
+		s.Require().NoError(c.ShouldBindJSON(&req))
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "name": req.Name, "created_at": "2020-12-01T00:00:00Z", "updated_at": "2020-12-01T00:00:00Z"})
+	})
+
+	w := performRequest(s.router, "PUT", "/api/users/1", `{"name":"user1"}`)
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Contains(w.Body.String(), `"name":"user1"`)
+}
+
+func (s *OpenAPIValidationSuite) TestInvalidResponse() {
+	s.body = gin.H{"id": "1", "name": 1, "created_at": "yesterday"}
+	w := performRequest(s.router, "GET", "/api/users/1", "")
+	s.Require().Equal(http.StatusInternalServerError, w.Code)
+	s.Require().Contains(w.Body.String(), `"code":"internal_error"`)
+}
+
+func (s *OpenAPIValidationSuite) TestUndocumentedStatus() {
+	s.status = http.StatusAccepted
+	w := performRequest(s.router, "GET", "/api/users", "")
+	s.Require().Equal(http.StatusInternalServerError, w.Code)
+}
+
+func (s *OpenAPIValidationSuite) TestEmptyResponse() {
+	s.status, s.body = http.StatusNoContent, nil
+	w := performRequest(s.router, "DELETE", "/api/users/1", "")
+	s.Require().Equal(http.StatusNoContent, w.Code)
+	s.Require().Empty(w.Body.String())
+
+	s.status, s.body = http.StatusNoContent, gin.H{}
+	w = performRequest(s.router, "DELETE", "/api/users/1", "")
+	s.Require().Equal(http.StatusNoContent, w.Code)
+
+	s.status, s.body = http.StatusOK, gin.H{}
+	w = performRequest(s.router, "DELETE", "/api/users/1", "")
+	s.Require().Equal(http.StatusInternalServerError, w.Code)
+}
+
+func (s *OpenAPIValidationSuite) TestUndocumentedRouteIsNotValidated() {
+	s.status = http.StatusAccepted
+	w := performRequest(s.router, "GET", "/undocumented?limit=ten", "")
+	s.Require().Equal(http.StatusAccepted, w.Code)
+}
+
+func TestOpenAPIValidationSuite(t *testing.T) {
+	suite.Run(t, new(OpenAPIValidationSuite))
+}
+
+func problemFields(t *testing.T, body []byte) string {
+	var problem ResponseProblem
+	require.NoError(t, json.Unmarshal(body, &problem))
+	fields, err := json.Marshal(problem.Errors)
+	require.NoError(t, err)
+	return string(fields)
+}
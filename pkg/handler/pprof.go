@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InitPprofRoutes initialize net/http/pprof endpoints under /debug/pprof/, they are served only by the admin listener
+func InitPprofRoutes(engine *gin.Engine) {
+	engine.Any("/debug/pprof/*name", func(c *gin.Context) {
+		switch c.Param("name") {
+		case "/cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "/profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "/symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "/trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			pprof.Index(c.Writer, c.Request)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+)
+
+// RateLimiter is a token bucket limiting requests per second of all clients, the burst equals the rate
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	clock  clock.Clock
+}
+
+// NewRateLimiter returns a new RateLimiter struct, rate <= 0 disables limiting, clock drives the refill of the bucket
+func NewRateLimiter(rate int64, clock clock.Clock) *RateLimiter {
+	l := &RateLimiter{clock: clock}
+	l.SetRate(rate)
+	return l
+}
+
+// SetRate changes the rate, it is subscribed to config reloads
+func (l *RateLimiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.setRate(rate)
+}
+
+func (l *RateLimiter) setRate(rate int64) {
+	l.rate = float64(rate)
+	l.tokens = l.rate
+	l.last = l.clock.Now()
+}
+
+// SetConfig applies RateLimit from the config, the bucket is refilled only when the rate changes
+func (l *RateLimiter) SetConfig(c *config.Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate != float64(c.RateLimit) {
+		l.setRate(c.RateLimit)
+	}
+}
+
+// Allow returns true if the request is allowed
+func (l *RateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return true
+	}
+
+	now := l.clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// RateLimitMiddleware middleware rejecting requests over the limit with 429
+func RateLimitMiddleware(l *RateLimiter) gin.HandlerFunc {
+	skipPaths := map[string]bool{"/api/healthcheck": true, "/api/readycheck": true, "/metrics": true}
+
+	return func(c *gin.Context) {
+		if !skipPaths[c.Request.URL.Path] && !l.Allow() {
+			abortWithError(c, errTooManyRequests)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+)
+
+func TestRateLimiter(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC))
+	l := NewRateLimiter(2, fakeClock)
+
+	assert.True(t, l.Allow())
+	assert.True(t, l.Allow())
+	assert.False(t, l.Allow())
+
+	fakeClock.Advance(500 * time.Millisecond)
+	assert.True(t, l.Allow())
+	assert.False(t, l.Allow())
+
+	l.SetRate(0)
+	for i := 0; i < 10; i++ {
+		assert.True(t, l.Allow())
+	}
+}
+
+func TestRateLimiterSetConfigKeepsBucket(t *testing.T) {
+	l := NewRateLimiter(0, clock.NewFake(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)))
+	l.SetConfig(&config.Config{RateLimit: 1})
+	assert.True(t, l.Allow())
+	assert.False(t, l.Allow())
+
+	l.SetConfig(&config.Config{RateLimit: 1})
+	assert.False(t, l.Allow(), "a reload without changes does not refill the bucket")
+
+	l.SetConfig(&config.Config{RateLimit: 2})
+	assert.True(t, l.Allow())
+}
@@ -1,15 +1,132 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/zaharinea/go-example/pkg/apperror"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:go-example:problem:"
+)
+
+// ResponseProblem struct is an RFC 7807 problem details object
+type ResponseProblem struct {
+	Type      string                `json:"type"`
+	Title     string                `json:"title"`
+	Status    int                   `json:"status"`
+	Detail    string                `json:"detail"`
+	Code      string                `json:"code"`
+	RequestID string                `json:"request_id,omitempty"`
+	Errors    []apperror.FieldError `json:"errors,omitempty"`
+}
+
+var statusByKind = map[apperror.Kind]int{
+	apperror.KindValidation:       http.StatusBadRequest,
+	apperror.KindUnauthorized:     http.StatusUnauthorized,
+	apperror.KindForbidden:        http.StatusForbidden,
+	apperror.KindNotFound:         http.StatusNotFound,
+	apperror.KindMethodNotAllowed: http.StatusMethodNotAllowed,
+	apperror.KindConflict:         http.StatusConflict,
+	apperror.KindPayloadTooLarge:  http.StatusRequestEntityTooLarge,
+	apperror.KindTooManyRequests:  http.StatusTooManyRequests,
+	apperror.KindUnavailable:      http.StatusServiceUnavailable,
+	apperror.KindInternal:         http.StatusInternalServerError,
+}
+
+// Errors of the transport layer
+var (
+	errNotFound         = apperror.NotFound("not_found", "Not found")
+	errMethodNotAllowed = apperror.New(apperror.KindMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	errBodyTooLarge     = apperror.New(apperror.KindPayloadTooLarge, "payload_too_large", "Request body too large")
+	errTooManyRequests  = apperror.New(apperror.KindTooManyRequests, "too_many_requests", "Too many requests")
+	errInvalidRequest   = apperror.Validation("invalid_request", "Request is invalid")
+	errInvalidBody      = apperror.Validation("invalid_body", "Request body is not valid JSON")
 )
 
-type errorResponse struct {
-	Message string `json:"message"`
+func init() {
+	// report fields by their names in the request instead of names of struct fields
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form", "uri"} {
+				if name := strings.Split(field.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	}
 }
 
-type emptyResponse struct{}
+// abortWithError aborts the request, the error is rendered by ErrorMiddleware
+func abortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// bindingError returns the error of binding the request
+func bindingError(err error) *apperror.Error {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]apperror.FieldError, len(validationErrs))
+		for i, fieldErr := range validationErrs {
+			fields[i] = apperror.FieldError{Field: fieldErr.Field(), Code: fieldErr.Tag(), Message: fieldMessage(fieldErr)}
+		}
+		return errInvalidRequest.WithFields(fields...).Wrap(err)
+	case errors.As(err, &typeErr):
+		return errInvalidRequest.WithFields(apperror.FieldError{
+			Field: typeErr.Field, Code: "type", Message: fmt.Sprintf("%s must be %s", typeErr.Field, typeErr.Type),
+		}).Wrap(err)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errInvalidBody.Wrap(err)
+	case err.Error() == "http: request body too large":
+		return errBodyTooLarge.Wrap(err)
+	default:
+		return errInvalidRequest.Wrap(err)
+	}
+}
+
+func fieldMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fieldErr.Field())
+	default:
+		return fmt.Sprintf("%s failed on the '%s' rule", fieldErr.Field(), fieldErr.Tag())
+	}
+}
+
+// newProblem returns the problem for err, details of internal errors are hidden
+func newProblem(c *gin.Context, err *apperror.Error) *ResponseProblem {
+	status, ok := statusByKind[err.Kind]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	return &ResponseProblem{
+		Type:      problemTypePrefix + string(err.Kind),
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    err.Message,
+		Code:      err.Code,
+		RequestID: c.GetString(contextRequestIDKey),
+		Errors:    err.Fields,
+	}
+}
 
-func newErrorResponse(c *gin.Context, statusCode int, message string) {
-	c.AbortWithStatusJSON(statusCode, errorResponse{message})
+func renderProblem(c *gin.Context, problem *ResponseProblem) {
+	c.Header("Content-Type", problemContentType)
+	c.JSON(problem.Status, problem)
 }
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/openapi"
+)
+
+// streamRetry is the reconnection delay sent to clients of event streams
+const streamRetry = time.Second
+
+// ResponseDeletedUser struct
+type ResponseDeletedUser struct {
+	ID string `json:"id"`
+}
+
+// StopStreams ends open event streams, clients reconnect with Last-Event-ID.
+// It is called on shutdown before the HTTP server waits for active requests.
+func (h *Handler) StopStreams() {
+	h.stopOnce.Do(func() { close(h.stop) })
+}
+
+// StreamUsers handler
+// @Summary Stream user changes
+// @Description stream created, updated and deleted users as Server-Sent Events, the data of deleted events holds only the user ID.
+// @Description Last-Event-ID resumes the stream after the event, idle streams send heartbeats.
+// @Tags users
+// @Produce text/event-stream
+// @Param Last-Event-ID header string false "ID of the last received event"
+// @Success 200 {string} string "Stream of created, updated and deleted events"
+// @Failure 400 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
+// @Router /api/users/stream [get]
+func (h *Handler) StreamUsers(c *gin.Context) {
+	config := h.Config()
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	if timeout := config.StreamTimeout(); timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+	}
+
+	stream, err := h.services.User.Watch(ctx, c.GetHeader("Last-Event-ID"), config.StreamHeartbeatInterval)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	defer func() { _ = stream.Close(context.Background()) }()
+
+	go func() {
+		select {
+		case <-h.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", openapi.ContentTypeEventStream)
+	header.Set("Cache-Control", "no-cache")
+	// disables buffering of proxies like nginx
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	_, err = fmt.Fprintf(c.Writer, "retry: %d\nid: %s\n\n", streamRetry.Milliseconds(), stream.ResumeToken())
+	for err == nil {
+		c.Writer.Flush()
+
+		var change *domain.UserChange
+		change, err = stream.Next(ctx)
+		switch {
+		case ctx.Err() != nil:
+			// the client is gone, the server is shutting down or the stream is due to end
+			return
+		case err != nil:
+			logrus.Errorf("User stream failed: request_id=%s, error=%s", c.GetString(contextRequestIDKey), err)
+			sentry.CurrentHub().CaptureException(err)
+			return
+		case change == nil:
+			_, err = fmt.Fprintf(c.Writer, ": heartbeat\nid: %s\n\n", stream.ResumeToken())
+		default:
+			err = writeUserEvent(c.Writer, change)
+		}
+	}
+}
+
+// writeUserEvent writes the change as an event named by its type, the data is JSON on a single line
+func writeUserEvent(w io.Writer, change *domain.UserChange) error {
+	var data interface{} = newResponseUser(change.User)
+	if change.Type == domain.UserDeleted {
+		data = ResponseDeletedUser{ID: change.User.ID}
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", change.Token, change.Type, encoded)
+	return err
+}
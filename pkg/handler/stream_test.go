@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository/memory"
+	"github.com/zaharinea/go-example/pkg/service"
+)
+
+type StreamSuite struct {
+	suite.Suite
+	ctx      context.Context
+	config   *config.Config
+	services *service.Service
+	handlers *Handler
+	server   *httptest.Server
+}
+
+func (s *StreamSuite) SetupTest() {
+	gin.SetMode(gin.ReleaseMode)
+	s.ctx = context.Background()
+	s.config = &config.Config{PageSize: 25, StreamHeartbeatInterval: 50 * time.Millisecond}
+	s.services = service.NewService(memory.NewRepository(clock.NewFake(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)), idgen.NewSequence()))
+	s.handlers = NewHandler(s.config, s.services)
+
+	router := gin.New()
+	router.Use(ErrorMiddleware(), Recovery(RecoveryHandler), OpenAPIValidationMiddleware(NewOpenAPI("1.0.0"), true))
+	s.handlers.InitRoutes(router)
+	s.server = httptest.NewServer(router)
+}
+
+func (s *StreamSuite) TearDownTest() {
+	s.server.Close()
+}
+
+// open opens the stream of users and reads its first event
+func (s *StreamSuite) open(lastEventID string) (*http.Response, *bufio.Reader, string) {
+	req, err := http.NewRequest("GET", s.server.URL+"/api/users/stream", nil)
+	s.Require().NoError(err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := s.server.Client().Do(req)
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Require().Equal("text/event-stream", resp.Header.Get("Content-Type"))
+	s.Require().Equal("no-cache", resp.Header.Get("Cache-Control"))
+
+	r := bufio.NewReader(resp.Body)
+	event := s.read(r)
+	s.Require().True(strings.HasPrefix(event, "retry: 1000\nid: "), event)
+	return resp, r, strings.TrimPrefix(event, "retry: 1000\nid: ")
+}
+
+// read returns the next event without its trailing blank line
+func (s *StreamSuite) read(r *bufio.Reader) string {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		s.Require().NoError(err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return strings.Join(lines, "\n")
+		}
+		lines = append(lines, line)
+	}
+}
+
+func (s *StreamSuite) TestEvents() {
+	resp, r, _ := s.open("")
+	defer resp.Body.Close()
+
+	user := domain.User{Name: "user1"}
+	s.Require().NoError(s.services.User.Create(s.ctx, &user))
+	s.Require().Equal(`id: 0000000000000001
+event: created
+data: {"id":"000000000000000000000001","name":"user1","created_at":"2020-12-01T00:00:00Z","updated_at":"2020-12-01T00:00:00Z"}`, s.read(r))
+
+	s.Require().NoError(s.services.User.Update(s.ctx, user.ID, domain.UpdateUser{Name: "user2"}))
+	s.Require().Equal(`id: 0000000000000002
+event: updated
+data: {"id":"000000000000000000000001","name":"user2","created_at":"2020-12-01T00:00:00Z","updated_at":"2020-12-01T00:00:00Z"}`, s.read(r))
+
+	s.Require().NoError(s.services.User.DeleteByID(s.ctx, user.ID))
+	s.Require().Equal("id: 0000000000000003\nevent: deleted\ndata: {\"id\":\"000000000000000000000001\"}", s.read(r))
+
+	s.Require().Equal(": heartbeat\nid: 0000000000000003", s.read(r))
+}
+
+func (s *StreamSuite) TestResume() {
+	resp, r, _ := s.open("")
+	user := domain.User{Name: "user1"}
+	s.Require().NoError(s.services.User.Create(s.ctx, &user))
+	s.Require().Contains(s.read(r), "event: created")
+	resp.Body.Close()
+
+	s.Require().NoError(s.services.User.DeleteByID(s.ctx, user.ID))
+
+	resp, r, id := s.open("0000000000000001")
+	defer resp.Body.Close()
+	s.Require().Equal("0000000000000001", id)
+	s.Require().Contains(s.read(r), "id: 0000000000000002\nevent: deleted")
+}
+
+func (s *StreamSuite) TestInvalidLastEventID() {
+	req, err := http.NewRequest("GET", s.server.URL+"/api/users/stream", nil)
+	s.Require().NoError(err)
+	req.Header.Set("Last-Event-ID", "token")
+	resp, err := s.server.Client().Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Require().Equal(http.StatusBadRequest, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	s.Require().Contains(string(body), `"code":"invalid_resume_token"`)
+}
+
+func (s *StreamSuite) TestStopStreams() {
+	resp, r, _ := s.open("")
+	defer resp.Body.Close()
+
+	s.handlers.StopStreams()
+	_, err := r.ReadString('\n')
+	s.Require().Equal(io.EOF, err)
+}
+
+func (s *StreamSuite) TestEndsBeforeWriteTimeout() {
+	s.config.HTTPWriteTimeout = 200 * time.Millisecond
+	resp, r, _ := s.open("")
+	defer resp.Body.Close()
+
+	s.Require().Equal(": heartbeat\nid: 0000000000000000", s.read(r))
+	for {
+		if _, err := r.ReadString('\n'); err != nil {
+			s.Require().Equal(io.EOF, err)
+			break
+		}
+	}
+}
+
+func TestStreamHeartbeatWithDefaultConfig(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	services := service.NewService(memory.NewRepository(clock.System{}, idgen.NewSequence()))
+	router := gin.New()
+	NewHandler(config.NewDefaultConfig(), services).InitRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/api/users/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	events := make(chan string)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			events <- scanner.Text()
+		}
+	}()
+
+	start := time.Now()
+	for line := range events {
+		if strings.HasPrefix(line, ": heartbeat") {
+			return
+		}
+	}
+	t.Fatalf("stream ended after %s without a heartbeat", time.Since(start))
+}
+
+func TestStreamSuite(t *testing.T) {
+	suite.Run(t, new(StreamSuite))
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/auth"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/repository/memory"
+	"github.com/zaharinea/go-example/pkg/service"
+	"github.com/zaharinea/go-example/pkg/tenant"
+	"golang.org/x/net/context"
+)
+
+func performTenantRequest(r http.Handler, method, path string, body string, tenantID string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(tenantIDHeaderName, tenantID)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type TenantMiddlewareSuite struct {
+	suite.Suite
+	config *config.Config
+	router *gin.Engine
+	clock  *clock.Fake
+}
+
+func (s *TenantMiddlewareSuite) SetupTest() {
+	gin.SetMode(gin.ReleaseMode)
+	s.config = &config.Config{JWTSecret: "secret", TenantJWTClaim: "tenant_id"}
+	s.clock = clock.NewFake(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC))
+	s.router = gin.New()
+	s.router.Use(ErrorMiddleware(), TenantMiddleware(s.config, s.clock))
+	s.router.GET("/", func(c *gin.Context) {
+		tenantID, _ := tenant.FromContext(c)
+		c.String(http.StatusOK, tenantID)
+	})
+}
+
+func (s *TenantMiddlewareSuite) performRequest(headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/", nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *TenantMiddlewareSuite) TestHeader() {
+	w := s.performRequest(map[string]string{tenantIDHeaderName: "1"})
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Equal("1", w.Body.String())
+}
+
+func (s *TenantMiddlewareSuite) TestJWT() {
+	token, err := auth.NewToken(auth.Claims{"tenant_id": "1"}, "secret")
+	s.Require().NoError(err)
+
+	w := s.performRequest(map[string]string{authorizationHeaderName: "Bearer " + token})
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Equal("1", w.Body.String())
+}
+
+func (s *TenantMiddlewareSuite) TestErrorExpiredJWT() {
+	token, err := auth.NewToken(auth.Claims{"tenant_id": "1", "exp": s.clock.Now().Add(time.Minute).Unix()}, "secret")
+	s.Require().NoError(err)
+
+	w := s.performRequest(map[string]string{authorizationHeaderName: "Bearer " + token})
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	s.clock.Advance(time.Minute)
+	w = s.performRequest(map[string]string{authorizationHeaderName: "Bearer " + token})
+	s.Require().Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (s *TenantMiddlewareSuite) TestErrorInvalidJWT() {
+	token, err := auth.NewToken(auth.Claims{"tenant_id": "1"}, "other")
+	s.Require().NoError(err)
+
+	w := s.performRequest(map[string]string{authorizationHeaderName: "Bearer " + token})
+	s.Require().Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (s *TenantMiddlewareSuite) TestErrorMismatch() {
+	token, err := auth.NewToken(auth.Claims{"tenant_id": "1"}, "secret")
+	s.Require().NoError(err)
+
+	w := s.performRequest(map[string]string{authorizationHeaderName: "Bearer " + token, tenantIDHeaderName: "2"})
+	s.Require().Equal(http.StatusForbidden, w.Code)
+}
+
+func (s *TenantMiddlewareSuite) TestErrorRequired() {
+	s.config.TenantRequired = true
+
+	w := s.performRequest(map[string]string{})
+	s.Require().Equal(http.StatusUnauthorized, w.Code)
+}
+
+func TestTenantMiddlewareSuite(t *testing.T) {
+	suite.Run(t, new(TenantMiddlewareSuite))
+}
+
+type TenantIsolationSuite struct {
+	suite.Suite
+	ctx    context.Context
+	config *config.Config
+	router *gin.Engine
+	repos  *repository.Repository
+	userA  ResponseUser
+	userB  ResponseUser
+}
+
+func (s *TenantIsolationSuite) SetupSuite() {
+	gin.SetMode(gin.ReleaseMode)
+	s.ctx = context.Background()
+	s.config = &config.Config{PageSize: 25}
+	s.repos = memory.NewRepository(clock.System{}, idgen.NewSequence())
+	handlers := NewHandler(s.config, service.NewService(s.repos))
+
+	s.router = gin.New()
+	s.router.Use(ErrorMiddleware(), TenantMiddleware(s.config, clock.System{}))
+	handlers.InitRoutes(s.router)
+}
+
+func (s *TenantIsolationSuite) SetupTest() {
+	s.Require().NoError(s.repos.User.DeleteAll(s.ctx))
+	s.Require().NoError(s.repos.Account.DeleteAll(s.ctx))
+
+	for _, externalID := range []string{"A", "B"} {
+		_, err := s.repos.Account.CreateOrUpdate(s.ctx, domain.Account{
+			ExternalID: externalID,
+			Name:       "account" + externalID,
+			CreatedAt:  time.Date(2020, 11, 23, 23, 0, 0, 0, time.UTC),
+			UpdatedAt:  time.Date(2020, 11, 23, 23, 0, 0, 0, time.UTC),
+		}, true)
+		s.Require().NoError(err)
+	}
+
+	w := performTenantRequest(s.router, "POST", "/api/users", `{"name": "userA"}`, "A")
+	s.Require().Equal(http.StatusCreated, w.Code)
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &s.userA))
+	w = performTenantRequest(s.router, "POST", "/api/users", `{"name": "userB"}`, "B")
+	s.Require().Equal(http.StatusCreated, w.Code)
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &s.userB))
+}
+
+func (s *TenantIsolationSuite) TestCreateAssignsTenant() {
+	s.Require().Equal("A", s.userA.AccountExternalID)
+	s.Require().Equal("B", s.userB.AccountExternalID)
+}
+
+func (s *TenantIsolationSuite) TestCreateErrorOtherTenantAccount() {
+	w := performTenantRequest(s.router, "POST", "/api/users", `{"name": "userC", "account_external_id": "B"}`, "A")
+	s.Require().Equal(http.StatusForbidden, w.Code)
+	s.Require().Contains(w.Body.String(), `"code":"tenant_mismatch"`)
+
+	w = performTenantRequest(s.router, "PUT", "/api/users/"+s.userA.ID, `{"name": "userC", "account_external_id": "B"}`, "A")
+	s.Require().Equal(http.StatusForbidden, w.Code)
+}
+
+func (s *TenantIsolationSuite) TestCreateErrorUnknownTenantAccount() {
+	w := performTenantRequest(s.router, "POST", "/api/users", `{"name": "userC"}`, "C")
+	s.Require().Equal(http.StatusBadRequest, w.Code)
+	s.Require().Contains(w.Body.String(), `"code":"unknown_account"`)
+}
+
+func (s *TenantIsolationSuite) TestListReturnsOnlyOwnUsers() {
+	w := performTenantRequest(s.router, "GET", "/api/users", "", "A")
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	response := ResponseUsers{}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	s.Require().Equal(1, len(response.Items))
+	s.Require().Equal(s.userA.ID, response.Items[0].ID)
+}
+
+func (s *TenantIsolationSuite) TestGetOtherTenantUserNotFound() {
+	w := performTenantRequest(s.router, "GET", "/api/users/"+s.userB.ID, "", "A")
+	s.Require().Equal(http.StatusNotFound, w.Code)
+}
+
+func (s *TenantIsolationSuite) TestUpdateOtherTenantUserNotFound() {
+	w := performTenantRequest(s.router, "PUT", "/api/users/"+s.userB.ID, `{"name": "user"}`, "A")
+	s.Require().Equal(http.StatusNotFound, w.Code)
+
+	user, err := s.repos.User.GetByID(s.ctx, s.userB.ID)
+	s.Require().NoError(err)
+	s.Require().Equal("userB", user.Name)
+}
+
+func (s *TenantIsolationSuite) TestDeleteOtherTenantUserNotFound() {
+	w := performTenantRequest(s.router, "DELETE", "/api/users/"+s.userB.ID, "", "A")
+	s.Require().Equal(http.StatusNotFound, w.Code)
+
+	_, err := s.repos.User.GetByID(s.ctx, s.userB.ID)
+	s.Require().NoError(err)
+}
+
+func (s *TenantIsolationSuite) TestListOtherTenantAccountUsersNotFound() {
+	w := performTenantRequest(s.router, "GET", "/api/accounts/B/users", "", "A")
+	s.Require().Equal(http.StatusNotFound, w.Code)
+}
+
+func TestTenantIsolationSuite(t *testing.T) {
+	suite.Run(t, new(TenantIsolationSuite))
+}
@@ -5,18 +5,19 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/zaharinea/go-example/pkg/repository"
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/zaharinea/go-example/pkg/domain"
 )
 
 // RequestCreateUser struct
 type RequestCreateUser struct {
-	Name string `json:"name" binding:"required"`
+	Name              string `json:"name" binding:"required"`
+	AccountExternalID string `json:"account_external_id"`
 }
 
 // RequestUpdateUser struct
 type RequestUpdateUser struct {
-	Name string `json:"name" binding:"required"`
+	Name              string `json:"name" binding:"required"`
+	AccountExternalID string `json:"account_external_id"`
 }
 
 // RequestListUsers struct
@@ -32,10 +33,11 @@ type RequestGetUser struct {
 
 // ResponseUser struct
 type ResponseUser struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	AccountExternalID string    `json:"account_external_id,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
 }
 
 // ResponseUsers struct
@@ -43,16 +45,17 @@ type ResponseUsers struct {
 	Items []*ResponseUser `json:"items"`
 }
 
-func newResponseUser(user *repository.User) *ResponseUser {
+func newResponseUser(user *domain.User) *ResponseUser {
 	return &ResponseUser{
-		ID:        user.ID.Hex(),
-		Name:      user.Name,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:                user.ID,
+		Name:              user.Name,
+		AccountExternalID: user.AccountExternalID,
+		CreatedAt:         user.CreatedAt,
+		UpdatedAt:         user.UpdatedAt,
 	}
 }
 
-func newResponseUsers(users []*repository.User) *ResponseUsers {
+func newResponseUsers(users []*domain.User) *ResponseUsers {
 	items := make([]*ResponseUser, len(users))
 	for idx, user := range users {
 		items[idx] = newResponseUser(user)
@@ -60,8 +63,6 @@ func newResponseUsers(users []*repository.User) *ResponseUsers {
 	return &ResponseUsers{Items: items}
 }
 
-const errMessageUserNotFound = "Not found user"
-
 // CreateUser handler
 // @Summary Create user
 // @Tags users
@@ -69,18 +70,20 @@ const errMessageUserNotFound = "Not found user"
 // @Produce  json
 // @Param user body RequestCreateUser true "Add user"
 // @Success 201 {object} ResponseUser
+// @Failure 400 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
 // @Router /api/users [post]
 func (h *Handler) CreateUser(c *gin.Context) {
 	var req RequestCreateUser
 	if err := c.ShouldBindJSON(&req); err != nil {
-		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		abortWithError(c, bindingError(err))
 		return
 	}
 
-	newUser := repository.User{Name: req.Name}
+	newUser := domain.User{Name: req.Name, AccountExternalID: req.AccountExternalID}
 	err := h.services.User.Create(c, &newUser)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		abortWithError(c, err)
 		return
 	}
 
@@ -96,15 +99,17 @@ func (h *Handler) CreateUser(c *gin.Context) {
 // @Param limit query int false "limit" mininum(1) maxinum(100) default(25)
 // @Param offset query int false "offset" mininum(0) default(0)
 // @Success 200 {object} ResponseUsers
+// @Failure 400 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
 // @Router /api/users [get]
 func (h *Handler) ListUsers(c *gin.Context) {
 	var req RequestListUsers
 	if err := c.ShouldBindQuery(&req); err != nil {
-		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		abortWithError(c, bindingError(err))
 		return
 	}
 	if req.Limit <= 0 || req.Limit > 100 {
-		req.Limit = h.config.PageSize
+		req.Limit = h.Config().PageSize
 	}
 	if req.Offset < 0 {
 		req.Offset = 0
@@ -112,7 +117,7 @@ func (h *Handler) ListUsers(c *gin.Context) {
 
 	users, err := h.services.User.List(c, req.Limit, req.Offset)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		abortWithError(c, err)
 		return
 	}
 
@@ -127,22 +132,19 @@ func (h *Handler) ListUsers(c *gin.Context) {
 // @Produce  json
 // @Param  id path string true "User ID"
 // @Success 200 {object} ResponseUser
+// @Failure 404 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
 // @Router /api/users/{id} [get]
 func (h *Handler) GetUserByID(c *gin.Context) {
 	var req RequestGetUser
 	if err := c.ShouldBindUri(&req); err != nil {
-		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		abortWithError(c, bindingError(err))
 		return
 	}
 
 	user, err := h.services.User.GetByID(c, req.ID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			newErrorResponse(c, http.StatusNotFound, errMessageUserNotFound)
-			return
-		}
-
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		abortWithError(c, err)
 		return
 	}
 
@@ -158,29 +160,27 @@ func (h *Handler) GetUserByID(c *gin.Context) {
 // @Param  id path string true "User ID"
 // @Param user body RequestUpdateUser true "Update user"
 // @Success 200 {object} ResponseUser
+// @Failure 400 {object} ResponseProblem
+// @Failure 404 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
 // @Router /api/users/{id} [put]
 func (h *Handler) UpdateUser(c *gin.Context) {
 	var reqURI RequestGetUser
 	if err := c.ShouldBindUri(&reqURI); err != nil {
-		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		abortWithError(c, bindingError(err))
 		return
 	}
 
 	var reqData RequestUpdateUser
 	if err := c.ShouldBindJSON(&reqData); err != nil {
-		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		abortWithError(c, bindingError(err))
 		return
 	}
 
-	updateUser := repository.UpdateUser{Name: reqData.Name}
+	updateUser := domain.UpdateUser{Name: reqData.Name, AccountExternalID: reqData.AccountExternalID}
 	updatedUser, err := h.services.User.UpdateAndReturn(c, reqURI.ID, updateUser)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			newErrorResponse(c, http.StatusNotFound, errMessageUserNotFound)
-			return
-		}
-
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		abortWithError(c, err)
 		return
 	}
 
@@ -194,20 +194,17 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 // @Accept  json
 // @Produce  json
 // @Param  id path string true "User ID"
-// @Success 204 {object} emptyResponse
+// @Success 204 "No Content"
+// @Failure 404 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
 // @Router /api/users/{id} [delete]
 func (h *Handler) DeleteUserByID(c *gin.Context) {
 	userID := c.Param("id")
 	err := h.services.User.DeleteByID(c, userID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			newErrorResponse(c, http.StatusNotFound, errMessageUserNotFound)
-			return
-		}
-
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		abortWithError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusNoContent, gin.H{})
+	c.Status(http.StatusNoContent)
 }
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"testing"
 	"time"
@@ -9,10 +10,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/suite"
 	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
 	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/repository/memory"
 	"github.com/zaharinea/go-example/pkg/service"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/net/context"
 )
 
@@ -20,45 +23,58 @@ type UsersSuite struct {
 	suite.Suite
 	ctx      context.Context
 	config   *config.Config
-	db       *mongo.Database
 	router   *gin.Engine
+	clock    *clock.Fake
+	ids      *idgen.Sequence
 	repos    *repository.Repository
 	services *service.Service
 	handlers *Handler
-	user1    repository.User
-	user2    repository.User
+	user1    domain.User
+	user2    domain.User
 }
 
 func (s *UsersSuite) SetupSuite() {
 	gin.SetMode(gin.ReleaseMode)
 	s.ctx = context.Background()
-	s.config = config.NewTestingConfig()
-	dbClient := repository.InitDbClient(s.config)
-	s.db = dbClient.Database(s.config.MongoDbName)
-	s.repos = repository.NewRepository(s.db)
+	s.config = &config.Config{PageSize: 25}
+	s.clock = clock.NewFake(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC))
+	s.ids = idgen.NewSequence()
+	s.repos = memory.NewRepository(s.clock, s.ids)
 	s.services = service.NewService(s.repos)
 	s.handlers = NewHandler(s.config, s.services)
 
 	s.router = gin.New()
-	s.router.Use(Recovery(RecoveryHandler))
+	s.router.Use(ErrorMiddleware(), Recovery(RecoveryHandler))
 	s.handlers.InitRoutes(s.router)
+}
+
+func (s *UsersSuite) SetupTest() {
+	err := s.repos.User.DeleteAll(s.ctx)
+	s.Require().NoError(err)
+	err = s.repos.Account.DeleteAll(s.ctx)
+	s.Require().NoError(err)
+	s.clock.Set(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC))
+	s.ids.Reset()
 
-	s.user1 = repository.User{
-		ID:        primitive.NewObjectID(),
+	s.user1 = domain.User{
 		Name:      "User1",
 		CreatedAt: time.Date(2020, 11, 23, 23, 0, 0, 0, time.UTC),
 		UpdatedAt: time.Date(2020, 11, 23, 23, 0, 0, 0, time.UTC),
 	}
-	s.user2 = repository.User{
-		ID:        primitive.NewObjectID(),
+	s.user2 = domain.User{
 		Name:      "User2",
 		CreatedAt: time.Date(2020, 11, 23, 23, 0, 0, 0, time.UTC),
 		UpdatedAt: time.Date(2020, 11, 23, 23, 0, 0, 0, time.UTC),
 	}
 }
 
-func (s *UsersSuite) SetupTest() {
-	err := s.repos.User.DeleteAll(s.ctx)
+func (s *UsersSuite) createAccount(externalID string) {
+	_, err := s.repos.Account.CreateOrUpdate(s.ctx, domain.Account{
+		ExternalID: externalID,
+		Name:       "account" + externalID,
+		CreatedAt:  time.Date(2020, 11, 23, 23, 0, 0, 0, time.UTC),
+		UpdatedAt:  time.Date(2020, 11, 23, 23, 0, 0, 0, time.UTC),
+	}, true)
 	s.Require().NoError(err)
 }
 
@@ -70,10 +86,35 @@ func (s *UsersSuite) TestCreateOk() {
 	w := performRequest(s.router, "POST", "/api/users", `{"name": "user"}`)
 	s.Require().Equal(http.StatusCreated, w.Code)
 
+	s.Require().JSONEq(`{
+		"id":"000000000000000000000001",
+		"name":"user",
+		"created_at":"2020-12-01T00:00:00Z",
+		"updated_at":"2020-12-01T00:00:00Z"
+	}`, w.Body.String())
+}
+
+func (s *UsersSuite) TestCreateWithAccountOk() {
+	s.createAccount("1")
+
+	w := performRequest(s.router, "POST", "/api/users", `{"name": "user", "account_external_id": "1"}`)
+	s.Require().Equal(http.StatusCreated, w.Code)
+
 	response := ResponseUser{}
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	s.Require().NoError(err)
-	s.Require().Equal("user", response.Name)
+	s.Require().Equal("1", response.AccountExternalID)
+}
+
+func (s *UsersSuite) TestCreateErrorAccountNotFound() {
+	w := performRequest(s.router, "POST", "/api/users", `{"name": "user", "account_external_id": "1"}`)
+	s.Require().Equal(http.StatusBadRequest, w.Code)
+
+	response := ResponseProblem{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	s.Require().NoError(err)
+	s.Require().Equal(service.ErrUnknownAccount.Code, response.Code)
+	s.Require().Equal("account_external_id", response.Errors[0].Field)
 }
 
 func (s *UsersSuite) TestCreateErrorInvalidRequest() {
@@ -83,14 +124,21 @@ func (s *UsersSuite) TestCreateErrorInvalidRequest() {
 	response := gin.H{}
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	s.Require().NoError(err)
-	s.Require().Equal(gin.H{"message": "Key: 'RequestCreateUser.Name' Error:Field validation for 'Name' failed on the 'required' tag"}, response)
+	s.Require().Equal(gin.H{
+		"type":   "urn:go-example:problem:validation",
+		"title":  "Bad Request",
+		"status": float64(http.StatusBadRequest),
+		"detail": "Request is invalid",
+		"code":   "invalid_request",
+		"errors": []interface{}{map[string]interface{}{"field": "name", "code": "required", "message": "name is required"}},
+	}, response)
 }
 
 func (s *UsersSuite) TestUpdateOk() {
 	err := s.services.User.Create(s.ctx, &s.user1)
 	s.Require().NoError(err)
 
-	w := performRequest(s.router, "PUT", "/api/users/"+s.user1.ID.Hex(), `{"name": "user"}`)
+	w := performRequest(s.router, "PUT", "/api/users/"+s.user1.ID, `{"name": "user"}`)
 	s.Require().Equal(http.StatusOK, w.Code)
 
 	response := ResponseUser{}
@@ -98,51 +146,73 @@ func (s *UsersSuite) TestUpdateOk() {
 	s.Require().NoError(err)
 	s.Require().Equal("user", response.Name)
 
-	updatedUser, err := s.services.User.GetByID(s.ctx, s.user1.ID.Hex())
+	updatedUser, err := s.services.User.GetByID(s.ctx, s.user1.ID)
 	s.Require().NoError(err)
 	s.Require().Equal("user", updatedUser.Name)
 }
 
+func (s *UsersSuite) TestUpdateErrorAccountNotFound() {
+	err := s.services.User.Create(s.ctx, &s.user1)
+	s.Require().NoError(err)
+
+	w := performRequest(s.router, "PUT", "/api/users/"+s.user1.ID, `{"name": "user", "account_external_id": "1"}`)
+	s.Require().Equal(http.StatusBadRequest, w.Code)
+
+	response := ResponseProblem{}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	s.Require().NoError(err)
+	s.Require().Equal(service.ErrUnknownAccount.Code, response.Code)
+}
+
 func (s *UsersSuite) TestUpdateErrorInvalidRequest() {
-	w := performRequest(s.router, "PUT", "/api/users/"+s.user1.ID.Hex(), "{}")
+	w := performRequest(s.router, "PUT", "/api/users/5fbaeab741e97bef8525d6ab", "{}")
 	s.Require().Equal(http.StatusBadRequest, w.Code)
 
 	response := gin.H{}
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	s.Require().NoError(err)
-	s.Require().Equal(gin.H{"message": "Key: 'RequestUpdateUser.Name' Error:Field validation for 'Name' failed on the 'required' tag"}, response)
+	s.Require().Equal(gin.H{
+		"type":   "urn:go-example:problem:validation",
+		"title":  "Bad Request",
+		"status": float64(http.StatusBadRequest),
+		"detail": "Request is invalid",
+		"code":   "invalid_request",
+		"errors": []interface{}{map[string]interface{}{"field": "name", "code": "required", "message": "name is required"}},
+	}, response)
 }
 func (s *UsersSuite) TestGetByIDErrorNotFound() {
 	w := performRequest(s.router, "GET", "/api/users/5fbaeab741e97bef8525d6ab", "")
 	s.Require().Equal(http.StatusNotFound, w.Code)
 
-	response := errorResponse{}
+	response := ResponseProblem{}
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	s.Require().NoError(err)
-	s.Require().Equal(errMessageUserNotFound, response.Message)
+	s.Require().Equal(service.ErrUserNotFound.Code, response.Code)
+	s.Require().Equal("Not found user", response.Detail)
 }
 
 func (s *UsersSuite) TestGetByIDErrorInvalidID() {
 	w := performRequest(s.router, "GET", "/api/users/1", "")
 	s.Require().Equal(http.StatusNotFound, w.Code)
 
-	response := errorResponse{}
+	response := ResponseProblem{}
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	s.Require().NoError(err)
-	s.Require().Equal(errMessageUserNotFound, response.Message)
+	s.Require().Equal(service.ErrUserNotFound.Code, response.Code)
+	s.Require().Equal("Not found user", response.Detail)
 }
 
 func (s *UsersSuite) TestGetByIDOk() {
 	err := s.services.User.Create(s.ctx, &s.user1)
 	s.Require().NoError(err)
 
-	w := performRequest(s.router, "GET", "/api/users/"+s.user1.ID.Hex(), "")
+	w := performRequest(s.router, "GET", "/api/users/"+s.user1.ID, "")
 	s.Require().Equal(http.StatusOK, w.Code)
 
 	response := ResponseUser{}
 	err = json.Unmarshal(w.Body.Bytes(), &response)
 	s.Require().NoError(err)
-	s.Require().Equal(s.user1.ID.Hex(), response.ID)
+	s.Require().Equal(s.user1.ID, response.ID)
 	s.Require().Equal(s.user1.Name, response.Name)
 }
 
@@ -165,9 +235,9 @@ func (s *UsersSuite) TestListOk() {
 	err = json.Unmarshal(w.Body.Bytes(), &response)
 	s.Require().NoError(err)
 	s.Require().Equal(2, len(response.Items))
-	s.Require().Equal(s.user1.ID.Hex(), response.Items[0].ID)
+	s.Require().Equal(s.user1.ID, response.Items[0].ID)
 	s.Require().Equal(s.user1.Name, response.Items[0].Name)
-	s.Require().Equal(s.user2.ID.Hex(), response.Items[1].ID)
+	s.Require().Equal(s.user2.ID, response.Items[1].ID)
 	s.Require().Equal(s.user2.Name, response.Items[1].Name)
 }
 
@@ -184,7 +254,7 @@ func (s *UsersSuite) TestListOkWithLimitAndOffset() {
 	err = json.Unmarshal(w.Body.Bytes(), &response)
 	s.Require().NoError(err)
 	s.Require().Equal(1, len(response.Items))
-	s.Require().Equal(s.user2.ID.Hex(), response.Items[0].ID)
+	s.Require().Equal(s.user2.ID, response.Items[0].ID)
 	s.Require().Equal(s.user2.Name, response.Items[0].Name)
 }
 
@@ -192,27 +262,71 @@ func (s *UsersSuite) TestDeleteOk() {
 	err := s.services.User.Create(s.ctx, &s.user1)
 	s.Require().NoError(err)
 
-	w := performRequest(s.router, "DELETE", "/api/users/"+s.user1.ID.Hex(), "")
+	w := performRequest(s.router, "DELETE", "/api/users/"+s.user1.ID, "")
 	s.Require().Equal(http.StatusNoContent, w.Code)
 	s.Require().Equal("", w.Body.String())
 
-	_, err = s.services.User.GetByID(s.ctx, s.user1.ID.Hex())
-	s.Require().Error(mongo.ErrNoDocuments, err)
+	_, err = s.services.User.GetByID(s.ctx, s.user1.ID)
+	s.Require().True(errors.Is(err, service.ErrUserNotFound))
 }
 
 func (s *UsersSuite) TestDeleteErrorNotFound() {
 	w := performRequest(s.router, "DELETE", "/api/users/5fbaeab741e97bef8525d6ab", "")
-	s.Require().Equal(http.StatusNoContent, w.Code) // FIXME should 404
-	s.Require().Equal("", w.Body.String())
+	s.Require().Equal(http.StatusNotFound, w.Code)
+
+	response := ResponseProblem{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	s.Require().NoError(err)
+	s.Require().Equal(service.ErrUserNotFound.Code, response.Code)
+}
+
+func (s *UsersSuite) TestDeleteErrorDeleted() {
+	err := s.services.User.Create(s.ctx, &s.user1)
+	s.Require().NoError(err)
+
+	w := performRequest(s.router, "DELETE", "/api/users/"+s.user1.ID, "")
+	s.Require().Equal(http.StatusNoContent, w.Code)
+	w = performRequest(s.router, "DELETE", "/api/users/"+s.user1.ID, "")
+	s.Require().Equal(http.StatusNotFound, w.Code)
 }
 func (s *UsersSuite) TestDeleteErrorInvalidID() {
 	w := performRequest(s.router, "DELETE", "/api/users/1", "")
 	s.Require().Equal(http.StatusNotFound, w.Code)
 
-	response := errorResponse{}
+	response := ResponseProblem{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	s.Require().NoError(err)
+	s.Require().Equal(service.ErrUserNotFound.Code, response.Code)
+	s.Require().Equal("Not found user", response.Detail)
+}
+
+func (s *UsersSuite) TestListAccountUsersOk() {
+	s.createAccount("1")
+	s.user1.AccountExternalID = "1"
+	err := s.services.User.Create(s.ctx, &s.user1)
+	s.Require().NoError(err)
+	err = s.services.User.Create(s.ctx, &s.user2)
+	s.Require().NoError(err)
+
+	w := performRequest(s.router, "GET", "/api/accounts/1/users", "")
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	response := ResponseUsers{}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	s.Require().NoError(err)
+	s.Require().Equal(1, len(response.Items))
+	s.Require().Equal(s.user1.ID, response.Items[0].ID)
+	s.Require().Equal("1", response.Items[0].AccountExternalID)
+}
+
+func (s *UsersSuite) TestListAccountUsersErrorNotFound() {
+	w := performRequest(s.router, "GET", "/api/accounts/1/users", "")
+	s.Require().Equal(http.StatusNotFound, w.Code)
+
+	response := ResponseProblem{}
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	s.Require().NoError(err)
-	s.Require().Equal(errMessageUserNotFound, response.Message)
+	s.Require().Equal(service.ErrAccountNotFound.Code, response.Code)
 }
 
 func TestUsersSuite(t *testing.T) {
@@ -0,0 +1,313 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zaharinea/go-example/pkg/domain"
+)
+
+// RequestCreateWebhook struct
+type RequestCreateWebhook struct {
+	URL        string   `json:"url" binding:"required,url,startswith=http"`
+	EventTypes []string `json:"event_types" binding:"required,min=1,dive,oneof=user.created user.updated user.deleted account.updated account.deleted"`
+	Secret     string   `json:"secret" binding:"required,min=16"`
+}
+
+// RequestUpdateWebhook struct, an omitted secret keeps the current one, enabled true re-enables a disabled webhook
+type RequestUpdateWebhook struct {
+	URL        string   `json:"url" binding:"required,url,startswith=http"`
+	EventTypes []string `json:"event_types" binding:"required,min=1,dive,oneof=user.created user.updated user.deleted account.updated account.deleted"`
+	Secret     string   `json:"secret" binding:"omitempty,min=16"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// RequestListWebhooks struct
+type RequestListWebhooks struct {
+	Limit  int64 `form:"limit"`
+	Offset int64 `form:"offset"`
+}
+
+// RequestGetWebhook struct
+type RequestGetWebhook struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+// ResponseWebhook struct, the secret is never returned
+type ResponseWebhook struct {
+	ID                string     `json:"id"`
+	URL               string     `json:"url"`
+	EventTypes        []string   `json:"event_types"`
+	AccountExternalID string     `json:"account_external_id,omitempty"`
+	Enabled           bool       `json:"enabled"`
+	Failures          int64      `json:"failures"`
+	DisabledAt        *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// ResponseWebhooks struct
+type ResponseWebhooks struct {
+	Items []*ResponseWebhook `json:"items"`
+}
+
+// ResponseWebhookDelivery struct
+type ResponseWebhookDelivery struct {
+	ID             string     `json:"id"`
+	WebhookID      string     `json:"webhook_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int64      `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// ResponseWebhookDeliveries struct
+type ResponseWebhookDeliveries struct {
+	Items []*ResponseWebhookDelivery `json:"items"`
+}
+
+func newResponseWebhook(webhook *domain.Webhook) *ResponseWebhook {
+	return &ResponseWebhook{
+		ID:                webhook.ID,
+		URL:               webhook.URL,
+		EventTypes:        webhook.EventTypes,
+		AccountExternalID: webhook.AccountExternalID,
+		Enabled:           webhook.Enabled,
+		Failures:          webhook.Failures,
+		DisabledAt:        webhook.DisabledAt,
+		CreatedAt:         webhook.CreatedAt,
+		UpdatedAt:         webhook.UpdatedAt,
+	}
+}
+
+func newResponseWebhooks(webhooks []*domain.Webhook) *ResponseWebhooks {
+	items := make([]*ResponseWebhook, len(webhooks))
+	for idx, webhook := range webhooks {
+		items[idx] = newResponseWebhook(webhook)
+	}
+	return &ResponseWebhooks{Items: items}
+}
+
+func newResponseWebhookDeliveries(deliveries []*domain.WebhookDelivery) *ResponseWebhookDeliveries {
+	items := make([]*ResponseWebhookDelivery, len(deliveries))
+	for idx, delivery := range deliveries {
+		items[idx] = &ResponseWebhookDelivery{
+			ID:             delivery.ID,
+			WebhookID:      delivery.WebhookID,
+			EventType:      delivery.EventType,
+			Payload:        delivery.Payload,
+			Status:         delivery.Status,
+			Attempts:       delivery.Attempts,
+			LastAttemptAt:  delivery.LastAttemptAt,
+			ResponseStatus: delivery.ResponseStatus,
+			Error:          delivery.Error,
+			CreatedAt:      delivery.CreatedAt,
+			UpdatedAt:      delivery.UpdatedAt,
+		}
+		// the next attempt of a finished delivery never happens
+		if delivery.Status == domain.DeliveryPending {
+			nextAttemptAt := delivery.NextAttemptAt
+			items[idx].NextAttemptAt = &nextAttemptAt
+		}
+	}
+	return &ResponseWebhookDeliveries{Items: items}
+}
+
+// CreateWebhook handler
+// @Summary Create webhook
+// @Description subscribe the URL to events, the payloads are signed with the secret
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param webhook body RequestCreateWebhook true "Add webhook"
+// @Success 201 {object} ResponseWebhook
+// @Failure 400 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
+// @Router /api/webhooks [post]
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	var req RequestCreateWebhook
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, bindingError(err))
+		return
+	}
+
+	webhook := domain.Webhook{URL: req.URL, EventTypes: req.EventTypes, Secret: req.Secret}
+	if err := h.services.Webhook.Create(c, &webhook); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, newResponseWebhook(&webhook))
+}
+
+// ListWebhooks handler
+// @Summary List webhooks
+// @Description get webhooks
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param limit query int false "limit" mininum(1) maxinum(100) default(25)
+// @Param offset query int false "offset" mininum(0) default(0)
+// @Success 200 {object} ResponseWebhooks
+// @Failure 400 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
+// @Router /api/webhooks [get]
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	var req RequestListWebhooks
+	if err := c.ShouldBindQuery(&req); err != nil {
+		abortWithError(c, bindingError(err))
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = h.Config().PageSize
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	webhooks, err := h.services.Webhook.List(c, req.Limit, req.Offset)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newResponseWebhooks(webhooks))
+}
+
+// GetWebhookByID handler
+// @Summary Get webhook by ID
+// @Description get webhook by ID
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param  id path string true "Webhook ID"
+// @Success 200 {object} ResponseWebhook
+// @Failure 404 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
+// @Router /api/webhooks/{id} [get]
+func (h *Handler) GetWebhookByID(c *gin.Context) {
+	var req RequestGetWebhook
+	if err := c.ShouldBindUri(&req); err != nil {
+		abortWithError(c, bindingError(err))
+		return
+	}
+
+	webhook, err := h.services.Webhook.GetByID(c, req.ID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newResponseWebhook(webhook))
+}
+
+// UpdateWebhook handler
+// @Summary Update webhook
+// @Description Update by json webhook, an omitted secret keeps the current one, enabled true re-enables a disabled webhook
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param  id path string true "Webhook ID"
+// @Param webhook body RequestUpdateWebhook true "Update webhook"
+// @Success 200 {object} ResponseWebhook
+// @Failure 400 {object} ResponseProblem
+// @Failure 404 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
+// @Router /api/webhooks/{id} [put]
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	var reqURI RequestGetWebhook
+	if err := c.ShouldBindUri(&reqURI); err != nil {
+		abortWithError(c, bindingError(err))
+		return
+	}
+
+	var reqData RequestUpdateWebhook
+	if err := c.ShouldBindJSON(&reqData); err != nil {
+		abortWithError(c, bindingError(err))
+		return
+	}
+
+	update := domain.UpdateWebhook{URL: reqData.URL, EventTypes: reqData.EventTypes, Secret: reqData.Secret, Enabled: reqData.Enabled}
+	webhook, err := h.services.Webhook.Update(c, reqURI.ID, update)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newResponseWebhook(webhook))
+}
+
+// DeleteWebhookByID handler
+// @Summary Delete webhook
+// @Description Delete by webhook ID with its deliveries
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param  id path string true "Webhook ID"
+// @Success 204 "No Content"
+// @Failure 404 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
+// @Router /api/webhooks/{id} [delete]
+func (h *Handler) DeleteWebhookByID(c *gin.Context) {
+	var req RequestGetWebhook
+	if err := c.ShouldBindUri(&req); err != nil {
+		abortWithError(c, bindingError(err))
+		return
+	}
+
+	if err := h.services.Webhook.DeleteByID(c, req.ID); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries handler
+// @Summary List webhook deliveries
+// @Description get deliveries of the webhook newest first
+// @Tags webhooks
+// @Accept  json
+// @Produce  json
+// @Param  id path string true "Webhook ID"
+// @Param limit query int false "limit" mininum(1) maxinum(100) default(25)
+// @Param offset query int false "offset" mininum(0) default(0)
+// @Success 200 {object} ResponseWebhookDeliveries
+// @Failure 400 {object} ResponseProblem
+// @Failure 404 {object} ResponseProblem
+// @Failure 500 {object} ResponseProblem
+// @Router /api/webhooks/{id}/deliveries [get]
+func (h *Handler) ListWebhookDeliveries(c *gin.Context) {
+	var reqURI RequestGetWebhook
+	if err := c.ShouldBindUri(&reqURI); err != nil {
+		abortWithError(c, bindingError(err))
+		return
+	}
+
+	var req RequestListWebhooks
+	if err := c.ShouldBindQuery(&req); err != nil {
+		abortWithError(c, bindingError(err))
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = h.Config().PageSize
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	deliveries, err := h.services.Webhook.ListDeliveries(c, reqURI.ID, req.Limit, req.Offset)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newResponseWebhookDeliveries(deliveries))
+}
@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/repository/memory"
+	"github.com/zaharinea/go-example/pkg/service"
+	"golang.org/x/net/context"
+)
+
+type WebhooksSuite struct {
+	suite.Suite
+	ctx    context.Context
+	router *gin.Engine
+	clock  *clock.Fake
+	ids    *idgen.Sequence
+	repos  *repository.Repository
+}
+
+func (s *WebhooksSuite) SetupSuite() {
+	gin.SetMode(gin.ReleaseMode)
+	s.ctx = context.Background()
+	s.clock = clock.NewFake(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC))
+	s.ids = idgen.NewSequence()
+	s.repos = memory.NewRepository(s.clock, s.ids)
+	handlers := NewHandler(&config.Config{PageSize: 25}, service.NewService(s.repos))
+
+	s.router = gin.New()
+	s.router.Use(ErrorMiddleware(), Recovery(RecoveryHandler))
+	handlers.InitRoutes(s.router)
+}
+
+func (s *WebhooksSuite) SetupTest() {
+	s.Require().NoError(s.repos.User.DeleteAll(s.ctx))
+	s.Require().NoError(s.repos.Webhook.DeleteAll(s.ctx))
+	s.Require().NoError(s.repos.WebhookDelivery.DeleteAll(s.ctx))
+	s.clock.Set(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC))
+	s.ids.Reset()
+}
+
+func (s *WebhooksSuite) createWebhook() {
+	w := performRequest(s.router, "POST", "/api/webhooks", `{
+		"url": "https://example.com/hook",
+		"event_types": ["user.created", "user.deleted"],
+		"secret": "0123456789abcdef"
+	}`)
+	s.Require().Equal(http.StatusCreated, w.Code)
+}
+
+func (s *WebhooksSuite) TestCreateOk() {
+	w := performRequest(s.router, "POST", "/api/webhooks", `{
+		"url": "https://example.com/hook",
+		"event_types": ["user.created", "user.deleted"],
+		"secret": "0123456789abcdef"
+	}`)
+	s.Require().Equal(http.StatusCreated, w.Code)
+
+	s.Require().JSONEq(`{
+		"id":"000000000000000000000001",
+		"url":"https://example.com/hook",
+		"event_types":["user.created","user.deleted"],
+		"enabled":true,
+		"failures":0,
+		"created_at":"2020-12-01T00:00:00Z",
+		"updated_at":"2020-12-01T00:00:00Z"
+	}`, w.Body.String(), "the secret is never returned")
+}
+
+func (s *WebhooksSuite) TestCreateErrorInvalidRequest() {
+	for _, body := range []string{
+		`{"url": "example.com", "event_types": ["user.created"], "secret": "0123456789abcdef"}`,
+		`{"url": "https://example.com", "event_types": [], "secret": "0123456789abcdef"}`,
+		`{"url": "https://example.com", "event_types": ["user.unknown"], "secret": "0123456789abcdef"}`,
+		`{"url": "https://example.com", "event_types": ["user.created"], "secret": "short"}`,
+	} {
+		w := performRequest(s.router, "POST", "/api/webhooks", body)
+		s.Require().Equal(http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func (s *WebhooksSuite) TestListOk() {
+	s.createWebhook()
+	s.createWebhook()
+
+	w := performRequest(s.router, "GET", "/api/webhooks?limit=1&offset=1", "")
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	response := ResponseWebhooks{}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	s.Require().Len(response.Items, 1)
+	s.Require().Equal("000000000000000000000002", response.Items[0].ID)
+}
+
+func (s *WebhooksSuite) TestGetErrorNotFound() {
+	w := performRequest(s.router, "GET", "/api/webhooks/000000000000000000000001", "")
+	s.Require().Equal(http.StatusNotFound, w.Code)
+
+	response := ResponseProblem{}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	s.Require().Equal(service.ErrWebhookNotFound.Code, response.Code)
+}
+
+func (s *WebhooksSuite) TestUpdateOk() {
+	s.createWebhook()
+	_, err := s.repos.Webhook.RecordFailure(s.ctx, "000000000000000000000001", 1)
+	s.Require().NoError(err)
+	s.clock.Advance(time.Hour)
+
+	w := performRequest(s.router, "PUT", "/api/webhooks/000000000000000000000001", `{
+		"url": "https://example.com/hook2",
+		"event_types": ["account.updated"],
+		"enabled": true
+	}`)
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	s.Require().JSONEq(`{
+		"id":"000000000000000000000001",
+		"url":"https://example.com/hook2",
+		"event_types":["account.updated"],
+		"enabled":true,
+		"failures":0,
+		"created_at":"2020-12-01T00:00:00Z",
+		"updated_at":"2020-12-01T01:00:00Z"
+	}`, w.Body.String())
+
+	webhook, err := s.repos.Webhook.GetByID(s.ctx, "000000000000000000000001")
+	s.Require().NoError(err)
+	s.Require().Equal("0123456789abcdef", webhook.Secret)
+}
+
+func (s *WebhooksSuite) TestDeleteOk() {
+	s.createWebhook()
+
+	w := performRequest(s.router, "DELETE", "/api/webhooks/000000000000000000000001", "")
+	s.Require().Equal(http.StatusNoContent, w.Code)
+
+	w = performRequest(s.router, "DELETE", "/api/webhooks/000000000000000000000001", "")
+	s.Require().Equal(http.StatusNotFound, w.Code)
+}
+
+func (s *WebhooksSuite) TestListDeliveriesOk() {
+	s.createWebhook()
+	w := performRequest(s.router, "POST", "/api/users", `{"name": "user"}`)
+	s.Require().Equal(http.StatusCreated, w.Code)
+	w = performRequest(s.router, "PUT", "/api/users/000000000000000000000002", `{"name": "user2"}`)
+	s.Require().Equal(http.StatusOK, w.Code)
+	w = performRequest(s.router, "DELETE", "/api/users/000000000000000000000002", "")
+	s.Require().Equal(http.StatusNoContent, w.Code)
+
+	w = performRequest(s.router, "GET", "/api/webhooks/000000000000000000000001/deliveries", "")
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	response := ResponseWebhookDeliveries{}
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	s.Require().Len(response.Items, 2, "the webhook is not subscribed to user.updated")
+	s.Require().Equal(domain.EventUserDeleted, response.Items[0].EventType)
+	s.Require().Equal(domain.EventUserCreated, response.Items[1].EventType)
+	s.Require().Equal(domain.DeliveryPending, response.Items[1].Status)
+	s.Require().NotNil(response.Items[1].NextAttemptAt)
+	s.Require().JSONEq(`{
+		"type":"user.created",
+		"data":{
+			"id":"000000000000000000000002",
+			"name":"user",
+			"created_at":"2020-12-01T00:00:00Z",
+			"updated_at":"2020-12-01T00:00:00Z"
+		}
+	}`, response.Items[1].Payload)
+}
+
+func (s *WebhooksSuite) TestListDeliveriesErrorNotFound() {
+	w := performRequest(s.router, "GET", "/api/webhooks/000000000000000000000001/deliveries", "")
+	s.Require().Equal(http.StatusNotFound, w.Code)
+}
+
+func TestWebhooksSuite(t *testing.T) {
+	suite.Run(t, new(WebhooksSuite))
+}
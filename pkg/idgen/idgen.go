@@ -0,0 +1,58 @@
+// Package idgen abstracts generation of IDs, so IDs assigned by the application can be asserted in tests
+package idgen
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IDGenerator returns unique IDs
+type IDGenerator interface {
+	NewID() string
+}
+
+// ObjectID generates hex MongoDB ObjectIDs, it is used for IDs of documents
+type ObjectID struct{}
+
+// NewID returns a new hex ObjectID
+func (ObjectID) NewID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// UUID generates random UUIDs, it is used for request IDs
+type UUID struct{}
+
+// NewID returns a new UUID
+func (UUID) NewID() string {
+	return uuid.New().String()
+}
+
+// Sequence is an IDGenerator for tests, it returns 1, 2, 3... formatted as hex ObjectIDs,
+// so the IDs are accepted by MongoDB repositories and sort in the order of generation
+type Sequence struct {
+	mu   sync.Mutex
+	last uint64
+}
+
+// NewSequence returns a new Sequence struct
+func NewSequence() *Sequence {
+	return &Sequence{}
+}
+
+// NewID returns the next ID
+func (s *Sequence) NewID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last++
+	return fmt.Sprintf("%024x", s.last)
+}
+
+// Reset restarts the sequence
+func (s *Sequence) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = 0
+}
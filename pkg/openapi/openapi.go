@@ -0,0 +1,194 @@
+// Package openapi builds OpenAPI 3 documents from Go types and validates values against their schemas.
+// Only the part of the specification used by the API is supported.
+package openapi
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Version of the OpenAPI specification
+const Version = "3.0.3"
+
+// Content types of request and response bodies
+const (
+	ContentTypeJSON        = "application/json"
+	ContentTypeProblem     = "application/problem+json"
+	ContentTypeEventStream = "text/event-stream"
+)
+
+// Document is the root object of an OpenAPI document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Components holds the schemas referenced by operations
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// PathItem holds the operations of a path by lowercase HTTP method
+type PathItem map[string]*Operation
+
+// Operation describes a single API operation on a path
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter of the path, the query or a header
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes the body of a request
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// Response describes a response of an operation, responses without Content have no body
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// NewDocument returns a new Document struct without paths
+func NewDocument(title string, description string, version string) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       Info{Title: title, Description: description, Version: version},
+		Paths:      map[string]*PathItem{},
+		Components: Components{Schemas: map[string]*Schema{}},
+	}
+}
+
+// AddOperation adds the operation of method on path, path is a template like /api/users/{id}
+func (d *Document) AddOperation(method string, path string, op *Operation) {
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+}
+
+// Operation returns the operation of method on path, nil if it is not documented
+func (d *Document) Operation(method string, path string) *Operation {
+	item, ok := d.Paths[path]
+	if !ok {
+		return nil
+	}
+	return (*item)[strings.ToLower(method)]
+}
+
+// Operations returns the number of documented operations
+func (d *Document) Operations() int {
+	count := 0
+	for _, item := range d.Paths {
+		count += len(*item)
+	}
+	return count
+}
+
+// Streams returns true if a response of the operation is a stream of Server-Sent Events
+func (o *Operation) Streams() bool {
+	for _, resp := range o.Responses {
+		if _, ok := resp.Content[ContentTypeEventStream]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PathTemplate converts a gin route like /api/users/:id to the template /api/users/{id}
+func PathTemplate(route string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// PathParameter returns a required string parameter of the path
+func PathParameter(name string, description string) *Parameter {
+	return &Parameter{Name: name, In: "path", Description: description, Required: true, Schema: &Schema{Type: TypeString}}
+}
+
+// QueryParameter returns an optional parameter of the query
+func QueryParameter(name string, description string, schema *Schema) *Parameter {
+	return &Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// HeaderParameter returns an optional parameter of a header
+func HeaderParameter(name string, description string, schema *Schema) *Parameter {
+	return &Parameter{Name: name, In: "header", Description: description, Schema: schema}
+}
+
+// JSONRequestBody returns a required JSON request body
+func JSONRequestBody(description string, schema *Schema) *RequestBody {
+	return &RequestBody{Description: description, Required: true, Content: map[string]*MediaType{ContentTypeJSON: {Schema: schema}}}
+}
+
+// JSONResponse returns a response with a JSON body
+func JSONResponse(description string, schema *Schema) *Response {
+	return &Response{Description: description, Content: map[string]*MediaType{ContentTypeJSON: {Schema: schema}}}
+}
+
+// ProblemResponse returns a response with an RFC 7807 problem body
+func ProblemResponse(description string, schema *Schema) *Response {
+	return &Response{Description: description, Content: map[string]*MediaType{ContentTypeProblem: {Schema: schema}}}
+}
+
+// EventStreamResponse returns a response streaming Server-Sent Events, the data of events is described in the description
+func EventStreamResponse(description string) *Response {
+	return &Response{Description: description, Content: map[string]*MediaType{ContentTypeEventStream: {Schema: &Schema{Type: TypeString}}}}
+}
+
+// EmptyResponse returns a response without a body
+func EmptyResponse(status int) *Response {
+	return &Response{Description: http.StatusText(status)}
+}
+
+// Schema returns the schema of the body, nil for responses without a body
+func (r *Response) Schema() *Schema {
+	for _, media := range r.Content {
+		return media.Schema
+	}
+	return nil
+}
+
+// Schema returns the schema of the body
+func (b *RequestBody) Schema() *Schema {
+	for _, media := range b.Content {
+		return media.Schema
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zaharinea/go-example/pkg/apperror"
+)
+
+type testItem struct {
+	ID   int64  `json:"id"`
+	Note string `json:"note,omitempty"`
+}
+
+type testRequest struct {
+	Name    string            `json:"name" binding:"required"`
+	Tags    []string          `json:"tags"`
+	Labels  map[string]string `json:"labels"`
+	Hidden  string            `json:"-"`
+	private string
+}
+
+type testResponse struct {
+	Items     []*testItem `json:"items"`
+	Enabled   bool        `json:"enabled"`
+	Score     float64     `json:"score,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	Next      *testItem   `json:"next,omitempty"`
+}
+
+func TestRequestSchema(t *testing.T) {
+	doc := NewDocument("title", "", "1.0.0")
+	require.Equal(t, Ref("testRequest"), doc.RequestSchema(testRequest{}))
+	require.Equal(t, &Schema{
+		Type: TypeObject,
+		Properties: map[string]*Schema{
+			"name":   {Type: TypeString},
+			"tags":   {Type: TypeArray, Items: &Schema{Type: TypeString}},
+			"labels": {Type: TypeObject, AdditionalProperties: &Schema{Type: TypeString}},
+		},
+		Required: []string{"name"},
+	}, doc.Components.Schemas["testRequest"])
+}
+
+func TestResponseSchema(t *testing.T) {
+	doc := NewDocument("title", "", "1.0.0")
+	require.Equal(t, Ref("testResponse"), doc.ResponseSchema(&testResponse{}))
+	require.Equal(t, &Schema{
+		Type: TypeObject,
+		Properties: map[string]*Schema{
+			"items":      {Type: TypeArray, Items: Ref("testItem")},
+			"enabled":    {Type: TypeBoolean},
+			"score":      {Type: TypeNumber},
+			"created_at": {Type: TypeString, Format: "date-time"},
+			"next":       Ref("testItem"),
+		},
+		Required: []string{"items", "enabled", "created_at"},
+	}, doc.Components.Schemas["testResponse"])
+	require.Equal(t, []string{"id"}, doc.Components.Schemas["testItem"].Required)
+}
+
+func TestValidate(t *testing.T) {
+	doc := NewDocument("title", "", "1.0.0")
+	schema := doc.ResponseSchema(testResponse{})
+
+	tests := []struct {
+		name   string
+		body   string
+		fields []apperror.FieldError
+	}{
+		{"valid", `{"items":[{"id":1}],"enabled":true,"created_at":"2020-12-01T00:00:00Z","score":1.5}`, nil},
+		{"unknown fields are allowed", `{"items":[],"enabled":false,"created_at":"2020-12-01T00:00:00.123+03:00","other":1}`, nil},
+		{"not an object", `[]`, []apperror.FieldError{{Field: "body", Code: "type", Message: "body must be object"}}},
+		{"missing fields", `{"items":[]}`, []apperror.FieldError{
+			{Field: "enabled", Code: "required", Message: "enabled is required"},
+			{Field: "created_at", Code: "required", Message: "created_at is required"},
+		}},
+		{"nested", `{"items":[{"id":1.5},{"note":"x"}],"enabled":true,"created_at":"2020-12-01T00:00:00Z"}`, []apperror.FieldError{
+			{Field: "items[0].id", Code: "type", Message: "items[0].id must be integer"},
+			{Field: "items[1].id", Code: "required", Message: "items[1].id is required"},
+		}},
+		{"null", `{"items":null,"enabled":true,"created_at":"2020-12-01T00:00:00Z"}`, []apperror.FieldError{
+			{Field: "items", Code: "type", Message: "items must be array"},
+		}},
+		{"format", `{"items":[],"enabled":"true","created_at":"yesterday"}`, []apperror.FieldError{
+			{Field: "created_at", Code: "format", Message: "created_at must be date-time"},
+			{Field: "enabled", Code: "type", Message: "enabled must be boolean"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := doc.ValidateJSON(schema, []byte(tt.body))
+			require.NoError(t, err)
+			require.Equal(t, tt.fields, fields)
+		})
+	}
+
+	_, err := doc.ValidateJSON(schema, []byte(`{`))
+	require.Error(t, err)
+}
+
+func TestValidateParameter(t *testing.T) {
+	doc := NewDocument("title", "", "1.0.0")
+	min, max := 1.0, 100.0
+	limit := QueryParameter("limit", "", &Schema{Type: TypeInteger, Minimum: &min, Maximum: &max})
+	order := QueryParameter("order", "", &Schema{Type: TypeString, Enum: []interface{}{"asc", "desc"}})
+	deleted := QueryParameter("deleted", "", &Schema{Type: TypeBoolean})
+
+	require.Empty(t, doc.ValidateParameter(limit, "10"))
+	require.Equal(t, []apperror.FieldError{{Field: "limit", Code: "type", Message: "limit must be integer"}}, doc.ValidateParameter(limit, "ten"))
+	require.Equal(t, []apperror.FieldError{{Field: "limit", Code: "min", Message: "limit must be at least 1"}}, doc.ValidateParameter(limit, "0"))
+	require.Equal(t, []apperror.FieldError{{Field: "limit", Code: "max", Message: "limit must be at most 100"}}, doc.ValidateParameter(limit, "101"))
+	require.Empty(t, doc.ValidateParameter(order, "asc"))
+	require.Equal(t, []apperror.FieldError{{Field: "order", Code: "oneof", Message: "order must be one of [asc desc]"}}, doc.ValidateParameter(order, "up"))
+	require.Empty(t, doc.ValidateParameter(deleted, "true"))
+	require.Equal(t, []apperror.FieldError{{Field: "deleted", Code: "type", Message: "deleted must be boolean"}}, doc.ValidateParameter(deleted, "yes"))
+}
+
+func TestDocument(t *testing.T) {
+	doc := NewDocument("title", "description", "1.0.0")
+	op := &Operation{OperationID: "GetUser", Responses: map[string]*Response{"200": JSONResponse("User", &Schema{Type: TypeObject})}}
+	doc.AddOperation("GET", "/api/users/{id}", op)
+	doc.AddOperation("DELETE", "/api/users/{id}", &Operation{OperationID: "DeleteUser", Responses: map[string]*Response{"204": EmptyResponse(204)}})
+
+	require.Equal(t, op, doc.Operation("GET", PathTemplate("/api/users/:id")))
+	require.Nil(t, doc.Operation("PUT", "/api/users/{id}"))
+	require.Nil(t, doc.Operation("GET", "/api/users"))
+	require.Equal(t, 2, doc.Operations())
+	require.Equal(t, "/files/{path}", PathTemplate("/files/*path"))
+	require.False(t, op.Streams())
+	require.True(t, (&Operation{Responses: map[string]*Response{"200": EventStreamResponse("Events")}}).Streams())
+
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"openapi": "3.0.3",
+		"info": {"title": "title", "description": "description", "version": "1.0.0"},
+		"paths": {"/api/users/{id}": {
+			"get": {"operationId": "GetUser", "responses": {"200": {"description": "User", "content": {"application/json": {"schema": {"type": "object"}}}}}},
+			"delete": {"operationId": "DeleteUser", "responses": {"204": {"description": "No Content"}}}
+		}},
+		"components": {"schemas": {}}
+	}`, string(data))
+}
@@ -0,0 +1,144 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Types of schemas
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+)
+
+const componentsPrefix = "#/components/schemas/"
+
+// Schema is the subset of the OpenAPI schema object supported by Validate
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+// Ref returns a schema referencing the component name
+func Ref(name string) *Schema {
+	return &Schema{Ref: componentsPrefix + name}
+}
+
+// Resolve returns the component referenced by the schema or the schema itself
+func (d *Document) Resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = d.Components.Schemas[strings.TrimPrefix(schema.Ref, componentsPrefix)]
+	}
+	return schema
+}
+
+// RequestSchema returns the schema of a request body v, fields with the binding:"required" tag are required.
+// Named structs are added to the components and referenced.
+func (d *Document) RequestSchema(v interface{}) *Schema {
+	return d.schemaOf(reflect.TypeOf(v), true)
+}
+
+// ResponseSchema returns the schema of a response body v, fields without omitempty are required.
+// Named structs are added to the components and referenced.
+func (d *Document) ResponseSchema(v interface{}) *Schema {
+	return d.schemaOf(reflect.TypeOf(v), false)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (d *Document) schemaOf(typ reflect.Type, request bool) *Schema {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == timeType {
+		return &Schema{Type: TypeString, Format: "date-time"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		if typ.Name() == "" {
+			return d.structSchema(typ, request)
+		}
+		if _, ok := d.Components.Schemas[typ.Name()]; !ok {
+			// the placeholder stops the recursion of self-referencing types
+			d.Components.Schemas[typ.Name()] = &Schema{}
+			d.Components.Schemas[typ.Name()] = d.structSchema(typ, request)
+		}
+		return Ref(typ.Name())
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: TypeString, Format: "byte"}
+		}
+		return &Schema{Type: TypeArray, Items: d.schemaOf(typ.Elem(), request)}
+	case reflect.Map:
+		return &Schema{Type: TypeObject, AdditionalProperties: d.schemaOf(typ.Elem(), request)}
+	case reflect.String:
+		return &Schema{Type: TypeString}
+	case reflect.Bool:
+		return &Schema{Type: TypeBoolean}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: TypeInteger, Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: TypeInteger, Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: TypeNumber}
+	default:
+		return &Schema{}
+	}
+}
+
+func (d *Document) structSchema(typ reflect.Type, request bool) *Schema {
+	schema := &Schema{Type: TypeObject, Properties: map[string]*Schema{}}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = d.schemaOf(field.Type, request)
+		if required(field, tag[1:], request) {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+func required(field reflect.StructField, options []string, request bool) bool {
+	if request {
+		for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+			if rule == "required" {
+				return true
+			}
+		}
+		return false
+	}
+	for _, option := range options {
+		if option == "omitempty" {
+			return false
+		}
+	}
+	return true
+}
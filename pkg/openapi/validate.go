@@ -0,0 +1,182 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zaharinea/go-example/pkg/apperror"
+)
+
+// Validate checks value decoded from JSON with UseNumber against schema and returns invalid fields,
+// field names are paths like items[0].name, the value itself is reported as body
+func (d *Document) Validate(schema *Schema, value interface{}) []apperror.FieldError {
+	var errs []apperror.FieldError
+	d.validate(schema, value, "", &errs)
+	return errs
+}
+
+// ValidateJSON decodes data and validates it against schema
+func (d *Document) ValidateJSON(schema *Schema, data []byte) ([]apperror.FieldError, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return d.Validate(schema, value), nil
+}
+
+// ValidateParameter checks the raw value of the path or query parameter
+func (d *Document) ValidateParameter(param *Parameter, raw string) []apperror.FieldError {
+	schema := d.Resolve(param.Schema)
+	var value interface{} = raw
+	switch schema.Type {
+	case TypeInteger, TypeNumber:
+		value = json.Number(raw)
+	case TypeBoolean:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return []apperror.FieldError{typeError(param.Name, schema)}
+		}
+		value = b
+	}
+	var errs []apperror.FieldError
+	d.validate(schema, value, param.Name, &errs)
+	return errs
+}
+
+func (d *Document) validate(schema *Schema, value interface{}, path string, errs *[]apperror.FieldError) {
+	schema = d.Resolve(schema)
+	if schema == nil {
+		return
+	}
+	if value == nil {
+		if !schema.Nullable && schema.Type != "" {
+			*errs = append(*errs, typeError(path, schema))
+		}
+		return
+	}
+
+	switch schema.Type {
+	case TypeObject:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			*errs = append(*errs, typeError(path, schema))
+			return
+		}
+		d.validateObject(schema, object, path, errs)
+	case TypeArray:
+		array, ok := value.([]interface{})
+		if !ok {
+			*errs = append(*errs, typeError(path, schema))
+			return
+		}
+		for i, item := range array {
+			d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case TypeString:
+		s, ok := value.(string)
+		if !ok {
+			*errs = append(*errs, typeError(path, schema))
+			return
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				*errs = append(*errs, fieldError(path, "format", "%s must be date-time"))
+				return
+			}
+		}
+	case TypeInteger, TypeNumber:
+		number, ok := value.(json.Number)
+		if !ok {
+			*errs = append(*errs, typeError(path, schema))
+			return
+		}
+		f, err := number.Float64()
+		if err == nil && schema.Type == TypeInteger {
+			_, err = number.Int64()
+		}
+		if err != nil {
+			*errs = append(*errs, typeError(path, schema))
+			return
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			*errs = append(*errs, fieldError(path, "min", "%s must be at least "+formatFloat(*schema.Minimum)))
+			return
+		}
+		if schema.Maximum != nil && f > *schema.Maximum {
+			*errs = append(*errs, fieldError(path, "max", "%s must be at most "+formatFloat(*schema.Maximum)))
+			return
+		}
+	case TypeBoolean:
+		if _, ok := value.(bool); !ok {
+			*errs = append(*errs, typeError(path, schema))
+			return
+		}
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		values := make([]string, len(schema.Enum))
+		for i, v := range schema.Enum {
+			values[i] = fmt.Sprint(v)
+		}
+		*errs = append(*errs, fieldError(path, "oneof", "%s must be one of ["+strings.Join(values, " ")+"]"))
+	}
+}
+
+func (d *Document) validateObject(schema *Schema, object map[string]interface{}, path string, errs *[]apperror.FieldError) {
+	for _, name := range schema.Required {
+		if _, ok := object[name]; !ok {
+			*errs = append(*errs, fieldError(join(path, name), "required", "%s is required"))
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if property, ok := schema.Properties[name]; ok {
+			d.validate(property, object[name], join(path, name), errs)
+		} else if schema.AdditionalProperties != nil {
+			d.validate(schema.AdditionalProperties, object[name], join(path, name), errs)
+		}
+	}
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, v := range enum {
+		if fmt.Sprint(v) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func typeError(path string, schema *Schema) apperror.FieldError {
+	return fieldError(path, "type", "%s must be "+schema.Type)
+}
+
+func fieldError(path string, code string, format string) apperror.FieldError {
+	if path == "" {
+		path = "body"
+	}
+	return apperror.FieldError{Field: path, Code: code, Message: fmt.Sprintf(format, path)}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -4,89 +4,225 @@ import (
 	"context"
 	"time"
 
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-const accountsCollection = "accounts"
+const (
+	accountsCollection = "accounts"
+	accountTenantField = "external_id"
+)
+
+// accountDocument is the stored form of domain.Account
+type accountDocument struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	ExternalID string             `bson:"external_id"`
+	Name       string             `bson:"name"`
+	CreatedAt  time.Time          `bson:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at"`
+	DeletedAt  *time.Time         `bson:"deleted_at,omitempty"`
+}
 
-// Account struct
-type Account struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	ExternalID string             `bson:"external_id" json:"external_id"`
-	Name       string             `bson:"name" json:"name"`
-	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+func (d *accountDocument) toDomain() *domain.Account {
+	return &domain.Account{
+		ID:         d.ID.Hex(),
+		ExternalID: d.ExternalID,
+		Name:       d.Name,
+		CreatedAt:  d.CreatedAt,
+		UpdatedAt:  d.UpdatedAt,
+		DeletedAt:  d.DeletedAt,
+	}
 }
 
 // AccountRepository struct
 type AccountRepository struct {
 	collection *mongo.Collection
+	ids        idgen.IDGenerator
 }
 
-// NewAccountRepository returns a new AccountRepository struct
-func NewAccountRepository(db *mongo.Database) *AccountRepository {
+// NewAccountRepository returns a new AccountRepository struct, ids must generate hex ObjectIDs
+func NewAccountRepository(db *mongo.Database, ids idgen.IDGenerator) *AccountRepository {
 	return &AccountRepository{
 		collection: db.Collection(accountsCollection),
+		ids:        ids,
 	}
 }
 
-// CreateOrUpdate returns a updated or created Account
-func (r *AccountRepository) CreateOrUpdate(ctx context.Context, account Account, forceUpdate bool) (*Account, error) {
+// newID returns the ID of an Account created by an upsert
+func (r *AccountRepository) newID() (primitive.ObjectID, error) {
+	return primitive.ObjectIDFromHex(r.ids.NewID())
+}
+
+// lastChangedAt returns the time of the deletion of a tombstone or of the last update
+func (d *accountDocument) lastChangedAt() time.Time {
+	if d.DeletedAt != nil && d.DeletedAt.After(d.UpdatedAt) {
+		return *d.DeletedAt
+	}
+	return d.UpdatedAt
+}
+
+// findByExternalID returns nil if there is no Account with the External ID, including tombstones
+func (r *AccountRepository) findByExternalID(ctx context.Context, accountExternalID string) (*accountDocument, error) {
+	var doc accountDocument
+	err := r.collection.FindOne(ctx, bson.M{"external_id": accountExternalID}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, translateErr(err)
+	}
+	return &doc, nil
+}
+
+// CreateOrUpdate returns a updated or created Account, unless forced only an update newer than the stored Account
+// or its tombstone is applied, an update newer than the tombstone restores the Account
+func (r *AccountRepository) CreateOrUpdate(ctx context.Context, account domain.Account, forceUpdate bool) (*domain.Account, error) {
+	if err := checkTenant(ctx, account.ExternalID); err != nil {
+		return nil, err
+	}
+
 	filter := bson.M{"external_id": account.ExternalID}
 	if !forceUpdate {
+		// check explicitly, a duplicate key error from the upsert would abort a surrounding transaction
+		existing, err := r.findByExternalID(ctx, account.ExternalID)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && !existing.lastChangedAt().Before(account.UpdatedAt) {
+			return existing.toDomain(), domain.ErrStale
+		}
 		filter["updated_at"] = bson.M{"$lt": account.UpdatedAt}
 	}
 
-	update := bson.D{bson.E{Key: "$set", Value: account}}
+	doc := accountDocument{
+		ExternalID: account.ExternalID,
+		Name:       account.Name,
+		CreatedAt:  account.CreatedAt,
+		UpdatedAt:  account.UpdatedAt,
+		DeletedAt:  account.DeletedAt,
+	}
+	id, err := r.newID()
+	if err != nil {
+		return nil, err
+	}
+	update := bson.D{
+		bson.E{Key: "$set", Value: doc},
+		bson.E{Key: "$setOnInsert", Value: bson.M{"_id": id}},
+	}
+	if !forceUpdate && account.DeletedAt == nil {
+		update = append(update, bson.E{Key: "$unset", Value: bson.M{"deleted_at": ""}})
+	}
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
 
-	var updatedAccount Account
-	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedAccount)
+	var updated accountDocument
+	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
 	if err != nil {
-		return &updatedAccount, err
+		return nil, translateErr(err)
 	}
-	return &updatedAccount, nil
+	return updated.toDomain(), nil
 }
 
-// List returns Account list
-func (r *AccountRepository) List(ctx context.Context, limit int64, offset int64) ([]*Account, error) {
-	var results []*Account
+// MarkDeleted records a tombstone for the Account, the tombstone is kept so that late updates do not resurrect it
+func (r *AccountRepository) MarkDeleted(ctx context.Context, accountExternalID string, deletedAt time.Time) (*domain.Account, error) {
+	if err := checkTenant(ctx, accountExternalID); err != nil {
+		return nil, err
+	}
 
-	opts := options.Find().SetSkip(offset).SetLimit(limit).SetSort(bson.D{bson.E{Key: "_id", Value: 1}})
+	existing, err := r.findByExternalID(ctx, accountExternalID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && (existing.DeletedAt != nil || existing.UpdatedAt.After(deletedAt)) {
+		return existing.toDomain(), domain.ErrStale
+	}
+
+	id, err := r.newID()
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"external_id": accountExternalID}
+	update := bson.D{
+		bson.E{Key: "$set", Value: bson.M{"deleted_at": deletedAt, "updated_at": deletedAt}},
+		bson.E{Key: "$setOnInsert", Value: bson.M{"_id": id, "created_at": deletedAt}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
 
-	cur, err := r.collection.Find(ctx, bson.M{}, opts)
+	var deleted accountDocument
+	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&deleted)
 	if err != nil {
-		return results, err
+		return nil, translateErr(err)
 	}
-	err = cur.All(ctx, &results)
+	return deleted.toDomain(), nil
+}
+
+// List returns Account list
+func (r *AccountRepository) List(ctx context.Context, limit int64, offset int64) ([]*domain.Account, error) {
+	opts := options.Find().SetSkip(offset).SetLimit(limit).SetSort(bson.D{bson.E{Key: "_id", Value: 1}})
+
+	cur, err := r.collection.Find(ctx, scopeByTenant(ctx, accountTenantField, bson.M{"deleted_at": notDeleted}), opts)
 	if err != nil {
-		return results, err
+		return nil, translateErr(err)
 	}
-	return results, nil
+	var docs []*accountDocument
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, translateErr(err)
+	}
+
+	accounts := make([]*domain.Account, len(docs))
+	for i, doc := range docs {
+		accounts[i] = doc.toDomain()
+	}
+	return accounts, nil
 }
 
 // GetByExternalID returns a Account by External ID
-func (r *AccountRepository) GetByExternalID(ctx context.Context, accountExternalID string) (*Account, error) {
-	var Account Account
+func (r *AccountRepository) GetByExternalID(ctx context.Context, accountExternalID string) (*domain.Account, error) {
+	var doc accountDocument
+	err := r.collection.FindOne(ctx, scopeByTenant(ctx, accountTenantField, bson.M{"external_id": accountExternalID, "deleted_at": notDeleted})).Decode(&doc)
+	if err != nil {
+		return nil, translateErr(err)
+	}
+	return doc.toDomain(), nil
+}
 
-	err := r.collection.FindOne(ctx, bson.M{"external_id": accountExternalID}).Decode(&Account)
+// ListByExternalIDs returns Accounts with the External IDs in one query, missing Accounts are skipped
+func (r *AccountRepository) ListByExternalIDs(ctx context.Context, accountExternalIDs []string) ([]*domain.Account, error) {
+	if len(accountExternalIDs) == 0 {
+		// a nil slice is encoded as null which $in rejects
+		return []*domain.Account{}, nil
+	}
+
+	filter := bson.M{"external_id": bson.M{"$in": accountExternalIDs}, "deleted_at": notDeleted}
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "_id", Value: 1}})
+
+	cur, err := r.collection.Find(ctx, scopeByTenant(ctx, accountTenantField, filter), opts)
 	if err != nil {
-		return &Account, err
+		return nil, translateErr(err)
+	}
+	var docs []*accountDocument
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, translateErr(err)
+	}
+
+	accounts := make([]*domain.Account, len(docs))
+	for i, doc := range docs {
+		accounts[i] = doc.toDomain()
 	}
-	return &Account, nil
+	return accounts, nil
 }
 
 // DeleteByExternalID delete Account by External ID
 func (r *AccountRepository) DeleteByExternalID(ctx context.Context, accountExternalID string) error {
-	_, err := r.collection.DeleteOne(ctx, bson.M{"external_id": accountExternalID})
-	return err
+	_, err := r.collection.DeleteOne(ctx, scopeByTenant(ctx, accountTenantField, bson.M{"external_id": accountExternalID}))
+	return translateErr(err)
 }
 
 // DeleteAll delete all
 func (r *AccountRepository) DeleteAll(ctx context.Context) error {
-	_, err := r.collection.DeleteMany(ctx, bson.M{})
-	return err
+	_, err := r.collection.DeleteMany(ctx, scopeByTenant(ctx, accountTenantField, bson.M{}))
+	return translateErr(err)
 }
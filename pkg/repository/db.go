@@ -7,9 +7,12 @@ import (
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/mongodb"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/sirupsen/logrus"
 	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/migrations"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -37,18 +40,46 @@ func InitDbClient(config *config.Config) *mongo.Client {
 	return client
 }
 
-// ApplyDbMigrations apply all migrations
-func ApplyDbMigrations(config *config.Config, client *mongo.Client) {
+// newMigrationsSource returns the migrations source merged with the registered Go migrations,
+// migrations embedded into the binary are used unless the source URL is set in config
+func newMigrationsSource(config *config.Config) (*goMigrationsSource, error) {
+	var fileSource source.Driver
+	var err error
+	if config.MongoMigrationsDir == "" {
+		fileSource, err = iofs.New(migrations.FS, ".")
+	} else {
+		fileSource, err = source.Open(config.MongoMigrationsDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newGoMigrationsSource(fileSource)
+}
+
+// NewMigrate returns a migrate instance for the database, Go migrations run with ctx
+// and each of their steps is limited by MongoMigrationTimeout
+func NewMigrate(ctx context.Context, config *config.Config, client *mongo.Client) (*migrate.Migrate, error) {
 	mConfig := mongodb.Config{
 		DatabaseName: config.MongoDbName,
 		Locking:      mongodb.Locking{Enabled: true},
 	}
 	driver, err := mongodb.WithInstance(client, &mConfig)
 	if err != nil {
-		logrus.Fatal(err)
+		return nil, err
 	}
 
-	m, err := migrate.NewWithDatabaseInstance(config.MongoMigrationsDir, "mongodb", driver)
+	src, err := newMigrationsSource(config)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &goMigrationsDriver{Driver: driver, db: client.Database(config.MongoDbName), ctx: ctx, timeout: config.MongoMigrationTimeout}
+	return migrate.NewWithInstance("go+file", src, "mongodb", db)
+}
+
+// ApplyDbMigrations apply all migrations
+func ApplyDbMigrations(ctx context.Context, config *config.Config, client *mongo.Client) {
+	m, err := NewMigrate(ctx, config, client)
 	if err != nil {
 		logrus.Fatal(err)
 	}
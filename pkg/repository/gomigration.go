@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/zaharinea/go-example/migrations"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// goMigrationPrefix marks the body of a Go migration passed from the source to the database driver
+const goMigrationPrefix = "go-migration:"
+
+// goMigrationsSource merges the registered Go migrations into a file migrations source
+type goMigrationsSource struct {
+	source.Driver
+	versions []uint
+}
+
+func newGoMigrationsSource(fileSource source.Driver) (*goMigrationsSource, error) {
+	versions := []uint{}
+	version, err := fileSource.First()
+	for err == nil {
+		versions = append(versions, version)
+		version, err = fileSource.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	fileVersions := make(map[uint]bool, len(versions))
+	for _, v := range versions {
+		fileVersions[v] = true
+	}
+	for _, migration := range migrations.Registered() {
+		if fileVersions[migration.Version] {
+			return nil, fmt.Errorf("go migration %d clashes with a file migration", migration.Version)
+		}
+		versions = append(versions, migration.Version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	return &goMigrationsSource{Driver: fileSource, versions: versions}, nil
+}
+
+func notExist(op string, version uint) error {
+	return &os.PathError{Op: op + " for version " + strconv.FormatUint(uint64(version), 10), Path: "go-migrations", Err: os.ErrNotExist}
+}
+
+// Open is part of source.Driver interface, the source is created with newGoMigrationsSource
+func (s *goMigrationsSource) Open(url string) (source.Driver, error) {
+	return nil, fmt.Errorf("go migrations source can not be opened by url")
+}
+
+// First is part of source.Driver interface
+func (s *goMigrationsSource) First() (uint, error) {
+	if len(s.versions) == 0 {
+		return 0, notExist("first", 0)
+	}
+	return s.versions[0], nil
+}
+
+// Prev is part of source.Driver interface
+func (s *goMigrationsSource) Prev(version uint) (uint, error) {
+	idx := sort.Search(len(s.versions), func(i int) bool { return s.versions[i] >= version })
+	if idx == 0 || idx == len(s.versions) || s.versions[idx] != version {
+		return 0, notExist("prev", version)
+	}
+	return s.versions[idx-1], nil
+}
+
+// Next is part of source.Driver interface
+func (s *goMigrationsSource) Next(version uint) (uint, error) {
+	idx := sort.Search(len(s.versions), func(i int) bool { return s.versions[i] > version })
+	if idx >= len(s.versions) {
+		return 0, notExist("next", version)
+	}
+	return s.versions[idx], nil
+}
+
+// ReadUp is part of source.Driver interface
+func (s *goMigrationsSource) ReadUp(version uint) (io.ReadCloser, string, error) {
+	if migration, ok := migrations.Get(version); ok {
+		return ioutil.NopCloser(strings.NewReader(goMigrationPrefix + "up:" + strconv.FormatUint(uint64(version), 10))), migration.Name, nil
+	}
+	return s.Driver.ReadUp(version)
+}
+
+// ReadDown is part of source.Driver interface
+func (s *goMigrationsSource) ReadDown(version uint) (io.ReadCloser, string, error) {
+	if migration, ok := migrations.Get(version); ok {
+		if migration.Down == nil {
+			return nil, "", notExist("read down", version)
+		}
+		return ioutil.NopCloser(strings.NewReader(goMigrationPrefix + "down:" + strconv.FormatUint(uint64(version), 10))), migration.Name, nil
+	}
+	return s.Driver.ReadDown(version)
+}
+
+// goMigrationsDriver runs Go migrations and passes command migrations to the wrapped database driver,
+// versions of both are recorded by the wrapped driver in the same schema collection
+type goMigrationsDriver struct {
+	database.Driver
+	db *mongo.Database
+	// ctx of the caller of migrate, database.Driver passes no context to Run
+	ctx     context.Context
+	timeout time.Duration
+}
+
+// Run is part of database.Driver interface
+func (d *goMigrationsDriver) Run(migration io.Reader) error {
+	body, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(body, []byte(goMigrationPrefix)) {
+		return d.Driver.Run(bytes.NewReader(body))
+	}
+
+	parts := strings.Split(strings.TrimPrefix(string(body), goMigrationPrefix), ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid go migration: %s", body)
+	}
+	version, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid go migration: %s", body)
+	}
+	goMigration, ok := migrations.Get(uint(version))
+	if !ok {
+		return fmt.Errorf("go migration not registered: %d", version)
+	}
+
+	step := goMigration.Up
+	if parts[0] == "down" {
+		step = goMigration.Down
+	}
+	ctx, cancel := context.WithTimeout(d.ctx, d.timeout)
+	defer cancel()
+	if err := step(ctx, d.db); err != nil {
+		return fmt.Errorf("go migration %d %s failed: %w", version, parts[0], err)
+	}
+	return nil
+}
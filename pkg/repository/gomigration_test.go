@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/migrations"
+)
+
+func newTestMigrationsSource(t *testing.T) *goMigrationsSource {
+	fileSource, err := source.Open("file://../../migrations")
+	require.NoError(t, err)
+	src, err := newGoMigrationsSource(fileSource)
+	require.NoError(t, err)
+	return src
+}
+
+func TestGoMigrationsSourceOrder(t *testing.T) {
+	src := newTestMigrationsSource(t)
+
+	version, err := src.First()
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), version)
+
+	version, err = src.Next(5)
+	require.NoError(t, err)
+	assert.Equal(t, uint(6), version)
+
+	version, err = src.Prev(6)
+	require.NoError(t, err)
+	assert.Equal(t, uint(5), version)
+
+	_, err = src.Prev(1)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestMigrationsSourceEmbedded(t *testing.T) {
+	src, err := newMigrationsSource(&config.Config{})
+	require.NoError(t, err)
+
+	version, err := src.First()
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), version)
+
+	version, err = src.Next(5)
+	require.NoError(t, err)
+	assert.Equal(t, uint(6), version)
+}
+
+func TestGoMigrationsSourceReadUp(t *testing.T) {
+	src := newTestMigrationsSource(t)
+
+	r, identifier, err := src.ReadUp(6)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "users_normalize_names", identifier)
+	assert.Equal(t, "go-migration:up:6", string(body))
+
+	r, identifier, err = src.ReadUp(1)
+	require.NoError(t, err)
+	body, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "create_indexes", identifier)
+	assert.True(t, strings.Contains(string(body), "createIndexes"))
+}
+
+func TestGoMigrationsDriverRunPassesFileMigrations(t *testing.T) {
+	stubDriver, err := (&stub.Stub{}).Open("stub://")
+	require.NoError(t, err)
+	driver := &goMigrationsDriver{Driver: stubDriver}
+
+	require.NoError(t, driver.Run(strings.NewReader(`[{"createIndexes": "users"}]`)))
+	assert.Equal(t, 1, len(stubDriver.(*stub.Stub).MigrationSequence))
+}
+
+func TestGoMigrationsDriverRunIrreversible(t *testing.T) {
+	driver := &goMigrationsDriver{ctx: context.Background(), timeout: time.Minute}
+
+	err := driver.Run(strings.NewReader("go-migration:down:6"))
+	assert.True(t, errors.Is(err, migrations.ErrIrreversible))
+}
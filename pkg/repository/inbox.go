@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/zaharinea/go-example/pkg/clock"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const inboxCollection = "inbox"
+
+// inboxDocument records a processed message
+type inboxDocument struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Queue       string             `bson:"queue"`
+	MessageID   string             `bson:"message_id"`
+	ProcessedAt time.Time          `bson:"processed_at"`
+}
+
+// InboxRepository struct
+type InboxRepository struct {
+	collection *mongo.Collection
+	clock      clock.Clock
+}
+
+// NewInboxRepository returns a new InboxRepository struct
+func NewInboxRepository(db *mongo.Database, clock clock.Clock) *InboxRepository {
+	return &InboxRepository{
+		collection: db.Collection(inboxCollection),
+		clock:      clock,
+	}
+}
+
+// Add records the message as processed, returns domain.ErrDuplicate if it was already processed
+func (r *InboxRepository) Add(ctx context.Context, queue string, messageID string) error {
+	message := inboxDocument{
+		Queue:       queue,
+		MessageID:   messageID,
+		ProcessedAt: r.clock.Now(),
+	}
+
+	_, err := r.collection.InsertOne(ctx, message)
+	return translateErr(err)
+}
+
+// Exists returns true if the message was already processed
+func (r *InboxRepository) Exists(ctx context.Context, queue string, messageID string) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"queue": queue, "message_id": messageID})
+	if err != nil {
+		return false, translateErr(err)
+	}
+	return count > 0, nil
+}
+
+// DeleteAll delete all
+func (r *InboxRepository) DeleteAll(ctx context.Context) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{})
+	return translateErr(err)
+}
@@ -0,0 +1,183 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/tenant"
+)
+
+// AccountRepository struct
+type AccountRepository struct {
+	mu sync.RWMutex
+	// accounts by External ID, tombstones included
+	accounts map[string]domain.Account
+	ids      idgen.IDGenerator
+}
+
+// NewAccountRepository returns a new AccountRepository struct
+func NewAccountRepository(ids idgen.IDGenerator) *AccountRepository {
+	return &AccountRepository{accounts: map[string]domain.Account{}, ids: ids}
+}
+
+// checkTenant returns domain.ErrTenantMismatch if ctx carries a tenant other than tenantID
+func checkTenant(ctx context.Context, tenantID string) error {
+	if ctxTenantID, ok := tenant.FromContext(ctx); ok && ctxTenantID != tenantID {
+		return domain.ErrTenantMismatch
+	}
+	return nil
+}
+
+// CreateOrUpdate returns a updated or created Account, unless forced only an update newer than the stored Account
+// or its tombstone is applied, an update newer than the tombstone restores the Account
+func (r *AccountRepository) CreateOrUpdate(ctx context.Context, account domain.Account, forceUpdate bool) (*domain.Account, error) {
+	if err := checkTenant(ctx, account.ExternalID); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.accounts[account.ExternalID]
+	if ok && !forceUpdate && !lastChangedAt(existing).Before(account.UpdatedAt) {
+		return &existing, domain.ErrStale
+	}
+
+	account.CreatedAt = storedTime(account.CreatedAt)
+	account.UpdatedAt = storedTime(account.UpdatedAt)
+	account.DeletedAt = storedTimePtr(account.DeletedAt)
+	if ok {
+		account.ID = existing.ID
+		// an empty deleted_at is omitted from a forced update as in MongoDB, a newer update restores the Account
+		if account.DeletedAt == nil && forceUpdate {
+			account.DeletedAt = existing.DeletedAt
+		}
+	} else {
+		account.ID = r.ids.NewID()
+	}
+	r.accounts[account.ExternalID] = account
+	return &account, nil
+}
+
+// MarkDeleted records a tombstone for the Account, the tombstone is kept so that late updates do not resurrect it
+func (r *AccountRepository) MarkDeleted(ctx context.Context, accountExternalID string, deletedAt time.Time) (*domain.Account, error) {
+	if err := checkTenant(ctx, accountExternalID); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	account, ok := r.accounts[accountExternalID]
+	if ok && (account.DeletedAt != nil || account.UpdatedAt.After(deletedAt)) {
+		return &account, domain.ErrStale
+	}
+	deletedAt = storedTime(deletedAt)
+	if !ok {
+		account = domain.Account{ID: r.ids.NewID(), ExternalID: accountExternalID, CreatedAt: deletedAt}
+	}
+	account.DeletedAt = &deletedAt
+	account.UpdatedAt = deletedAt
+	r.accounts[accountExternalID] = account
+	return &account, nil
+}
+
+// List returns Account list
+func (r *AccountRepository) List(ctx context.Context, limit int64, offset int64) ([]*domain.Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	accounts := []*domain.Account{}
+	for _, account := range r.accounts {
+		account := account
+		if account.DeletedAt == nil && visible(ctx, account.ExternalID) {
+			accounts = append(accounts, &account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+
+	start, end := page(len(accounts), limit, offset)
+	return accounts[start:end], nil
+}
+
+// GetByExternalID returns a Account by External ID
+func (r *AccountRepository) GetByExternalID(ctx context.Context, accountExternalID string) (*domain.Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	account, ok := r.accounts[accountExternalID]
+	if !ok || account.DeletedAt != nil || !visible(ctx, accountExternalID) {
+		return nil, domain.ErrNotFound
+	}
+	return &account, nil
+}
+
+// ListByExternalIDs returns Accounts with the External IDs, missing Accounts are skipped
+func (r *AccountRepository) ListByExternalIDs(ctx context.Context, accountExternalIDs []string) ([]*domain.Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	accounts := []*domain.Account{}
+	seen := map[string]bool{}
+	for _, externalID := range accountExternalIDs {
+		account, ok := r.accounts[externalID]
+		if !ok || seen[externalID] || account.DeletedAt != nil || !visible(ctx, externalID) {
+			continue
+		}
+		seen[externalID] = true
+		accounts = append(accounts, &account)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return accounts, nil
+}
+
+// DeleteByExternalID delete Account by External ID
+func (r *AccountRepository) DeleteByExternalID(ctx context.Context, accountExternalID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if visible(ctx, accountExternalID) {
+		delete(r.accounts, accountExternalID)
+	}
+	return nil
+}
+
+// DeleteAll delete all
+func (r *AccountRepository) DeleteAll(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for externalID := range r.accounts {
+		if visible(ctx, externalID) {
+			delete(r.accounts, externalID)
+		}
+	}
+	return nil
+}
+
+func (r *AccountRepository) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	accounts := make(map[string]domain.Account, len(r.accounts))
+	for externalID, account := range r.accounts {
+		accounts[externalID] = account
+	}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.accounts = accounts
+	}
+}
+
+// lastChangedAt returns the time of the deletion of a tombstone or of the last update
+func lastChangedAt(account domain.Account) time.Time {
+	if account.DeletedAt != nil && account.DeletedAt.After(account.UpdatedAt) {
+		return *account.DeletedAt
+	}
+	return account.UpdatedAt
+}
@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+)
+
+type inboxKey struct {
+	queue     string
+	messageID string
+}
+
+// InboxRepository struct
+type InboxRepository struct {
+	mu       sync.RWMutex
+	messages map[inboxKey]time.Time
+	clock    clock.Clock
+}
+
+// NewInboxRepository returns a new InboxRepository struct
+func NewInboxRepository(clock clock.Clock) *InboxRepository {
+	return &InboxRepository{messages: map[inboxKey]time.Time{}, clock: clock}
+}
+
+// Add records the message as processed, returns domain.ErrDuplicate if it was already processed
+func (r *InboxRepository) Add(ctx context.Context, queue string, messageID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := inboxKey{queue: queue, messageID: messageID}
+	if _, ok := r.messages[key]; ok {
+		return fmt.Errorf("%w: message %s of queue %s", domain.ErrDuplicate, messageID, queue)
+	}
+	r.messages[key] = storedTime(r.clock.Now())
+	return nil
+}
+
+// Exists returns true if the message was already processed
+func (r *InboxRepository) Exists(ctx context.Context, queue string, messageID string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.messages[inboxKey{queue: queue, messageID: messageID}]
+	return ok, nil
+}
+
+// DeleteAll delete all
+func (r *InboxRepository) DeleteAll(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages = map[inboxKey]time.Time{}
+	return nil
+}
+
+func (r *InboxRepository) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := make(map[inboxKey]time.Time, len(r.messages))
+	for key, processedAt := range r.messages {
+		messages[key] = processedAt
+	}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.messages = messages
+	}
+}
@@ -0,0 +1,75 @@
+// Package memory implements repositories in memory, it is intended for tests which should not depend on MongoDB.
+// The repositories follow the semantics of the MongoDB ones: tenant scoping, soft deletes, tombstones,
+// the updated_at guard of upserts and domain errors. The contract is checked by pkg/repository/repositorytest.
+package memory
+
+import (
+	"context"
+	"encoding/hex"
+	"time"
+
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/tenant"
+)
+
+// visible returns true if ctx does not carry a tenant or carries tenantID
+func visible(ctx context.Context, tenantID string) bool {
+	ctxTenantID, ok := tenant.FromContext(ctx)
+	return !ok || ctxTenantID == tenantID
+}
+
+// page returns bounds of the page of n sorted items, zero limit means no limit as in MongoDB
+func page(n int, limit int64, offset int64) (int, int) {
+	start := int(offset)
+	if start > n {
+		start = n
+	}
+	end := n
+	if limit > 0 && start+int(limit) < n {
+		end = start + int(limit)
+	}
+	return start, end
+}
+
+// storedTime returns t as it is read back from MongoDB, BSON dates have millisecond precision and are decoded as UTC
+func storedTime(t time.Time) time.Time {
+	return t.Truncate(time.Millisecond).UTC()
+}
+
+func storedTimePtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	stored := storedTime(*t)
+	return &stored
+}
+
+// validID returns true if id has the format of a hex ObjectID, MongoDB repositories report other IDs as not found
+func validID(id string) bool {
+	if len(id) != 24 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// NewRepository returns a new repository.Repository struct backed by memory,
+// clock sets timestamps and ids generates hex ObjectIDs of documents like in MongoDB repositories
+func NewRepository(clock clock.Clock, ids idgen.IDGenerator) *repository.Repository {
+	user := NewUserRepository(clock, ids)
+	account := NewAccountRepository(ids)
+	inbox := NewInboxRepository(clock)
+	webhook := NewWebhookRepository(clock, ids)
+	delivery := NewWebhookDeliveryRepository(clock, ids)
+	return &repository.Repository{
+		User:            user,
+		Account:         account,
+		Inbox:           inbox,
+		Webhook:         webhook,
+		WebhookDelivery: delivery,
+		Migration:       NewMigrationRepository(),
+		Transactor:      newTransactor(user, account, inbox, webhook, delivery),
+	}
+}
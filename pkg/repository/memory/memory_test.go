@@ -0,0 +1,17 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/repository/repositorytest"
+)
+
+func TestContractSuite(t *testing.T) {
+	suite.Run(t, &repositorytest.ContractSuite{NewRepository: func(clock clock.Clock, ids idgen.IDGenerator) *repository.Repository {
+		return NewRepository(clock, ids)
+	}})
+}
@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/repository"
+)
+
+// MigrationRepository reports the status set by SetStatus, the database is migrated by default
+type MigrationRepository struct {
+	mu     sync.RWMutex
+	status domain.MigrationStatus
+}
+
+// NewMigrationRepository returns a new MigrationRepository struct
+func NewMigrationRepository() *MigrationRepository {
+	return &MigrationRepository{}
+}
+
+// SetStatus sets the status returned by Status
+func (r *MigrationRepository) SetStatus(status domain.MigrationStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+// Status returns current and target migration versions
+func (r *MigrationRepository) Status(ctx context.Context) (*domain.MigrationStatus, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	status := r.status
+	return &status, nil
+}
+
+// Verify returns an error if the database is dirty or not migrated to the latest version
+func (r *MigrationRepository) Verify(ctx context.Context) error {
+	status, _ := r.Status(ctx)
+	if status.Dirty {
+		return fmt.Errorf("%w: version=%d", repository.ErrMigrationsDirty, status.Version)
+	}
+	if status.Pending() {
+		return fmt.Errorf("%w: version=%d, target_version=%d", repository.ErrMigrationsBehind, status.Version, status.TargetVersion)
+	}
+	return nil
+}
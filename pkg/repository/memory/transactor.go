@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"sync"
+)
+
+// snapshotter is implemented by repositories taking part in transactions
+type snapshotter interface {
+	// snapshot returns a function restoring the current state
+	snapshot() func()
+}
+
+type transactionKey struct{}
+
+// Transactor runs transactions one at a time and rolls back the repositories when fn fails.
+// Writes made outside of a transaction while it runs are lost on rollback, which is fine for tests.
+type Transactor struct {
+	mu    sync.Mutex
+	repos []snapshotter
+}
+
+// newTransactor returns a new Transactor struct for the repositories
+func newTransactor(repos ...snapshotter) *Transactor {
+	return &Transactor{repos: repos}
+}
+
+// WithTransaction runs fn inside a transaction, a nested call joins the running transaction
+func (t *Transactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(transactionKey{}) != nil {
+		return fn(ctx)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	restores := make([]func(), len(t.repos))
+	for i, repo := range t.repos {
+		restores[i] = repo.snapshot()
+	}
+
+	if err := fn(context.WithValue(ctx, transactionKey{}, t)); err != nil {
+		for _, restore := range restores {
+			restore()
+		}
+		return err
+	}
+	return nil
+}
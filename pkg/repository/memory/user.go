@@ -0,0 +1,369 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/tenant"
+)
+
+// UserRepository struct
+type UserRepository struct {
+	mu    sync.RWMutex
+	users map[string]domain.User
+	clock clock.Clock
+	ids   idgen.IDGenerator
+	// changes is the change log of users, the sequence number of a change is its resume token
+	changes []userChange
+	seq     int64
+	// evicted is the sequence number of the last change dropped from the capped log
+	evicted int64
+	// changed is closed and replaced when a change is recorded
+	changed chan struct{}
+}
+
+// NewUserRepository returns a new UserRepository struct
+func NewUserRepository(clock clock.Clock, ids idgen.IDGenerator) *UserRepository {
+	return &UserRepository{users: map[string]domain.User{}, clock: clock, ids: ids, changed: make(chan struct{})}
+}
+
+// Create creates the user and sets its ID, a user of another tenant is domain.ErrTenantMismatch
+func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
+	if err := checkTenant(ctx, user.AccountExternalID); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	if user.ID == "" {
+		user.ID = r.ids.NewID()
+	}
+	if !validID(user.ID) {
+		return fmt.Errorf("invalid user ID: %s", user.ID)
+	}
+	if _, ok := r.users[user.ID]; ok {
+		return fmt.Errorf("%w: user %s", domain.ErrDuplicate, user.ID)
+	}
+
+	stored := *user
+	stored.CreatedAt = storedTime(stored.CreatedAt)
+	stored.UpdatedAt = storedTime(stored.UpdatedAt)
+	stored.DeletedAt = storedTimePtr(stored.DeletedAt)
+	r.users[user.ID] = stored
+	r.record(domain.UserCreated, stored)
+	return nil
+}
+
+// List returns User list
+func (r *UserRepository) List(ctx context.Context, limit int64, offset int64) ([]*domain.User, error) {
+	return r.find(ctx, func(user *domain.User) bool { return true }, limit, offset), nil
+}
+
+// GetByID returns a User by ID
+func (r *UserRepository) GetByID(ctx context.Context, userID string) (*domain.User, error) {
+	if !validID(userID) {
+		return nil, domain.ErrNotFound
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[userID]
+	if !ok || user.DeletedAt != nil || !visible(ctx, user.AccountExternalID) {
+		return nil, domain.ErrNotFound
+	}
+	return &user, nil
+}
+
+// Update updates the User, a missing User is not an error
+func (r *UserRepository) Update(ctx context.Context, userID string, update domain.UpdateUser) error {
+	if !validID(userID) {
+		return domain.ErrNotFound
+	}
+	_, err := r.UpdateAndReturn(ctx, userID, update)
+	if err == domain.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// UpdateAndReturn returns a updated User
+func (r *UserRepository) UpdateAndReturn(ctx context.Context, userID string, update domain.UpdateUser) (*domain.User, error) {
+	if !validID(userID) {
+		return nil, domain.ErrNotFound
+	}
+	if update.AccountExternalID != "" {
+		if err := checkTenant(ctx, update.AccountExternalID); err != nil {
+			return nil, err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok || user.DeletedAt != nil || !visible(ctx, user.AccountExternalID) {
+		return nil, domain.ErrNotFound
+	}
+	user.Name = update.Name
+	// an empty account is omitted from the update as in MongoDB
+	if update.AccountExternalID != "" {
+		user.AccountExternalID = update.AccountExternalID
+	}
+	user.UpdatedAt = storedTime(r.clock.Now())
+	r.users[userID] = user
+	r.record(domain.UserUpdated, user)
+	return &user, nil
+}
+
+// ListByAccountExternalID returns User list of the Account
+func (r *UserRepository) ListByAccountExternalID(ctx context.Context, accountExternalID string, limit int64, offset int64) ([]*domain.User, error) {
+	return r.find(ctx, func(user *domain.User) bool { return user.AccountExternalID == accountExternalID }, limit, offset), nil
+}
+
+// CountByAccountExternalID returns count of Users of the Account
+func (r *UserRepository) CountByAccountExternalID(ctx context.Context, accountExternalID string) (int64, error) {
+	users := r.find(ctx, func(user *domain.User) bool { return user.AccountExternalID == accountExternalID }, 0, 0)
+	return int64(len(users)), nil
+}
+
+// SoftDeleteByAccountExternalID marks Users of the Account as deleted
+func (r *UserRepository) SoftDeleteByAccountExternalID(ctx context.Context, accountExternalID string, deletedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range r.sortedIDs() {
+		user := r.users[id]
+		if user.AccountExternalID != accountExternalID || user.DeletedAt != nil || !visible(ctx, user.AccountExternalID) {
+			continue
+		}
+		user.DeletedAt = storedTimePtr(&deletedAt)
+		user.UpdatedAt = storedTime(r.clock.Now())
+		r.users[id] = user
+		r.record(domain.UserDeleted, user)
+	}
+	return nil
+}
+
+// DetachAccount removes the Account from its Users
+func (r *UserRepository) DetachAccount(ctx context.Context, accountExternalID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range r.sortedIDs() {
+		user := r.users[id]
+		if user.AccountExternalID != accountExternalID || !visible(ctx, user.AccountExternalID) {
+			continue
+		}
+		user.AccountExternalID = ""
+		user.UpdatedAt = storedTime(r.clock.Now())
+		r.users[id] = user
+		if user.DeletedAt == nil {
+			r.record(domain.UserUpdated, user)
+		}
+	}
+	return nil
+}
+
+// DeleteByID marks User as deleted
+func (r *UserRepository) DeleteByID(ctx context.Context, userID string) error {
+	if !validID(userID) {
+		return domain.ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok || user.DeletedAt != nil || !visible(ctx, user.AccountExternalID) {
+		return domain.ErrNotFound
+	}
+	now := storedTime(r.clock.Now())
+	user.DeletedAt = &now
+	user.UpdatedAt = now
+	r.users[userID] = user
+	r.record(domain.UserDeleted, user)
+	return nil
+}
+
+// DeleteAll delete all
+func (r *UserRepository) DeleteAll(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range r.sortedIDs() {
+		if visible(ctx, r.users[id].AccountExternalID) {
+			delete(r.users, id)
+			r.record(domain.UserDeleted, domain.User{ID: id})
+		}
+	}
+	return nil
+}
+
+// find returns the page of not deleted Users matching the filter ordered by ID
+func (r *UserRepository) find(ctx context.Context, filter func(user *domain.User) bool, limit int64, offset int64) []*domain.User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []*domain.User{}
+	for _, user := range r.users {
+		user := user
+		if user.DeletedAt == nil && visible(ctx, user.AccountExternalID) && filter(&user) {
+			users = append(users, &user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	start, end := page(len(users), limit, offset)
+	return users[start:end]
+}
+
+func (r *UserRepository) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make(map[string]domain.User, len(r.users))
+	for id, user := range r.users {
+		users[id] = user
+	}
+	// changes of a rolled back transaction are dropped as MongoDB streams only committed changes,
+	// seq is kept so that tokens are not reused
+	changes := append([]userChange(nil), r.changes...)
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.users = users
+		r.changes = changes
+	}
+}
+
+// changeLogSize is the number of changes kept for resuming streams like the capped oplog of MongoDB
+const changeLogSize = 1000
+
+type userChange struct {
+	seq    int64
+	change domain.UserChange
+}
+
+// record appends the change of the user to the change log, it is called with mu held
+func (r *UserRepository) record(changeType string, user domain.User) {
+	r.seq++
+	r.changes = append(r.changes, userChange{seq: r.seq, change: domain.UserChange{Type: changeType, User: &user, Token: formatToken(r.seq)}})
+	if len(r.changes) > changeLogSize {
+		r.evicted = r.changes[0].seq
+		r.changes = r.changes[1:]
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// sortedIDs returns IDs of stored users in the order of MongoDB bulk writes, it is called with mu held
+func (r *UserRepository) sortedIDs() []string {
+	ids := make([]string, 0, len(r.users))
+	for id := range r.users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Watch returns a stream of changes of users after resumeToken, an empty token starts at the current time.
+// A tenant's stream matches each change by the state of the user recorded with the change, not by its current state,
+// as the MongoDB change stream does, so it does not contain changes of users detached from the tenant's account
+// and users removed by DeleteAll.
+func (r *UserRepository) Watch(ctx context.Context, resumeToken string, maxAwait time.Duration) (repository.IUserChangeStream, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pos := r.seq
+	if resumeToken != "" {
+		var err error
+		if pos, err = strconv.ParseInt(resumeToken, 16, 64); err != nil || pos < r.evicted || pos > r.seq {
+			return nil, domain.ErrInvalidResumeToken
+		}
+	}
+	tenantID, scoped := tenant.FromContext(ctx)
+	return &userChangeStream{repo: r, pos: pos, tenantID: tenantID, scoped: scoped, maxAwait: maxAwait}, nil
+}
+
+// userChangeStream struct
+type userChangeStream struct {
+	repo     *UserRepository
+	pos      int64
+	tenantID string
+	scoped   bool
+	maxAwait time.Duration
+}
+
+// Next returns the next change, or nil if there was none for maxAwait of Watch
+func (s *userChangeStream) Next(ctx context.Context) (*domain.UserChange, error) {
+	timer := time.NewTimer(s.maxAwait)
+	defer timer.Stop()
+
+	for {
+		change, scanned, changed, err := s.scan()
+		if change != nil || err != nil {
+			return change, err
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			// the token of an idle stream moves past changes of other tenants
+			s.pos = scanned
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// scan returns the next change of the stream, or the sequence number it scanned up to and the channel closed on the next change
+func (s *userChangeStream) scan() (*domain.UserChange, int64, chan struct{}, error) {
+	s.repo.mu.RLock()
+	defer s.repo.mu.RUnlock()
+
+	if s.pos < s.repo.evicted {
+		return nil, 0, nil, domain.ErrInvalidResumeToken
+	}
+	for _, entry := range s.repo.changes {
+		if entry.seq <= s.pos {
+			continue
+		}
+		if s.scoped && entry.change.User.AccountExternalID != s.tenantID {
+			continue
+		}
+		s.pos = entry.seq
+		change := entry.change
+		user := *change.User
+		change.User = &user
+		return &change, 0, nil, nil
+	}
+	return nil, s.repo.seq, s.repo.changed, nil
+}
+
+// ResumeToken returns the token resuming the stream after the last returned change or idle period
+func (s *userChangeStream) ResumeToken() string {
+	return formatToken(s.pos)
+}
+
+// Close closes the stream
+func (s *userChangeStream) Close(ctx context.Context) error {
+	return nil
+}
+
+// formatToken returns the resume token of the sequence number, tokens are hex strings as in MongoDB
+func formatToken(seq int64) string {
+	return fmt.Sprintf("%016x", seq)
+}
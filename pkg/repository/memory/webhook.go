@@ -0,0 +1,214 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/tenant"
+)
+
+// WebhookRepository struct
+type WebhookRepository struct {
+	mu       sync.RWMutex
+	webhooks map[string]domain.Webhook
+	clock    clock.Clock
+	ids      idgen.IDGenerator
+}
+
+// NewWebhookRepository returns a new WebhookRepository struct
+func NewWebhookRepository(clock clock.Clock, ids idgen.IDGenerator) *WebhookRepository {
+	return &WebhookRepository{webhooks: map[string]domain.Webhook{}, clock: clock, ids: ids}
+}
+
+// Create creates the enabled webhook and sets its ID
+func (r *WebhookRepository) Create(ctx context.Context, webhook *domain.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tenantID, ok := tenant.FromContext(ctx); ok {
+		webhook.AccountExternalID = tenantID
+	}
+	now := r.clock.Now()
+	webhook.ID = r.ids.NewID()
+	webhook.Enabled = true
+	webhook.Failures = 0
+	webhook.DisabledAt = nil
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+
+	stored := *webhook
+	stored.EventTypes = append([]string(nil), webhook.EventTypes...)
+	stored.CreatedAt = storedTime(stored.CreatedAt)
+	stored.UpdatedAt = storedTime(stored.UpdatedAt)
+	r.webhooks[webhook.ID] = stored
+	return nil
+}
+
+// List returns Webhook list
+func (r *WebhookRepository) List(ctx context.Context, limit int64, offset int64) ([]*domain.Webhook, error) {
+	webhooks := r.find(func(webhook *domain.Webhook) bool { return visible(ctx, webhook.AccountExternalID) })
+	start, end := page(len(webhooks), limit, offset)
+	return webhooks[start:end], nil
+}
+
+// GetByID returns a Webhook by ID
+func (r *WebhookRepository) GetByID(ctx context.Context, webhookID string) (*domain.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhook, ok := r.webhooks[webhookID]
+	if !ok || !visible(ctx, webhook.AccountExternalID) {
+		return nil, domain.ErrNotFound
+	}
+	return copyWebhook(webhook), nil
+}
+
+// Update returns the updated Webhook
+func (r *WebhookRepository) Update(ctx context.Context, webhookID string, update domain.UpdateWebhook) (*domain.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	webhook, ok := r.webhooks[webhookID]
+	if !ok || !visible(ctx, webhook.AccountExternalID) {
+		return nil, domain.ErrNotFound
+	}
+
+	now := storedTime(r.clock.Now())
+	webhook.URL = update.URL
+	webhook.EventTypes = append([]string(nil), update.EventTypes...)
+	webhook.UpdatedAt = now
+	if update.Secret != "" {
+		webhook.Secret = update.Secret
+	}
+	if update.Enabled != nil {
+		webhook.Enabled = *update.Enabled
+		webhook.Failures = 0
+		webhook.DisabledAt = nil
+		if !webhook.Enabled {
+			webhook.DisabledAt = &now
+		}
+	}
+	r.webhooks[webhookID] = webhook
+	return copyWebhook(webhook), nil
+}
+
+// DeleteByID delete Webhook by ID
+func (r *WebhookRepository) DeleteByID(ctx context.Context, webhookID string) error {
+	if !validID(webhookID) {
+		return domain.ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if webhook, ok := r.webhooks[webhookID]; ok && visible(ctx, webhook.AccountExternalID) {
+		delete(r.webhooks, webhookID)
+	}
+	return nil
+}
+
+// ListSubscribed returns enabled webhooks subscribed to the event type which belong to the tenant
+// accountExternalID, an empty accountExternalID matches webhooks of no tenant, the tenant of ctx is ignored
+func (r *WebhookRepository) ListSubscribed(ctx context.Context, eventType string, accountExternalID string) ([]*domain.Webhook, error) {
+	return r.find(func(webhook *domain.Webhook) bool {
+		if !webhook.Enabled || webhook.AccountExternalID != accountExternalID {
+			return false
+		}
+		for _, subscribed := range webhook.EventTypes {
+			if subscribed == eventType {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// RecordSuccess resets failures of the webhook
+func (r *WebhookRepository) RecordSuccess(ctx context.Context, webhookID string) error {
+	if !validID(webhookID) {
+		return domain.ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if webhook, ok := r.webhooks[webhookID]; ok {
+		webhook.Failures = 0
+		r.webhooks[webhookID] = webhook
+	}
+	return nil
+}
+
+// RecordFailure counts a failed delivery attempt, the webhook is disabled after disableAfter failures in a row
+func (r *WebhookRepository) RecordFailure(ctx context.Context, webhookID string, disableAfter int64) (*domain.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	webhook, ok := r.webhooks[webhookID]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	webhook.Failures++
+	if webhook.Enabled && webhook.Failures >= disableAfter {
+		now := storedTime(r.clock.Now())
+		webhook.Enabled = false
+		webhook.DisabledAt = &now
+		webhook.UpdatedAt = now
+	}
+	r.webhooks[webhookID] = webhook
+	return copyWebhook(webhook), nil
+}
+
+// DeleteAll delete all
+func (r *WebhookRepository) DeleteAll(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, webhook := range r.webhooks {
+		if visible(ctx, webhook.AccountExternalID) {
+			delete(r.webhooks, id)
+		}
+	}
+	return nil
+}
+
+// find returns Webhooks matching the filter ordered by ID
+func (r *WebhookRepository) find(filter func(webhook *domain.Webhook) bool) []*domain.Webhook {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhooks := []*domain.Webhook{}
+	for _, webhook := range r.webhooks {
+		webhook := webhook
+		if filter(&webhook) {
+			webhooks = append(webhooks, copyWebhook(webhook))
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks
+}
+
+func (r *WebhookRepository) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhooks := make(map[string]domain.Webhook, len(r.webhooks))
+	for id, webhook := range r.webhooks {
+		webhooks[id] = webhook
+	}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.webhooks = webhooks
+	}
+}
+
+// copyWebhook returns a copy of the stored webhook which does not share its event types
+func copyWebhook(webhook domain.Webhook) *domain.Webhook {
+	webhook.EventTypes = append([]string(nil), webhook.EventTypes...)
+	return &webhook
+}
@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+)
+
+// WebhookDeliveryRepository struct
+type WebhookDeliveryRepository struct {
+	mu         sync.RWMutex
+	deliveries map[string]domain.WebhookDelivery
+	clock      clock.Clock
+	ids        idgen.IDGenerator
+}
+
+// NewWebhookDeliveryRepository returns a new WebhookDeliveryRepository struct
+func NewWebhookDeliveryRepository(clock clock.Clock, ids idgen.IDGenerator) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{deliveries: map[string]domain.WebhookDelivery{}, clock: clock, ids: ids}
+}
+
+// Create stores the delivery as pending, a zero NextAttemptAt is due immediately
+func (r *WebhookDeliveryRepository) Create(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	if !validID(delivery.WebhookID) {
+		return domain.ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	delivery.ID = r.ids.NewID()
+	delivery.Status = domain.DeliveryPending
+	if delivery.NextAttemptAt.IsZero() {
+		delivery.NextAttemptAt = now
+	}
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	r.deliveries[delivery.ID] = storedDelivery(*delivery)
+	return nil
+}
+
+// ListByWebhookID returns deliveries of the webhook newest first
+func (r *WebhookDeliveryRepository) ListByWebhookID(ctx context.Context, webhookID string, limit int64, offset int64) ([]*domain.WebhookDelivery, error) {
+	if !validID(webhookID) {
+		return nil, domain.ErrNotFound
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deliveries := []*domain.WebhookDelivery{}
+	for _, delivery := range r.deliveries {
+		delivery := delivery
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+
+	start, end := page(len(deliveries), limit, offset)
+	return deliveries[start:end], nil
+}
+
+// ClaimDue returns the pending delivery due first and postpones it by lease so that other workers skip it,
+// domain.ErrNotFound if no delivery is due
+func (r *WebhookDeliveryRepository) ClaimDue(ctx context.Context, lease time.Duration) (*domain.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	var due *domain.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		delivery := delivery
+		if delivery.Status != domain.DeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		if due == nil || delivery.NextAttemptAt.Before(due.NextAttemptAt) ||
+			(delivery.NextAttemptAt.Equal(due.NextAttemptAt) && delivery.ID < due.ID) {
+			due = &delivery
+		}
+	}
+	if due == nil {
+		return nil, domain.ErrNotFound
+	}
+
+	due.NextAttemptAt = storedTime(now.Add(lease))
+	r.deliveries[due.ID] = *due
+	return due, nil
+}
+
+// Update stores the result of an attempt
+func (r *WebhookDeliveryRepository) Update(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.deliveries[delivery.ID]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	delivery.UpdatedAt = r.clock.Now()
+
+	stored.Status = delivery.Status
+	stored.Attempts = delivery.Attempts
+	stored.NextAttemptAt = delivery.NextAttemptAt
+	stored.LastAttemptAt = delivery.LastAttemptAt
+	stored.ResponseStatus = delivery.ResponseStatus
+	stored.Error = delivery.Error
+	stored.UpdatedAt = delivery.UpdatedAt
+	r.deliveries[delivery.ID] = storedDelivery(stored)
+	return nil
+}
+
+// DeleteByWebhookID deletes deliveries of the webhook
+func (r *WebhookDeliveryRepository) DeleteByWebhookID(ctx context.Context, webhookID string) error {
+	if !validID(webhookID) {
+		return domain.ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, delivery := range r.deliveries {
+		if delivery.WebhookID == webhookID {
+			delete(r.deliveries, id)
+		}
+	}
+	return nil
+}
+
+// DeleteAll delete all
+func (r *WebhookDeliveryRepository) DeleteAll(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deliveries = map[string]domain.WebhookDelivery{}
+	return nil
+}
+
+func (r *WebhookDeliveryRepository) snapshot() func() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deliveries := make(map[string]domain.WebhookDelivery, len(r.deliveries))
+	for id, delivery := range r.deliveries {
+		deliveries[id] = delivery
+	}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.deliveries = deliveries
+	}
+}
+
+// storedDelivery returns the delivery with times as they are read back from MongoDB
+func storedDelivery(delivery domain.WebhookDelivery) domain.WebhookDelivery {
+	delivery.NextAttemptAt = storedTime(delivery.NextAttemptAt)
+	delivery.LastAttemptAt = storedTimePtr(delivery.LastAttemptAt)
+	delivery.CreatedAt = storedTime(delivery.CreatedAt)
+	delivery.UpdatedAt = storedTime(delivery.UpdatedAt)
+	return delivery
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrMigrationsBehind returned when the database is not migrated to the latest version
+var ErrMigrationsBehind = errors.New("database migrations are behind")
+
+// ErrMigrationsDirty returned when the last migration failed
+var ErrMigrationsDirty = errors.New("database migrations are dirty")
+
+// MigrationRepository struct
+type MigrationRepository struct {
+	config *config.Config
+	client *mongo.Client
+
+	mu      sync.Mutex
+	migrate *migrate.Migrate
+}
+
+// NewMigrationRepository returns a new MigrationRepository struct
+func NewMigrationRepository(config *config.Config, client *mongo.Client) *MigrationRepository {
+	return &MigrationRepository{config: config, client: client}
+}
+
+// instance returns the migrate instance created by the first call. Creating an instance takes the migration lock,
+// so it is not repeated on each status request. The instance is never closed, closing it disconnects the shared client
+func (r *MigrationRepository) instance() (*migrate.Migrate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.migrate == nil {
+		// the instance only reads the version, it never runs Go migrations
+		m, err := NewMigrate(context.Background(), r.config, r.client)
+		if err != nil {
+			return nil, err
+		}
+		r.migrate = m
+	}
+	return r.migrate, nil
+}
+
+// Status returns current and target migration versions
+func (r *MigrationRepository) Status(ctx context.Context) (*domain.MigrationStatus, error) {
+	m, err := r.instance()
+	if err != nil {
+		return nil, err
+	}
+
+	var status domain.MigrationStatus
+	status.Version, status.Dirty, err = m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return nil, err
+	}
+
+	status.TargetVersion, err = r.targetVersion()
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Verify returns an error if the database is dirty or not migrated to the latest version
+func (r *MigrationRepository) Verify(ctx context.Context) error {
+	status, err := r.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Dirty {
+		return fmt.Errorf("%w: version=%d", ErrMigrationsDirty, status.Version)
+	}
+	if status.Pending() {
+		return fmt.Errorf("%w: version=%d, target_version=%d", ErrMigrationsBehind, status.Version, status.TargetVersion)
+	}
+	return nil
+}
+
+// targetVersion returns the latest version in the migrations source
+func (r *MigrationRepository) targetVersion() (uint, error) {
+	src, err := newMigrationsSource(r.config)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return version, nil
+			}
+			return 0, err
+		}
+		version = next
+	}
+}
@@ -3,38 +3,63 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// IUserRepository interface
-type IUserRepository interface {
-	Create(ctx context.Context, user *User) error
-	List(ctx context.Context, limit int64, offset int64) ([]*User, error)
-	GetByID(ctx context.Context, userID string) (*User, error)
-	Update(ctx context.Context, userID string, update UpdateUser) error
-	UpdateAndReturn(ctx context.Context, userID string, update UpdateUser) (*User, error)
-	DeleteByID(ctx context.Context, userID string) error
-	DeleteAll(ctx context.Context) error
+// notDeleted filter hides soft deleted and tombstoned documents
+var notDeleted = bson.M{"$exists": false}
+
+// scopeByTenant restricts the filter to the tenant carried by ctx, tenantField holds the tenant ID in the collection
+func scopeByTenant(ctx context.Context, tenantField string, filter bson.M) bson.M {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return filter
+	}
+	return bson.M{"$and": bson.A{filter, bson.M{tenantField: tenantID}}}
 }
 
-// IAccountRepository interface
-type IAccountRepository interface {
-	CreateOrUpdate(ctx context.Context, account Account, forceUpdate bool) (*Account, error)
-	List(ctx context.Context, limit int64, offset int64) ([]*Account, error)
-	GetByExternalID(ctx context.Context, accountExternalID string) (*Account, error)
-	DeleteByExternalID(ctx context.Context, accountExternalID string) error
-	DeleteAll(ctx context.Context) error
+// checkTenant returns domain.ErrTenantMismatch if ctx carries a tenant other than tenantID
+func checkTenant(ctx context.Context, tenantID string) error {
+	if ctxTenantID, ok := tenant.FromContext(ctx); ok && ctxTenantID != tenantID {
+		return domain.ErrTenantMismatch
+	}
+	return nil
 }
 
-// Repository struct
-type Repository struct {
-	User    IUserRepository
-	Account IAccountRepository
+// objectIDFromHex converts the domain ID, an invalid ID can not match any document
+func objectIDFromHex(id string) (primitive.ObjectID, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return objectID, domain.ErrNotFound
+	}
+	return objectID, nil
 }
 
-// IsDuplicateKeyErr DuplicateKey error helper
-func (r *Repository) IsDuplicateKeyErr(err error) bool {
+// translateErr translates MongoDB driver errors to domain errors
+func translateErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return domain.ErrNotFound
+	case isDuplicateKeyErr(err):
+		return fmt.Errorf("%w: %s", domain.ErrDuplicate, err)
+	default:
+		return err
+	}
+}
+
+// isDuplicateKeyErr DuplicateKey error helper
+func isDuplicateKeyErr(err error) bool {
 	var writeExc mongo.WriteException
 	var commandExc mongo.CommandError
 	if errors.As(err, &writeExc) {
@@ -51,9 +76,144 @@ func (r *Repository) IsDuplicateKeyErr(err error) bool {
 	return false
 }
 
-// NewRepository returns a new Repository struct
-func NewRepository(db *mongo.Database) *Repository {
+// IUserRepository interface
+type IUserRepository interface {
+	Create(ctx context.Context, user *domain.User) error
+	List(ctx context.Context, limit int64, offset int64) ([]*domain.User, error)
+	GetByID(ctx context.Context, userID string) (*domain.User, error)
+	Update(ctx context.Context, userID string, update domain.UpdateUser) error
+	UpdateAndReturn(ctx context.Context, userID string, update domain.UpdateUser) (*domain.User, error)
+	DeleteByID(ctx context.Context, userID string) error
+	ListByAccountExternalID(ctx context.Context, accountExternalID string, limit int64, offset int64) ([]*domain.User, error)
+	CountByAccountExternalID(ctx context.Context, accountExternalID string) (int64, error)
+	SoftDeleteByAccountExternalID(ctx context.Context, accountExternalID string, deletedAt time.Time) error
+	DetachAccount(ctx context.Context, accountExternalID string) error
+	DeleteAll(ctx context.Context) error
+	// Watch returns a stream of changes of users after resumeToken, an empty token starts at the current time
+	Watch(ctx context.Context, resumeToken string, maxAwait time.Duration) (IUserChangeStream, error)
+}
+
+// IUserChangeStream interface
+type IUserChangeStream interface {
+	// Next returns the next change, or nil if there was none for maxAwait of Watch
+	Next(ctx context.Context) (*domain.UserChange, error)
+	// ResumeToken returns the token resuming the stream after the last returned change or idle period
+	ResumeToken() string
+	Close(ctx context.Context) error
+}
+
+// IAccountRepository interface
+type IAccountRepository interface {
+	CreateOrUpdate(ctx context.Context, account domain.Account, forceUpdate bool) (*domain.Account, error)
+	MarkDeleted(ctx context.Context, accountExternalID string, deletedAt time.Time) (*domain.Account, error)
+	List(ctx context.Context, limit int64, offset int64) ([]*domain.Account, error)
+	GetByExternalID(ctx context.Context, accountExternalID string) (*domain.Account, error)
+	ListByExternalIDs(ctx context.Context, accountExternalIDs []string) ([]*domain.Account, error)
+	DeleteByExternalID(ctx context.Context, accountExternalID string) error
+	DeleteAll(ctx context.Context) error
+}
+
+// IWebhookRepository interface
+type IWebhookRepository interface {
+	Create(ctx context.Context, webhook *domain.Webhook) error
+	List(ctx context.Context, limit int64, offset int64) ([]*domain.Webhook, error)
+	GetByID(ctx context.Context, webhookID string) (*domain.Webhook, error)
+	Update(ctx context.Context, webhookID string, update domain.UpdateWebhook) (*domain.Webhook, error)
+	DeleteByID(ctx context.Context, webhookID string) error
+	// ListSubscribed returns enabled webhooks subscribed to the event type which belong to the tenant
+	// accountExternalID, an empty accountExternalID matches webhooks of no tenant, the tenant of ctx is ignored
+	ListSubscribed(ctx context.Context, eventType string, accountExternalID string) ([]*domain.Webhook, error)
+	// RecordSuccess resets failures of the webhook
+	RecordSuccess(ctx context.Context, webhookID string) error
+	// RecordFailure counts a failed delivery attempt, the webhook is disabled after disableAfter failures in a row
+	RecordFailure(ctx context.Context, webhookID string, disableAfter int64) (*domain.Webhook, error)
+	DeleteAll(ctx context.Context) error
+}
+
+// IWebhookDeliveryRepository interface
+type IWebhookDeliveryRepository interface {
+	// Create stores the delivery as pending, a zero NextAttemptAt is due immediately
+	Create(ctx context.Context, delivery *domain.WebhookDelivery) error
+	// ListByWebhookID returns deliveries of the webhook newest first
+	ListByWebhookID(ctx context.Context, webhookID string, limit int64, offset int64) ([]*domain.WebhookDelivery, error)
+	// ClaimDue returns the pending delivery due first and postpones it by lease so that other workers skip it,
+	// domain.ErrNotFound if no delivery is due
+	ClaimDue(ctx context.Context, lease time.Duration) (*domain.WebhookDelivery, error)
+	// Update stores the result of an attempt
+	Update(ctx context.Context, delivery *domain.WebhookDelivery) error
+	DeleteByWebhookID(ctx context.Context, webhookID string) error
+	DeleteAll(ctx context.Context) error
+}
+
+// IInboxRepository interface
+type IInboxRepository interface {
+	Add(ctx context.Context, queue string, messageID string) error
+	Exists(ctx context.Context, queue string, messageID string) (bool, error)
+	DeleteAll(ctx context.Context) error
+}
+
+// IMigrationRepository interface
+type IMigrationRepository interface {
+	Status(ctx context.Context) (*domain.MigrationStatus, error)
+	Verify(ctx context.Context) error
+}
+
+// ITransactor interface
+type ITransactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Repository struct
+type Repository struct {
+	User    IUserRepository
+	Account IAccountRepository
+	Inbox   IInboxRepository
+	Webhook IWebhookRepository
+	// WebhookDelivery is the delivery log of webhooks
+	WebhookDelivery IWebhookDeliveryRepository
+	// Migration is set by the caller as it depends on the migrations source from config
+	Migration  IMigrationRepository
+	Transactor ITransactor
+}
+
+// WithTransaction runs fn inside a transaction, all repository calls made with the passed context join it
+func (r *Repository) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.Transactor.WithTransaction(ctx, fn)
+}
+
+// Transactor struct
+type Transactor struct {
+	client *mongo.Client
+}
+
+// NewTransactor returns a new Transactor struct
+func NewTransactor(client *mongo.Client) *Transactor {
+	return &Transactor{client: client}
+}
+
+// WithTransaction runs fn inside a MongoDB transaction, a nested call joins the running transaction
+func (t *Transactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return translateErr(err)
+}
+
+// NewRepository returns a new Repository struct, clock sets timestamps and ids generates hex ObjectIDs of documents
+func NewRepository(db *mongo.Database, clock clock.Clock, ids idgen.IDGenerator) *Repository {
 	return &Repository{
-		User: NewUserRepository(db), Account: NewAccountRepository(db),
+		User: NewUserRepository(db, clock, ids), Account: NewAccountRepository(db, ids), Inbox: NewInboxRepository(db, clock),
+		Webhook: NewWebhookRepository(db, clock, ids), WebhookDelivery: NewWebhookDeliveryRepository(db, clock, ids),
+		Transactor: NewTransactor(db.Client()),
 	}
 }
@@ -0,0 +1,24 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/repository/repositorytest"
+)
+
+func TestContractSuite(t *testing.T) {
+	c := config.NewTestingConfig()
+	dbClient := repository.InitDbClient(c)
+	repository.ApplyDbMigrations(context.Background(), c, dbClient)
+	db := dbClient.Database(c.MongoDbName)
+
+	suite.Run(t, &repositorytest.ContractSuite{NewRepository: func(clock clock.Clock, ids idgen.IDGenerator) *repository.Repository {
+		return repository.NewRepository(db, clock, ids)
+	}})
+}
@@ -0,0 +1,784 @@
+// Package repositorytest holds the contract test suite shared by implementations of the repositories,
+// running it against each implementation keeps them in sync.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/tenant"
+)
+
+var (
+	createdAt = time.Date(2020, 11, 20, 0, 0, 0, 0, time.UTC)
+	updatedAt = time.Date(2020, 11, 21, 0, 0, 0, 0, time.UTC)
+	now       = time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// ContractSuite checks the behaviour services and handlers expect from repositories
+type ContractSuite struct {
+	suite.Suite
+	// NewRepository returns the repository under test using the clock and the IDs,
+	// its data is deleted before each test
+	NewRepository func(clock clock.Clock, ids idgen.IDGenerator) *repository.Repository
+
+	ctx   context.Context
+	clock *clock.Fake
+	ids   *idgen.Sequence
+	repos *repository.Repository
+}
+
+// SetupTest deletes data left by the previous test
+func (s *ContractSuite) SetupTest() {
+	s.ctx = context.Background()
+	s.clock = clock.NewFake(now)
+	s.ids = idgen.NewSequence()
+	s.repos = s.NewRepository(s.clock, s.ids)
+	s.Require().NoError(s.repos.User.DeleteAll(s.ctx))
+	s.Require().NoError(s.repos.Account.DeleteAll(s.ctx))
+	s.Require().NoError(s.repos.Inbox.DeleteAll(s.ctx))
+	s.Require().NoError(s.repos.Webhook.DeleteAll(s.ctx))
+	s.Require().NoError(s.repos.WebhookDelivery.DeleteAll(s.ctx))
+}
+
+func (s *ContractSuite) requireErrorIs(err error, target error) {
+	s.Require().Error(err)
+	s.Require().True(errors.Is(err, target), "expected %v, got %v", target, err)
+}
+
+func (s *ContractSuite) createUser(ctx context.Context, name string, accountExternalID string) *domain.User {
+	user := &domain.User{Name: name, AccountExternalID: accountExternalID}
+	s.Require().NoError(s.repos.User.Create(ctx, user))
+	return user
+}
+
+func (s *ContractSuite) createAccount(externalID string, updatedAt time.Time) *domain.Account {
+	account, err := s.repos.Account.CreateOrUpdate(s.ctx, domain.Account{
+		ExternalID: externalID,
+		Name:       "account" + externalID,
+		CreatedAt:  createdAt,
+		UpdatedAt:  updatedAt,
+	}, true)
+	s.Require().NoError(err)
+	return account
+}
+
+func (s *ContractSuite) TestUserCreate() {
+	user := s.createUser(s.ctx, "user1", "1")
+	s.Require().Equal("000000000000000000000001", user.ID)
+	s.Require().Equal(now, user.CreatedAt)
+	s.Require().Equal(now, user.UpdatedAt)
+
+	stored, err := s.repos.User.GetByID(s.ctx, user.ID)
+	s.Require().NoError(err)
+	s.Require().Equal(user, stored)
+}
+
+func (s *ContractSuite) TestUserTenantMismatch() {
+	ctxA := tenant.WithTenant(s.ctx, "A")
+	s.requireErrorIs(s.repos.User.Create(ctxA, &domain.User{Name: "user1", AccountExternalID: "B"}), domain.ErrTenantMismatch)
+	s.requireErrorIs(s.repos.User.Create(ctxA, &domain.User{Name: "user1"}), domain.ErrTenantMismatch)
+
+	user := s.createUser(ctxA, "user1", "A")
+	_, err := s.repos.User.UpdateAndReturn(ctxA, user.ID, domain.UpdateUser{Name: "user2", AccountExternalID: "B"})
+	s.requireErrorIs(err, domain.ErrTenantMismatch)
+	s.requireErrorIs(s.repos.User.Update(ctxA, user.ID, domain.UpdateUser{Name: "user2", AccountExternalID: "B"}), domain.ErrTenantMismatch)
+
+	updated, err := s.repos.User.UpdateAndReturn(ctxA, user.ID, domain.UpdateUser{Name: "user2"})
+	s.Require().NoError(err)
+	s.Require().Equal("A", updated.AccountExternalID)
+}
+
+func (s *ContractSuite) TestUserCreateDuplicateID() {
+	user := s.createUser(s.ctx, "user1", "")
+
+	err := s.repos.User.Create(s.ctx, &domain.User{ID: user.ID, Name: "user2"})
+	s.requireErrorIs(err, domain.ErrDuplicate)
+}
+
+func (s *ContractSuite) TestUserGetByIDNotFound() {
+	_, err := s.repos.User.GetByID(s.ctx, "5fbaeab741e97bef8525d6ab")
+	s.requireErrorIs(err, domain.ErrNotFound)
+
+	_, err = s.repos.User.GetByID(s.ctx, "1")
+	s.requireErrorIs(err, domain.ErrNotFound)
+}
+
+func (s *ContractSuite) TestUserList() {
+	user1 := s.createUser(s.ctx, "user1", "")
+	user2 := s.createUser(s.ctx, "user2", "")
+	user3 := s.createUser(s.ctx, "user3", "")
+
+	users, err := s.repos.User.List(s.ctx, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{user1.ID, user2.ID, user3.ID}, userIDs(users))
+
+	users, err = s.repos.User.List(s.ctx, 1, 1)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{user2.ID}, userIDs(users))
+
+	users, err = s.repos.User.List(s.ctx, 0, 1)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{user2.ID, user3.ID}, userIDs(users))
+
+	users, err = s.repos.User.List(s.ctx, 10, 5)
+	s.Require().NoError(err)
+	s.Require().Empty(users)
+}
+
+func (s *ContractSuite) TestUserTenantScope() {
+	userA := s.createUser(s.ctx, "userA", "A")
+	userB := s.createUser(s.ctx, "userB", "B")
+	ctxA := tenant.WithTenant(s.ctx, "A")
+
+	users, err := s.repos.User.List(ctxA, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{userA.ID}, userIDs(users))
+
+	_, err = s.repos.User.GetByID(ctxA, userB.ID)
+	s.requireErrorIs(err, domain.ErrNotFound)
+
+	_, err = s.repos.User.UpdateAndReturn(ctxA, userB.ID, domain.UpdateUser{Name: "userC"})
+	s.requireErrorIs(err, domain.ErrNotFound)
+
+	s.requireErrorIs(s.repos.User.DeleteByID(ctxA, userB.ID), domain.ErrNotFound)
+	s.Require().NoError(s.repos.User.DeleteAll(ctxA))
+
+	users, err = s.repos.User.List(s.ctx, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{userB.ID}, userIDs(users))
+	s.Require().Equal("userB", users[0].Name)
+}
+
+func (s *ContractSuite) TestUserUpdate() {
+	user := s.createUser(s.ctx, "user1", "1")
+
+	s.clock.Advance(time.Hour)
+	updated, err := s.repos.User.UpdateAndReturn(s.ctx, user.ID, domain.UpdateUser{Name: "user2"})
+	s.Require().NoError(err)
+	s.Require().Equal("user2", updated.Name)
+	s.Require().Equal("1", updated.AccountExternalID, "empty account is not updated")
+	s.Require().Equal(now, updated.CreatedAt)
+	s.Require().Equal(now.Add(time.Hour), updated.UpdatedAt)
+
+	s.Require().NoError(s.repos.User.Update(s.ctx, user.ID, domain.UpdateUser{Name: "user3", AccountExternalID: "2"}))
+	stored, err := s.repos.User.GetByID(s.ctx, user.ID)
+	s.Require().NoError(err)
+	s.Require().Equal("user3", stored.Name)
+	s.Require().Equal("2", stored.AccountExternalID)
+}
+
+func (s *ContractSuite) TestUserUpdateNotFound() {
+	s.Require().NoError(s.repos.User.Update(s.ctx, "5fbaeab741e97bef8525d6ab", domain.UpdateUser{Name: "user"}))
+
+	err := s.repos.User.Update(s.ctx, "1", domain.UpdateUser{Name: "user"})
+	s.requireErrorIs(err, domain.ErrNotFound)
+
+	_, err = s.repos.User.UpdateAndReturn(s.ctx, "5fbaeab741e97bef8525d6ab", domain.UpdateUser{Name: "user"})
+	s.requireErrorIs(err, domain.ErrNotFound)
+}
+
+func (s *ContractSuite) TestUserDelete() {
+	user := s.createUser(s.ctx, "user1", "")
+
+	s.Require().NoError(s.repos.User.DeleteByID(s.ctx, user.ID))
+	_, err := s.repos.User.GetByID(s.ctx, user.ID)
+	s.requireErrorIs(err, domain.ErrNotFound)
+
+	s.requireErrorIs(s.repos.User.DeleteByID(s.ctx, user.ID), domain.ErrNotFound)
+	s.requireErrorIs(s.repos.User.DeleteByID(s.ctx, "5fbaeab741e97bef8525d6ab"), domain.ErrNotFound)
+	s.requireErrorIs(s.repos.User.DeleteByID(s.ctx, "1"), domain.ErrNotFound)
+}
+
+func (s *ContractSuite) TestUserByAccount() {
+	user1 := s.createUser(s.ctx, "user1", "1")
+	user2 := s.createUser(s.ctx, "user2", "1")
+	s.createUser(s.ctx, "user3", "2")
+
+	users, err := s.repos.User.ListByAccountExternalID(s.ctx, "1", 10, 0)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{user1.ID, user2.ID}, userIDs(users))
+
+	count, err := s.repos.User.CountByAccountExternalID(s.ctx, "1")
+	s.Require().NoError(err)
+	s.Require().Equal(int64(2), count)
+}
+
+func (s *ContractSuite) TestUserSoftDeleteByAccount() {
+	user1 := s.createUser(s.ctx, "user1", "1")
+	user2 := s.createUser(s.ctx, "user2", "2")
+
+	s.Require().NoError(s.repos.User.SoftDeleteByAccountExternalID(s.ctx, "1", updatedAt))
+
+	_, err := s.repos.User.GetByID(s.ctx, user1.ID)
+	s.requireErrorIs(err, domain.ErrNotFound)
+	users, err := s.repos.User.List(s.ctx, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{user2.ID}, userIDs(users))
+	count, err := s.repos.User.CountByAccountExternalID(s.ctx, "1")
+	s.Require().NoError(err)
+	s.Require().Equal(int64(0), count)
+}
+
+func (s *ContractSuite) TestUserDetachAccount() {
+	user := s.createUser(s.ctx, "user1", "1")
+
+	s.Require().NoError(s.repos.User.DetachAccount(s.ctx, "1"))
+
+	stored, err := s.repos.User.GetByID(s.ctx, user.ID)
+	s.Require().NoError(err)
+	s.Require().Equal("", stored.AccountExternalID)
+	count, err := s.repos.User.CountByAccountExternalID(s.ctx, "1")
+	s.Require().NoError(err)
+	s.Require().Equal(int64(0), count)
+}
+
+// nextChange returns the next change of the stream waiting through idle periods.
+// Changes are read right after each write as MongoDB looks up the current document of a change when it is read.
+func (s *ContractSuite) nextChange(stream repository.IUserChangeStream) *domain.UserChange {
+	for i := 0; i < 50; i++ {
+		change, err := stream.Next(s.ctx)
+		s.Require().NoError(err)
+		if change != nil {
+			s.Require().Equal(change.Token, stream.ResumeToken())
+			return change
+		}
+	}
+	s.FailNow("no change")
+	return nil
+}
+
+func (s *ContractSuite) TestUserWatch() {
+	stream, err := s.repos.User.Watch(s.ctx, "", 100*time.Millisecond)
+	s.Require().NoError(err)
+	defer stream.Close(s.ctx)
+	tenantStream, err := s.repos.User.Watch(tenant.WithTenant(s.ctx, "1"), "", 100*time.Millisecond)
+	s.Require().NoError(err)
+	defer tenantStream.Close(s.ctx)
+
+	user1 := s.createUser(s.ctx, "user1", "1")
+	change := s.nextChange(stream)
+	s.Require().Equal(domain.UserCreated, change.Type)
+	s.Require().Equal(user1, change.User)
+	s.Require().Equal(user1.ID, s.nextChange(tenantStream).User.ID)
+
+	user2 := s.createUser(s.ctx, "user2", "2")
+	s.Require().Equal(user2.ID, s.nextChange(stream).User.ID)
+
+	s.clock.Advance(time.Hour)
+	_, err = s.repos.User.UpdateAndReturn(s.ctx, user1.ID, domain.UpdateUser{Name: "user3"})
+	s.Require().NoError(err)
+	change = s.nextChange(stream)
+	s.Require().Equal(domain.UserUpdated, change.Type)
+	s.Require().Equal("user3", change.User.Name)
+	s.Require().Equal(now.Add(time.Hour), change.User.UpdatedAt)
+	s.Require().Equal(domain.UserUpdated, s.nextChange(tenantStream).Type)
+	resumeToken := change.Token
+
+	s.Require().NoError(s.repos.User.DeleteByID(s.ctx, user2.ID))
+	change = s.nextChange(stream)
+	s.Require().Equal(domain.UserDeleted, change.Type)
+	s.Require().Equal(user2.ID, change.User.ID)
+	s.Require().Equal(now.Add(time.Hour), *change.User.DeletedAt)
+
+	s.Require().NoError(s.repos.User.SoftDeleteByAccountExternalID(s.ctx, "1", updatedAt))
+	change = s.nextChange(stream)
+	s.Require().Equal(domain.UserDeleted, change.Type)
+	s.Require().Equal(user1.ID, change.User.ID)
+	s.Require().NotNil(change.User.DeletedAt)
+	// the tenant's stream skips the delete of another tenant's user
+	change = s.nextChange(tenantStream)
+	s.Require().Equal(domain.UserDeleted, change.Type)
+	s.Require().Equal(user1.ID, change.User.ID)
+
+	change, err = stream.Next(s.ctx)
+	s.Require().NoError(err)
+	s.Require().Nil(change, "idle stream")
+	s.Require().NotEmpty(stream.ResumeToken())
+
+	resumed, err := s.repos.User.Watch(s.ctx, resumeToken, 100*time.Millisecond)
+	s.Require().NoError(err)
+	defer resumed.Close(s.ctx)
+	s.Require().Equal(user2.ID, s.nextChange(resumed).User.ID)
+	s.Require().Equal(user1.ID, s.nextChange(resumed).User.ID)
+
+	_, err = s.repos.User.Watch(s.ctx, "token", time.Second)
+	s.requireErrorIs(err, domain.ErrInvalidResumeToken)
+}
+
+func (s *ContractSuite) TestUserWatchTenantDelete() {
+	ctx := tenant.WithTenant(s.ctx, "1")
+	stream, err := s.repos.User.Watch(ctx, "", 100*time.Millisecond)
+	s.Require().NoError(err)
+	defer stream.Close(s.ctx)
+
+	user := s.createUser(ctx, "user1", "1")
+	s.Require().Equal(domain.UserCreated, s.nextChange(stream).Type)
+
+	s.Require().NoError(s.repos.User.DeleteByID(ctx, user.ID))
+	change := s.nextChange(stream)
+	s.Require().Equal(domain.UserDeleted, change.Type)
+	s.Require().Equal(user.ID, change.User.ID)
+}
+
+func (s *ContractSuite) TestAccountCreate() {
+	account := s.createAccount("1", updatedAt)
+	s.Require().Equal("000000000000000000000001", account.ID)
+	s.Require().Equal("1", account.ExternalID)
+	s.Require().Equal(createdAt, account.CreatedAt)
+	s.Require().Equal(updatedAt, account.UpdatedAt)
+
+	stored, err := s.repos.Account.GetByExternalID(s.ctx, "1")
+	s.Require().NoError(err)
+	s.Require().Equal(account, stored)
+}
+
+func (s *ContractSuite) TestAccountGetByExternalIDNotFound() {
+	_, err := s.repos.Account.GetByExternalID(s.ctx, "1")
+	s.requireErrorIs(err, domain.ErrNotFound)
+}
+
+func (s *ContractSuite) TestAccountListByExternalIDs() {
+	account1 := s.createAccount("1", updatedAt)
+	account2 := s.createAccount("2", updatedAt)
+	s.createAccount("3", updatedAt)
+	_, err := s.repos.Account.MarkDeleted(s.ctx, "3", updatedAt.Add(time.Hour))
+	s.Require().NoError(err)
+
+	accounts, err := s.repos.Account.ListByExternalIDs(s.ctx, []string{"2", "3", "4", "1", "2"})
+	s.Require().NoError(err)
+	s.Require().Equal([]*domain.Account{account1, account2}, accounts)
+
+	accounts, err = s.repos.Account.ListByExternalIDs(tenant.WithTenant(s.ctx, "2"), []string{"1", "2"})
+	s.Require().NoError(err)
+	s.Require().Equal([]*domain.Account{account2}, accounts)
+
+	accounts, err = s.repos.Account.ListByExternalIDs(s.ctx, nil)
+	s.Require().NoError(err)
+	s.Require().Empty(accounts)
+}
+
+func (s *ContractSuite) TestAccountUpdateGuard() {
+	account := s.createAccount("1", updatedAt)
+
+	newer := domain.Account{ExternalID: "1", Name: "newer", CreatedAt: createdAt, UpdatedAt: updatedAt.Add(time.Hour)}
+	updated, err := s.repos.Account.CreateOrUpdate(s.ctx, newer, false)
+	s.Require().NoError(err)
+	s.Require().Equal(account.ID, updated.ID)
+	s.Require().Equal("newer", updated.Name)
+
+	for _, stale := range []time.Time{updatedAt, updatedAt.Add(time.Hour)} {
+		older := domain.Account{ExternalID: "1", Name: "older", CreatedAt: createdAt, UpdatedAt: stale}
+		stored, err := s.repos.Account.CreateOrUpdate(s.ctx, older, false)
+		s.requireErrorIs(err, domain.ErrStale)
+		s.Require().Equal("newer", stored.Name)
+	}
+
+	forced := domain.Account{ExternalID: "1", Name: "forced", CreatedAt: createdAt, UpdatedAt: updatedAt}
+	updated, err = s.repos.Account.CreateOrUpdate(s.ctx, forced, true)
+	s.Require().NoError(err)
+	s.Require().Equal("forced", updated.Name)
+	s.Require().Equal(updatedAt, updated.UpdatedAt)
+}
+
+func (s *ContractSuite) TestAccountCreateNotForced() {
+	account, err := s.repos.Account.CreateOrUpdate(s.ctx, domain.Account{ExternalID: "1", CreatedAt: createdAt, UpdatedAt: updatedAt}, false)
+	s.Require().NoError(err)
+	s.Require().Equal("1", account.ExternalID)
+}
+
+func (s *ContractSuite) TestAccountTombstone() {
+	s.createAccount("1", updatedAt)
+	deletedAt := updatedAt.Add(time.Hour)
+
+	deleted, err := s.repos.Account.MarkDeleted(s.ctx, "1", deletedAt)
+	s.Require().NoError(err)
+	s.Require().Equal(deletedAt, *deleted.DeletedAt)
+	s.Require().Equal(deletedAt, deleted.UpdatedAt)
+
+	_, err = s.repos.Account.GetByExternalID(s.ctx, "1")
+	s.requireErrorIs(err, domain.ErrNotFound)
+	accounts, err := s.repos.Account.List(s.ctx, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Empty(accounts)
+
+	_, err = s.repos.Account.MarkDeleted(s.ctx, "1", deletedAt.Add(time.Hour))
+	s.requireErrorIs(err, domain.ErrStale)
+
+	for _, stale := range []time.Time{updatedAt.Add(time.Minute), deletedAt} {
+		late := domain.Account{ExternalID: "1", Name: "late", CreatedAt: createdAt, UpdatedAt: stale}
+		_, err = s.repos.Account.CreateOrUpdate(s.ctx, late, false)
+		s.requireErrorIs(err, domain.ErrStale)
+	}
+
+	newer := domain.Account{ExternalID: "1", Name: "newer", CreatedAt: createdAt, UpdatedAt: deletedAt.Add(time.Hour)}
+	restored, err := s.repos.Account.CreateOrUpdate(s.ctx, newer, false)
+	s.Require().NoError(err)
+	s.Require().Nil(restored.DeletedAt)
+	stored, err := s.repos.Account.GetByExternalID(s.ctx, "1")
+	s.Require().NoError(err)
+	s.Require().Equal("newer", stored.Name)
+}
+
+func (s *ContractSuite) TestAccountMarkDeletedGuard() {
+	s.createAccount("1", updatedAt)
+
+	_, err := s.repos.Account.MarkDeleted(s.ctx, "1", updatedAt.Add(-time.Hour))
+	s.requireErrorIs(err, domain.ErrStale)
+
+	deleted, err := s.repos.Account.MarkDeleted(s.ctx, "2", updatedAt)
+	s.Require().NoError(err)
+	s.Require().Equal(updatedAt, deleted.CreatedAt)
+
+	_, err = s.repos.Account.CreateOrUpdate(s.ctx, domain.Account{ExternalID: "2", CreatedAt: createdAt, UpdatedAt: createdAt}, false)
+	s.requireErrorIs(err, domain.ErrStale)
+}
+
+func (s *ContractSuite) TestAccountTenantScope() {
+	s.createAccount("A", updatedAt)
+	s.createAccount("B", updatedAt)
+	ctxA := tenant.WithTenant(s.ctx, "A")
+
+	accounts, err := s.repos.Account.List(ctxA, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Len(accounts, 1)
+	s.Require().Equal("A", accounts[0].ExternalID)
+
+	_, err = s.repos.Account.GetByExternalID(ctxA, "B")
+	s.requireErrorIs(err, domain.ErrNotFound)
+
+	_, err = s.repos.Account.CreateOrUpdate(ctxA, domain.Account{ExternalID: "B", UpdatedAt: updatedAt}, true)
+	s.requireErrorIs(err, domain.ErrTenantMismatch)
+	_, err = s.repos.Account.MarkDeleted(ctxA, "B", updatedAt)
+	s.requireErrorIs(err, domain.ErrTenantMismatch)
+}
+
+func (s *ContractSuite) TestAccountDelete() {
+	s.createAccount("1", updatedAt)
+	s.createAccount("2", updatedAt)
+
+	s.Require().NoError(s.repos.Account.DeleteByExternalID(s.ctx, "1"))
+
+	accounts, err := s.repos.Account.List(s.ctx, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Len(accounts, 1)
+	s.Require().Equal("2", accounts[0].ExternalID)
+
+	// a deleted account leaves no tombstone
+	_, err = s.repos.Account.CreateOrUpdate(s.ctx, domain.Account{ExternalID: "1", CreatedAt: createdAt, UpdatedAt: createdAt}, false)
+	s.Require().NoError(err)
+}
+
+func (s *ContractSuite) TestInbox() {
+	s.Require().NoError(s.repos.Inbox.Add(s.ctx, "queue1", "message1"))
+	s.requireErrorIs(s.repos.Inbox.Add(s.ctx, "queue1", "message1"), domain.ErrDuplicate)
+	s.Require().NoError(s.repos.Inbox.Add(s.ctx, "queue2", "message1"))
+
+	exists, err := s.repos.Inbox.Exists(s.ctx, "queue1", "message1")
+	s.Require().NoError(err)
+	s.Require().True(exists)
+	exists, err = s.repos.Inbox.Exists(s.ctx, "queue1", "message2")
+	s.Require().NoError(err)
+	s.Require().False(exists)
+}
+
+func (s *ContractSuite) createWebhook(ctx context.Context, url string, eventTypes ...string) *domain.Webhook {
+	webhook := &domain.Webhook{URL: url, EventTypes: eventTypes, Secret: "secret"}
+	s.Require().NoError(s.repos.Webhook.Create(ctx, webhook))
+	return webhook
+}
+
+func (s *ContractSuite) TestWebhookCreate() {
+	webhook := s.createWebhook(s.ctx, "http://example.com/1", domain.EventUserCreated)
+	s.Require().NotEmpty(webhook.ID)
+	s.Require().True(webhook.Enabled)
+
+	got, err := s.repos.Webhook.GetByID(s.ctx, webhook.ID)
+	s.Require().NoError(err)
+	s.Require().Equal(webhook, got)
+
+	_, err = s.repos.Webhook.GetByID(s.ctx, "000000000000000000000099")
+	s.requireErrorIs(err, domain.ErrNotFound)
+	_, err = s.repos.Webhook.GetByID(s.ctx, "invalid")
+	s.requireErrorIs(err, domain.ErrNotFound)
+}
+
+func (s *ContractSuite) TestWebhookTenantScope() {
+	webhookA := s.createWebhook(tenant.WithTenant(s.ctx, "A"), "http://example.com/a", domain.EventUserCreated)
+	webhookB := s.createWebhook(tenant.WithTenant(s.ctx, "B"), "http://example.com/b", domain.EventUserCreated)
+	s.Require().Equal("A", webhookA.AccountExternalID)
+	ctxA := tenant.WithTenant(s.ctx, "A")
+
+	webhooks, err := s.repos.Webhook.List(ctxA, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Len(webhooks, 1)
+	s.Require().Equal(webhookA.ID, webhooks[0].ID)
+
+	_, err = s.repos.Webhook.GetByID(ctxA, webhookB.ID)
+	s.requireErrorIs(err, domain.ErrNotFound)
+	_, err = s.repos.Webhook.Update(ctxA, webhookB.ID, domain.UpdateWebhook{URL: "http://example.com/c"})
+	s.requireErrorIs(err, domain.ErrNotFound)
+	s.Require().NoError(s.repos.Webhook.DeleteByID(ctxA, webhookB.ID))
+
+	webhooks, err = s.repos.Webhook.List(s.ctx, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Len(webhooks, 2)
+}
+
+func (s *ContractSuite) TestWebhookUpdate() {
+	webhook := s.createWebhook(s.ctx, "http://example.com/1", domain.EventUserCreated)
+	s.clock.Advance(time.Minute)
+
+	updated, err := s.repos.Webhook.Update(s.ctx, webhook.ID, domain.UpdateWebhook{
+		URL:        "http://example.com/2",
+		EventTypes: []string{domain.EventUserUpdated, domain.EventUserDeleted},
+	})
+	s.Require().NoError(err)
+	s.Require().Equal("http://example.com/2", updated.URL)
+	s.Require().Equal([]string{domain.EventUserUpdated, domain.EventUserDeleted}, updated.EventTypes)
+	s.Require().Equal("secret", updated.Secret, "an empty secret keeps the current one")
+	s.Require().Equal(now.Add(time.Minute), updated.UpdatedAt)
+
+	disabled := false
+	updated, err = s.repos.Webhook.Update(s.ctx, webhook.ID, domain.UpdateWebhook{
+		URL:        updated.URL,
+		EventTypes: updated.EventTypes,
+		Secret:     "secret2",
+		Enabled:    &disabled,
+	})
+	s.Require().NoError(err)
+	s.Require().Equal("secret2", updated.Secret)
+	s.Require().False(updated.Enabled)
+	s.Require().NotNil(updated.DisabledAt)
+
+	got, err := s.repos.Webhook.GetByID(s.ctx, webhook.ID)
+	s.Require().NoError(err)
+	s.Require().Equal(updated, got)
+}
+
+func (s *ContractSuite) TestWebhookDelete() {
+	webhook1 := s.createWebhook(s.ctx, "http://example.com/1", domain.EventUserCreated)
+	webhook2 := s.createWebhook(s.ctx, "http://example.com/2", domain.EventUserCreated)
+
+	s.Require().NoError(s.repos.Webhook.DeleteByID(s.ctx, webhook1.ID))
+
+	webhooks, err := s.repos.Webhook.List(s.ctx, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Len(webhooks, 1)
+	s.Require().Equal(webhook2.ID, webhooks[0].ID)
+}
+
+func (s *ContractSuite) TestWebhookListSubscribed() {
+	global := s.createWebhook(s.ctx, "http://example.com/global", domain.EventUserCreated, domain.EventUserDeleted)
+	tenantA := s.createWebhook(tenant.WithTenant(s.ctx, "A"), "http://example.com/a", domain.EventUserCreated)
+	s.createWebhook(tenant.WithTenant(s.ctx, "B"), "http://example.com/b", domain.EventUserCreated)
+	s.createWebhook(s.ctx, "http://example.com/other", domain.EventAccountUpdated)
+	disabled := s.createWebhook(s.ctx, "http://example.com/disabled", domain.EventUserCreated)
+	enabled := false
+	_, err := s.repos.Webhook.Update(s.ctx, disabled.ID, domain.UpdateWebhook{
+		URL:        disabled.URL,
+		EventTypes: disabled.EventTypes,
+		Enabled:    &enabled,
+	})
+	s.Require().NoError(err)
+
+	webhooks, err := s.repos.Webhook.ListSubscribed(tenant.WithTenant(s.ctx, "B"), domain.EventUserCreated, "A")
+	s.Require().NoError(err)
+	s.Require().Equal([]string{tenantA.ID}, webhookIDs(webhooks), "the tenant of ctx is ignored")
+
+	webhooks, err = s.repos.Webhook.ListSubscribed(s.ctx, domain.EventUserCreated, "")
+	s.Require().NoError(err)
+	s.Require().Equal([]string{global.ID}, webhookIDs(webhooks))
+}
+
+func (s *ContractSuite) TestWebhookRecordFailure() {
+	webhook := s.createWebhook(s.ctx, "http://example.com/1", domain.EventUserCreated)
+
+	got, err := s.repos.Webhook.RecordFailure(s.ctx, webhook.ID, 2)
+	s.Require().NoError(err)
+	s.Require().Equal(int64(1), got.Failures)
+	s.Require().True(got.Enabled)
+
+	s.Require().NoError(s.repos.Webhook.RecordSuccess(s.ctx, webhook.ID))
+	got, err = s.repos.Webhook.RecordFailure(s.ctx, webhook.ID, 2)
+	s.Require().NoError(err)
+	s.Require().Equal(int64(1), got.Failures, "a success resets failures")
+
+	s.clock.Advance(time.Minute)
+	got, err = s.repos.Webhook.RecordFailure(s.ctx, webhook.ID, 2)
+	s.Require().NoError(err)
+	s.Require().Equal(int64(2), got.Failures)
+	s.Require().False(got.Enabled)
+	s.Require().NotNil(got.DisabledAt)
+	s.Require().Equal(now.Add(time.Minute), *got.DisabledAt)
+
+	enabled := true
+	got, err = s.repos.Webhook.Update(s.ctx, webhook.ID, domain.UpdateWebhook{
+		URL:        webhook.URL,
+		EventTypes: webhook.EventTypes,
+		Enabled:    &enabled,
+	})
+	s.Require().NoError(err)
+	s.Require().True(got.Enabled)
+	s.Require().Equal(int64(0), got.Failures)
+	s.Require().Nil(got.DisabledAt)
+
+	_, err = s.repos.Webhook.RecordFailure(s.ctx, "000000000000000000000099", 2)
+	s.requireErrorIs(err, domain.ErrNotFound)
+}
+
+func (s *ContractSuite) createDelivery(webhookID string, nextAttemptAt time.Time) *domain.WebhookDelivery {
+	delivery := &domain.WebhookDelivery{
+		WebhookID:     webhookID,
+		EventType:     domain.EventUserCreated,
+		Payload:       `{"type":"user.created"}`,
+		NextAttemptAt: nextAttemptAt,
+	}
+	s.Require().NoError(s.repos.WebhookDelivery.Create(s.ctx, delivery))
+	return delivery
+}
+
+func (s *ContractSuite) TestWebhookDeliveryClaimDue() {
+	webhook := s.createWebhook(s.ctx, "http://example.com/1", domain.EventUserCreated)
+	later := s.createDelivery(webhook.ID, now.Add(time.Minute))
+	first := s.createDelivery(webhook.ID, time.Time{})
+	second := s.createDelivery(webhook.ID, time.Time{})
+	s.Require().Equal(domain.DeliveryPending, first.Status)
+	s.Require().Equal(now, first.NextAttemptAt)
+
+	claimed, err := s.repos.WebhookDelivery.ClaimDue(s.ctx, time.Hour)
+	s.Require().NoError(err)
+	s.Require().Equal(first.ID, claimed.ID)
+	s.Require().Equal(now.Add(time.Hour), claimed.NextAttemptAt)
+	s.Require().Equal(first.Payload, claimed.Payload)
+
+	claimed, err = s.repos.WebhookDelivery.ClaimDue(s.ctx, time.Hour)
+	s.Require().NoError(err)
+	s.Require().Equal(second.ID, claimed.ID)
+
+	_, err = s.repos.WebhookDelivery.ClaimDue(s.ctx, time.Hour)
+	s.requireErrorIs(err, domain.ErrNotFound)
+
+	s.clock.Advance(time.Minute)
+	claimed, err = s.repos.WebhookDelivery.ClaimDue(s.ctx, time.Hour)
+	s.Require().NoError(err)
+	s.Require().Equal(later.ID, claimed.ID)
+
+	lastAttemptAt := now.Add(time.Minute)
+	claimed.Status = domain.DeliverySucceeded
+	claimed.Attempts = 1
+	claimed.LastAttemptAt = &lastAttemptAt
+	claimed.ResponseStatus = 200
+	s.Require().NoError(s.repos.WebhookDelivery.Update(s.ctx, claimed))
+
+	// a lease expires, a finished delivery is never claimed again
+	s.clock.Advance(2 * time.Hour)
+	claimed, err = s.repos.WebhookDelivery.ClaimDue(s.ctx, time.Hour)
+	s.Require().NoError(err)
+	s.Require().Equal(first.ID, claimed.ID)
+	claimed, err = s.repos.WebhookDelivery.ClaimDue(s.ctx, time.Hour)
+	s.Require().NoError(err)
+	s.Require().Equal(second.ID, claimed.ID)
+	_, err = s.repos.WebhookDelivery.ClaimDue(s.ctx, time.Hour)
+	s.requireErrorIs(err, domain.ErrNotFound)
+}
+
+func (s *ContractSuite) TestWebhookDeliveryList() {
+	webhook1 := s.createWebhook(s.ctx, "http://example.com/1", domain.EventUserCreated)
+	webhook2 := s.createWebhook(s.ctx, "http://example.com/2", domain.EventUserCreated)
+	delivery1 := s.createDelivery(webhook1.ID, time.Time{})
+	delivery2 := s.createDelivery(webhook1.ID, time.Time{})
+	delivery3 := s.createDelivery(webhook2.ID, time.Time{})
+
+	lastAttemptAt := now
+	delivery1.Status = domain.DeliveryFailed
+	delivery1.Attempts = 3
+	delivery1.LastAttemptAt = &lastAttemptAt
+	delivery1.ResponseStatus = 500
+	delivery1.Error = "unexpected status 500"
+	s.Require().NoError(s.repos.WebhookDelivery.Update(s.ctx, delivery1))
+
+	deliveries, err := s.repos.WebhookDelivery.ListByWebhookID(s.ctx, webhook1.ID, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Equal([]*domain.WebhookDelivery{delivery2, delivery1}, deliveries, "newest first")
+
+	deliveries, err = s.repos.WebhookDelivery.ListByWebhookID(s.ctx, webhook1.ID, 1, 1)
+	s.Require().NoError(err)
+	s.Require().Equal([]*domain.WebhookDelivery{delivery1}, deliveries)
+
+	s.Require().NoError(s.repos.WebhookDelivery.DeleteByWebhookID(s.ctx, webhook1.ID))
+	deliveries, err = s.repos.WebhookDelivery.ListByWebhookID(s.ctx, webhook1.ID, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Empty(deliveries)
+	deliveries, err = s.repos.WebhookDelivery.ListByWebhookID(s.ctx, webhook2.ID, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Equal([]*domain.WebhookDelivery{delivery3}, deliveries)
+
+	s.requireErrorIs(s.repos.WebhookDelivery.Update(s.ctx, &domain.WebhookDelivery{ID: "000000000000000000000099"}), domain.ErrNotFound)
+}
+
+func (s *ContractSuite) TestTransactionCommit() {
+	err := s.repos.WithTransaction(s.ctx, func(ctx context.Context) error {
+		if err := s.repos.Inbox.Add(ctx, "queue1", "message1"); err != nil {
+			return err
+		}
+		_, err := s.repos.Account.CreateOrUpdate(ctx, domain.Account{ExternalID: "1", CreatedAt: createdAt, UpdatedAt: updatedAt}, false)
+		return err
+	})
+	s.Require().NoError(err)
+
+	exists, err := s.repos.Inbox.Exists(s.ctx, "queue1", "message1")
+	s.Require().NoError(err)
+	s.Require().True(exists)
+	_, err = s.repos.Account.GetByExternalID(s.ctx, "1")
+	s.Require().NoError(err)
+}
+
+func (s *ContractSuite) TestTransactionRollback() {
+	errFailed := errors.New("failed")
+	user := s.createUser(s.ctx, "user1", "1")
+
+	err := s.repos.WithTransaction(s.ctx, func(ctx context.Context) error {
+		if err := s.repos.Inbox.Add(ctx, "queue1", "message1"); err != nil {
+			return err
+		}
+		if _, err := s.repos.Account.MarkDeleted(ctx, "1", updatedAt); err != nil {
+			return err
+		}
+		if err := s.repos.User.SoftDeleteByAccountExternalID(ctx, "1", updatedAt); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	s.requireErrorIs(err, errFailed)
+
+	exists, err := s.repos.Inbox.Exists(s.ctx, "queue1", "message1")
+	s.Require().NoError(err)
+	s.Require().False(exists)
+	_, err = s.repos.Account.MarkDeleted(s.ctx, "1", updatedAt)
+	s.Require().NoError(err, "tombstone is rolled back")
+	_, err = s.repos.User.GetByID(s.ctx, user.ID)
+	s.Require().NoError(err)
+}
+
+func userIDs(users []*domain.User) []string {
+	ids := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return ids
+}
+
+func webhookIDs(webhooks []*domain.Webhook) []string {
+	ids := make([]string, len(webhooks))
+	for i, webhook := range webhooks {
+		ids[i] = webhook.ID
+	}
+	return ids
+}
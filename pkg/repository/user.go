@@ -2,158 +2,354 @@ package repository
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/tenant"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-const usersCollection = "users"
+const (
+	usersCollection = "users"
+	userTenantField = "account_external_id"
+)
+
+// userDocument is the stored form of domain.User
+type userDocument struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty"`
+	Name              string             `bson:"name"`
+	AccountExternalID string             `bson:"account_external_id,omitempty"`
+	CreatedAt         time.Time          `bson:"created_at"`
+	UpdatedAt         time.Time          `bson:"updated_at"`
+	DeletedAt         *time.Time         `bson:"deleted_at,omitempty"`
+}
+
+// updateUserDocument is the stored form of domain.UpdateUser
+type updateUserDocument struct {
+	Name              string    `bson:"name"`
+	AccountExternalID string    `bson:"account_external_id,omitempty"`
+	UpdatedAt         time.Time `bson:"updated_at"`
+}
 
-// User struct
-type User struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name      string             `bson:"name" json:"name"`
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+func (d *userDocument) toDomain() *domain.User {
+	return &domain.User{
+		ID:                d.ID.Hex(),
+		Name:              d.Name,
+		AccountExternalID: d.AccountExternalID,
+		CreatedAt:         d.CreatedAt,
+		UpdatedAt:         d.UpdatedAt,
+		DeletedAt:         d.DeletedAt,
+	}
 }
 
-// UpdateUser struct
-type UpdateUser struct {
-	Name      string    `bson:"name" json:"name"`
-	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+func usersToDomain(docs []*userDocument) []*domain.User {
+	users := make([]*domain.User, len(docs))
+	for i, doc := range docs {
+		users[i] = doc.toDomain()
+	}
+	return users
 }
 
 // UserRepository struct
 type UserRepository struct {
 	collection *mongo.Collection
+	clock      clock.Clock
+	ids        idgen.IDGenerator
 }
 
-// NewUserRepository returns a new UserRepository struct
-func NewUserRepository(db *mongo.Database) *UserRepository {
+// NewUserRepository returns a new UserRepository struct, ids must generate hex ObjectIDs
+func NewUserRepository(db *mongo.Database, clock clock.Clock, ids idgen.IDGenerator) *UserRepository {
 	return &UserRepository{
 		collection: db.Collection(usersCollection),
+		clock:      clock,
+		ids:        ids,
 	}
 }
 
-// Create returns a created user ID
-func (r *UserRepository) Create(ctx context.Context, user *User) error {
-	now := time.Now()
+// Create creates the user and sets its ID, a user of another tenant is domain.ErrTenantMismatch
+func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
+	if err := checkTenant(ctx, user.AccountExternalID); err != nil {
+		return err
+	}
+	now := r.clock.Now()
 	user.CreatedAt = now
 	user.UpdatedAt = now
 
-	insertResult, err := r.collection.InsertOne(ctx, user)
+	id := user.ID
+	if id == "" {
+		id = r.ids.NewID()
+	}
+	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return err
 	}
-	user.ID = insertResult.InsertedID.(primitive.ObjectID)
+	doc := userDocument{
+		ID:                objectID,
+		Name:              user.Name,
+		AccountExternalID: user.AccountExternalID,
+		CreatedAt:         user.CreatedAt,
+		UpdatedAt:         user.UpdatedAt,
+		DeletedAt:         user.DeletedAt,
+	}
+
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return translateErr(err)
+	}
+	user.ID = id
 	return nil
 }
 
 // List returns User list
-func (r *UserRepository) List(ctx context.Context, limit int64, offset int64) ([]*User, error) {
-	var results []*User
-
-	opts := options.Find().SetSkip(offset).SetLimit(limit).SetSort(bson.D{bson.E{Key: "_id", Value: 1}})
+func (r *UserRepository) List(ctx context.Context, limit int64, offset int64) ([]*domain.User, error) {
+	return r.find(ctx, bson.M{"deleted_at": notDeleted}, limit, offset)
+}
 
-	cur, err := r.collection.Find(ctx, bson.M{}, opts)
+// GetByID returns a User by ID
+func (r *UserRepository) GetByID(ctx context.Context, userID string) (*domain.User, error) {
+	objectID, err := objectIDFromHex(userID)
 	if err != nil {
-		return results, err
+		return nil, err
 	}
-	err = cur.All(ctx, &results)
+
+	var doc userDocument
+	err = r.collection.FindOne(ctx, scopeByTenant(ctx, userTenantField, bson.M{"_id": objectID, "deleted_at": notDeleted})).Decode(&doc)
 	if err != nil {
-		return results, err
+		return nil, translateErr(err)
 	}
+	return doc.toDomain(), nil
+}
 
-	// defer func() {
-	// 	if err := cur.Close(ctx); err != nil {
-	// 		logrus.Errorf("Error close cursor: %v\n:", err)
-	// 	}
-	// }()
-
-	// for cur.Next(ctx) {
-	// 	var elem User
-	// 	err := cur.Decode(&elem)
-	// 	if err != nil {
-	// 		return results, err
-	// 	}
-	// 	results = append(results, &elem)
-	// }
-
-	// if err := cur.Err(); err != nil {
-	// 	return results, err
-	// }
+// Update updates the User, a missing User is not an error
+func (r *UserRepository) Update(ctx context.Context, userID string, updateUser domain.UpdateUser) error {
+	filter, update, err := r.updateUserQuery(ctx, userID, updateUser)
+	if err != nil {
+		return err
+	}
 
-	return results, nil
+	_, err = r.collection.UpdateOne(ctx, filter, update)
+	return translateErr(err)
 }
 
-// GetByID returns a User by ID
-func (r *UserRepository) GetByID(ctx context.Context, userID string) (*User, error) {
-	var user User
-
-	objectID, err := primitive.ObjectIDFromHex(userID)
+// UpdateAndReturn returns a updated User
+func (r *UserRepository) UpdateAndReturn(ctx context.Context, userID string, updateUser domain.UpdateUser) (*domain.User, error) {
+	filter, update, err := r.updateUserQuery(ctx, userID, updateUser)
 	if err != nil {
-		return &user, mongo.ErrNoDocuments
+		return nil, err
 	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(false)
 
-	err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	var doc userDocument
+	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc)
 	if err != nil {
-		return &user, err
+		return nil, translateErr(err)
 	}
-	return &user, nil
+	return doc.toDomain(), nil
 }
 
-// Update returns a updated User
-func (r *UserRepository) Update(ctx context.Context, userID string, updateUser UpdateUser) error {
-	objectID, err := primitive.ObjectIDFromHex(userID)
+func (r *UserRepository) updateUserQuery(ctx context.Context, userID string, updateUser domain.UpdateUser) (bson.M, bson.D, error) {
+	objectID, err := objectIDFromHex(userID)
 	if err != nil {
-		return mongo.ErrNoDocuments
+		return nil, nil, err
+	}
+	// an empty account is omitted from the update
+	if updateUser.AccountExternalID != "" {
+		if err := checkTenant(ctx, updateUser.AccountExternalID); err != nil {
+			return nil, nil, err
+		}
 	}
-	updateUser.UpdatedAt = time.Now()
 
-	filter := bson.M{"_id": objectID}
-	update := bson.D{bson.E{Key: "$set", Value: updateUser}}
+	doc := updateUserDocument{
+		Name:              updateUser.Name,
+		AccountExternalID: updateUser.AccountExternalID,
+		UpdatedAt:         r.clock.Now(),
+	}
+	filter := scopeByTenant(ctx, userTenantField, bson.M{"_id": objectID, "deleted_at": notDeleted})
+	update := bson.D{bson.E{Key: "$set", Value: doc}}
+	return filter, update, nil
+}
 
-	_, err = r.collection.UpdateOne(ctx, filter, update)
-	return err
+// ListByAccountExternalID returns User list of the Account
+func (r *UserRepository) ListByAccountExternalID(ctx context.Context, accountExternalID string, limit int64, offset int64) ([]*domain.User, error) {
+	return r.find(ctx, bson.M{"account_external_id": accountExternalID, "deleted_at": notDeleted}, limit, offset)
 }
 
-// UpdateAndReturn returns a updated User
-func (r *UserRepository) UpdateAndReturn(ctx context.Context, userID string, updateUser UpdateUser) (*User, error) {
-	var user User
+func (r *UserRepository) find(ctx context.Context, filter bson.M, limit int64, offset int64) ([]*domain.User, error) {
+	opts := options.Find().SetSkip(offset).SetLimit(limit).SetSort(bson.D{bson.E{Key: "_id", Value: 1}})
 
-	objectID, err := primitive.ObjectIDFromHex(userID)
+	cur, err := r.collection.Find(ctx, scopeByTenant(ctx, userTenantField, filter), opts)
 	if err != nil {
-		return &user, mongo.ErrNoDocuments
+		return nil, translateErr(err)
 	}
-	updateUser.UpdatedAt = time.Now()
+	var docs []*userDocument
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, translateErr(err)
+	}
+	return usersToDomain(docs), nil
+}
 
-	filter := bson.M{"_id": objectID}
-	update := bson.D{bson.E{Key: "$set", Value: updateUser}}
-	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(false)
+// CountByAccountExternalID returns count of Users of the Account
+func (r *UserRepository) CountByAccountExternalID(ctx context.Context, accountExternalID string) (int64, error) {
+	count, err := r.collection.CountDocuments(ctx, scopeByTenant(ctx, userTenantField, bson.M{"account_external_id": accountExternalID, "deleted_at": notDeleted}))
+	return count, translateErr(err)
+}
 
-	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&user)
-	if err != nil {
-		return &user, err
+// SoftDeleteByAccountExternalID marks Users of the Account as deleted
+func (r *UserRepository) SoftDeleteByAccountExternalID(ctx context.Context, accountExternalID string, deletedAt time.Time) error {
+	filter := scopeByTenant(ctx, userTenantField, bson.M{"account_external_id": accountExternalID, "deleted_at": notDeleted})
+	update := bson.D{bson.E{Key: "$set", Value: bson.M{"deleted_at": deletedAt, "updated_at": r.clock.Now()}}}
+
+	_, err := r.collection.UpdateMany(ctx, filter, update)
+	return translateErr(err)
+}
+
+// DetachAccount removes the Account from its Users
+func (r *UserRepository) DetachAccount(ctx context.Context, accountExternalID string) error {
+	filter := scopeByTenant(ctx, userTenantField, bson.M{"account_external_id": accountExternalID})
+	update := bson.D{
+		bson.E{Key: "$unset", Value: bson.M{"account_external_id": ""}},
+		bson.E{Key: "$set", Value: bson.M{"updated_at": r.clock.Now()}},
 	}
-	return &user, nil
+
+	_, err := r.collection.UpdateMany(ctx, filter, update)
+	return translateErr(err)
 }
 
-// DeleteByID delete User by ID
+// DeleteByID marks User as deleted, the deletion is an update so that change streams of its tenant see it.
+// It returns domain.ErrNotFound if the user does not exist or is already deleted
 func (r *UserRepository) DeleteByID(ctx context.Context, userID string) error {
-	objectID, err := primitive.ObjectIDFromHex(userID)
+	objectID, err := objectIDFromHex(userID)
 	if err != nil {
-		return mongo.ErrNoDocuments
+		return err
 	}
 
-	_, err = r.collection.DeleteOne(ctx, bson.M{"_id": objectID})
-	return err
+	now := r.clock.Now()
+	filter := scopeByTenant(ctx, userTenantField, bson.M{"_id": objectID, "deleted_at": notDeleted})
+	update := bson.D{bson.E{Key: "$set", Value: bson.M{"deleted_at": now, "updated_at": now}}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return translateErr(err)
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
 }
 
 // DeleteAll delete all
 func (r *UserRepository) DeleteAll(ctx context.Context) error {
-	_, err := r.collection.DeleteMany(ctx, bson.M{})
-	return err
+	_, err := r.collection.DeleteMany(ctx, scopeByTenant(ctx, userTenantField, bson.M{}))
+	return translateErr(err)
+}
+
+// Codes of server errors returned when a change stream can not be resumed from the token
+var resumeTokenErrCodes = map[int32]bool{
+	260: true, // InvalidResumeToken
+	280: true, // ChangeStreamFatalError
+	286: true, // ChangeStreamHistoryLost
+}
+
+// userChangeEvent is the stored form of a change event of the users collection
+type userChangeEvent struct {
+	OperationType string        `bson:"operationType"`
+	FullDocument  *userDocument `bson:"fullDocument"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	UpdateDescription struct {
+		UpdatedFields bson.M `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// Watch returns a stream of changes of users after resumeToken, an empty token starts at the current time.
+// A tenant's stream matches each change by the document of the user at the change, so it does not contain
+// changes of users detached from the tenant's account and users removed by DeleteAll.
+func (r *UserRepository) Watch(ctx context.Context, resumeToken string, maxAwait time.Duration) (IUserChangeStream, error) {
+	match := bson.M{"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}}}
+	if tenantID, ok := tenant.FromContext(ctx); ok {
+		match["fullDocument."+userTenantField] = tenantID
+	}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup).SetMaxAwaitTime(maxAwait)
+	if resumeToken != "" {
+		if _, err := hex.DecodeString(resumeToken); err != nil {
+			return nil, domain.ErrInvalidResumeToken
+		}
+		opts.SetResumeAfter(bson.M{"_data": resumeToken})
+	}
+
+	cs, err := r.collection.Watch(ctx, mongo.Pipeline{bson.D{bson.E{Key: "$match", Value: match}}}, opts)
+	if err != nil {
+		return nil, translateStreamErr(err)
+	}
+	return &userChangeStream{cs: cs}, nil
+}
+
+// userChangeStream struct
+type userChangeStream struct {
+	cs *mongo.ChangeStream
+}
+
+// Next returns the next change, or nil if there was none for maxAwait of Watch
+func (s *userChangeStream) Next(ctx context.Context) (*domain.UserChange, error) {
+	for s.cs.TryNext(ctx) {
+		var event userChangeEvent
+		if err := s.cs.Decode(&event); err != nil {
+			return nil, err
+		}
+		if change := event.toDomain(); change != nil {
+			change.Token = s.ResumeToken()
+			return change, nil
+		}
+	}
+	return nil, translateStreamErr(s.cs.Err())
+}
+
+// ResumeToken returns the token resuming the stream after the last returned change or idle period
+func (s *userChangeStream) ResumeToken() string {
+	data, _ := s.cs.ResumeToken().Lookup("_data").StringValueOK()
+	return data
+}
+
+// Close closes the stream
+func (s *userChangeStream) Close(ctx context.Context) error {
+	return s.cs.Close(ctx)
+}
+
+// toDomain returns the change, nil for changes of soft deleted users and of users removed before the lookup
+func (e *userChangeEvent) toDomain() *domain.UserChange {
+	if e.OperationType == "delete" {
+		return &domain.UserChange{Type: domain.UserDeleted, User: &domain.User{ID: e.DocumentKey.ID.Hex()}}
+	}
+	if e.FullDocument == nil {
+		return nil
+	}
+
+	change := &domain.UserChange{Type: domain.UserUpdated, User: e.FullDocument.toDomain()}
+	switch {
+	case e.OperationType == "insert":
+		change.Type = domain.UserCreated
+	case e.FullDocument.DeletedAt == nil:
+	case e.UpdateDescription.UpdatedFields["deleted_at"] != nil:
+		change.Type = domain.UserDeleted
+	default:
+		return nil
+	}
+	return change
+}
+
+// translateStreamErr translates errors of change streams, resume token errors to domain.ErrInvalidResumeToken
+func translateStreamErr(err error) error {
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && resumeTokenErrCodes[commandErr.Code] {
+		return fmt.Errorf("%w: %s", domain.ErrInvalidResumeToken, err)
+	}
+	return translateErr(err)
 }
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	webhooksCollection = "webhooks"
+	webhookTenantField = "account_external_id"
+)
+
+// webhookDocument is the stored form of domain.Webhook
+type webhookDocument struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty"`
+	URL               string             `bson:"url"`
+	EventTypes        []string           `bson:"event_types"`
+	Secret            string             `bson:"secret"`
+	AccountExternalID string             `bson:"account_external_id,omitempty"`
+	Enabled           bool               `bson:"enabled"`
+	Failures          int64              `bson:"failures"`
+	DisabledAt        *time.Time         `bson:"disabled_at,omitempty"`
+	CreatedAt         time.Time          `bson:"created_at"`
+	UpdatedAt         time.Time          `bson:"updated_at"`
+}
+
+func (d *webhookDocument) toDomain() *domain.Webhook {
+	return &domain.Webhook{
+		ID:                d.ID.Hex(),
+		URL:               d.URL,
+		EventTypes:        d.EventTypes,
+		Secret:            d.Secret,
+		AccountExternalID: d.AccountExternalID,
+		Enabled:           d.Enabled,
+		Failures:          d.Failures,
+		DisabledAt:        d.DisabledAt,
+		CreatedAt:         d.CreatedAt,
+		UpdatedAt:         d.UpdatedAt,
+	}
+}
+
+// WebhookRepository struct
+type WebhookRepository struct {
+	collection *mongo.Collection
+	clock      clock.Clock
+	ids        idgen.IDGenerator
+}
+
+// NewWebhookRepository returns a new WebhookRepository struct, ids must generate hex ObjectIDs
+func NewWebhookRepository(db *mongo.Database, clock clock.Clock, ids idgen.IDGenerator) *WebhookRepository {
+	return &WebhookRepository{
+		collection: db.Collection(webhooksCollection),
+		clock:      clock,
+		ids:        ids,
+	}
+}
+
+// Create creates the enabled webhook and sets its ID
+func (r *WebhookRepository) Create(ctx context.Context, webhook *domain.Webhook) error {
+	if tenantID, ok := tenant.FromContext(ctx); ok {
+		webhook.AccountExternalID = tenantID
+	}
+	now := r.clock.Now()
+	webhook.Enabled = true
+	webhook.Failures = 0
+	webhook.DisabledAt = nil
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+
+	objectID, err := primitive.ObjectIDFromHex(r.ids.NewID())
+	if err != nil {
+		return err
+	}
+	doc := webhookDocument{
+		ID:                objectID,
+		URL:               webhook.URL,
+		EventTypes:        webhook.EventTypes,
+		Secret:            webhook.Secret,
+		AccountExternalID: webhook.AccountExternalID,
+		Enabled:           webhook.Enabled,
+		CreatedAt:         webhook.CreatedAt,
+		UpdatedAt:         webhook.UpdatedAt,
+	}
+
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return translateErr(err)
+	}
+	webhook.ID = objectID.Hex()
+	return nil
+}
+
+// List returns Webhook list
+func (r *WebhookRepository) List(ctx context.Context, limit int64, offset int64) ([]*domain.Webhook, error) {
+	return r.find(ctx, scopeByTenant(ctx, webhookTenantField, bson.M{}), options.Find().SetSkip(offset).SetLimit(limit))
+}
+
+// GetByID returns a Webhook by ID
+func (r *WebhookRepository) GetByID(ctx context.Context, webhookID string) (*domain.Webhook, error) {
+	objectID, err := objectIDFromHex(webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc webhookDocument
+	err = r.collection.FindOne(ctx, scopeByTenant(ctx, webhookTenantField, bson.M{"_id": objectID})).Decode(&doc)
+	if err != nil {
+		return nil, translateErr(err)
+	}
+	return doc.toDomain(), nil
+}
+
+// Update returns the updated Webhook
+func (r *WebhookRepository) Update(ctx context.Context, webhookID string, update domain.UpdateWebhook) (*domain.Webhook, error) {
+	objectID, err := objectIDFromHex(webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := r.clock.Now()
+	set := bson.M{"url": update.URL, "event_types": update.EventTypes, "updated_at": now}
+	unset := bson.M{}
+	if update.Secret != "" {
+		set["secret"] = update.Secret
+	}
+	if update.Enabled != nil {
+		set["enabled"] = *update.Enabled
+		set["failures"] = 0
+		if *update.Enabled {
+			unset["disabled_at"] = ""
+		} else {
+			set["disabled_at"] = now
+		}
+	}
+	changes := bson.D{bson.E{Key: "$set", Value: set}}
+	if len(unset) > 0 {
+		changes = append(changes, bson.E{Key: "$unset", Value: unset})
+	}
+
+	var doc webhookDocument
+	filter := scopeByTenant(ctx, webhookTenantField, bson.M{"_id": objectID})
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := r.collection.FindOneAndUpdate(ctx, filter, changes, opts).Decode(&doc); err != nil {
+		return nil, translateErr(err)
+	}
+	return doc.toDomain(), nil
+}
+
+// DeleteByID delete Webhook by ID
+func (r *WebhookRepository) DeleteByID(ctx context.Context, webhookID string) error {
+	objectID, err := objectIDFromHex(webhookID)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.collection.DeleteOne(ctx, scopeByTenant(ctx, webhookTenantField, bson.M{"_id": objectID}))
+	return translateErr(err)
+}
+
+// ListSubscribed returns enabled webhooks subscribed to the event type which belong to the tenant
+// accountExternalID, an empty accountExternalID matches webhooks of no tenant, the tenant of ctx is ignored
+func (r *WebhookRepository) ListSubscribed(ctx context.Context, eventType string, accountExternalID string) ([]*domain.Webhook, error) {
+	filter := bson.M{"event_types": eventType, "enabled": true, webhookTenantField: accountExternalID}
+	if accountExternalID == "" {
+		filter[webhookTenantField] = bson.M{"$exists": false}
+	}
+	return r.find(ctx, filter, options.Find())
+}
+
+// RecordSuccess resets failures of the webhook
+func (r *WebhookRepository) RecordSuccess(ctx context.Context, webhookID string) error {
+	objectID, err := objectIDFromHex(webhookID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": objectID, "failures": bson.M{"$gt": 0}}
+	_, err = r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"failures": 0}})
+	return translateErr(err)
+}
+
+// RecordFailure counts a failed delivery attempt, the webhook is disabled after disableAfter failures in a row
+func (r *WebhookRepository) RecordFailure(ctx context.Context, webhookID string, disableAfter int64) (*domain.Webhook, error) {
+	objectID, err := objectIDFromHex(webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the pipeline update increments and disables atomically, so concurrent workers disable the webhook once
+	failures := bson.M{"$add": bson.A{"$failures", 1}}
+	disable := bson.M{"$and": bson.A{"$enabled", bson.M{"$gte": bson.A{failures, disableAfter}}}}
+	now := r.clock.Now()
+	update := bson.A{bson.M{"$set": bson.M{
+		"failures":    failures,
+		"enabled":     bson.M{"$cond": bson.A{disable, false, "$enabled"}},
+		"disabled_at": bson.M{"$cond": bson.A{disable, now, "$disabled_at"}},
+		"updated_at":  bson.M{"$cond": bson.A{disable, now, "$updated_at"}},
+	}}}
+
+	var doc webhookDocument
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID}, update, opts).Decode(&doc); err != nil {
+		return nil, translateErr(err)
+	}
+	return doc.toDomain(), nil
+}
+
+// DeleteAll delete all
+func (r *WebhookRepository) DeleteAll(ctx context.Context) error {
+	_, err := r.collection.DeleteMany(ctx, scopeByTenant(ctx, webhookTenantField, bson.M{}))
+	return translateErr(err)
+}
+
+func (r *WebhookRepository) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]*domain.Webhook, error) {
+	cur, err := r.collection.Find(ctx, filter, opts.SetSort(bson.D{bson.E{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, translateErr(err)
+	}
+	var docs []*webhookDocument
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, translateErr(err)
+	}
+	webhooks := make([]*domain.Webhook, len(docs))
+	for i, doc := range docs {
+		webhooks[i] = doc.toDomain()
+	}
+	return webhooks, nil
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const webhookDeliveriesCollection = "webhook_deliveries"
+
+// webhookDeliveryDocument is the stored form of domain.WebhookDelivery
+type webhookDeliveryDocument struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	WebhookID      primitive.ObjectID `bson:"webhook_id"`
+	EventType      string             `bson:"event_type"`
+	Payload        string             `bson:"payload"`
+	Status         string             `bson:"status"`
+	Attempts       int64              `bson:"attempts"`
+	NextAttemptAt  time.Time          `bson:"next_attempt_at"`
+	LastAttemptAt  *time.Time         `bson:"last_attempt_at,omitempty"`
+	ResponseStatus int                `bson:"response_status,omitempty"`
+	Error          string             `bson:"error,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at"`
+}
+
+func (d *webhookDeliveryDocument) toDomain() *domain.WebhookDelivery {
+	return &domain.WebhookDelivery{
+		ID:             d.ID.Hex(),
+		WebhookID:      d.WebhookID.Hex(),
+		EventType:      d.EventType,
+		Payload:        d.Payload,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt,
+		LastAttemptAt:  d.LastAttemptAt,
+		ResponseStatus: d.ResponseStatus,
+		Error:          d.Error,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+}
+
+// WebhookDeliveryRepository struct
+type WebhookDeliveryRepository struct {
+	collection *mongo.Collection
+	clock      clock.Clock
+	ids        idgen.IDGenerator
+}
+
+// NewWebhookDeliveryRepository returns a new WebhookDeliveryRepository struct, ids must generate hex ObjectIDs
+func NewWebhookDeliveryRepository(db *mongo.Database, clock clock.Clock, ids idgen.IDGenerator) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{
+		collection: db.Collection(webhookDeliveriesCollection),
+		clock:      clock,
+		ids:        ids,
+	}
+}
+
+// Create stores the delivery as pending, a zero NextAttemptAt is due immediately
+func (r *WebhookDeliveryRepository) Create(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	webhookID, err := primitive.ObjectIDFromHex(delivery.WebhookID)
+	if err != nil {
+		return err
+	}
+	objectID, err := primitive.ObjectIDFromHex(r.ids.NewID())
+	if err != nil {
+		return err
+	}
+	now := r.clock.Now()
+	delivery.Status = domain.DeliveryPending
+	if delivery.NextAttemptAt.IsZero() {
+		delivery.NextAttemptAt = now
+	}
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+
+	doc := webhookDeliveryDocument{
+		ID:            objectID,
+		WebhookID:     webhookID,
+		EventType:     delivery.EventType,
+		Payload:       delivery.Payload,
+		Status:        delivery.Status,
+		Attempts:      delivery.Attempts,
+		NextAttemptAt: delivery.NextAttemptAt,
+		CreatedAt:     delivery.CreatedAt,
+		UpdatedAt:     delivery.UpdatedAt,
+	}
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return translateErr(err)
+	}
+	delivery.ID = objectID.Hex()
+	return nil
+}
+
+// ListByWebhookID returns deliveries of the webhook newest first
+func (r *WebhookDeliveryRepository) ListByWebhookID(ctx context.Context, webhookID string, limit int64, offset int64) ([]*domain.WebhookDelivery, error) {
+	objectID, err := objectIDFromHex(webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSkip(offset).SetLimit(limit).SetSort(bson.D{bson.E{Key: "_id", Value: -1}})
+	cur, err := r.collection.Find(ctx, bson.M{"webhook_id": objectID}, opts)
+	if err != nil {
+		return nil, translateErr(err)
+	}
+	var docs []*webhookDeliveryDocument
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, translateErr(err)
+	}
+	deliveries := make([]*domain.WebhookDelivery, len(docs))
+	for i, doc := range docs {
+		deliveries[i] = doc.toDomain()
+	}
+	return deliveries, nil
+}
+
+// ClaimDue returns the pending delivery due first and postpones it by lease so that other workers skip it,
+// domain.ErrNotFound if no delivery is due
+func (r *WebhookDeliveryRepository) ClaimDue(ctx context.Context, lease time.Duration) (*domain.WebhookDelivery, error) {
+	now := r.clock.Now()
+	filter := bson.M{"status": domain.DeliveryPending, "next_attempt_at": bson.M{"$lte": now}}
+	update := bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{bson.E{Key: "next_attempt_at", Value: 1}, bson.E{Key: "_id", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var doc webhookDeliveryDocument
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc); err != nil {
+		return nil, translateErr(err)
+	}
+	return doc.toDomain(), nil
+}
+
+// Update stores the result of an attempt
+func (r *WebhookDeliveryRepository) Update(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	objectID, err := objectIDFromHex(delivery.ID)
+	if err != nil {
+		return err
+	}
+	delivery.UpdatedAt = r.clock.Now()
+
+	set := bson.M{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"last_attempt_at": delivery.LastAttemptAt,
+		"response_status": delivery.ResponseStatus,
+		"error":           delivery.Error,
+		"updated_at":      delivery.UpdatedAt,
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": set})
+	if err != nil {
+		return translateErr(err)
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteByWebhookID deletes deliveries of the webhook
+func (r *WebhookDeliveryRepository) DeleteByWebhookID(ctx context.Context, webhookID string) error {
+	objectID, err := objectIDFromHex(webhookID)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.collection.DeleteMany(ctx, bson.M{"webhook_id": objectID})
+	return translateErr(err)
+}
+
+// DeleteAll delete all
+func (r *WebhookDeliveryRepository) DeleteAll(ctx context.Context) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{})
+	return translateErr(err)
+}
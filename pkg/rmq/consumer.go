@@ -0,0 +1,63 @@
+package rmq
+
+import (
+	"github.com/streadway/amqp"
+	rmqclient "github.com/zaharinea/go-rmq-client"
+)
+
+// Queue describes a queue, a queue without a handler is declared but not consumed
+type Queue struct {
+	Name       string
+	RoutingKey string
+	Arguments  amqp.Table
+	Handler    rmqclient.HandlerFunc
+}
+
+// Exchange describes an exchange and the queues bound to it
+type Exchange struct {
+	Name      string
+	Kind      string
+	Arguments amqp.Table
+	Queues    []*Queue
+}
+
+// Consumer declares exchanges and queues and consumes them with the registered middlewares,
+// it is implemented by ClientConsumer and by fakes in tests
+type Consumer interface {
+	RegisterExchange(exchange *Exchange)
+	RegisterQueue(queues ...*Queue)
+	RegisterMiddleware(m ...rmqclient.MiddlewareFunc)
+	Start()
+	// Stop stops consuming and waits for running handlers
+	Stop() error
+	// Close closes the connection without waiting for running handlers
+	Close() error
+}
+
+// ClientConsumer is a Consumer connected to RabbitMQ
+type ClientConsumer struct {
+	*rmqclient.Consumer
+}
+
+// NewClientConsumer returns a new ClientConsumer struct
+func NewClientConsumer(uri string, logger rmqclient.Logger) *ClientConsumer {
+	return &ClientConsumer{Consumer: rmqclient.NewConsumer(uri, logger)}
+}
+
+// RegisterExchange registers the exchange and its queues
+func (c *ClientConsumer) RegisterExchange(exchange *Exchange) {
+	c.Consumer.RegisterExchange(rmqclient.NewExchange(exchange.Name, exchange.Kind, exchange.Arguments, newClientQueues(exchange.Queues)))
+}
+
+// RegisterQueue registers queues
+func (c *ClientConsumer) RegisterQueue(queues ...*Queue) {
+	c.Consumer.RegisterQueue(newClientQueues(queues)...)
+}
+
+func newClientQueues(queues []*Queue) []*rmqclient.Queue {
+	clientQueues := make([]*rmqclient.Queue, len(queues))
+	for i, queue := range queues {
+		clientQueues[i] = rmqclient.NewQueue(queue.Name, queue.RoutingKey, queue.Arguments).SetHandler(queue.Handler)
+	}
+	return clientQueues
+}
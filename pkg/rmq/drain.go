@@ -0,0 +1,98 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+	rmqclient "github.com/zaharinea/go-rmq-client"
+)
+
+// detachedContext keeps values of the parent context but is cancelled only by done
+type detachedContext struct {
+	context.Context
+	done context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) { return c.done.Deadline() }
+func (c detachedContext) Done() <-chan struct{}       { return c.done.Done() }
+func (c detachedContext) Err() error                  { return c.done.Err() }
+
+// Drainer tracks in-flight handlers and lets them finish after the consumer is stopped,
+// the consumer cancels the context of handlers on stop so it is replaced by one cancelled by Abort
+type Drainer struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	inFlight int64
+	wg       sync.WaitGroup
+}
+
+// NewDrainer returns a new Drainer struct
+func NewDrainer() *Drainer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Drainer{ctx: ctx, cancel: cancel}
+}
+
+// Middleware runs the handler with the detached context and counts it as in-flight
+func (d *Drainer) Middleware(handler rmqclient.HandlerFunc) rmqclient.HandlerFunc {
+	return func(ctx context.Context, msg amqp.Delivery) bool {
+		d.wg.Add(1)
+		atomic.AddInt64(&d.inFlight, 1)
+		defer func() {
+			atomic.AddInt64(&d.inFlight, -1)
+			d.wg.Done()
+		}()
+		return handler(detachedContext{Context: ctx, done: d.ctx}, msg)
+	}
+}
+
+// InFlight returns count of running handlers
+func (d *Drainer) InFlight() int64 {
+	return atomic.LoadInt64(&d.inFlight)
+}
+
+// Wait waits for running handlers until ctx is done
+func (d *Drainer) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Abort cancels the context of running handlers
+func (d *Drainer) Abort() {
+	d.cancel()
+}
+
+// StopConsumer stops consuming new messages and waits for in-flight handlers until ctx is done.
+// On timeout the handlers are aborted and the connection is closed,
+// so the broker requeues all unacknowledged messages.
+func StopConsumer(ctx context.Context, consumer Consumer, h *Handler) error {
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- consumer.Stop()
+	}()
+
+	select {
+	case err := <-stopped:
+		return err
+	case <-ctx.Done():
+		inFlight := h.drainer.InFlight()
+		h.drainer.Abort()
+		if err := consumer.Close(); err != nil {
+			return fmt.Errorf("%d in-flight messages aborted, failed close connection: %w", inFlight, err)
+		}
+		return fmt.Errorf("%d in-flight messages aborted and requeued: %w", inFlight, ctx.Err())
+	}
+}
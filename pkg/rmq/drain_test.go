@@ -0,0 +1,46 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rmqclient "github.com/zaharinea/go-rmq-client"
+)
+
+func TestDrainer(t *testing.T) {
+	d := NewDrainer()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	results := make(chan error, 1)
+
+	handler := d.Middleware(func(ctx context.Context, msg amqp.Delivery) bool {
+		close(started)
+		<-release
+		assert.Equal(t, "queue", ctx.Value(rmqclient.QueueNameKey))
+		results <- ctx.Err()
+		<-ctx.Done()
+		return true
+	})
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), rmqclient.QueueNameKey, "queue"))
+	go handler(ctx, amqp.Delivery{})
+	<-started
+	assert.Equal(t, int64(1), d.InFlight())
+
+	// the consumer cancels the context of handlers on stop
+	cancel()
+	close(release)
+	require.NoError(t, <-results, "the handler context is detached from the consumer")
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer waitCancel()
+	assert.Equal(t, context.DeadlineExceeded, d.Wait(waitCtx))
+
+	d.Abort()
+	require.NoError(t, d.Wait(context.Background()))
+	assert.Equal(t, int64(0), d.InFlight())
+}
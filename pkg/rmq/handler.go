@@ -3,45 +3,48 @@ package rmq
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
 	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/domain"
 	"github.com/zaharinea/go-example/pkg/repository"
-	rmqclient "github.com/zaharinea/go-rmq-client"
+	"github.com/zaharinea/go-example/pkg/webhook"
 )
 
 // Handler struct
 type Handler struct {
-	config *config.Config
-	repos  *repository.Repository
+	config    *config.Config
+	repos     *repository.Repository
+	publisher webhook.IPublisher
+	drainer   *Drainer
 }
 
 // NewHandler returns a new RmqHandler struct
 func NewHandler(config *config.Config, repos *repository.Repository) *Handler {
-	return &Handler{config: config, repos: repos}
+	return &Handler{config: config, repos: repos, publisher: webhook.NewPublisher(repos), drainer: NewDrainer()}
 }
 
 // SetupExchangesAndQueues setup Exchanges and Queues
-func SetupExchangesAndQueues(consumer *rmqclient.Consumer, h *Handler) {
-	companyQueque := rmqclient.NewQueue("go-example-companies", "events.companies", amqp.Table{})
-	companyQueque.SetHandler(h.HandlerCompanyEvent)
-	companyExchange := rmqclient.NewExchange("events.companies", "fanout", amqp.Table{}, []*rmqclient.Queue{companyQueque})
-	consumer.RegisterExchange(companyExchange)
+func SetupExchangesAndQueues(consumer Consumer, h *Handler) {
+	companyQueue := &Queue{Name: "go-example-companies", RoutingKey: "events.companies", Arguments: amqp.Table{}, Handler: h.HandlerCompanyEvent}
+	consumer.RegisterExchange(&Exchange{Name: "events.companies", Kind: "fanout", Arguments: amqp.Table{}, Queues: []*Queue{companyQueue}})
 
-	accountFailedQueque := rmqclient.NewQueue("go-example-accounts-failed", "", amqp.Table{
+	accountFailedQueue := &Queue{Name: "go-example-accounts-failed", Arguments: amqp.Table{
 		"x-dead-letter-exchange":    "",
 		"x-dead-letter-routing-key": "go-example-accounts",
 		"x-message-ttl":             60 * 1000,
-	})
-	accountQueque := rmqclient.NewQueue("go-example-accounts", "", amqp.Table{
+	}}
+	accountQueue := &Queue{Name: "go-example-accounts", Arguments: amqp.Table{
 		"x-dead-letter-exchange":    "",
 		"x-dead-letter-routing-key": "go-example-accounts-failed",
-	})
-	accountQueque.SetHandler(h.HandlerAccountEvent)
-	consumer.RegisterQueue(accountQueque, accountFailedQueque)
+	}, Handler: h.HandlerAccountEvent}
+	consumer.RegisterQueue(accountQueue, accountFailedQueue)
 
-	consumer.RegisterMiddleware(loggingMiddleware, prometheusMiddleware)
+	consumer.RegisterMiddleware(h.drainer.Middleware, loggingMiddleware, prometheusMiddleware, inboxMiddleware(h.repos))
 }
 
 // HandlerCompanyEvent handler for company events
@@ -53,14 +56,83 @@ func (h *Handler) HandlerCompanyEvent(ctx context.Context, msg amqp.Delivery) bo
 	return true
 }
 
+const (
+	accountEventUpdated = "account.updated"
+	accountEventDeleted = "account.deleted"
+)
+
+type accountEvent struct {
+	EventType string `json:"event_type"`
+	domain.Account
+}
+
+var errAccountHasUsers = errors.New("account has users")
+
+// applyAccountDeletePolicy prepares users of the account for its deletion and publishes changes of the users,
+// it is idempotent as the event may be redelivered
+func (h *Handler) applyAccountDeletePolicy(ctx context.Context, accountExternalID string, deletedAt time.Time) error {
+	switch h.config.AccountDeletePolicy {
+	case config.AccountDeletePolicyBlock:
+		count, err := h.repos.User.CountByAccountExternalID(ctx, accountExternalID)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return errAccountHasUsers
+		}
+		return nil
+	case config.AccountDeletePolicyCascade:
+		users, err := h.repos.User.ListByAccountExternalID(ctx, accountExternalID, 0, 0)
+		if err != nil {
+			return err
+		}
+		if err := h.repos.User.SoftDeleteByAccountExternalID(ctx, accountExternalID, deletedAt); err != nil {
+			return err
+		}
+		for _, user := range users {
+			user.DeletedAt = &deletedAt
+			if err := h.publisher.Publish(ctx, webhook.UserEvent(domain.EventUserDeleted, user)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		users, err := h.repos.User.ListByAccountExternalID(ctx, accountExternalID, 0, 0)
+		if err != nil {
+			return err
+		}
+		if err := h.repos.User.DetachAccount(ctx, accountExternalID); err != nil {
+			return err
+		}
+		for _, user := range users {
+			detached, err := h.repos.User.GetByID(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+			// the event goes to webhooks of the tenant the user belonged to
+			event := webhook.Event{Type: domain.EventUserUpdated, AccountExternalID: accountExternalID, Data: detached}
+			if err := h.publisher.Publish(ctx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 // HandlerAccountEvent handler for account events
 /*
 {
+    "event_type":"account.updated",
     "external_id":"1",
     "name":"account1",
     "created_at":"2020-11-20T22:56:57.565Z",
     "updated_at":"2020-11-20T22:56:57.565Z"
 }
+{
+    "event_type":"account.deleted",
+    "external_id":"1",
+    "deleted_at":"2020-11-21T22:56:57.565Z"
+}
 */
 func (h *Handler) HandlerAccountEvent(ctx context.Context, msg amqp.Delivery) bool {
 	if msg.Body == nil {
@@ -68,19 +140,53 @@ func (h *Handler) HandlerAccountEvent(ctx context.Context, msg amqp.Delivery) bo
 		return false
 	}
 
-	var account repository.Account
-	if err := json.Unmarshal(msg.Body, &account); err != nil {
+	var event accountEvent
+	if err := json.Unmarshal(msg.Body, &event); err != nil {
 		logrus.Errorf("Invalid account event: msg=%s, error=%s", string(msg.Body), err)
 		return false
 	}
 
-	if _, err := h.repos.Account.CreateOrUpdate(ctx, account, false); err != nil {
-		if h.repos.IsDuplicateKeyErr(err) {
+	var err error
+	var account *domain.Account
+	switch event.EventType {
+	case "", accountEventUpdated:
+		account, err = h.repos.Account.CreateOrUpdate(ctx, event.Account, false)
+		if err == nil {
+			err = h.publisher.Publish(ctx, webhook.AccountEvent(domain.EventAccountUpdated, account))
+		}
+	case accountEventDeleted:
+		deletedAt := event.UpdatedAt
+		if event.DeletedAt != nil {
+			deletedAt = *event.DeletedAt
+		}
+		if deletedAt.IsZero() {
+			// without a timestamp the delete can not be ordered against updates, it is dead-lettered
+			logrus.Errorf("Invalid account event: msg=%s, error=deleted_at and updated_at are empty", string(msg.Body))
+			return false
+		}
+		// the policy is applied only to a delete newer than the account, a failed policy rolls back the tombstone
+		err = h.repos.WithTransaction(ctx, func(ctx context.Context) error {
+			account, err := h.repos.Account.MarkDeleted(ctx, event.ExternalID, deletedAt)
+			if err != nil {
+				return err
+			}
+			if err := h.applyAccountDeletePolicy(ctx, event.ExternalID, deletedAt); err != nil {
+				return fmt.Errorf("apply %s account delete policy: %w", h.config.AccountDeletePolicy, err)
+			}
+			return h.publisher.Publish(ctx, webhook.AccountEvent(domain.EventAccountDeleted, account))
+		})
+	default:
+		logrus.Errorf("Unknown account event type: msg=%s", string(msg.Body))
+		return false
+	}
+
+	if err != nil {
+		if errors.Is(err, domain.ErrStale) || errors.Is(err, domain.ErrDuplicate) {
 			logrus.Infof("Skip duplicate or expired event: msg=%s", string(msg.Body))
 			return true
 		}
 
-		logrus.Errorf("Failed create or update account: msg=%s, error=%s", string(msg.Body), err)
+		logrus.Errorf("Failed process account event: msg=%s, error=%s", string(msg.Body), err)
 		return false
 	}
 
@@ -5,12 +5,17 @@ import (
 	"time"
 
 	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
 	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/repository/memory"
 	"github.com/zaharinea/go-example/pkg/service"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/zaharinea/go-example/pkg/tenant"
+	rmqclient "github.com/zaharinea/go-rmq-client"
 	"golang.org/x/net/context"
 )
 
@@ -18,7 +23,6 @@ type RmqHanlersSuite struct {
 	suite.Suite
 	ctx         context.Context
 	config      *config.Config
-	db          *mongo.Database
 	repos       *repository.Repository
 	services    *service.Service
 	rmqHandlers *Handler
@@ -26,10 +30,8 @@ type RmqHanlersSuite struct {
 
 func (s *RmqHanlersSuite) SetupSuite() {
 	s.ctx = context.Background()
-	s.config = config.NewTestingConfig()
-	dbClient := repository.InitDbClient(s.config)
-	s.db = dbClient.Database(s.config.MongoDbName)
-	s.repos = repository.NewRepository(s.db)
+	s.config = &config.Config{AccountDeletePolicy: config.AccountDeletePolicyOrphan}
+	s.repos = memory.NewRepository(clock.System{}, idgen.NewSequence())
 	s.services = service.NewService(s.repos)
 	s.rmqHandlers = NewHandler(s.config, s.repos)
 }
@@ -37,6 +39,15 @@ func (s *RmqHanlersSuite) SetupSuite() {
 func (s *RmqHanlersSuite) SetupTest() {
 	err := s.repos.Account.DeleteAll(s.ctx)
 	s.Require().NoError(err)
+	err = s.repos.Inbox.DeleteAll(s.ctx)
+	s.Require().NoError(err)
+	err = s.repos.User.DeleteAll(s.ctx)
+	s.Require().NoError(err)
+	err = s.repos.Webhook.DeleteAll(s.ctx)
+	s.Require().NoError(err)
+	err = s.repos.WebhookDelivery.DeleteAll(s.ctx)
+	s.Require().NoError(err)
+	s.config.AccountDeletePolicy = config.AccountDeletePolicyOrphan
 }
 
 func (s *RmqHanlersSuite) TearDownTest() {}
@@ -69,8 +80,7 @@ func (s *RmqHanlersSuite) TestHandlerAccountEvent() {
 }
 
 func (s *RmqHanlersSuite) TestHandlerAccountEventSkipOld() {
-	_, err := s.repos.Account.CreateOrUpdate(s.ctx, repository.Account{
-		ID:         primitive.NewObjectID(),
+	_, err := s.repos.Account.CreateOrUpdate(s.ctx, domain.Account{
 		ExternalID: "1",
 		Name:       "account1",
 		CreatedAt:  time.Date(2020, 11, 20, 0, 0, 0, 0, time.UTC),
@@ -93,6 +103,263 @@ func (s *RmqHanlersSuite) TestHandlerAccountEventSkipOld() {
 	s.Require().Equal("account1", dbAccount.Name)
 }
 
+func (s *RmqHanlersSuite) TestHandlerAccountEventDeleted() {
+	_, err := s.repos.Account.CreateOrUpdate(s.ctx, domain.Account{
+		ExternalID: "1",
+		Name:       "account1",
+		CreatedAt:  time.Date(2020, 11, 20, 0, 0, 0, 0, time.UTC),
+		UpdatedAt:  time.Date(2020, 11, 21, 0, 0, 0, 0, time.UTC),
+	}, true)
+	s.Require().NoError(err)
+
+	deletedAccountEvent := `{
+		"event_type":"account.deleted",
+		"external_id":"1",
+		"deleted_at":"2020-11-22T00:00:00.000Z"
+	}`
+	msg := amqp.Delivery{Body: []byte(deletedAccountEvent)}
+	result := s.rmqHandlers.HandlerAccountEvent(s.ctx, msg)
+	s.Require().Equal(true, result)
+
+	_, err = s.repos.Account.GetByExternalID(s.ctx, "1")
+	s.Require().Equal(domain.ErrNotFound, err)
+
+	accounts, err := s.repos.Account.List(s.ctx, 10, 0)
+	s.Require().NoError(err)
+	s.Require().Equal(0, len(accounts))
+}
+
+func (s *RmqHanlersSuite) TestHandlerAccountEventDeletedWithoutTimestamp() {
+	msg := amqp.Delivery{Body: []byte(`{"external_id":"1","name":"account1","updated_at":"2020-11-21T00:00:00.000Z"}`)}
+	s.Require().Equal(true, s.rmqHandlers.HandlerAccountEvent(s.ctx, msg))
+
+	msg = amqp.Delivery{Body: []byte(`{"event_type":"account.deleted","external_id":"1"}`)}
+	s.Require().Equal(false, s.rmqHandlers.HandlerAccountEvent(s.ctx, msg))
+
+	_, err := s.repos.Account.GetByExternalID(s.ctx, "1")
+	s.Require().NoError(err)
+}
+
+func (s *RmqHanlersSuite) TestHandlerAccountEventUpdateAfterDeleted() {
+	msg := amqp.Delivery{Body: []byte(`{"event_type":"account.deleted","external_id":"1","deleted_at":"2020-11-22T00:00:00.000Z"}`)}
+	s.Require().Equal(true, s.rmqHandlers.HandlerAccountEvent(s.ctx, msg))
+
+	msg = amqp.Delivery{Body: []byte(`{"external_id":"1","name":"account2","updated_at":"2020-11-23T00:00:00.000Z"}`)}
+	s.Require().Equal(true, s.rmqHandlers.HandlerAccountEvent(s.ctx, msg))
+
+	account, err := s.repos.Account.GetByExternalID(s.ctx, "1")
+	s.Require().NoError(err)
+	s.Require().Equal("account2", account.Name)
+}
+
+func (s *RmqHanlersSuite) TestHandlerAccountEventSkipUpdateAfterDeleted() {
+	deletedAccountEvent := `{
+		"event_type":"account.deleted",
+		"external_id":"1",
+		"deleted_at":"2020-11-22T00:00:00.000Z"
+	}`
+	msg := amqp.Delivery{Body: []byte(deletedAccountEvent)}
+	result := s.rmqHandlers.HandlerAccountEvent(s.ctx, msg)
+	s.Require().Equal(true, result)
+
+	lateAccountEvent := `{
+		"external_id":"1",
+		"name":"account1",
+		"created_at":"2020-11-20T00:00:00.000Z",
+		"updated_at":"2020-11-21T00:00:00.000Z"
+	}`
+	msg = amqp.Delivery{Body: []byte(lateAccountEvent)}
+	result = s.rmqHandlers.HandlerAccountEvent(s.ctx, msg)
+	s.Require().Equal(true, result)
+
+	_, err := s.repos.Account.GetByExternalID(s.ctx, "1")
+	s.Require().Equal(domain.ErrNotFound, err)
+}
+
+func (s *RmqHanlersSuite) deleteAccountWithUser(policy string) (bool, *domain.User) {
+	return s.deleteAccountWithUserAt(policy, "2020-11-22T00:00:00.000Z")
+}
+
+func (s *RmqHanlersSuite) deleteAccountWithUserAt(policy string, deletedAt string) (bool, *domain.User) {
+	s.config.AccountDeletePolicy = policy
+	_, err := s.repos.Account.CreateOrUpdate(s.ctx, domain.Account{
+		ExternalID: "1",
+		Name:       "account1",
+		CreatedAt:  time.Date(2020, 11, 20, 0, 0, 0, 0, time.UTC),
+		UpdatedAt:  time.Date(2020, 11, 21, 0, 0, 0, 0, time.UTC),
+	}, true)
+	s.Require().NoError(err)
+	user := domain.User{Name: "user1", AccountExternalID: "1"}
+	err = s.repos.User.Create(s.ctx, &user)
+	s.Require().NoError(err)
+
+	msg := amqp.Delivery{Body: []byte(`{"event_type":"account.deleted","external_id":"1","deleted_at":"` + deletedAt + `"}`)}
+	return s.rmqHandlers.HandlerAccountEvent(s.ctx, msg), &user
+}
+
+func (s *RmqHanlersSuite) TestHandlerAccountEventDeletedBlock() {
+	result, user := s.deleteAccountWithUser(config.AccountDeletePolicyBlock)
+	s.Require().Equal(false, result)
+
+	_, err := s.repos.Account.GetByExternalID(s.ctx, "1")
+	s.Require().NoError(err)
+	dbUser, err := s.repos.User.GetByID(s.ctx, user.ID)
+	s.Require().NoError(err)
+	s.Require().Equal("1", dbUser.AccountExternalID)
+}
+
+func (s *RmqHanlersSuite) TestHandlerAccountEventDeletedCascade() {
+	result, user := s.deleteAccountWithUser(config.AccountDeletePolicyCascade)
+	s.Require().Equal(true, result)
+
+	_, err := s.repos.User.GetByID(s.ctx, user.ID)
+	s.Require().Equal(domain.ErrNotFound, err)
+}
+
+func (s *RmqHanlersSuite) TestHandlerAccountEventDeletedOrphan() {
+	result, user := s.deleteAccountWithUser(config.AccountDeletePolicyOrphan)
+	s.Require().Equal(true, result)
+
+	dbUser, err := s.repos.User.GetByID(s.ctx, user.ID)
+	s.Require().NoError(err)
+	s.Require().Equal("", dbUser.AccountExternalID)
+}
+
+func (s *RmqHanlersSuite) TestHandlerAccountEventStaleDeletedKeepsUsers() {
+	for _, policy := range []string{config.AccountDeletePolicyCascade, config.AccountDeletePolicyOrphan} {
+		s.SetupTest()
+		deliveries := s.webhookDeliveries(domain.EventUserDeleted, domain.EventUserUpdated, domain.EventAccountDeleted)
+
+		result, user := s.deleteAccountWithUserAt(policy, "2020-11-20T12:00:00.000Z")
+		s.Require().Equal(true, result, policy)
+
+		_, err := s.repos.Account.GetByExternalID(s.ctx, "1")
+		s.Require().NoError(err, policy)
+		dbUser, err := s.repos.User.GetByID(s.ctx, user.ID)
+		s.Require().NoError(err, policy)
+		s.Require().Equal("1", dbUser.AccountExternalID, policy)
+		s.Require().Empty(deliveries(), policy)
+	}
+}
+
+// webhookDeliveries creates a webhook of the tenant "1" and returns a function listing event types of its deliveries
+func (s *RmqHanlersSuite) webhookDeliveries(eventTypes ...string) func() []string {
+	webhook := &domain.Webhook{URL: "http://example.com", EventTypes: eventTypes, Secret: "secret"}
+	s.Require().NoError(s.repos.Webhook.Create(tenant.WithTenant(s.ctx, "1"), webhook))
+	return func() []string {
+		deliveries, err := s.repos.WebhookDelivery.ListByWebhookID(s.ctx, webhook.ID, 0, 0)
+		s.Require().NoError(err)
+		eventTypes := make([]string, len(deliveries))
+		for i, delivery := range deliveries {
+			eventTypes[i] = delivery.EventType
+		}
+		return eventTypes
+	}
+}
+
+func (s *RmqHanlersSuite) TestHandlerAccountEventPublishesToWebhooks() {
+	deliveries := s.webhookDeliveries(domain.EventAccountUpdated, domain.EventAccountDeleted)
+
+	msg := amqp.Delivery{Body: []byte(`{"external_id":"1","name":"account1","updated_at":"2020-11-21T00:00:00.000Z"}`)}
+	s.Require().Equal(true, s.rmqHandlers.HandlerAccountEvent(s.ctx, msg))
+	s.Require().Equal(true, s.rmqHandlers.HandlerAccountEvent(s.ctx, msg), "a stale event is skipped")
+	s.Require().Equal([]string{domain.EventAccountUpdated}, deliveries())
+
+	msg = amqp.Delivery{Body: []byte(`{"event_type":"account.deleted","external_id":"1","deleted_at":"2020-11-22T00:00:00.000Z"}`)}
+	s.Require().Equal(true, s.rmqHandlers.HandlerAccountEvent(s.ctx, msg))
+	s.Require().Equal([]string{domain.EventAccountDeleted, domain.EventAccountUpdated}, deliveries())
+}
+
+func (s *RmqHanlersSuite) TestHandlerAccountEventDeletedCascadePublishesToWebhooks() {
+	deliveries := s.webhookDeliveries(domain.EventUserDeleted, domain.EventUserUpdated)
+
+	result, _ := s.deleteAccountWithUser(config.AccountDeletePolicyCascade)
+	s.Require().Equal(true, result)
+	s.Require().Equal([]string{domain.EventUserDeleted}, deliveries())
+}
+
+func (s *RmqHanlersSuite) TestHandlerAccountEventDeletedOrphanPublishesToWebhooks() {
+	deliveries := s.webhookDeliveries(domain.EventUserDeleted, domain.EventUserUpdated)
+
+	result, _ := s.deleteAccountWithUser(config.AccountDeletePolicyOrphan)
+	s.Require().Equal(true, result)
+	s.Require().Equal([]string{domain.EventUserUpdated}, deliveries())
+}
+
+func (s *RmqHanlersSuite) TestHandlerAccountEventUnknownType() {
+	msg := amqp.Delivery{Body: []byte(`{"event_type":"account.unknown","external_id":"1"}`)}
+	result := s.rmqHandlers.HandlerAccountEvent(s.ctx, msg)
+	s.Require().Equal(false, result)
+}
+
+func (s *RmqHanlersSuite) TestInboxMiddlewareSkipDuplicate() {
+	calls := 0
+	handler := inboxMiddleware(s.repos)(func(ctx context.Context, msg amqp.Delivery) bool {
+		calls++
+		return s.rmqHandlers.HandlerAccountEvent(ctx, msg)
+	})
+	ctx := context.WithValue(s.ctx, rmqclient.QueueNameKey, "go-example-accounts")
+	msg := amqp.Delivery{MessageId: "message-1", Body: []byte(`{
+		"external_id":"1",
+		"name":"account1",
+		"created_at":"2020-11-20T00:00:00.000Z",
+		"updated_at":"2020-11-21T00:00:00.000Z"
+	}`)}
+
+	s.Require().Equal(true, handler(ctx, msg))
+	s.Require().Equal(true, handler(ctx, msg))
+	s.Require().Equal(1, calls)
+
+	exists, err := s.repos.Inbox.Exists(s.ctx, "go-example-accounts", "message-1")
+	s.Require().NoError(err)
+	s.Require().Equal(true, exists)
+}
+
+func (s *RmqHanlersSuite) TestInboxMiddlewareRollbackOnFailure() {
+	handler := inboxMiddleware(s.repos)(func(ctx context.Context, msg amqp.Delivery) bool {
+		return false
+	})
+	ctx := context.WithValue(s.ctx, rmqclient.QueueNameKey, "go-example-accounts")
+	msg := amqp.Delivery{Body: []byte(`{"message_id":"message-2"}`)}
+
+	s.Require().Equal(false, handler(ctx, msg))
+
+	exists, err := s.repos.Inbox.Exists(s.ctx, "go-example-accounts", "message-2")
+	s.Require().NoError(err)
+	s.Require().Equal(false, exists)
+}
+
+func (s *RmqHanlersSuite) TestInboxMiddlewareWithoutQueueName() {
+	calls := 0
+	handler := inboxMiddleware(s.repos)(func(ctx context.Context, msg amqp.Delivery) bool {
+		calls++
+		return true
+	})
+	msg := amqp.Delivery{MessageId: "message-3", Body: []byte(`{}`)}
+
+	s.Require().Equal(false, handler(s.ctx, msg))
+	s.Require().Equal(0, calls)
+
+	// a message without id is passed through, logging and metrics fall back to the unknown queue
+	s.Require().Equal(true, loggingMiddleware(prometheusMiddleware(handler))(s.ctx, amqp.Delivery{Body: []byte(`{}`)}))
+	s.Require().Equal(1, calls)
+}
+
+func TestGetQueueName(t *testing.T) {
+	queueName, ok := getQueueName(context.WithValue(context.Background(), rmqclient.QueueNameKey, "queue"))
+	assert.Equal(t, "queue", queueName)
+	assert.Equal(t, true, ok)
+	queueName, ok = getQueueName(context.Background())
+	assert.Equal(t, unknownQueueName, queueName)
+	assert.Equal(t, false, ok)
+}
+
+func TestGetMessageID(t *testing.T) {
+	assert.Equal(t, "1", getMessageID(amqp.Delivery{MessageId: "1", Body: []byte(`{"message_id":"2"}`)}))
+	assert.Equal(t, "2", getMessageID(amqp.Delivery{Body: []byte(`{"message_id":"2"}`)}))
+	assert.Equal(t, "", getMessageID(amqp.Delivery{Body: []byte("test")}))
+}
+
 func TestRmqHanlersSuite(t *testing.T) {
 	suite.Run(t, new(RmqHanlersSuite))
 }
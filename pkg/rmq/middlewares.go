@@ -2,17 +2,32 @@ package rmq
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/repository"
 	rmqclient "github.com/zaharinea/go-rmq-client"
 )
 
+// unknownQueueName is used in logs and metrics when the consumer context has no queue name
+const unknownQueueName = "unknown"
+
+func getQueueName(ctx context.Context) (string, bool) {
+	queueName, ok := ctx.Value(rmqclient.QueueNameKey).(string)
+	if !ok || queueName == "" {
+		return unknownQueueName, false
+	}
+	return queueName, true
+}
+
 func loggingMiddleware(handler rmqclient.HandlerFunc) rmqclient.HandlerFunc {
 	return func(ctx context.Context, msg amqp.Delivery) bool {
-		queueName := ctx.Value(rmqclient.QueueNameKey).(string)
+		queueName, _ := getQueueName(ctx)
 		logrus.Debugf("start processing event: queue=%s, msg=%s", queueName, string(msg.Body))
 		res := handler(ctx, msg)
 		logrus.Debugf("end processing event: queue=%s, msg=%s", queueName, string(msg.Body))
@@ -58,7 +73,7 @@ func init() {
 func prometheusMiddleware(handler rmqclient.HandlerFunc) rmqclient.HandlerFunc {
 	return func(ctx context.Context, msg amqp.Delivery) bool {
 		start := time.Now()
-		queueName := ctx.Value(rmqclient.QueueNameKey).(string)
+		queueName, _ := getQueueName(ctx)
 
 		eventCounter.WithLabelValues(queueName).Inc()
 		result := handler(ctx, msg)
@@ -73,3 +88,69 @@ func prometheusMiddleware(handler rmqclient.HandlerFunc) rmqclient.HandlerFunc {
 		return result
 	}
 }
+
+var (
+	errDuplicateMessage = errors.New("message already processed")
+	errHandlerFailed    = errors.New("message handler failed")
+)
+
+// messageEnvelope is used to read the message id from the body when the AMQP MessageId property is empty
+type messageEnvelope struct {
+	MessageID string `json:"message_id"`
+}
+
+func getMessageID(msg amqp.Delivery) string {
+	if msg.MessageId != "" {
+		return msg.MessageId
+	}
+
+	var envelope messageEnvelope
+	if err := json.Unmarshal(msg.Body, &envelope); err != nil {
+		return ""
+	}
+	return envelope.MessageID
+}
+
+// inboxMiddleware records processed message ids in the inbox in the same transaction as the handler's writes,
+// redelivered messages are acked without calling the handler
+func inboxMiddleware(repos *repository.Repository) rmqclient.MiddlewareFunc {
+	return func(handler rmqclient.HandlerFunc) rmqclient.HandlerFunc {
+		return func(ctx context.Context, msg amqp.Delivery) bool {
+			messageID := getMessageID(msg)
+			if messageID == "" {
+				return handler(ctx, msg)
+			}
+			// the inbox is keyed by queue, without the queue name the message can not be deduplicated
+			queueName, ok := getQueueName(ctx)
+			if !ok {
+				logrus.Errorf("Failed process event: message_id=%s, error=queue name is missing in context", messageID)
+				return false
+			}
+
+			err := repos.WithTransaction(ctx, func(ctx context.Context) error {
+				if err := repos.Inbox.Add(ctx, queueName, messageID); err != nil {
+					if errors.Is(err, domain.ErrDuplicate) {
+						return errDuplicateMessage
+					}
+					return err
+				}
+
+				if !handler(ctx, msg) {
+					return errHandlerFailed
+				}
+				return nil
+			})
+			if err != nil {
+				if errors.Is(err, errDuplicateMessage) {
+					logrus.Infof("Skip already processed event: queue=%s, message_id=%s", queueName, messageID)
+					return true
+				}
+				if !errors.Is(err, errHandlerFailed) {
+					logrus.Errorf("Failed process event in transaction: queue=%s, message_id=%s, error=%s", queueName, messageID, err)
+				}
+				return false
+			}
+			return true
+		}
+	}
+}
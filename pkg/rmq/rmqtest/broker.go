@@ -0,0 +1,499 @@
+// Package rmqtest provides an in-memory RabbitMQ broker implementing rmq.Consumer,
+// so the topology and handlers are tested without RabbitMQ
+package rmqtest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"github.com/zaharinea/go-example/pkg/rmq"
+	rmqclient "github.com/zaharinea/go-rmq-client"
+)
+
+// Arguments of queues supported by Broker
+const (
+	argDeadLetterExchange   = "x-dead-letter-exchange"
+	argDeadLetterRoutingKey = "x-dead-letter-routing-key"
+	argMessageTTL           = "x-message-ttl"
+)
+
+// Reasons of dead-lettering
+const (
+	ReasonRejected = "rejected"
+	ReasonExpired  = "expired"
+)
+
+// defaultExchange routes messages to the queue named by the routing key
+const defaultExchange = ""
+
+// maxDeliveries limits deliveries of one dispatch to catch dead-letter cycles
+const maxDeliveries = 10000
+
+type message struct {
+	delivery  amqp.Delivery
+	expires   bool
+	expiresAt time.Time
+	acked     bool
+}
+
+type queue struct {
+	spec     *rmq.Queue
+	ttl      *time.Duration
+	messages []*message
+}
+
+type binding struct {
+	queue      *queue
+	routingKey string
+}
+
+type exchange struct {
+	spec     *rmq.Exchange
+	bindings []binding
+}
+
+// Broker is an in-memory RabbitMQ implementing rmq.Consumer. It supports direct, fanout and topic exchanges,
+// the default exchange, dead-lettering of rejected and expired messages and message TTL.
+// Time of the broker only moves by Advance, so TTL is tested without waiting.
+// Messages are delivered in the goroutine calling Publish, Deliver, Advance or Start, one at a time like
+// a consumer with a single worker, handlers must not publish to the broker.
+type Broker struct {
+	mu          sync.RWMutex
+	now         time.Time
+	started     bool
+	exchanges   map[string]*exchange
+	queues      map[string]*queue
+	order       []*queue
+	middlewares []rmqclient.MiddlewareFunc
+	deliveryTag uint64
+
+	dispatchMu sync.Mutex
+}
+
+// NewBroker returns a new Broker struct, the broker does not deliver messages until Start
+func NewBroker() *Broker {
+	return &Broker{now: time.Now().UTC(), exchanges: map[string]*exchange{}, queues: map[string]*queue{}}
+}
+
+// RegisterExchange declares the exchange and its queues and binds the queues with their routing keys
+func (b *Broker) RegisterExchange(spec *rmq.Exchange) {
+	switch spec.Kind {
+	case amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic:
+	default:
+		panic(fmt.Sprintf("exchange kind is not supported: %s", spec.Kind))
+	}
+	b.RegisterQueue(spec.Queues...)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.exchanges[spec.Name]; ok || spec.Name == defaultExchange {
+		panic(fmt.Sprintf("exchange already registered: %s", spec.Name))
+	}
+	e := &exchange{spec: spec}
+	for _, q := range spec.Queues {
+		e.bindings = append(e.bindings, binding{queue: b.queues[q.Name], routingKey: q.RoutingKey})
+	}
+	b.exchanges[spec.Name] = e
+}
+
+// RegisterQueue declares queues
+func (b *Broker) RegisterQueue(specs ...*rmq.Queue) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, spec := range specs {
+		if _, ok := b.queues[spec.Name]; ok {
+			panic(fmt.Sprintf("queue already registered: %s", spec.Name))
+		}
+		q := &queue{spec: spec}
+		if value, ok := spec.Arguments[argMessageTTL]; ok {
+			ttl, err := milliseconds(value)
+			if err != nil {
+				panic(fmt.Sprintf("invalid %s of queue %s: %s", argMessageTTL, spec.Name, err))
+			}
+			q.ttl = &ttl
+		}
+		b.queues[spec.Name] = q
+		b.order = append(b.order, q)
+	}
+}
+
+// RegisterMiddleware registers middlewares
+func (b *Broker) RegisterMiddleware(m ...rmqclient.MiddlewareFunc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.middlewares = append(b.middlewares, m...)
+}
+
+// Start starts consuming, messages published before Start are delivered
+func (b *Broker) Start() {
+	b.mu.Lock()
+	b.started = true
+	b.mu.Unlock()
+	b.dispatch()
+}
+
+// Stop stops consuming, messages stay in queues until Start
+func (b *Broker) Stop() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.started = false
+	return nil
+}
+
+// Close stops consuming
+func (b *Broker) Close() error {
+	return b.Stop()
+}
+
+// Now returns the time of the broker
+func (b *Broker) Now() time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.now
+}
+
+// Advance moves the time of the broker, expired messages are dead-lettered and delivered
+func (b *Broker) Advance(d time.Duration) {
+	b.mu.Lock()
+	b.now = b.now.Add(d)
+	b.expire()
+	b.mu.Unlock()
+	b.dispatch()
+}
+
+// Queue returns the registered queue or nil
+func (b *Broker) Queue(name string) *rmq.Queue {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if q, ok := b.queues[name]; ok {
+		return q.spec
+	}
+	return nil
+}
+
+// Messages returns messages waiting in the queue
+func (b *Broker) Messages(queueName string) []amqp.Delivery {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	q, ok := b.queues[queueName]
+	if !ok {
+		return nil
+	}
+	deliveries := make([]amqp.Delivery, len(q.messages))
+	for i, m := range q.messages {
+		deliveries[i] = m.delivery
+	}
+	return deliveries
+}
+
+// Purge deletes messages of all queues
+func (b *Broker) Purge() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, q := range b.order {
+		q.messages = nil
+	}
+}
+
+// Publish routes msg to queues like RabbitMQ and delivers it to consumed queues.
+// Publishing to an unknown exchange returns a NOT_FOUND error, unroutable messages are dropped.
+func (b *Broker) Publish(exchangeName string, routingKey string, msg amqp.Publishing) error {
+	delivery := amqp.Delivery{
+		Headers:         msg.Headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	}
+
+	b.mu.Lock()
+	if _, ok := b.exchanges[exchangeName]; !ok && exchangeName != defaultExchange {
+		b.mu.Unlock()
+		return &amqp.Error{Code: amqp.NotFound, Reason: fmt.Sprintf("NOT_FOUND - no exchange '%s' in vhost '/'", exchangeName)}
+	}
+	b.publish(exchangeName, routingKey, delivery)
+	b.mu.Unlock()
+
+	b.dispatch()
+	return nil
+}
+
+// Deliver puts msg to the consumed queue through the default exchange and delivers it,
+// returns true if the message is acked. A nacked message is dead-lettered.
+func (b *Broker) Deliver(queueName string, msg amqp.Delivery) bool {
+	b.mu.Lock()
+	q, ok := b.queues[queueName]
+	if !ok || q.spec.Handler == nil {
+		b.mu.Unlock()
+		panic(fmt.Sprintf("queue is not consumed: %s", queueName))
+	}
+	if !b.started {
+		b.mu.Unlock()
+		panic("broker is not started")
+	}
+	msg.Exchange, msg.RoutingKey = defaultExchange, queueName
+	m := b.enqueue(q, msg)
+	b.mu.Unlock()
+
+	b.dispatch()
+	return m.acked
+}
+
+// publish puts copies of the delivery to queues bound to the exchange with matching routing keys
+func (b *Broker) publish(exchangeName string, routingKey string, delivery amqp.Delivery) {
+	delivery.Exchange, delivery.RoutingKey = exchangeName, routingKey
+
+	if exchangeName == defaultExchange {
+		if q, ok := b.queues[routingKey]; ok {
+			b.enqueue(q, delivery)
+		}
+		return
+	}
+
+	e, ok := b.exchanges[exchangeName]
+	if !ok {
+		return
+	}
+	routed := map[*queue]bool{}
+	for _, bind := range e.bindings {
+		if routed[bind.queue] || !routes(e.spec.Kind, bind.routingKey, routingKey) {
+			continue
+		}
+		routed[bind.queue] = true
+		b.enqueue(bind.queue, delivery)
+	}
+}
+
+// enqueue appends the delivery to the queue, the message expires by the lower of the queue and message TTL
+func (b *Broker) enqueue(q *queue, delivery amqp.Delivery) *message {
+	m := &message{delivery: delivery}
+	if q.ttl != nil {
+		m.expires, m.expiresAt = true, b.now.Add(*q.ttl)
+	}
+	if expiration, err := strconv.ParseInt(delivery.Expiration, 10, 64); err == nil && expiration >= 0 {
+		expiresAt := b.now.Add(time.Duration(expiration) * time.Millisecond)
+		if !m.expires || expiresAt.Before(m.expiresAt) {
+			m.expires, m.expiresAt = true, expiresAt
+		}
+	}
+	q.messages = append(q.messages, m)
+	return m
+}
+
+// expire dead-letters expired messages of all queues
+func (b *Broker) expire() {
+	for _, q := range b.order {
+		var alive []*message
+		for _, m := range q.messages {
+			if m.expires && !m.expiresAt.After(b.now) {
+				b.deadLetter(q, m, ReasonExpired)
+				continue
+			}
+			alive = append(alive, m)
+		}
+		q.messages = alive
+	}
+}
+
+// deadLetter republishes the message to the dead-letter exchange of the queue adding x-death headers,
+// the message is dropped if the queue has no dead-letter exchange
+func (b *Broker) deadLetter(q *queue, m *message, reason string) {
+	value, ok := q.spec.Arguments[argDeadLetterExchange]
+	if !ok {
+		return
+	}
+	exchangeName, _ := value.(string)
+	routingKey := m.delivery.RoutingKey
+	if value, ok := q.spec.Arguments[argDeadLetterRoutingKey]; ok {
+		routingKey, _ = value.(string)
+	}
+
+	delivery := m.delivery
+	delivery.Headers = xDeathHeaders(delivery, q.spec.Name, reason, b.now)
+	delivery.Expiration = ""
+	delivery.DeliveryTag = 0
+	b.publish(exchangeName, routingKey, delivery)
+}
+
+// dispatch delivers messages of consumed queues until the queues are empty
+func (b *Broker) dispatch() {
+	b.dispatchMu.Lock()
+	defer b.dispatchMu.Unlock()
+
+	for i := 0; ; i++ {
+		if i == maxDeliveries {
+			panic("too many deliveries, dead-letter cycle without TTL")
+		}
+
+		b.mu.Lock()
+		q, m := b.next()
+		if m == nil {
+			b.mu.Unlock()
+			return
+		}
+		b.deliveryTag++
+		m.delivery.DeliveryTag = b.deliveryTag
+		handler := q.spec.Handler
+		for j := len(b.middlewares) - 1; j >= 0; j-- {
+			handler = b.middlewares[j](handler)
+		}
+		b.mu.Unlock()
+
+		m.acked = deliver(q.spec.Name, handler, m.delivery)
+		if !m.acked {
+			b.mu.Lock()
+			b.deadLetter(q, m, ReasonRejected)
+			b.mu.Unlock()
+		}
+	}
+}
+
+// next removes and returns the first message of the first consumed queue with messages
+func (b *Broker) next() (*queue, *message) {
+	if !b.started {
+		return nil, nil
+	}
+	for _, q := range b.order {
+		if q.spec.Handler == nil || len(q.messages) == 0 {
+			continue
+		}
+		m := q.messages[0]
+		q.messages = q.messages[1:]
+		return q, m
+	}
+	return nil, nil
+}
+
+// deliver runs the handler like the consumer does, a panic of the handler nacks the message
+func deliver(queueName string, handler rmqclient.HandlerFunc, delivery amqp.Delivery) (acked bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			logrus.Errorf("Panic recovered: queue=%s, error=%s", queueName, err)
+			acked = false
+		}
+	}()
+	ctx := context.WithValue(context.Background(), rmqclient.QueueNameKey, queueName)
+	return handler(ctx, delivery)
+}
+
+// xDeathHeaders returns headers of the dead-lettered message, x-death holds an entry per queue and reason
+// with the most recent first like RabbitMQ does
+func xDeathHeaders(delivery amqp.Delivery, queueName string, reason string, now time.Time) amqp.Table {
+	headers := amqp.Table{}
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+
+	entry := amqp.Table{
+		"count":        int64(1),
+		"reason":       reason,
+		"queue":        queueName,
+		"time":         now,
+		"exchange":     delivery.Exchange,
+		"routing-keys": []interface{}{delivery.RoutingKey},
+	}
+	if delivery.Expiration != "" {
+		entry["original-expiration"] = delivery.Expiration
+	}
+
+	deaths := []interface{}{entry}
+	existing, _ := headers["x-death"].([]interface{})
+	for _, value := range existing {
+		death, ok := value.(amqp.Table)
+		if !ok {
+			continue
+		}
+		if death["queue"] == queueName && death["reason"] == reason {
+			count, _ := death["count"].(int64)
+			entry["count"] = count + 1
+			continue
+		}
+		deaths = append(deaths, death)
+	}
+	headers["x-death"] = deaths
+
+	if _, ok := headers["x-first-death-queue"]; !ok {
+		headers["x-first-death-queue"] = queueName
+		headers["x-first-death-reason"] = reason
+		headers["x-first-death-exchange"] = delivery.Exchange
+	}
+	return headers
+}
+
+// DeathCount returns the number of times the message was dead-lettered from the queue for the reason
+func DeathCount(delivery amqp.Delivery, queueName string, reason string) int64 {
+	deaths, _ := delivery.Headers["x-death"].([]interface{})
+	for _, value := range deaths {
+		death, ok := value.(amqp.Table)
+		if ok && death["queue"] == queueName && death["reason"] == reason {
+			count, _ := death["count"].(int64)
+			return count
+		}
+	}
+	return 0
+}
+
+// routes returns true if the exchange of the kind routes routingKey to the binding with bindingKey
+func routes(kind string, bindingKey string, routingKey string) bool {
+	switch kind {
+	case amqp.ExchangeFanout:
+		return true
+	case amqp.ExchangeTopic:
+		return topicMatch(strings.Split(bindingKey, "."), strings.Split(routingKey, "."))
+	default:
+		return bindingKey == routingKey
+	}
+}
+
+// topicMatch matches words of the routing key, * matches one word and # matches zero or more words
+func topicMatch(pattern []string, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if topicMatch(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && topicMatch(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && topicMatch(pattern[1:], words[1:])
+	}
+}
+
+func milliseconds(value interface{}) (time.Duration, error) {
+	var ms int64
+	switch v := value.(type) {
+	case int:
+		ms = int64(v)
+	case int32:
+		ms = int64(v)
+	case int64:
+		ms = v
+	default:
+		return 0, fmt.Errorf("unsupported type %T", value)
+	}
+	if ms < 0 {
+		return 0, fmt.Errorf("negative value %d", ms)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
@@ -0,0 +1,216 @@
+package rmqtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/pkg/rmq"
+	rmqclient "github.com/zaharinea/go-rmq-client"
+)
+
+type BrokerSuite struct {
+	suite.Suite
+	broker   *Broker
+	received map[string][]string
+	ack      bool
+}
+
+func (s *BrokerSuite) SetupTest() {
+	s.broker = NewBroker()
+	s.received = map[string][]string{}
+	s.ack = true
+}
+
+func (s *BrokerSuite) handler(name string) rmqclient.HandlerFunc {
+	return func(ctx context.Context, msg amqp.Delivery) bool {
+		s.received[name] = append(s.received[name], string(msg.Body))
+		return s.ack
+	}
+}
+
+func (s *BrokerSuite) publish(exchange string, routingKey string, body string) {
+	s.Require().NoError(s.broker.Publish(exchange, routingKey, amqp.Publishing{Body: []byte(body)}))
+}
+
+func (s *BrokerSuite) TestDirectExchange() {
+	s.broker.RegisterExchange(&rmq.Exchange{Name: "events", Kind: amqp.ExchangeDirect, Queues: []*rmq.Queue{
+		{Name: "q1", RoutingKey: "a", Handler: s.handler("q1")},
+		{Name: "q2", RoutingKey: "b", Handler: s.handler("q2")},
+	}})
+	s.broker.Start()
+
+	s.publish("events", "a", "1")
+	s.publish("events", "c", "2")
+	s.Require().Equal(map[string][]string{"q1": {"1"}}, s.received)
+}
+
+func (s *BrokerSuite) TestFanoutExchange() {
+	s.broker.RegisterExchange(&rmq.Exchange{Name: "events", Kind: amqp.ExchangeFanout, Queues: []*rmq.Queue{
+		{Name: "q1", RoutingKey: "a", Handler: s.handler("q1")},
+		{Name: "q2", Handler: s.handler("q2")},
+	}})
+	s.broker.Start()
+
+	s.publish("events", "b", "1")
+	s.Require().Equal(map[string][]string{"q1": {"1"}, "q2": {"1"}}, s.received)
+}
+
+func (s *BrokerSuite) TestTopicExchange() {
+	s.broker.RegisterExchange(&rmq.Exchange{Name: "events", Kind: amqp.ExchangeTopic, Queues: []*rmq.Queue{
+		{Name: "q1", RoutingKey: "accounts.*", Handler: s.handler("q1")},
+		{Name: "q2", RoutingKey: "#.deleted", Handler: s.handler("q2")},
+	}})
+	s.broker.Start()
+
+	s.publish("events", "accounts.updated", "1")
+	s.publish("events", "accounts.users.deleted", "2")
+	s.publish("events", "accounts.deleted", "3")
+	s.Require().Equal(map[string][]string{"q1": {"1", "3"}, "q2": {"2", "3"}}, s.received)
+}
+
+func (s *BrokerSuite) TestDefaultExchange() {
+	s.broker.RegisterQueue(&rmq.Queue{Name: "q1", Handler: s.handler("q1")}, &rmq.Queue{Name: "q2"})
+	s.broker.Start()
+
+	s.publish("", "q1", "1")
+	s.publish("", "q2", "2")
+	s.publish("", "unknown", "3")
+	s.Require().Equal(map[string][]string{"q1": {"1"}}, s.received)
+	s.Require().Len(s.broker.Messages("q2"), 1)
+}
+
+func (s *BrokerSuite) TestUnknownExchange() {
+	err := s.broker.Publish("unknown", "", amqp.Publishing{})
+	var amqpErr *amqp.Error
+	s.Require().True(errors.As(err, &amqpErr))
+	s.Require().Equal(amqp.NotFound, amqpErr.Code)
+}
+
+func (s *BrokerSuite) TestStoppedBrokerKeepsMessages() {
+	s.broker.RegisterQueue(&rmq.Queue{Name: "q1", Handler: s.handler("q1")})
+
+	s.publish("", "q1", "1")
+	s.Require().Empty(s.received)
+	s.Require().Len(s.broker.Messages("q1"), 1)
+
+	s.broker.Start()
+	s.Require().Equal(map[string][]string{"q1": {"1"}}, s.received)
+	s.Require().Empty(s.broker.Messages("q1"))
+
+	s.Require().NoError(s.broker.Stop())
+	s.publish("", "q1", "2")
+	s.Require().Len(s.broker.Messages("q1"), 1)
+}
+
+func (s *BrokerSuite) TestRejectedMessageIsDeadLettered() {
+	s.broker.RegisterQueue(
+		&rmq.Queue{Name: "q1", Arguments: amqp.Table{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": "q1-failed"}, Handler: s.handler("q1")},
+		&rmq.Queue{Name: "q1-failed"},
+	)
+	s.broker.Start()
+	s.ack = false
+
+	s.Require().False(s.broker.Deliver("q1", amqp.Delivery{Body: []byte("1")}))
+	messages := s.broker.Messages("q1-failed")
+	s.Require().Len(messages, 1)
+	s.Require().Equal("1", string(messages[0].Body))
+	s.Require().Equal("q1-failed", messages[0].RoutingKey)
+	s.Require().Equal(int64(1), DeathCount(messages[0], "q1", ReasonRejected))
+	s.Require().Equal("q1", messages[0].Headers["x-first-death-queue"])
+}
+
+func (s *BrokerSuite) TestRejectedMessageWithoutDeadLetterExchangeIsDropped() {
+	s.broker.RegisterQueue(&rmq.Queue{Name: "q1", Handler: s.handler("q1")})
+	s.broker.Start()
+	s.ack = false
+
+	s.Require().False(s.broker.Deliver("q1", amqp.Delivery{Body: []byte("1")}))
+	s.Require().Empty(s.broker.Messages("q1"))
+}
+
+func (s *BrokerSuite) TestQueueTTL() {
+	s.broker.RegisterQueue(
+		&rmq.Queue{Name: "delayed", Arguments: amqp.Table{"x-message-ttl": 1000, "x-dead-letter-exchange": "", "x-dead-letter-routing-key": "q1"}},
+		&rmq.Queue{Name: "q1", Handler: s.handler("q1")},
+	)
+	s.broker.Start()
+
+	s.publish("", "delayed", "1")
+	s.broker.Advance(999 * time.Millisecond)
+	s.Require().Empty(s.received)
+
+	s.broker.Advance(time.Millisecond)
+	s.Require().Equal(map[string][]string{"q1": {"1"}}, s.received)
+	s.Require().Empty(s.broker.Messages("delayed"))
+}
+
+func (s *BrokerSuite) TestMessageExpiration() {
+	s.broker.RegisterQueue(
+		&rmq.Queue{Name: "delayed", Arguments: amqp.Table{"x-message-ttl": 1000, "x-dead-letter-exchange": "", "x-dead-letter-routing-key": "expired"}},
+		&rmq.Queue{Name: "expired"},
+	)
+	s.Require().NoError(s.broker.Publish("", "delayed", amqp.Publishing{Body: []byte("1"), Expiration: "100"}))
+
+	s.broker.Advance(100 * time.Millisecond)
+	messages := s.broker.Messages("expired")
+	s.Require().Len(messages, 1)
+	s.Require().Empty(messages[0].Expiration)
+	s.Require().Equal(int64(1), DeathCount(messages[0], "delayed", ReasonExpired))
+}
+
+func (s *BrokerSuite) TestRetryThroughDelayedQueue() {
+	s.broker.RegisterQueue(
+		&rmq.Queue{Name: "q1", Arguments: amqp.Table{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": "q1-failed"}, Handler: s.handler("q1")},
+		&rmq.Queue{Name: "q1-failed", Arguments: amqp.Table{"x-message-ttl": 1000, "x-dead-letter-exchange": "", "x-dead-letter-routing-key": "q1"}},
+	)
+	s.broker.Start()
+	s.ack = false
+
+	s.publish("", "q1", "1")
+	s.broker.Advance(time.Second)
+	messages := s.broker.Messages("q1-failed")
+	s.Require().Len(messages, 1)
+	s.Require().Equal(int64(2), DeathCount(messages[0], "q1", ReasonRejected))
+	s.Require().Equal(int64(1), DeathCount(messages[0], "q1-failed", ReasonExpired))
+
+	s.ack = true
+	s.broker.Advance(time.Second)
+	s.Require().Equal(map[string][]string{"q1": {"1", "1", "1"}}, s.received)
+	s.Require().Empty(s.broker.Messages("q1-failed"))
+}
+
+func (s *BrokerSuite) TestMiddlewaresAndPanic() {
+	var calls []string
+	middleware := func(name string) rmqclient.MiddlewareFunc {
+		return func(next rmqclient.HandlerFunc) rmqclient.HandlerFunc {
+			return func(ctx context.Context, msg amqp.Delivery) bool {
+				calls = append(calls, name+":"+ctx.Value(rmqclient.QueueNameKey).(string))
+				return next(ctx, msg)
+			}
+		}
+	}
+	s.broker.RegisterQueue(&rmq.Queue{Name: "q1", Handler: func(ctx context.Context, msg amqp.Delivery) bool {
+		panic("failed")
+	}})
+	s.broker.RegisterMiddleware(middleware("first"), middleware("second"))
+	s.broker.Start()
+
+	s.Require().False(s.broker.Deliver("q1", amqp.Delivery{}))
+	s.Require().Equal([]string{"first:q1", "second:q1"}, calls)
+}
+
+func (s *BrokerSuite) TestPurge() {
+	s.broker.RegisterQueue(&rmq.Queue{Name: "q1"})
+	s.publish("", "q1", "1")
+
+	s.broker.Purge()
+	s.Require().Empty(s.broker.Messages("q1"))
+}
+
+func TestBrokerSuite(t *testing.T) {
+	suite.Run(t, new(BrokerSuite))
+}
@@ -0,0 +1,100 @@
+package rmq_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/repository/memory"
+	"github.com/zaharinea/go-example/pkg/rmq"
+	"github.com/zaharinea/go-example/pkg/rmq/rmqtest"
+)
+
+const (
+	accountsQueue       = "go-example-accounts"
+	accountsFailedQueue = "go-example-accounts-failed"
+)
+
+type TopologySuite struct {
+	suite.Suite
+	ctx    context.Context
+	repos  *repository.Repository
+	broker *rmqtest.Broker
+}
+
+func (s *TopologySuite) SetupTest() {
+	s.ctx = context.Background()
+	s.repos = memory.NewRepository(clock.System{}, idgen.NewSequence())
+	s.broker = rmqtest.NewBroker()
+	c := &config.Config{AccountDeletePolicy: config.AccountDeletePolicyBlock}
+	rmq.SetupExchangesAndQueues(s.broker, rmq.NewHandler(c, s.repos))
+	s.broker.Start()
+}
+
+func (s *TopologySuite) TestCompanyEventsFanout() {
+	s.Require().NoError(s.broker.Publish("events.companies", "any", amqp.Publishing{MessageId: "1", Body: []byte(`{"id":"1"}`)}))
+	s.Require().Empty(s.broker.Messages("go-example-companies"))
+
+	exists, err := s.repos.Inbox.Exists(s.ctx, "go-example-companies", "1")
+	s.Require().NoError(err)
+	s.Require().True(exists)
+}
+
+func (s *TopologySuite) TestFailedAccountEventIsRetriedAfterTTL() {
+	_, err := s.repos.Account.CreateOrUpdate(s.ctx, domain.Account{ExternalID: "1", Name: "account1"}, true)
+	s.Require().NoError(err)
+	user := domain.User{Name: "user1", AccountExternalID: "1"}
+	s.Require().NoError(s.repos.User.Create(s.ctx, &user))
+
+	event := amqp.Delivery{Body: []byte(`{"message_id":"1","event_type":"account.deleted","external_id":"1","deleted_at":"2020-11-22T00:00:00.000Z"}`)}
+	s.Require().False(s.broker.Deliver(accountsQueue, event))
+
+	messages := s.broker.Messages(accountsFailedQueue)
+	s.Require().Len(messages, 1)
+	s.Require().Equal(int64(1), rmqtest.DeathCount(messages[0], accountsQueue, rmqtest.ReasonRejected))
+
+	s.broker.Advance(59 * time.Second)
+	s.Require().Len(s.broker.Messages(accountsFailedQueue), 1)
+
+	s.Require().NoError(s.repos.User.DeleteByID(s.ctx, user.ID))
+	s.broker.Advance(time.Second)
+	s.Require().Empty(s.broker.Messages(accountsFailedQueue))
+	s.Require().Empty(s.broker.Messages(accountsQueue))
+
+	_, err = s.repos.Account.GetByExternalID(s.ctx, "1")
+	s.Require().Equal(domain.ErrNotFound, err)
+}
+
+func (s *TopologySuite) TestFailedAccountEventIsRetriedUntilProcessed() {
+	s.Require().False(s.broker.Deliver(accountsQueue, amqp.Delivery{Body: []byte(`{"external_id":1}`)}))
+
+	s.broker.Advance(time.Minute)
+	s.broker.Advance(time.Minute)
+	messages := s.broker.Messages(accountsFailedQueue)
+	s.Require().Len(messages, 1)
+	s.Require().Equal(int64(3), rmqtest.DeathCount(messages[0], accountsQueue, rmqtest.ReasonRejected))
+	s.Require().Equal(int64(2), rmqtest.DeathCount(messages[0], accountsFailedQueue, rmqtest.ReasonExpired))
+}
+
+func (s *TopologySuite) TestStoppedConsumerKeepsEvents() {
+	s.Require().NoError(s.broker.Stop())
+	s.Require().NoError(s.broker.Publish("", accountsQueue, amqp.Publishing{Body: []byte(`{"external_id":"1","name":"account1"}`)}))
+	s.Require().Len(s.broker.Messages(accountsQueue), 1)
+
+	s.broker.Start()
+	s.Require().Empty(s.broker.Messages(accountsQueue))
+	account, err := s.repos.Account.GetByExternalID(s.ctx, "1")
+	s.Require().NoError(err)
+	s.Require().Equal("account1", account.Name)
+}
+
+func TestTopologySuite(t *testing.T) {
+	suite.Run(t, new(TopologySuite))
+}
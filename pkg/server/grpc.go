@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/zaharinea/go-example/config"
+	"google.golang.org/grpc"
+)
+
+// GRPCServer struct
+type GRPCServer struct {
+	addr      string
+	tlsConfig *tls.Config
+	grpc      *grpc.Server
+}
+
+// NewGRPCServer returns a new GRPCServer struct serving srv on GRPCAddr with TLS from the config
+func NewGRPCServer(c *config.Config, srv *grpc.Server) (*GRPCServer, error) {
+	tlsConfig, err := NewTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		// gRPC clients require HTTP/2 to be negotiated by ALPN
+		tlsConfig.NextProtos = []string{"h2"}
+	}
+	return &GRPCServer{addr: c.GRPCAddr, tlsConfig: tlsConfig, grpc: srv}, nil
+}
+
+// ListenAndServe serves over TLS if it is configured, otherwise over plain TCP
+func (s *GRPCServer) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+	return s.grpc.Serve(listener)
+}
+
+// Shutdown gracefully stops the server, pending calls are cancelled when ctx is done
+func (s *GRPCServer) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		<-stopped
+		return ctx.Err()
+	}
+}
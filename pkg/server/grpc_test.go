@@ -0,0 +1,30 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaharinea/go-example/config"
+	"google.golang.org/grpc"
+)
+
+func TestGRPCServerShutdown(t *testing.T) {
+	srv, err := NewGRPCServer(&config.Config{GRPCAddr: "127.0.0.1:0"}, grpc.NewServer())
+	require.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, srv.Shutdown(ctx))
+
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("ListenAndServe did not return after Shutdown")
+	}
+}
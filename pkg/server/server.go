@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/zaharinea/go-example/config"
+)
+
+// Server struct
+type Server struct {
+	http *http.Server
+}
+
+// NewServer returns a new Server struct serving handler on AppAddr with timeouts and TLS from the config
+func NewServer(c *config.Config, handler http.Handler) (*Server, error) {
+	tlsConfig, err := NewTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{http: &http.Server{
+		Addr:           c.AppAddr,
+		Handler:        handler,
+		TLSConfig:      tlsConfig,
+		ReadTimeout:    c.HTTPReadTimeout,
+		WriteTimeout:   c.HTTPWriteTimeout,
+		IdleTimeout:    c.HTTPIdleTimeout,
+		MaxHeaderBytes: int(c.HTTPMaxHeaderBytes),
+	}}, nil
+}
+
+// NewAdminServer returns a new Server struct serving handler on AdminAddr over plain HTTP,
+// it has no write timeout so that long pprof profiles can be collected
+func NewAdminServer(c *config.Config, handler http.Handler) *Server {
+	return &Server{http: &http.Server{
+		Addr:           c.AdminAddr,
+		Handler:        handler,
+		ReadTimeout:    c.HTTPReadTimeout,
+		IdleTimeout:    c.HTTPIdleTimeout,
+		MaxHeaderBytes: int(c.HTTPMaxHeaderBytes),
+	}}
+}
+
+// ListenAndServe serves HTTPS if TLS is configured, otherwise HTTP
+func (s *Server) ListenAndServe() error {
+	if s.http.TLSConfig != nil {
+		return s.http.ListenAndServeTLS("", "")
+	}
+	return s.http.ListenAndServe()
+}
+
+// Shutdown gracefully shuts down the server
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
+}
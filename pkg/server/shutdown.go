@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Phase is a step of the graceful shutdown
+type Phase struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// PhaseResult is the outcome of a Phase
+type PhaseResult struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// Shutdown runs phases in order, each one with its own timeout, a failed phase does not stop the following ones
+func Shutdown(phases ...Phase) []PhaseResult {
+	results := make([]PhaseResult, 0, len(phases))
+	for _, phase := range phases {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), phase.Timeout)
+		err := phase.Run(ctx)
+		cancel()
+
+		result := PhaseResult{Name: phase.Name, Duration: time.Since(start), Err: err}
+		if err != nil {
+			logrus.Errorf("Shutdown phase %s failed in %s: %s", result.Name, result.Duration, err)
+		} else {
+			logrus.Infof("Shutdown phase %s completed in %s", result.Name, result.Duration)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Failed returns true if any phase failed
+func Failed(results []PhaseResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return true
+		}
+	}
+	return false
+}
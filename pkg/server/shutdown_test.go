@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdown(t *testing.T) {
+	var order []string
+	errFailed := errors.New("failed")
+
+	results := Shutdown(
+		Phase{Name: "slow", Timeout: 10 * time.Millisecond, Run: func(ctx context.Context) error {
+			order = append(order, "slow")
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		Phase{Name: "failed", Timeout: time.Second, Run: func(ctx context.Context) error {
+			order = append(order, "failed")
+			return errFailed
+		}},
+		Phase{Name: "ok", Timeout: time.Second, Run: func(ctx context.Context) error {
+			order = append(order, "ok")
+			// the expired timeout of the previous phases does not affect this one
+			return ctx.Err()
+		}},
+	)
+
+	assert.Equal(t, []string{"slow", "failed", "ok"}, order)
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, context.DeadlineExceeded, results[0].Err)
+	assert.Equal(t, errFailed, results[1].Err)
+	assert.NoError(t, results[2].Err)
+	assert.True(t, Failed(results))
+	assert.False(t, Failed(results[2:]))
+}
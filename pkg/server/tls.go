@@ -0,0 +1,124 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zaharinea/go-example/config"
+)
+
+const certCheckInterval = 10 * time.Second
+
+// CertReloader serves the certificate and reloads it when the certificate or the key file changes
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+	now       func() time.Time
+}
+
+// NewCertReloader returns a new CertReloader struct with the loaded certificate
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, now: time.Now}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) lastModTime() (time.Time, error) {
+	var modTime time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTime, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+func (r *CertReloader) reload() error {
+	modTime, err := r.lastModTime()
+	if err != nil {
+		return fmt.Errorf("failed load certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed load certificate: %w", err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// GetCertificate returns the certificate, it is checked for changes at most every 10 seconds
+// and the previous certificate is kept if the new one is invalid
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if now.Sub(r.checkedAt) < certCheckInterval {
+		return r.cert, nil
+	}
+	r.checkedAt = now
+
+	modTime, err := r.lastModTime()
+	if err != nil || !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+	if err := r.reload(); err != nil {
+		logrus.Errorf("Certificate reload failed: %s", err)
+		return r.cert, nil
+	}
+	logrus.Infof("Certificate reloaded: %s", r.certFile)
+	return r.cert, nil
+}
+
+// NewTLSConfig returns the TLS config of the server, nil if TLS is disabled
+func NewTLSConfig(c *config.Config) (*tls.Config, error) {
+	if !c.TLSEnabled() {
+		return nil, nil
+	}
+
+	reloader, err := NewCertReloader(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	switch c.TLSClientAuth {
+	case config.TLSClientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.TLSClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return tlsConfig, nil
+	}
+
+	caData, err := ioutil.ReadFile(c.TLSClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed load client CA: %w", err)
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("failed load client CA: no certificates in %s", c.TLSClientCAFile)
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaharinea/go-example/config"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, commonName string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"go-example"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	} else {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeTestCert(t *testing.T, dir string, name string, cert *testCert) (string, string) {
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	require.NoError(t, ioutil.WriteFile(certFile, cert.certPEM, 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, cert.keyPEM, 0600))
+	return certFile, keyFile
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "server")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := tempDir(t)
+	ca := newTestCert(t, "ca", nil)
+	certFile, keyFile := writeTestCert(t, dir, "server", newTestCert(t, "server1", ca))
+
+	r, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	assert.Equal(t, "server1", leaf.Subject.CommonName)
+
+	writeTestCert(t, dir, "server", newTestCert(t, "server2", ca))
+	future := now.Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, "server1", leaf.Subject.CommonName, "files are not checked more often than every 10 seconds")
+
+	now = now.Add(certCheckInterval)
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, "server2", leaf.Subject.CommonName)
+
+	require.NoError(t, ioutil.WriteFile(certFile, []byte("invalid"), 0600))
+	later := future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	now = now.Add(certCheckInterval)
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, "server2", leaf.Subject.CommonName, "invalid certificate is not applied")
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := tempDir(t)
+	ca := newTestCert(t, "ca", nil)
+	certFile, keyFile := writeTestCert(t, dir, "server", newTestCert(t, "localhost", ca))
+	caFile, _ := writeTestCert(t, dir, "ca", ca)
+
+	tlsConfig, err := NewTLSConfig(&config.Config{
+		TLSCertFile:     certFile,
+		TLSKeyFile:      keyFile,
+		TLSClientCAFile: caFile,
+		TLSClientAuth:   config.TLSClientAuthRequire,
+	})
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+	}))
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs, ServerName: "localhost"}}}
+	}
+
+	_, err = newClient().Get(srv.URL)
+	assert.Error(t, err, "client certificate is required")
+
+	client := newTestCert(t, "client1", ca)
+	clientCert, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	require.NoError(t, err)
+	resp, err := newClient(clientCert).Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "client1", string(body))
+}
+
+func TestNewTLSConfigDisabled(t *testing.T) {
+	tlsConfig, err := NewTLSConfig(&config.Config{})
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/repository"
+)
+
+// AccountService struct, accounts are read-only for the API as they are synchronized from RabbitMQ
+type AccountService struct {
+	repo repository.IAccountRepository
+}
+
+// NewAccountService returns a new AccountService struct
+func NewAccountService(repo repository.IAccountRepository) *AccountService {
+	return &AccountService{repo: repo}
+}
+
+// List method
+func (s *AccountService) List(ctx context.Context, limit int64, offset int64) ([]*domain.Account, error) {
+	accounts, err := s.repo.List(ctx, limit, offset)
+	return accounts, translateErr(err, ErrAccountNotFound)
+}
+
+// GetByExternalID method
+func (s *AccountService) GetByExternalID(ctx context.Context, accountExternalID string) (*domain.Account, error) {
+	account, err := s.repo.GetByExternalID(ctx, accountExternalID)
+	return account, translateErr(err, ErrAccountNotFound)
+}
+
+// ListByExternalIDs method, missing accounts are skipped
+func (s *AccountService) ListByExternalIDs(ctx context.Context, accountExternalIDs []string) ([]*domain.Account, error) {
+	accounts, err := s.repo.ListByExternalIDs(ctx, accountExternalIDs)
+	return accounts, translateErr(err, ErrAccountNotFound)
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"context"
+
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/repository"
+)
+
+// MigrationService struct
+type MigrationService struct {
+	repo repository.IMigrationRepository
+}
+
+// NewMigrationService returns a new MigrationService struct
+func NewMigrationService(repo repository.IMigrationRepository) *MigrationService {
+	return &MigrationService{repo: repo}
+}
+
+//Status method
+func (s *MigrationService) Status(ctx context.Context) (*domain.MigrationStatus, error) {
+	return s.repo.Status(ctx)
+}
@@ -2,28 +2,61 @@ package service
 
 import (
 	"context"
+	"time"
 
+	"github.com/zaharinea/go-example/pkg/domain"
 	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/webhook"
 )
 
 // IUserService interface
 type IUserService interface {
-	Create(ctx context.Context, user *repository.User) error
-	List(ctx context.Context, limit int64, offset int64) ([]*repository.User, error)
-	GetByID(ctx context.Context, userID string) (*repository.User, error)
-	Update(ctx context.Context, userID string, update repository.UpdateUser) error
-	UpdateAndReturn(ctx context.Context, userID string, update repository.UpdateUser) (*repository.User, error)
+	Create(ctx context.Context, user *domain.User) error
+	List(ctx context.Context, limit int64, offset int64) ([]*domain.User, error)
+	ListByAccount(ctx context.Context, accountExternalID string, limit int64, offset int64) ([]*domain.User, error)
+	GetByID(ctx context.Context, userID string) (*domain.User, error)
+	Update(ctx context.Context, userID string, update domain.UpdateUser) error
+	UpdateAndReturn(ctx context.Context, userID string, update domain.UpdateUser) (*domain.User, error)
 	DeleteByID(ctx context.Context, userID string) error
+	Watch(ctx context.Context, resumeToken string, maxAwait time.Duration) (repository.IUserChangeStream, error)
+}
+
+// IAccountService interface
+type IAccountService interface {
+	List(ctx context.Context, limit int64, offset int64) ([]*domain.Account, error)
+	GetByExternalID(ctx context.Context, accountExternalID string) (*domain.Account, error)
+	ListByExternalIDs(ctx context.Context, accountExternalIDs []string) ([]*domain.Account, error)
+}
+
+// IWebhookService interface
+type IWebhookService interface {
+	Create(ctx context.Context, webhook *domain.Webhook) error
+	List(ctx context.Context, limit int64, offset int64) ([]*domain.Webhook, error)
+	GetByID(ctx context.Context, webhookID string) (*domain.Webhook, error)
+	Update(ctx context.Context, webhookID string, update domain.UpdateWebhook) (*domain.Webhook, error)
+	DeleteByID(ctx context.Context, webhookID string) error
+	ListDeliveries(ctx context.Context, webhookID string, limit int64, offset int64) ([]*domain.WebhookDelivery, error)
+}
+
+// IMigrationService interface
+type IMigrationService interface {
+	Status(ctx context.Context) (*domain.MigrationStatus, error)
 }
 
 // Service struct
 type Service struct {
-	User IUserService
+	User      IUserService
+	Account   IAccountService
+	Webhook   IWebhookService
+	Migration IMigrationService
 }
 
 // NewService returns a new Service struct
 func NewService(repos *repository.Repository) *Service {
 	return &Service{
-		User: NewUserService(repos.User),
+		User:      NewUserService(repos.User, repos.Account, repos.Transactor, webhook.NewPublisher(repos)),
+		Account:   NewAccountService(repos.Account),
+		Webhook:   NewWebhookService(repos.Webhook, repos.WebhookDelivery, repos.Transactor),
+		Migration: NewMigrationService(repos.Migration),
 	}
 }
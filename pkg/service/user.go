@@ -2,46 +2,171 @@ package service
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/zaharinea/go-example/pkg/apperror"
+	"github.com/zaharinea/go-example/pkg/domain"
 	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/tenant"
+	"github.com/zaharinea/go-example/pkg/webhook"
 )
 
-// UserService struct
+// Errors returned by UserService
+var (
+	ErrUserNotFound    = apperror.NotFound("user_not_found", "Not found user")
+	ErrAccountNotFound = apperror.NotFound("account_not_found", "Not found account")
+	ErrUnknownAccount  = apperror.Validation("unknown_account", "Not found account", apperror.FieldError{
+		Field: "account_external_id", Code: "exists", Message: "account_external_id refers to an account that does not exist",
+	})
+	ErrTenantMismatch     = apperror.Forbidden("tenant_mismatch", "Tenant mismatch")
+	ErrInvalidResumeToken = apperror.Validation("invalid_resume_token", "Stream can not be resumed from the event ID")
+)
+
+// translateErr translates repository errors to errors returned by the service
+func translateErr(err error, notFound *apperror.Error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, domain.ErrNotFound):
+		return notFound.Wrap(err)
+	case errors.Is(err, domain.ErrTenantMismatch):
+		return ErrTenantMismatch.Wrap(err)
+	case errors.Is(err, domain.ErrInvalidResumeToken):
+		return ErrInvalidResumeToken.Wrap(err)
+	default:
+		return err
+	}
+}
+
+// UserService struct, changes of users are published to webhooks in the transaction of the change,
+// so with MongoDB repositories it requires a replica set
 type UserService struct {
-	repo repository.IUserRepository
+	repo        repository.IUserRepository
+	accountRepo repository.IAccountRepository
+	transactor  repository.ITransactor
+	publisher   webhook.IPublisher
 }
 
 // NewUserService returns a new UserService struct
-func NewUserService(repo repository.IUserRepository) *UserService {
-	return &UserService{repo: repo}
+func NewUserService(repo repository.IUserRepository, accountRepo repository.IAccountRepository, transactor repository.ITransactor, publisher webhook.IPublisher) *UserService {
+	return &UserService{repo: repo, accountRepo: accountRepo, transactor: transactor, publisher: publisher}
 }
 
-//Create method
-func (s *UserService) Create(ctx context.Context, user *repository.User) error {
-	return s.repo.Create(ctx, user)
+// checkUserAccount checks the account written to a user: a tenant writes users of its own account only
+func (s *UserService) checkUserAccount(ctx context.Context, accountExternalID string) error {
+	if tenantID, ok := tenant.FromContext(ctx); ok && accountExternalID != "" && accountExternalID != tenantID {
+		return ErrTenantMismatch
+	}
+	return s.checkAccountExists(ctx, accountExternalID, ErrUnknownAccount)
+}
+
+func (s *UserService) checkAccountExists(ctx context.Context, accountExternalID string, notFound *apperror.Error) error {
+	if accountExternalID == "" {
+		return nil
+	}
+
+	_, err := s.accountRepo.GetByExternalID(ctx, accountExternalID)
+	return translateErr(err, notFound)
+}
+
+//Create method, a user created by a tenant without an account belongs to the tenant's account
+func (s *UserService) Create(ctx context.Context, user *domain.User) error {
+	if tenantID, ok := tenant.FromContext(ctx); ok && user.AccountExternalID == "" {
+		user.AccountExternalID = tenantID
+	}
+	if err := s.checkUserAccount(ctx, user.AccountExternalID); err != nil {
+		return err
+	}
+	err := s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, user); err != nil {
+			return err
+		}
+		return s.publisher.Publish(ctx, webhook.UserEvent(domain.EventUserCreated, user))
+	})
+	return translateErr(err, ErrUserNotFound)
 }
 
 //List method
-func (s *UserService) List(ctx context.Context, limit int64, offset int64) ([]*repository.User, error) {
-	return s.repo.List(ctx, limit, offset)
+func (s *UserService) List(ctx context.Context, limit int64, offset int64) ([]*domain.User, error) {
+	users, err := s.repo.List(ctx, limit, offset)
+	return users, translateErr(err, ErrUserNotFound)
+}
+
+//ListByAccount method
+func (s *UserService) ListByAccount(ctx context.Context, accountExternalID string, limit int64, offset int64) ([]*domain.User, error) {
+	if err := s.checkAccountExists(ctx, accountExternalID, ErrAccountNotFound); err != nil {
+		return nil, err
+	}
+	users, err := s.repo.ListByAccountExternalID(ctx, accountExternalID, limit, offset)
+	return users, translateErr(err, ErrUserNotFound)
 }
 
 //GetByID method
-func (s *UserService) GetByID(ctx context.Context, userID string) (*repository.User, error) {
-	return s.repo.GetByID(ctx, userID)
+func (s *UserService) GetByID(ctx context.Context, userID string) (*domain.User, error) {
+	user, err := s.repo.GetByID(ctx, userID)
+	return user, translateErr(err, ErrUserNotFound)
 }
 
 //Update method
-func (s *UserService) Update(ctx context.Context, userID string, update repository.UpdateUser) error {
-	return s.repo.Update(ctx, userID, update)
+func (s *UserService) Update(ctx context.Context, userID string, update domain.UpdateUser) error {
+	if err := s.checkUserAccount(ctx, update.AccountExternalID); err != nil {
+		return err
+	}
+	err := s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := s.updateAndPublish(ctx, userID, update)
+		if errors.Is(err, domain.ErrNotFound) {
+			// Update of a missing user is not an error, the repository reports invalid IDs only
+			return s.repo.Update(ctx, userID, update)
+		}
+		return err
+	})
+	return translateErr(err, ErrUserNotFound)
 }
 
 //UpdateAndReturn method
-func (s *UserService) UpdateAndReturn(ctx context.Context, userID string, update repository.UpdateUser) (*repository.User, error) {
-	return s.repo.UpdateAndReturn(ctx, userID, update)
+func (s *UserService) UpdateAndReturn(ctx context.Context, userID string, update domain.UpdateUser) (*domain.User, error) {
+	if err := s.checkUserAccount(ctx, update.AccountExternalID); err != nil {
+		return nil, err
+	}
+	var user *domain.User
+	err := s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = s.updateAndPublish(ctx, userID, update)
+		return err
+	})
+	if err != nil {
+		return nil, translateErr(err, ErrUserNotFound)
+	}
+	return user, nil
+}
+
+func (s *UserService) updateAndPublish(ctx context.Context, userID string, update domain.UpdateUser) (*domain.User, error) {
+	user, err := s.repo.UpdateAndReturn(ctx, userID, update)
+	if err != nil {
+		return nil, err
+	}
+	return user, s.publisher.Publish(ctx, webhook.UserEvent(domain.EventUserUpdated, user))
 }
 
 //DeleteByID method
 func (s *UserService) DeleteByID(ctx context.Context, userID string) error {
-	return s.repo.DeleteByID(ctx, userID)
+	err := s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		// the deleted user is read first, its account routes the event to webhooks of the tenant
+		user, err := s.repo.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.DeleteByID(ctx, userID); err != nil {
+			return err
+		}
+		return s.publisher.Publish(ctx, webhook.UserEvent(domain.EventUserDeleted, user))
+	})
+	return translateErr(err, ErrUserNotFound)
+}
+
+//Watch method
+func (s *UserService) Watch(ctx context.Context, resumeToken string, maxAwait time.Duration) (repository.IUserChangeStream, error) {
+	stream, err := s.repo.Watch(ctx, resumeToken, maxAwait)
+	return stream, translateErr(err, ErrUserNotFound)
 }
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+
+	"github.com/zaharinea/go-example/pkg/apperror"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/repository"
+)
+
+// Errors returned by WebhookService
+var (
+	ErrWebhookNotFound = apperror.NotFound("webhook_not_found", "Not found webhook")
+)
+
+// WebhookService struct, webhooks of a tenant and their deliveries are visible to the tenant only
+type WebhookService struct {
+	repo         repository.IWebhookRepository
+	deliveryRepo repository.IWebhookDeliveryRepository
+	transactor   repository.ITransactor
+}
+
+// NewWebhookService returns a new WebhookService struct
+func NewWebhookService(repo repository.IWebhookRepository, deliveryRepo repository.IWebhookDeliveryRepository, transactor repository.ITransactor) *WebhookService {
+	return &WebhookService{repo: repo, deliveryRepo: deliveryRepo, transactor: transactor}
+}
+
+// Create method
+func (s *WebhookService) Create(ctx context.Context, webhook *domain.Webhook) error {
+	return translateErr(s.repo.Create(ctx, webhook), ErrWebhookNotFound)
+}
+
+// List method
+func (s *WebhookService) List(ctx context.Context, limit int64, offset int64) ([]*domain.Webhook, error) {
+	webhooks, err := s.repo.List(ctx, limit, offset)
+	return webhooks, translateErr(err, ErrWebhookNotFound)
+}
+
+// GetByID method
+func (s *WebhookService) GetByID(ctx context.Context, webhookID string) (*domain.Webhook, error) {
+	webhook, err := s.repo.GetByID(ctx, webhookID)
+	return webhook, translateErr(err, ErrWebhookNotFound)
+}
+
+// Update method
+func (s *WebhookService) Update(ctx context.Context, webhookID string, update domain.UpdateWebhook) (*domain.Webhook, error) {
+	webhook, err := s.repo.Update(ctx, webhookID, update)
+	return webhook, translateErr(err, ErrWebhookNotFound)
+}
+
+// DeleteByID method, deliveries of the webhook are deleted with it
+func (s *WebhookService) DeleteByID(ctx context.Context, webhookID string) error {
+	err := s.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		// deliveries are not scoped by tenant, the webhook is checked first
+		if _, err := s.repo.GetByID(ctx, webhookID); err != nil {
+			return err
+		}
+		if err := s.repo.DeleteByID(ctx, webhookID); err != nil {
+			return err
+		}
+		return s.deliveryRepo.DeleteByWebhookID(ctx, webhookID)
+	})
+	return translateErr(err, ErrWebhookNotFound)
+}
+
+// ListDeliveries method, deliveries are ordered newest first
+func (s *WebhookService) ListDeliveries(ctx context.Context, webhookID string, limit int64, offset int64) ([]*domain.WebhookDelivery, error) {
+	if _, err := s.repo.GetByID(ctx, webhookID); err != nil {
+		return nil, translateErr(err, ErrWebhookNotFound)
+	}
+	deliveries, err := s.deliveryRepo.ListByWebhookID(ctx, webhookID, limit, offset)
+	return deliveries, translateErr(err, ErrWebhookNotFound)
+}
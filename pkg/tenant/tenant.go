@@ -0,0 +1,24 @@
+package tenant
+
+import "context"
+
+// ContextKey key of the tenant ID in gin.Context, gin only resolves string keys set with c.Set
+const ContextKey = "tenant_id"
+
+type contextKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant ID
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenantID)
+}
+
+// FromContext returns the tenant ID carried by ctx
+func FromContext(ctx context.Context) (string, bool) {
+	if tenantID, ok := ctx.Value(contextKey{}).(string); ok && tenantID != "" {
+		return tenantID, true
+	}
+	if tenantID, ok := ctx.Value(ContextKey).(string); ok && tenantID != "" {
+		return tenantID, true
+	}
+	return "", false
+}
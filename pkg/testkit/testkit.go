@@ -0,0 +1,171 @@
+// Package testkit runs the whole App in-process with in-memory repositories and an in-memory RabbitMQ broker,
+// so tests exercise the real middlewares and routes of app.NewApp without MongoDB and RabbitMQ.
+package testkit
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/app"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/repository/memory"
+	"github.com/zaharinea/go-example/pkg/rmq/rmqtest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// StartTime is the time of Kit.Clock after New and Reset
+var StartTime = time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+
+// Kit holds the App and the fakes it was built with
+type Kit struct {
+	Config *config.Config
+	App    *app.App
+	Repos  *repository.Repository
+	Broker *rmqtest.Broker
+	Clock  *clock.Fake
+	// IDs generates IDs of documents, RequestIDs generates IDs of requests without X-Request-ID
+	IDs        *idgen.Sequence
+	RequestIDs *idgen.Sequence
+
+	grpcOnce     sync.Once
+	grpcListener *bufconn.Listener
+}
+
+const grpcBufferSize = 1 << 20
+
+// New returns a new Kit, configure functions change the default config before the App is built
+func New(configure ...func(c *config.Config)) *Kit {
+	gin.SetMode(gin.ReleaseMode)
+
+	c := config.NewDefaultConfig()
+	c.LogLevel = "error"
+	c.OpenAPIValidation = config.OpenAPIValidationResponse
+	// requests without a tenant access all tenants, tests of tenant scoping set TenantRequired
+	c.TenantRequired = false
+	for _, fn := range configure {
+		fn(c)
+	}
+
+	k := &Kit{
+		Config:     c,
+		Broker:     rmqtest.NewBroker(),
+		Clock:      clock.NewFake(StartTime),
+		IDs:        idgen.NewSequence(),
+		RequestIDs: idgen.NewSequence(),
+	}
+	k.Repos = memory.NewRepository(k.Clock, k.IDs)
+	k.App = app.NewAppWithDependencies(c, app.Dependencies{
+		Logger:      app.InitLogger(c),
+		Repos:       k.Repos,
+		RmqConsumer: k.Broker,
+		Clock:       k.Clock,
+		RequestIDs:  k.RequestIDs,
+		HTTPClient:  http.DefaultClient,
+	})
+	k.Broker.Start()
+	return k
+}
+
+// Reset deletes all data and messages, restarts the clock and the IDs and makes the App ready,
+// it is called between tests
+func (k *Kit) Reset() error {
+	ctx := context.Background()
+	if err := k.Repos.User.DeleteAll(ctx); err != nil {
+		return err
+	}
+	if err := k.Repos.Account.DeleteAll(ctx); err != nil {
+		return err
+	}
+	if err := k.Repos.Inbox.DeleteAll(ctx); err != nil {
+		return err
+	}
+	if err := k.Repos.Webhook.DeleteAll(ctx); err != nil {
+		return err
+	}
+	if err := k.Repos.WebhookDelivery.DeleteAll(ctx); err != nil {
+		return err
+	}
+	k.Broker.Purge()
+	k.Clock.Set(StartTime)
+	k.IDs.Reset()
+	k.RequestIDs.Reset()
+	k.App.Handlers.SetReady(true)
+	k.App.GRPCServer.SetReady(true)
+	return nil
+}
+
+// Do performs the request on the public listener, header may be nil
+func (k *Kit) Do(method string, path string, body string, header http.Header) *httptest.ResponseRecorder {
+	return serve(k.App.Engine, method, path, body, header)
+}
+
+// DoAdmin performs the request on the admin listener, or on the public one if the admin listener is disabled
+func (k *Kit) DoAdmin(method string, path string, body string, header http.Header) *httptest.ResponseRecorder {
+	if k.App.AdminEngine == nil {
+		return k.Do(method, path, body, header)
+	}
+	return serve(k.App.AdminEngine, method, path, body, header)
+}
+
+// GRPCConn returns a connection to the gRPC server of the App served in-process, the caller closes it
+func (k *Kit) GRPCConn() (*grpc.ClientConn, error) {
+	k.grpcOnce.Do(func() {
+		k.grpcListener = bufconn.Listen(grpcBufferSize)
+		go func() { _ = k.App.GRPCServer.Serve(k.grpcListener) }()
+	})
+	return grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return k.grpcListener.Dial() }),
+		grpc.WithInsecure(),
+	)
+}
+
+// Deliver delivers the message body to the queue synchronously, returns true if the message is acked
+func (k *Kit) Deliver(queue string, body string) bool {
+	return k.Broker.Deliver(queue, amqp.Delivery{Body: []byte(body)})
+}
+
+func serve(handler http.Handler, method string, path string, body string, header http.Header) *httptest.ResponseRecorder {
+	var bodyReader io.Reader
+	if body != "" {
+		bodyReader = strings.NewReader(body)
+	}
+
+	req := httptest.NewRequest(method, path, bodyReader)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+// Suite is a testify suite running the App, data is reset before each test
+type Suite struct {
+	suite.Suite
+	Kit *Kit
+	// Configure functions change the config of the App built by SetupSuite
+	Configure []func(c *config.Config)
+}
+
+// SetupSuite builds the App
+func (s *Suite) SetupSuite() {
+	s.Kit = New(s.Configure...)
+}
+
+// SetupTest resets data left by the previous test
+func (s *Suite) SetupTest() {
+	s.Require().NoError(s.Kit.Reset())
+}
@@ -0,0 +1,245 @@
+package testkit_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/auth"
+	"github.com/zaharinea/go-example/pkg/handler"
+	"github.com/zaharinea/go-example/pkg/openapi"
+	"github.com/zaharinea/go-example/pkg/testkit"
+	"github.com/zaharinea/go-example/pkg/webhook"
+)
+
+const accountEvent = `{
+	"message_id":"message-1",
+	"external_id":"1",
+	"name":"account1",
+	"created_at":"2020-11-20T00:00:00.000Z",
+	"updated_at":"2020-11-21T00:00:00.000Z"
+}`
+
+type AppSuite struct {
+	testkit.Suite
+}
+
+func (s *AppSuite) TestUserOfAccountFromEvent() {
+	s.Require().True(s.Kit.Deliver("go-example-accounts", accountEvent))
+
+	w := s.Kit.Do("POST", "/api/users", `{"name": "user", "account_external_id": "1"}`, nil)
+	s.Require().Equal(http.StatusCreated, w.Code)
+	s.Require().NotEmpty(w.Header().Get("X-Request-ID"))
+
+	w = s.Kit.Do("GET", "/api/accounts/1/users", "", nil)
+	s.Require().Equal(http.StatusOK, w.Code)
+	var users handler.ResponseUsers
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &users))
+	s.Require().Len(users.Items, 1)
+	s.Require().Equal("user", users.Items[0].Name)
+}
+
+func (s *AppSuite) TestDuplicateEventIsSkipped() {
+	s.Require().True(s.Kit.Deliver("go-example-accounts", accountEvent))
+	s.Require().True(s.Kit.Deliver("go-example-accounts", accountEvent))
+
+	exists, err := s.Kit.Repos.Inbox.Exists(context.Background(), "go-example-accounts", "message-1")
+	s.Require().NoError(err)
+	s.Require().True(exists)
+}
+
+func (s *AppSuite) TestDeterministicIDsAndTimestamps() {
+	w := s.Kit.Do("POST", "/api/users", `{"name": "user"}`, nil)
+	s.Require().Equal(http.StatusCreated, w.Code)
+	s.Require().Equal("000000000000000000000001", w.Header().Get("X-Request-ID"))
+
+	s.Kit.Clock.Advance(time.Hour)
+	w = s.Kit.Do("PUT", "/api/users/000000000000000000000001", `{"name": "user2"}`, nil)
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().JSONEq(`{
+		"id":"000000000000000000000001",
+		"name":"user2",
+		"created_at":"2020-12-01T00:00:00Z",
+		"updated_at":"2020-12-01T01:00:00Z"
+	}`, w.Body.String())
+}
+
+func (s *AppSuite) TestResetDeletesData() {
+	w := s.Kit.Do("GET", "/api/users", "", nil)
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Equal(`{"items":[]}`, w.Body.String())
+}
+
+func (s *AppSuite) TestNotFoundProblem() {
+	w := s.Kit.Do("GET", "/api/users/5fbaeab741e97bef8525d6ab", "", http.Header{"X-Request-Id": {"request-1"}})
+	s.Require().Equal(http.StatusNotFound, w.Code)
+	s.Require().Equal("application/problem+json", w.Header().Get("Content-Type"))
+
+	var problem handler.ResponseProblem
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &problem))
+	s.Require().Equal("user_not_found", problem.Code)
+	s.Require().Equal("request-1", problem.RequestID)
+}
+
+func (s *AppSuite) TestOpenAPIDocument() {
+	w := s.Kit.Do("GET", "/openapi.json", "", nil)
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	var doc openapi.Document
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &doc))
+	s.Require().Equal(openapi.Version, doc.OpenAPI)
+	s.Require().NotNil(doc.Operation("DELETE", "/api/users/{id}"))
+}
+
+func (s *AppSuite) TestRequestValidation() {
+	w := s.Kit.Do("GET", "/api/users?offset=first", "", nil)
+	s.Require().Equal(http.StatusBadRequest, w.Code)
+	s.Require().Contains(w.Body.String(), `"errors":[{"field":"offset","code":"type","message":"offset must be integer"}]`)
+}
+
+func (s *AppSuite) TestPublishToFanoutExchange() {
+	s.Require().NoError(s.Kit.Broker.Publish("events.companies", "", amqp.Publishing{Body: []byte(`{"id":"1"}`)}))
+	s.Require().Empty(s.Kit.Broker.Messages("go-example-companies"))
+}
+
+func (s *AppSuite) TestRejectedEventIsRetried() {
+	s.Require().False(s.Kit.Deliver("go-example-accounts", `{"message_id":"message-2","external_id":1}`))
+	s.Require().Len(s.Kit.Broker.Messages("go-example-accounts-failed"), 1)
+}
+
+func (s *AppSuite) TestWebhookDeliveryOfAccountEvent() {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	w := s.Kit.Do("POST", "/api/webhooks", `{"url": "`+receiver.URL+`", "event_types": ["account.updated"], "secret": "0123456789abcdef"}`,
+		http.Header{"X-Tenant-Id": {"1"}})
+	s.Require().Equal(http.StatusCreated, w.Code)
+	s.Require().True(s.Kit.Deliver("go-example-accounts", accountEvent))
+
+	count, err := s.Kit.App.WebhookWorker.DeliverDue(context.Background())
+	s.Require().NoError(err)
+	s.Require().Equal(1, count)
+
+	r, body := <-received, <-bodies
+	s.Require().Equal("account.updated", r.Header.Get(webhook.HeaderEvent))
+	timestamp, err := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+	s.Require().NoError(err)
+	s.Require().Equal(testkit.StartTime.Unix(), timestamp)
+	s.Require().True(webhook.Verify("0123456789abcdef", timestamp, body, r.Header.Get(webhook.HeaderSignature)))
+	s.Require().Contains(string(body), `"external_id":"1"`)
+
+	w = s.Kit.Do("GET", "/api/webhooks/"+r.Header.Get(webhook.HeaderWebhookID)+"/deliveries", "", nil)
+	s.Require().Equal(http.StatusOK, w.Code)
+	s.Require().Contains(w.Body.String(), `"status":"succeeded"`)
+}
+
+func (s *AppSuite) TestWebhooksIsolatedByTenant() {
+	webhookIDs := map[string]string{}
+	for _, tenantID := range []string{"", "1", "2"} {
+		w := s.Kit.Do("POST", "/api/webhooks", `{"url": "https://example.com/`+tenantID+`", "event_types": ["account.updated", "user.created"], "secret": "0123456789abcdef"}`,
+			http.Header{"X-Tenant-Id": {tenantID}})
+		s.Require().Equal(http.StatusCreated, w.Code)
+		var response struct {
+			ID string `json:"id"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		webhookIDs[tenantID] = response.ID
+	}
+
+	s.Require().True(s.Kit.Deliver("go-example-accounts", accountEvent))
+	w := s.Kit.Do("POST", "/api/users", `{"name": "user1"}`, http.Header{"X-Tenant-Id": {"1"}})
+	s.Require().Equal(http.StatusCreated, w.Code)
+	w = s.Kit.Do("POST", "/api/users", `{"name": "user2"}`, nil)
+	s.Require().Equal(http.StatusCreated, w.Code)
+
+	expected := map[string][]string{"": {"user.created"}, "1": {"user.created", "account.updated"}, "2": nil}
+	for tenantID, eventTypes := range expected {
+		w := s.Kit.Do("GET", "/api/webhooks/"+webhookIDs[tenantID]+"/deliveries", "", nil)
+		s.Require().Equal(http.StatusOK, w.Code)
+		var response struct {
+			Items []struct {
+				EventType string `json:"event_type"`
+			} `json:"items"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		var got []string
+		for _, item := range response.Items {
+			got = append(got, item.EventType)
+		}
+		s.Require().Equal(eventTypes, got, "tenant %q", tenantID)
+	}
+}
+
+func TestAppSuite(t *testing.T) {
+	suite.Run(t, new(AppSuite))
+}
+
+func TestTenantRequired(t *testing.T) {
+	kit := testkit.New(func(c *config.Config) { c.TenantRequired = true })
+
+	w := kit.Do("GET", "/api/users", "", nil)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = kit.Do("GET", "/api/users", "", http.Header{"X-Tenant-Id": {"1"}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = kit.Do("GET", "/openapi.json", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTokenWithoutTenantClaim(t *testing.T) {
+	kit := testkit.New(func(c *config.Config) { c.JWTSecret = "secret" })
+	token, err := auth.NewToken(auth.Claims{"sub": "1"}, "secret")
+	require.NoError(t, err)
+
+	w := kit.Do("GET", "/api/users", "", http.Header{"Authorization": {"Bearer " + token}})
+	require.Equal(t, http.StatusUnauthorized, w.Code, "a token without the claim does not give access to all tenants")
+}
+
+func TestRateLimitRefillsWithClock(t *testing.T) {
+	kit := testkit.New(func(c *config.Config) { c.RateLimit = 1 })
+
+	w := kit.Do("GET", "/api/users", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = kit.Do("GET", "/api/users", "", nil)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	kit.Clock.Advance(time.Second)
+	w = kit.Do("GET", "/api/users", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAdminListener(t *testing.T) {
+	kit := testkit.New(func(c *config.Config) { c.AdminAddr = "127.0.0.1:0" })
+
+	w := kit.DoAdmin("GET", "/api/admin/migrations", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = kit.Do("GET", "/api/admin/migrations", "", nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMetricsCountRenderedProblems(t *testing.T) {
+	kit := testkit.New(func(c *config.Config) { c.TenantRequired = true })
+
+	w := kit.Do("GET", "/api/users", "", nil)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = kit.Do("GET", "/metrics", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `gin_requests_total{code="401",handler="github.com/zaharinea/go-example/pkg/handler.(*Handler).ListUsers-fm"`)
+}
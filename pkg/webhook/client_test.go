@@ -0,0 +1,44 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForbiddenIP(t *testing.T) {
+	for _, ip := range []string{
+		"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "172.31.255.255", "192.168.1.1", "100.64.0.1",
+		"169.254.169.254", "fe80::1", "fd00::1", "0.0.0.0", "::", "224.0.0.1", "::ffff:127.0.0.1",
+	} {
+		assert.True(t, forbiddenIP(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "172.32.0.1", "2001:4860:4860::8888"} {
+		assert.False(t, forbiddenIP(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestHTTPClientRejectsInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := NewHTTPClient(time.Second)
+	for _, url := range []string{server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)} {
+		_, err := client.Post(url, "application/json", nil)
+		require.Error(t, err, url)
+		assert.True(t, errors.Is(err, ErrForbiddenAddress), err.Error())
+	}
+}
+
+func TestHTTPClientDoesNotFollowRedirects(t *testing.T) {
+	client := NewHTTPClient(time.Second)
+	assert.Equal(t, time.Second, client.Timeout)
+	assert.Equal(t, http.ErrUseLastResponse, client.CheckRedirect(nil, nil))
+}
@@ -0,0 +1,77 @@
+// Package webhook delivers events to webhook subscriptions: Publisher stores a delivery for each subscribed webhook
+// in the transaction of the change, Worker posts the deliveries signed with the secret of the webhook
+// and retries failed attempts with exponential backoff
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/repository"
+)
+
+// Event struct
+type Event struct {
+	Type string
+	// AccountExternalID routes the event to webhooks of the tenant only, events of no tenant go to webhooks of no tenant
+	AccountExternalID string
+	// Data is marshalled to the data field of the payload
+	Data interface{}
+}
+
+// UserEvent returns the event of the user change
+func UserEvent(eventType string, user *domain.User) Event {
+	return Event{Type: eventType, AccountExternalID: user.AccountExternalID, Data: user}
+}
+
+// AccountEvent returns the event of the account change
+func AccountEvent(eventType string, account *domain.Account) Event {
+	return Event{Type: eventType, AccountExternalID: account.ExternalID, Data: account}
+}
+
+// Payload is the JSON body posted to webhooks
+type Payload struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// IPublisher interface
+type IPublisher interface {
+	// Publish stores a delivery of the event for each subscribed webhook, ctx should carry the transaction of the change
+	Publish(ctx context.Context, event Event) error
+}
+
+// Publisher struct
+type Publisher struct {
+	repos *repository.Repository
+}
+
+// NewPublisher returns a new Publisher struct
+func NewPublisher(repos *repository.Repository) *Publisher {
+	return &Publisher{repos: repos}
+}
+
+// Publish stores a delivery of the event for each subscribed webhook, ctx should carry the transaction of the change
+func (p *Publisher) Publish(ctx context.Context, event Event) error {
+	webhooks, err := p.repos.Webhook.ListSubscribed(ctx, event.Type, event.AccountExternalID)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(Payload{Type: event.Type, Data: data})
+	if err != nil {
+		return err
+	}
+	for _, webhook := range webhooks {
+		delivery := &domain.WebhookDelivery{WebhookID: webhook.ID, EventType: event.Type, Payload: string(payload)}
+		if err := p.repos.WebhookDelivery.Create(ctx, delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Headers of delivery requests
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderWebhookID = "X-Webhook-ID"
+	// HeaderDeliveryID is the same in every attempt of a delivery, receivers use it to skip duplicates
+	HeaderDeliveryID = "X-Webhook-Delivery"
+)
+
+const signaturePrefix = "sha256="
+
+// Sign returns the signature of the body sent at the unix timestamp:
+// "sha256=" followed by the hex encoded HMAC-SHA256 of "<timestamp>.<body>" keyed by the secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of the body sent at timestamp,
+// receivers should also reject timestamps too far from their clock to prevent replays
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,261 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/repository"
+)
+
+// Results of delivery attempts counted by webhook_deliveries_total
+const (
+	resultSucceeded = "succeeded"
+	resultRetried   = "retried"
+	resultFailed    = "failed"
+)
+
+// maxResponseBytes limits the part of the response body read to reuse the connection
+const maxResponseBytes = 64 << 10
+
+var deliveryCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "webhook_deliveries_total",
+		Help: "How many webhook delivery attempts made, partitioned by event type and result.",
+	},
+	[]string{"event_type", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(deliveryCounter)
+}
+
+var (
+	errWebhookDeleted  = errors.New("webhook deleted")
+	errWebhookDisabled = errors.New("webhook disabled")
+)
+
+// Worker struct, posts due deliveries with config.WebhookWorkers goroutines
+type Worker struct {
+	config *config.Config
+	repos  *repository.Repository
+	clock  clock.Clock
+	client *http.Client
+
+	// ctx is cancelled by Stop to abort running attempts
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewWorker returns a new Worker struct, attempts are limited by config.WebhookTimeout,
+// client is meant to be NewHTTPClient which keeps deliveries off the internal network
+func NewWorker(config *config.Config, repos *repository.Repository, clock clock.Clock, client *http.Client) *Worker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Worker{
+		config: config,
+		repos:  repos,
+		clock:  clock,
+		client: client,
+		ctx:    ctx,
+		cancel: cancel,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start starts polling for due deliveries, it does nothing if config.WebhookWorkers is 0
+func (w *Worker) Start() {
+	for i := int64(0); i < w.config.WebhookWorkers; i++ {
+		w.wg.Add(1)
+		go w.run()
+	}
+}
+
+func (w *Worker) run() {
+	defer w.wg.Done()
+	for {
+		if _, err := w.DeliverDue(w.ctx); err != nil && w.ctx.Err() == nil {
+			logrus.Errorf("Failed claim webhook delivery: error=%s", err)
+		}
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(w.config.WebhookPollInterval):
+		}
+	}
+}
+
+// Stop stops polling and waits for running attempts until ctx is done, then aborts them,
+// aborted deliveries are attempted again when their claim expires
+func (w *Worker) Stop(ctx context.Context) error {
+	w.stopOnce.Do(func() { close(w.stop) })
+	defer w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DeliverDue attempts due deliveries until none is due or the worker is stopped, it returns count of attempted deliveries
+func (w *Worker) DeliverDue(ctx context.Context) (int, error) {
+	// a claim outlives the attempt, so a delivery is not attempted twice at the same time
+	lease := 2 * w.config.WebhookTimeout
+	count := 0
+	for {
+		select {
+		case <-w.stop:
+			return count, nil
+		default:
+		}
+
+		delivery, err := w.repos.WebhookDelivery.ClaimDue(ctx, lease)
+		if errors.Is(err, domain.ErrNotFound) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		w.deliver(ctx, delivery)
+		count++
+	}
+}
+
+// deliver makes an attempt of the claimed delivery and stores its result
+func (w *Worker) deliver(ctx context.Context, delivery *domain.WebhookDelivery) {
+	webhook, err := w.repos.Webhook.GetByID(ctx, delivery.WebhookID)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		w.finish(ctx, delivery, errWebhookDeleted)
+		return
+	case err != nil:
+		logrus.Errorf("Failed get webhook: webhook_id=%s, delivery_id=%s, error=%s", delivery.WebhookID, delivery.ID, err)
+		return
+	case !webhook.Enabled:
+		w.finish(ctx, delivery, errWebhookDisabled)
+		return
+	}
+
+	now := w.clock.Now()
+	status, err := w.post(ctx, webhook, delivery, now)
+	if err != nil && ctx.Err() != nil {
+		// the worker is stopped, the attempt is not the fault of the receiver
+		return
+	}
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = status
+
+	result := resultSucceeded
+	if err == nil {
+		delivery.Status = domain.DeliverySucceeded
+		delivery.Error = ""
+		if err := w.repos.Webhook.RecordSuccess(ctx, webhook.ID); err != nil {
+			logrus.Errorf("Failed record webhook success: webhook_id=%s, error=%s", webhook.ID, err)
+		}
+	} else {
+		delivery.Error = err.Error()
+		result = w.fail(ctx, webhook, delivery, now)
+	}
+
+	deliveryCounter.WithLabelValues(delivery.EventType, result).Inc()
+	if err := w.repos.WebhookDelivery.Update(ctx, delivery); err != nil {
+		logrus.Errorf("Failed update webhook delivery: delivery_id=%s, error=%s", delivery.ID, err)
+	}
+}
+
+// fail counts the failed attempt and schedules the next one, the delivery fails after config.WebhookMaxAttempts
+// attempts or once the webhook is disabled
+func (w *Worker) fail(ctx context.Context, webhook *domain.Webhook, delivery *domain.WebhookDelivery, now time.Time) string {
+	updated, err := w.repos.Webhook.RecordFailure(ctx, webhook.ID, w.config.WebhookDisableAfter)
+	if err != nil {
+		logrus.Errorf("Failed record webhook failure: webhook_id=%s, error=%s", webhook.ID, err)
+		updated = webhook
+	}
+	if !updated.Enabled && webhook.Enabled {
+		logrus.Warnf("Webhook disabled after failed deliveries: webhook_id=%s, failures=%d", webhook.ID, updated.Failures)
+	}
+
+	if delivery.Attempts >= w.config.WebhookMaxAttempts || !updated.Enabled {
+		delivery.Status = domain.DeliveryFailed
+		return resultFailed
+	}
+	delivery.Status = domain.DeliveryPending
+	delivery.NextAttemptAt = now.Add(backoff(w.config.WebhookRetryBase, w.config.WebhookRetryMax, delivery.Attempts))
+	return resultRetried
+}
+
+// finish fails the delivery without an attempt
+func (w *Worker) finish(ctx context.Context, delivery *domain.WebhookDelivery, reason error) {
+	delivery.Status = domain.DeliveryFailed
+	delivery.Error = reason.Error()
+	deliveryCounter.WithLabelValues(delivery.EventType, resultFailed).Inc()
+	if err := w.repos.WebhookDelivery.Update(ctx, delivery); err != nil {
+		logrus.Errorf("Failed update webhook delivery: delivery_id=%s, error=%s", delivery.ID, err)
+	}
+}
+
+// post sends the signed payload and returns the response status, a status other than 2xx is an error
+func (w *Worker) post(ctx context.Context, webhook *domain.Webhook, delivery *domain.WebhookDelivery, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.config.WebhookTimeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderWebhookID, webhook.ID)
+	req.Header.Set(HeaderDeliveryID, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the attempt following attempts failed ones: base doubled for each failed
+// attempt after the first, at most max
+func backoff(base time.Duration, max time.Duration, attempts int64) time.Duration {
+	delay := base
+	for i := int64(1); i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
@@ -0,0 +1,293 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/zaharinea/go-example/config"
+	"github.com/zaharinea/go-example/pkg/clock"
+	"github.com/zaharinea/go-example/pkg/domain"
+	"github.com/zaharinea/go-example/pkg/idgen"
+	"github.com/zaharinea/go-example/pkg/repository"
+	"github.com/zaharinea/go-example/pkg/repository/memory"
+	"github.com/zaharinea/go-example/pkg/tenant"
+)
+
+var now = time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+type WorkerSuite struct {
+	suite.Suite
+	ctx       context.Context
+	config    *config.Config
+	clock     *clock.Fake
+	repos     *repository.Repository
+	publisher *Publisher
+	worker    *Worker
+	server    *httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	received []received
+}
+
+func (s *WorkerSuite) SetupTest() {
+	s.ctx = context.Background()
+	s.config = &config.Config{
+		WebhookTimeout:      time.Second,
+		WebhookMaxAttempts:  3,
+		WebhookRetryBase:    10 * time.Second,
+		WebhookRetryMax:     time.Hour,
+		WebhookDisableAfter: 5,
+	}
+	s.clock = clock.NewFake(now)
+	s.repos = memory.NewRepository(s.clock, idgen.NewSequence())
+	s.publisher = NewPublisher(s.repos)
+	s.worker = NewWorker(s.config, s.repos, s.clock, http.DefaultClient)
+	s.status = http.StatusOK
+	s.received = nil
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.received = append(s.received, received{header: r.Header, body: body})
+		w.WriteHeader(s.status)
+	}))
+}
+
+func (s *WorkerSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *WorkerSuite) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *WorkerSuite) requests() []received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]received(nil), s.received...)
+}
+
+func (s *WorkerSuite) createWebhook(ctx context.Context, eventTypes ...string) *domain.Webhook {
+	webhook := &domain.Webhook{URL: s.server.URL, EventTypes: eventTypes, Secret: "0123456789abcdef"}
+	s.Require().NoError(s.repos.Webhook.Create(ctx, webhook))
+	return webhook
+}
+
+func (s *WorkerSuite) deliverDue(expected int) {
+	count, err := s.worker.DeliverDue(s.ctx)
+	s.Require().NoError(err)
+	s.Require().Equal(expected, count)
+}
+
+func (s *WorkerSuite) deliveries(webhookID string) []*domain.WebhookDelivery {
+	deliveries, err := s.repos.WebhookDelivery.ListByWebhookID(s.ctx, webhookID, 0, 0)
+	s.Require().NoError(err)
+	return deliveries
+}
+
+func (s *WorkerSuite) TestDeliverSigned() {
+	webhook := s.createWebhook(s.ctx, domain.EventUserCreated)
+	user := &domain.User{ID: "1", Name: "user1", CreatedAt: now, UpdatedAt: now}
+	s.Require().NoError(s.publisher.Publish(s.ctx, UserEvent(domain.EventUserCreated, user)))
+
+	s.deliverDue(1)
+
+	requests := s.requests()
+	s.Require().Len(requests, 1)
+	header := requests[0].header
+	s.Require().Equal("application/json", header.Get("Content-Type"))
+	s.Require().Equal(domain.EventUserCreated, header.Get(HeaderEvent))
+	s.Require().Equal(webhook.ID, header.Get(HeaderWebhookID))
+	s.Require().Equal(strconv.FormatInt(now.Unix(), 10), header.Get(HeaderTimestamp))
+	s.Require().True(Verify(webhook.Secret, now.Unix(), requests[0].body, header.Get(HeaderSignature)))
+
+	var payload struct {
+		Type string      `json:"type"`
+		Data domain.User `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(requests[0].body, &payload))
+	s.Require().Equal(domain.EventUserCreated, payload.Type)
+	s.Require().Equal(*user, payload.Data)
+
+	deliveries := s.deliveries(webhook.ID)
+	s.Require().Len(deliveries, 1)
+	s.Require().Equal(header.Get(HeaderDeliveryID), deliveries[0].ID)
+	s.Require().Equal(domain.DeliverySucceeded, deliveries[0].Status)
+	s.Require().Equal(int64(1), deliveries[0].Attempts)
+	s.Require().Equal(http.StatusOK, deliveries[0].ResponseStatus)
+
+	s.deliverDue(0)
+}
+
+func (s *WorkerSuite) TestPublishRoutesByTenant() {
+	global := s.createWebhook(s.ctx, domain.EventAccountUpdated, domain.EventUserCreated)
+	tenantA := s.createWebhook(tenant.WithTenant(s.ctx, "A"), domain.EventAccountUpdated)
+	tenantB := s.createWebhook(tenant.WithTenant(s.ctx, "B"), domain.EventAccountUpdated)
+	other := s.createWebhook(s.ctx, domain.EventAccountDeleted)
+
+	account := &domain.Account{ExternalID: "A", Name: "account1"}
+	s.Require().NoError(s.publisher.Publish(s.ctx, AccountEvent(domain.EventAccountUpdated, account)))
+
+	s.Require().Empty(s.deliveries(global.ID), "webhooks of no tenant do not get events of tenants")
+	s.Require().Len(s.deliveries(tenantA.ID), 1)
+	s.Require().Empty(s.deliveries(tenantB.ID))
+	s.Require().Empty(s.deliveries(other.ID))
+
+	user := &domain.User{ID: "000000000000000000000001", Name: "user1"}
+	s.Require().NoError(s.publisher.Publish(s.ctx, UserEvent(domain.EventUserCreated, user)))
+	s.Require().Len(s.deliveries(global.ID), 1, "events of no tenant go to webhooks of no tenant")
+	s.Require().Len(s.deliveries(tenantA.ID), 1)
+}
+
+func (s *WorkerSuite) TestRetryWithBackoff() {
+	webhook := s.createWebhook(s.ctx, domain.EventUserCreated)
+	s.Require().NoError(s.publisher.Publish(s.ctx, UserEvent(domain.EventUserCreated, &domain.User{ID: "1"})))
+	s.setStatus(http.StatusInternalServerError)
+
+	s.deliverDue(1)
+	delivery := s.deliveries(webhook.ID)[0]
+	s.Require().Equal(domain.DeliveryPending, delivery.Status)
+	s.Require().Equal(int64(1), delivery.Attempts)
+	s.Require().Equal(http.StatusInternalServerError, delivery.ResponseStatus)
+	s.Require().Equal("unexpected status 500", delivery.Error)
+	s.Require().Equal(now.Add(10*time.Second), delivery.NextAttemptAt)
+
+	s.clock.Advance(9 * time.Second)
+	s.deliverDue(0)
+	s.clock.Advance(time.Second)
+	s.deliverDue(1)
+	delivery = s.deliveries(webhook.ID)[0]
+	s.Require().Equal(int64(2), delivery.Attempts)
+	s.Require().Equal(now.Add(30*time.Second), delivery.NextAttemptAt)
+
+	s.clock.Advance(20 * time.Second)
+	s.deliverDue(1)
+	delivery = s.deliveries(webhook.ID)[0]
+	s.Require().Equal(domain.DeliveryFailed, delivery.Status, "fails after WebhookMaxAttempts")
+	s.Require().Equal(int64(3), delivery.Attempts)
+
+	requests := s.requests()
+	s.Require().Len(requests, 3)
+	s.Require().Equal(requests[0].header.Get(HeaderDeliveryID), requests[2].header.Get(HeaderDeliveryID))
+
+	got, err := s.repos.Webhook.GetByID(s.ctx, webhook.ID)
+	s.Require().NoError(err)
+	s.Require().Equal(int64(3), got.Failures)
+	s.Require().True(got.Enabled)
+}
+
+func (s *WorkerSuite) TestSuccessResetsFailures() {
+	webhook := s.createWebhook(s.ctx, domain.EventUserCreated)
+	s.Require().NoError(s.publisher.Publish(s.ctx, UserEvent(domain.EventUserCreated, &domain.User{ID: "1"})))
+	s.setStatus(http.StatusBadGateway)
+	s.deliverDue(1)
+
+	s.setStatus(http.StatusNoContent)
+	s.clock.Advance(time.Minute)
+	s.deliverDue(1)
+
+	delivery := s.deliveries(webhook.ID)[0]
+	s.Require().Equal(domain.DeliverySucceeded, delivery.Status)
+	s.Require().Empty(delivery.Error)
+	got, err := s.repos.Webhook.GetByID(s.ctx, webhook.ID)
+	s.Require().NoError(err)
+	s.Require().Equal(int64(0), got.Failures)
+}
+
+func (s *WorkerSuite) TestDisableAfterFailures() {
+	s.config.WebhookDisableAfter = 2
+	webhook := s.createWebhook(s.ctx, domain.EventUserCreated)
+	for i := 0; i < 3; i++ {
+		s.Require().NoError(s.publisher.Publish(s.ctx, UserEvent(domain.EventUserCreated, &domain.User{ID: "1"})))
+	}
+	s.setStatus(http.StatusInternalServerError)
+
+	s.deliverDue(3)
+	s.clock.Advance(time.Minute)
+	s.deliverDue(1)
+
+	s.Require().Len(s.requests(), 2, "deliveries of the disabled webhook are not attempted")
+	got, err := s.repos.Webhook.GetByID(s.ctx, webhook.ID)
+	s.Require().NoError(err)
+	s.Require().False(got.Enabled)
+	s.Require().NotNil(got.DisabledAt)
+
+	deliveries := s.deliveries(webhook.ID)
+	s.Require().Len(deliveries, 3)
+	for _, delivery := range deliveries {
+		s.Require().Equal(domain.DeliveryFailed, delivery.Status)
+	}
+	s.Require().Equal(errWebhookDisabled.Error(), deliveries[0].Error)
+
+	// the disabled webhook gets no new deliveries
+	s.Require().NoError(s.publisher.Publish(s.ctx, UserEvent(domain.EventUserCreated, &domain.User{ID: "1"})))
+	s.Require().Len(s.deliveries(webhook.ID), 3)
+}
+
+func (s *WorkerSuite) TestDeletedWebhook() {
+	webhook := s.createWebhook(s.ctx, domain.EventUserCreated)
+	s.Require().NoError(s.publisher.Publish(s.ctx, UserEvent(domain.EventUserCreated, &domain.User{ID: "1"})))
+	s.Require().NoError(s.repos.Webhook.DeleteByID(s.ctx, webhook.ID))
+
+	s.deliverDue(1)
+
+	s.Require().Empty(s.requests())
+	delivery := s.deliveries(webhook.ID)[0]
+	s.Require().Equal(domain.DeliveryFailed, delivery.Status)
+	s.Require().Equal(errWebhookDeleted.Error(), delivery.Error)
+}
+
+func (s *WorkerSuite) TestStartStop() {
+	s.config.WebhookWorkers = 2
+	s.config.WebhookPollInterval = 10 * time.Millisecond
+	webhook := s.createWebhook(s.ctx, domain.EventUserCreated)
+	s.Require().NoError(s.publisher.Publish(s.ctx, UserEvent(domain.EventUserCreated, &domain.User{ID: "1"})))
+
+	s.worker.Start()
+	s.Require().Eventually(func() bool { return len(s.requests()) == 1 }, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(s.ctx, time.Second)
+	defer cancel()
+	s.Require().NoError(s.worker.Stop(ctx))
+	s.Require().Equal(domain.DeliverySucceeded, s.deliveries(webhook.ID)[0].Status)
+}
+
+func TestWorkerSuite(t *testing.T) {
+	suite.Run(t, new(WorkerSuite))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, backoff(10*time.Second, time.Minute, 1))
+	assert.Equal(t, 20*time.Second, backoff(10*time.Second, time.Minute, 2))
+	assert.Equal(t, 40*time.Second, backoff(10*time.Second, time.Minute, 3))
+	assert.Equal(t, time.Minute, backoff(10*time.Second, time.Minute, 4))
+	assert.Equal(t, time.Minute, backoff(10*time.Second, time.Minute, 100))
+}
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"type":"user.created"}`)
+	signature := Sign("secret", 1606780800, body)
+
+	assert.Equal(t, "sha256=", signature[:7])
+	assert.True(t, Verify("secret", 1606780800, body, signature))
+	assert.False(t, Verify("other", 1606780800, body, signature))
+	assert.False(t, Verify("secret", 1606780801, body, signature))
+	assert.False(t, Verify("secret", 1606780800, []byte(`{}`), signature))
+}